@@ -0,0 +1,179 @@
+package cmd
+
+// analyze.go implements the `analyze` command: fetch a source and report how
+// many IDs it holds, without choosing or running a sharding strategy.
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// analyzePercentages are the per-shard percentages analyze suggests shard
+// counts for.
+var analyzePercentages = []int{50, 25, 20, 10, 5, 1}
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Report source ID counts and suggested shard counts",
+	Long: `Connects to Jamf Pro, fetches IDs from the specified source, applies any
+exclusions, and prints how many IDs were fetched, excluded, and remain. No
+strategy is required; the report suggests shard counts for common per-shard
+percentages to help choose one.
+
+Examples:
+  go-jamf-guid-sharder analyze --config ./config.yaml \
+    --source-type computer_inventory
+
+  go-jamf-guid-sharder analyze --config ./config.yaml \
+    --source-type computer_group_membership --group-id 42 \
+    --exclude-from-result wave1.json`,
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd) },
+	RunE:   runAnalyze,
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+
+	addConnectionFlags(analyzeCmd)
+	addSourceFlags(analyzeCmd)
+	analyzeCmd.Flags().StringSlice("exclude-ids", []string{}, "IDs to exclude from the remaining count (comma-separated)")
+	analyzeCmd.Flags().String("exclude-from-result", "", "Path to a previous result file; every ID in any of its shards is excluded")
+	analyzeCmd.Flags().String("exclude-id-pattern", "", "Regular expression; every fetched ID it matches is excluded")
+}
+
+// analyzeReport is the summary printed by the analyze command.
+type analyzeReport struct {
+	SourceType        string
+	GroupID           string
+	TotalIDsFetched   int
+	DuplicatesRemoved int
+	LocationFilter    *LocationFilterSummary
+	ExcludedIDCount   int
+	RemainingIDs      int
+}
+
+// shardCountSuggestion is one row of the suggested shard count table.
+type shardCountSuggestion struct {
+	Percent     int
+	ShardCount  int
+	IDsPerShard int
+}
+
+func runAnalyze(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadShardConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	fetched, remaining, err := fetchRemainingIDs(cfg)
+	if err != nil {
+		return err
+	}
+
+	report := &analyzeReport{
+		SourceType:        cfg.SourceType,
+		GroupID:           cfg.GroupID,
+		TotalIDsFetched:   len(fetched.IDs),
+		DuplicatesRemoved: fetched.DuplicatesRemoved,
+		LocationFilter:    fetched.LocationFilter,
+		ExcludedIDCount:   len(fetched.IDs) - len(remaining),
+		RemainingIDs:      len(remaining),
+	}
+	return writeAnalyzeReport(cmd.OutOrStdout(), report)
+}
+
+// fetchRemainingIDs validates cfg for a fetch-only command, fetches the
+// source, and applies exclusions exactly as shard does. It returns the fetch
+// result and the IDs that remain after exclusions.
+func fetchRemainingIDs(cfg *shardConfig) (*sourceFetchResult, []string, error) {
+	logResolvedConfig(cfg)
+
+	if err := validateFetchConfig(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := newRunContext(cfg)
+	defer cancel()
+
+	start := time.Now()
+	phase := "building the Jamf Pro client"
+	fetched, err := loadSourceIDs(ctx, cfg, func(name string) error {
+		phase = name
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, nil, runTimeoutError(ctx, cfg, phase, err)
+	}
+	logPhase(fmt.Sprintf("Fetching %d ID(s) from %s", len(fetched.IDs), cfg.SourceType), start)
+
+	excludeIDs, err := resolveExcludeIDs(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	excludePattern, err := compileExcludePattern(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining, patternMatched := applyExclusions(fetched.IDs, excludeIDs, excludePattern)
+	if excludePattern != nil {
+		infof("exclude_id_pattern matched %d ID(s)", patternMatched)
+	}
+	return fetched, remaining, nil
+}
+
+// suggestShardCounts returns, for each of analyzePercentages, the shard count
+// that gives every shard that share of the remaining IDs. Percentages that
+// would leave a shard empty are skipped.
+func suggestShardCounts(remaining int) []shardCountSuggestion {
+	var suggestions []shardCountSuggestion
+	for _, pct := range analyzePercentages {
+		shardCount := (100 + pct - 1) / pct
+		if shardCount > remaining {
+			continue
+		}
+		suggestions = append(suggestions, shardCountSuggestion{
+			Percent:     pct,
+			ShardCount:  shardCount,
+			IDsPerShard: (remaining + shardCount - 1) / shardCount,
+		})
+	}
+	return suggestions
+}
+
+// writeAnalyzeReport prints report as an aligned, human-readable summary.
+func writeAnalyzeReport(w io.Writer, report *analyzeReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	source := report.SourceType
+	if report.GroupID != "" {
+		source = fmt.Sprintf("%s (group %s)", source, report.GroupID)
+	}
+	fmt.Fprintf(tw, "Source:\t%s\n", source)
+	fmt.Fprintf(tw, "IDs fetched:\t%d\n", report.TotalIDsFetched)
+	fmt.Fprintf(tw, "Duplicates removed:\t%d\n", report.DuplicatesRemoved)
+	if report.LocationFilter != nil {
+		fmt.Fprintf(tw, "Removed by location filter:\t%d\n", report.LocationFilter.IDsRemoved)
+	}
+	fmt.Fprintf(tw, "Excluded:\t%d\n", report.ExcludedIDCount)
+	fmt.Fprintf(tw, "Remaining:\t%d\n", report.RemainingIDs)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	suggestions := suggestShardCounts(report.RemainingIDs)
+	if len(suggestions) == 0 {
+		_, err := fmt.Fprintln(w, "\nToo few IDs remain to suggest a shard count.")
+		return err
+	}
+
+	fmt.Fprintln(w, "\nSuggested shard counts (round-robin, rendezvous, or balanced):")
+	fmt.Fprintln(tw, "  % per shard\tshard_count\tIDs per shard")
+	for _, s := range suggestions {
+		fmt.Fprintf(tw, "  %d%%\t%d\t~%d\n", s.Percent, s.ShardCount, s.IDsPerShard)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,116 @@
+package cmd
+
+// analyze_test.go contains unit tests for the `analyze` command helpers in
+// analyze.go.
+//
+//   TestSuggestShardCounts_*   — shard counts per percentage, empty-shard skipping
+//   TestWriteAnalyzeReport_*   — text layout of the summary and suggestions
+//   TestRunAnalyze_*           — end-to-end against the integration mock server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestShardCounts_AllPercentages(t *testing.T) {
+	suggestions := suggestShardCounts(1000)
+
+	expected := []shardCountSuggestion{
+		{Percent: 50, ShardCount: 2, IDsPerShard: 500},
+		{Percent: 25, ShardCount: 4, IDsPerShard: 250},
+		{Percent: 20, ShardCount: 5, IDsPerShard: 200},
+		{Percent: 10, ShardCount: 10, IDsPerShard: 100},
+		{Percent: 5, ShardCount: 20, IDsPerShard: 50},
+		{Percent: 1, ShardCount: 100, IDsPerShard: 10},
+	}
+	assert.Equal(t, expected, suggestions)
+}
+
+func TestSuggestShardCounts_RoundsIDsPerShardUp(t *testing.T) {
+	suggestions := suggestShardCounts(7)
+
+	require.Len(t, suggestions, 3, "Shard counts above 7 would leave empty shards")
+	assert.Equal(t, shardCountSuggestion{Percent: 50, ShardCount: 2, IDsPerShard: 4}, suggestions[0])
+	assert.Equal(t, shardCountSuggestion{Percent: 20, ShardCount: 5, IDsPerShard: 2}, suggestions[2])
+}
+
+func TestSuggestShardCounts_TooFewIDs(t *testing.T) {
+	assert.Empty(t, suggestShardCounts(1))
+	assert.Empty(t, suggestShardCounts(0))
+}
+
+func TestWriteAnalyzeReport_Layout(t *testing.T) {
+	var buf bytes.Buffer
+	report := &analyzeReport{
+		SourceType:        "computer_group_membership",
+		GroupID:           "42",
+		TotalIDsFetched:   120,
+		DuplicatesRemoved: 2,
+		LocationFilter:    &LocationFilterSummary{Department: "Sales", IDsRemoved: 30},
+		ExcludedIDCount:   20,
+		RemainingIDs:      100,
+	}
+
+	require.NoError(t, writeAnalyzeReport(&buf, report))
+
+	out := buf.String()
+	assert.Contains(t, out, "Source:                      computer_group_membership (group 42)")
+	assert.Contains(t, out, "Removed by location filter:  30")
+	assert.Contains(t, out, "Remaining:                   100")
+	assert.Contains(t, out, "Suggested shard counts")
+	assert.Contains(t, out, "10%          10           ~10")
+}
+
+func TestWriteAnalyzeReport_NoSuggestions(t *testing.T) {
+	var buf bytes.Buffer
+
+	require.NoError(t, writeAnalyzeReport(&buf, &analyzeReport{SourceType: "user_accounts", RemainingIDs: 1}))
+
+	assert.Contains(t, buf.String(), "Too few IDs remain")
+	assert.NotContains(t, buf.String(), "Removed by location filter")
+}
+
+func TestRunAnalyze_CountsAndExclusions(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("exclude_ids", []string{"1", "2", "999"})
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&buf)
+
+	require.NoError(t, runAnalyze(cmd, []string{}))
+
+	out := buf.String()
+	assert.Contains(t, out, "IDs fetched:         50")
+	assert.Contains(t, out, "Excluded:            2")
+	assert.Contains(t, out, "Remaining:           48")
+	assert.Contains(t, out, "25%          4            ~12")
+}
+
+func TestRunAnalyze_DoesNotRequireStrategy(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("instance_domain", "https://example.jamfcloud.com")
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "id")
+	viper.Set("client_secret", "secret")
+
+	err := runAnalyze(&cobra.Command{}, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source_type is required")
+	assert.NotContains(t, err.Error(), "strategy")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+// audit.go implements audit_file: one JSON line per shard result, recording
+// the inputs and the result hash of each run as a compliance ledger. Unlike
+// run_log, a failed audit write fails the run.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// auditRecord is one line of the audit file. Config is the resolved
+// configuration with secrets always redacted, whatever hide_sensitive_data
+// is set to.
+type auditRecord struct {
+	Time       time.Time      `json:"time"`
+	Version    string         `json:"version"`
+	Config     map[string]any `json:"config"`
+	Source     auditSource    `json:"source"`
+	ShardCount int            `json:"shard_count"`
+	ResultHash string         `json:"result_hash"`
+}
+
+// auditSource records the counts of the source pool behind a result.
+type auditSource struct {
+	TotalIDsFetched   int `json:"total_ids_fetched"`
+	DuplicatesRemoved int `json:"duplicates_removed"`
+	ExcludedIDCount   int `json:"excluded_id_count"`
+	ReservedIDCount   int `json:"reserved_id_count"`
+}
+
+// newAuditRecord builds the audit record for result, produced with cfg.
+func newAuditRecord(cfg *shardConfig, result *ShardResult, now time.Time) auditRecord {
+	config := make(map[string]any)
+	for _, field := range configFields(cfg, true) {
+		// Durations would otherwise encode as nanoseconds.
+		if d, ok := field.value.(time.Duration); ok {
+			field.value = d.String()
+		}
+		config[field.key] = field.value
+	}
+	meta := result.Metadata
+	return auditRecord{
+		Time:    now.UTC(),
+		Version: Version,
+		Config:  config,
+		Source: auditSource{
+			TotalIDsFetched:   meta.TotalIDsFetched,
+			DuplicatesRemoved: meta.DuplicatesRemoved,
+			ExcludedIDCount:   meta.ExcludedIDCount,
+			ReservedIDCount:   meta.ReservedIDCount,
+		},
+		ShardCount: meta.ShardCount,
+		ResultHash: meta.ResultHash,
+	}
+}
+
+// appendAuditRecord appends the audit record for result to cfg.AuditFile,
+// creating the file if needed. It is never truncated, so the file is a
+// running ledger of every run. Does nothing when audit_file is not set.
+func appendAuditRecord(cfg *shardConfig, result *ShardResult) error {
+	if cfg.AuditFile == "" {
+		return nil
+	}
+	line, err := json.Marshal(newAuditRecord(cfg, result, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to encode audit_file record: %w", err)
+	}
+	f, err := os.OpenFile(cfg.AuditFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit_file %s: %w", cfg.AuditFile, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit_file %s: %w", cfg.AuditFile, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close audit_file %s: %w", cfg.AuditFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package cmd
+
+// audit_test.go contains tests for the audit_file ledger in audit.go.
+//
+//   TestNewAuditRecord_*    — record contents and secret redaction
+//   TestAppendAuditRecord_* — appending and failures
+//   TestRunShard_AuditFile  — one line per run, end to end
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAuditFile decodes every line of the audit file at path.
+func readAuditFile(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var record auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestNewAuditRecord_RedactsSecrets(t *testing.T) {
+	cfg := &shardConfig{
+		ClientID:       "client",
+		ClientSecret:   "super-secret",
+		Password:       "hunter2",
+		Strategy:       "round-robin",
+		ShardCount:     2,
+		SourceTimeout:  90 * time.Second,
+		AuditFile:      "audit.jsonl",
+		InstanceDomain: "https://example.jamfcloud.com",
+	}
+	result := &ShardResult{Metadata: ShardMetadata{
+		TotalIDsFetched:   10,
+		DuplicatesRemoved: 1,
+		ExcludedIDCount:   2,
+		ReservedIDCount:   3,
+		ShardCount:        2,
+		ResultHash:        "abc123",
+	}}
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	record := newAuditRecord(cfg, result, now)
+
+	assert.Equal(t, now.UTC(), record.Time)
+	assert.Equal(t, Version, record.Version)
+	assert.Equal(t, "********", record.Config["client_secret"], "Secrets are redacted without hide_sensitive_data")
+	assert.Equal(t, "********", record.Config["basic_auth_password"])
+	assert.Equal(t, "client", record.Config["client_id"])
+	assert.Equal(t, "1m30s", record.Config["source_timeout"])
+	assert.Equal(t, auditSource{TotalIDsFetched: 10, DuplicatesRemoved: 1, ExcludedIDCount: 2, ReservedIDCount: 3}, record.Source)
+	assert.Equal(t, 2, record.ShardCount)
+	assert.Equal(t, "abc123", record.ResultHash)
+
+	line, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.NotContains(t, string(line), "super-secret")
+	assert.NotContains(t, string(line), "hunter2")
+}
+
+func TestAppendAuditRecord_Unset(t *testing.T) {
+	assert.NoError(t, appendAuditRecord(&shardConfig{}, &ShardResult{}))
+}
+
+func TestAppendAuditRecord_Unwritable(t *testing.T) {
+	cfg := &shardConfig{AuditFile: filepath.Join(t.TempDir(), "missing", "audit.jsonl")}
+
+	err := appendAuditRecord(cfg, &ShardResult{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open audit_file")
+}
+
+func TestRunShard_AuditFile(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+	auditFile := filepath.Join(tmpDir, "audit.jsonl")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("exclude_ids", []string{"1", "2"})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+	viper.Set("audit_file", auditFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+
+	records := readAuditFile(t, auditFile)
+	require.Len(t, records, 2, "Each run appends a line")
+	for _, record := range records {
+		assert.Equal(t, result.Metadata.ResultHash, record.ResultHash)
+		assert.Equal(t, 50, record.Source.TotalIDsFetched)
+		assert.Equal(t, 2, record.Source.ExcludedIDCount)
+		assert.Equal(t, 3, record.ShardCount)
+		assert.Equal(t, "********", record.Config["client_secret"])
+		assert.Equal(t, "round-robin", record.Config["strategy"])
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+// cache.go implements cache_ids: keep the fetched source IDs in a local file
+// so repeated runs against the same fleet, e.g. while tuning a strategy, can
+// skip the Jamf Pro API until the cache is older than cache_ttl.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// sourceCache is the cache_ids file: everything fetchSourceIDs returned,
+// when it was fetched, and the source settings it was fetched with.
+type sourceCache struct {
+	FetchedAt         time.Time              `json:"fetched_at"`
+	Source            string                 `json:"source"`
+	IDs               []string               `json:"ids"`
+	DuplicatesRemoved int                    `json:"duplicates_removed"`
+	LocationFilter    *LocationFilterSummary `json:"location_filter,omitempty"`
+	Unmanaged         map[string]bool        `json:"unmanaged,omitempty"`
+	Names             map[string]string      `json:"names,omitempty"`
+	Warnings          []string               `json:"warnings,omitempty"`
+	SourceBreakdown   map[string]int         `json:"source_breakdown,omitempty"`
+}
+
+// loadSourceIDs returns the source IDs from the cache_ids file when it is
+// fresh. Otherwise it builds a Jamf Pro client, fetches the IDs, and rewrites
+// the cache. enterPhase is called before the fetch, as in runShard. The
+// fetch alone is limited to source_timeout, when set. With fixture set, the
+// IDs are served from the fixture file instead.
+func loadSourceIDs(ctx context.Context, cfg *shardConfig, enterPhase func(string) error) (*sourceFetchResult, error) {
+	// A fixture stands in for Jamf Pro: there is no client to build or
+	// authenticate, and nothing worth caching.
+	if cfg.Fixture != "" {
+		if err := enterPhase("fetching source IDs"); err != nil {
+			return nil, err
+		}
+		return fetchSourceIDs(ctx, nil, cfg)
+	}
+	if cached := readSourceCache(cfg, time.Now()); cached != nil {
+		return cached, nil
+	}
+
+	ctx, rateLimits := withRateLimitTracker(ctx)
+	client, err := buildJamfClient(cfg)
+	if err != nil {
+		if tokenRejectedRe.MatchString(err.Error()) {
+			return nil, authFailedError(cfg, err)
+		}
+		return nil, fmt.Errorf("failed to build Jamf Pro client: %w", err)
+	}
+	if cfg.CheckAuth {
+		if err := enterPhase("checking authentication"); err != nil {
+			return nil, err
+		}
+		if err := checkAuth(ctx, client, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := enterPhase("fetching source IDs"); err != nil {
+		return nil, err
+	}
+	fetchCtx, progress := withFetchProgress(ctx)
+	if cfg.SourceTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithTimeout(fetchCtx, cfg.SourceTimeout)
+		defer cancel()
+	}
+	fetched, err := fetchSourceIDs(fetchCtx, client, cfg)
+	if err != nil {
+		return nil, sourceTimeoutError(ctx, fetchCtx, cfg, progress, err)
+	}
+	fetched.RateLimitWaitsMs = rateLimits.waitedMs()
+	writeSourceCache(cfg, fetched, time.Now())
+	return fetched, nil
+}
+
+// sourceCacheKey describes the settings that decide which IDs a fetch
+// returns, and the checks a fetch applies to them. A cache written under a
+// different key is never used: a cache hit skips the fetch, so
+// fail_on_duplicates and strict_source_match are only honoured by refetching.
+func sourceCacheKey(cfg *shardConfig) string {
+	domain := cfg.InstanceDomain
+	if normalized, err := normalizeInstanceDomain(domain); err == nil {
+		domain = normalized
+	}
+	key := fmt.Sprintf("instance_domain=%s source_type=%s group_id=%s prestage_id=%s site_id=%s namespace_ids=%t "+
+		"include_unmanaged=%t filter_department=%s filter_building=%s id_field=%s "+
+		"fail_on_duplicates=%t strict_source_match=%t",
+		domain, cfg.SourceType, cfg.GroupID, cfg.PrestageID, cfg.SiteID, cfg.NamespaceIDs,
+		cfg.IncludeUnmanaged, cfg.FilterDepartment, cfg.FilterBuilding, cfg.IDField,
+		cfg.FailOnDuplicates, cfg.StrictSourceMatch)
+	// Only appended when set, so caches written before raw_endpoint existed
+	// keep their key.
+	if cfg.RawPath != "" || cfg.RawIDJSONPath != "" {
+		key += fmt.Sprintf(" raw_path=%s raw_id_jsonpath=%s", cfg.RawPath, cfg.RawIDJSONPath)
+	}
+	return key
+}
+
+// readSourceCache returns the IDs in the cache_ids file when it was written
+// for the same source less than cache_ttl before now. It returns nil, so the
+// caller fetches, when cache_ids is not set, refresh_cache is, or the file is
+// missing, stale, for another source, or unreadable.
+func readSourceCache(cfg *shardConfig, now time.Time) *sourceFetchResult {
+	if cfg.CacheIDs == "" || cfg.RefreshCache {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.CacheIDs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		warnf("failed to read cache_ids %s, fetching instead: %v", cfg.CacheIDs, err)
+		return nil
+	}
+	var cache sourceCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		warnf("cache_ids %s is not a valid cache file, fetching instead: %v", cfg.CacheIDs, err)
+		return nil
+	}
+
+	age := now.Sub(cache.FetchedAt)
+	switch {
+	case cache.Source != sourceCacheKey(cfg):
+		infof("cache_ids %s was written for a different source; fetching", cfg.CacheIDs)
+		return nil
+	case age >= cfg.CacheTTL:
+		infof("cache_ids %s is %s old, older than cache_ttl %s; fetching", cfg.CacheIDs, age.Round(time.Second), cfg.CacheTTL)
+		return nil
+	}
+	infof("Using %d cached ID(s) from %s, fetched %s ago", len(cache.IDs), cfg.CacheIDs, age.Round(time.Second))
+	return &sourceFetchResult{
+		IDs:               cache.IDs,
+		DuplicatesRemoved: cache.DuplicatesRemoved,
+		LocationFilter:    cache.LocationFilter,
+		Unmanaged:         cache.Unmanaged,
+		Names:             cache.Names,
+		Warnings:          cache.Warnings,
+		SourceBreakdown:   cache.SourceBreakdown,
+	}
+}
+
+// writeSourceCache saves fetched to the cache_ids file, when it is set. The
+// cache only saves API calls, so a failed write is reported as a warning
+// rather than failing the run.
+func writeSourceCache(cfg *shardConfig, fetched *sourceFetchResult, now time.Time) {
+	if cfg.CacheIDs == "" {
+		return
+	}
+	data, err := json.Marshal(sourceCache{
+		FetchedAt:         now.UTC(),
+		Source:            sourceCacheKey(cfg),
+		IDs:               fetched.IDs,
+		DuplicatesRemoved: fetched.DuplicatesRemoved,
+		LocationFilter:    fetched.LocationFilter,
+		Unmanaged:         fetched.Unmanaged,
+		Names:             fetched.Names,
+		Warnings:          fetched.Warnings,
+		SourceBreakdown:   fetched.SourceBreakdown,
+	})
+	if err == nil {
+		// Device names may be cached, so the file is private to the user.
+		err = os.WriteFile(cfg.CacheIDs, data, 0o600)
+	}
+	if err != nil {
+		warnf("failed to write cache_ids %s: %v", cfg.CacheIDs, err)
+	}
+}
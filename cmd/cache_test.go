@@ -0,0 +1,149 @@
+package cmd
+
+// cache_test.go contains tests for the cache_ids source cache in cache.go.
+//
+//   TestSourceCache_*     — write/read round trip, freshness, and fallbacks
+//   TestRunShard_CacheIDs — a second run served from the cache, offline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cacheTestConfig returns a config caching computer_inventory to a file in a
+// temporary directory, fresh for an hour.
+func cacheTestConfig(t *testing.T) *shardConfig {
+	t.Helper()
+	return &shardConfig{
+		SourceType: "computer_inventory",
+		CacheIDs:   filepath.Join(t.TempDir(), "ids-cache.json"),
+		CacheTTL:   time.Hour,
+	}
+}
+
+func TestSourceCache_RoundTrip(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	fetchedAt := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	fetched := &sourceFetchResult{
+		IDs:               []string{"3", "1", "2"},
+		DuplicatesRemoved: 1,
+		Unmanaged:         map[string]bool{"2": true},
+		Names:             map[string]string{"1": "Mac-1"},
+		Warnings:          []string{"a warning"},
+		SourceBreakdown:   map[string]int{"computer_inventory": 3},
+	}
+
+	writeSourceCache(cfg, fetched, fetchedAt)
+	cached := readSourceCache(cfg, fetchedAt.Add(59*time.Minute))
+
+	require.NotNil(t, cached)
+	assert.Equal(t, fetched, cached, "IDs keep their fetched order")
+
+	info, err := os.Stat(cfg.CacheIDs)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestSourceCache_Stale(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	fetchedAt := time.Now()
+	writeSourceCache(cfg, &sourceFetchResult{IDs: []string{"1"}}, fetchedAt)
+
+	assert.Nil(t, readSourceCache(cfg, fetchedAt.Add(time.Hour)))
+}
+
+func TestSourceCache_DifferentSource(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	writeSourceCache(cfg, &sourceFetchResult{IDs: []string{"1"}}, time.Now())
+
+	cfg.SourceType = "computer_group_membership"
+	cfg.GroupID = "42"
+
+	assert.Nil(t, readSourceCache(cfg, time.Now()))
+}
+
+func TestSourceCache_DifferentInstance(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	cfg.InstanceDomain = "prod.jamfcloud.com"
+	writeSourceCache(cfg, &sourceFetchResult{IDs: []string{"1"}}, time.Now())
+
+	cfg.InstanceDomain = "https://PROD.jamfcloud.com/"
+	assert.NotNil(t, readSourceCache(cfg, time.Now()), "The same instance, written differently")
+
+	cfg.InstanceDomain = "staging.jamfcloud.com"
+	assert.Nil(t, readSourceCache(cfg, time.Now()))
+}
+
+func TestSourceCache_FetchChecks(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	writeSourceCache(cfg, &sourceFetchResult{IDs: []string{"1"}, DuplicatesRemoved: 1}, time.Now())
+
+	cfg.FailOnDuplicates = true
+	assert.Nil(t, readSourceCache(cfg, time.Now()), "fail_on_duplicates refetches to check")
+
+	cfg.FailOnDuplicates = false
+	cfg.StrictSourceMatch = true
+	assert.Nil(t, readSourceCache(cfg, time.Now()), "strict_source_match refetches to check")
+}
+
+func TestSourceCache_Fallbacks(t *testing.T) {
+	cfg := cacheTestConfig(t)
+	assert.Nil(t, readSourceCache(cfg, time.Now()), "Missing file")
+
+	writeSourceCache(cfg, &sourceFetchResult{IDs: []string{"1"}}, time.Now())
+	cfg.RefreshCache = true
+	assert.Nil(t, readSourceCache(cfg, time.Now()), "refresh_cache ignores a fresh cache")
+
+	cfg.RefreshCache = false
+	require.NoError(t, os.WriteFile(cfg.CacheIDs, []byte("not json"), 0o600))
+	assert.Nil(t, readSourceCache(cfg, time.Now()), "Corrupt file")
+
+	assert.Nil(t, readSourceCache(&shardConfig{}, time.Now()), "cache_ids not set")
+}
+
+func TestRunShard_CacheIDs(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+	cacheFile := filepath.Join(tmpDir, "ids-cache.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("cache_ids", cacheFile)
+	viper.Set("cache_ttl", time.Hour)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+	first, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	require.FileExists(t, cacheFile)
+
+	// With the server gone, only the cache can supply the IDs.
+	server.Close()
+	require.NoError(t, runShard(cmd, []string{}))
+	second, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, first.Metadata.ResultHash, second.Metadata.ResultHash)
+	assert.Equal(t, 50, second.Metadata.TotalIDsFetched)
+
+	viper.Set("refresh_cache", true)
+	assert.Error(t, runShard(cmd, []string{}), "refresh_cache fetches even though the cache is fresh")
+}
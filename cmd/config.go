@@ -0,0 +1,246 @@
+package cmd
+
+// config.go implements the `config` command group. `config normalize`
+// rewrites a config file so every key uses its canonical mapstructure name,
+// catching typos and flag-style spellings that viper would otherwise ignore.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// configKeyAliases maps common misspellings and alternative names to their
+// canonical config key. Flag names (and their underscore forms) are handled
+// separately via shardFlagKeys.
+var configKeyAliases = map[string]string{
+	"retry_eligible_requests": "retry_eligiable_requests",
+	"username":                "basic_auth_username",
+	"password":                "basic_auth_password",
+	"output":                  "output_format",
+	"format":                  "output_format",
+	"custom_timeout":          "custom_timeout_seconds",
+	"custom_timeout_ms":       "custom_timeout_milliseconds",
+	"token_refresh_buffer":    "token_refresh_buffer_period_seconds",
+	"total_retry_duration":    "total_retry_duration_seconds",
+	"mandatory_request_delay": "mandatory_request_delay_milliseconds",
+	"overflow":                "overflow_policy",
+	"percentages":             "shard_percentages",
+	"sizes":                   "shard_sizes",
+	"weights":                 "shard_weights",
+	"excluded_ids":            "exclude_ids",
+	"reserved":                "reserved_ids",
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and maintain go-jamf-guid-sharder config files",
+}
+
+var configNormalizeCmd = &cobra.Command{
+	Use:   "normalize <config-file>",
+	Short: "Rewrite a config file using canonical key names",
+	Long: `Reads a YAML or JSON config file, renames known aliases (flag-style
+names such as "shard-count", or misspellings such as "retry_eligible_requests")
+to their canonical keys, drops unknown keys with a warning, and writes the
+cleaned file back in the same format.
+
+Keys are written in the same order as the configuration reference.
+
+Examples:
+  # Rewrite in place
+  go-jamf-guid-sharder config normalize ./go-jamf-guid-sharder.yaml
+
+  # Preview the result without touching the file
+  go-jamf-guid-sharder config normalize ./config.json --dry-run`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigNormalize,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configNormalizeCmd)
+
+	configNormalizeCmd.Flags().Bool("dry-run", false, "Print the normalized config to stdout instead of rewriting the file")
+}
+
+func runConfigNormalize(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	// YAML is a superset of JSON, so a single decoder handles both formats.
+	raw := make(map[string]any)
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	normalized, warnings := normalizeConfigMap(raw)
+	for _, w := range warnings {
+		warnf("%s", w)
+	}
+
+	asJSON := strings.EqualFold(filepath.Ext(path), ".json")
+	out, err := marshalOrderedConfig(normalized, asJSON)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat config file %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
+	infof("Normalized %s (%d key(s))", path, len(normalized))
+	return nil
+}
+
+// canonicalConfigKeys returns every config key accepted by shardConfig, in
+// struct declaration order. Derived by reflection so it cannot drift from the
+// struct tags.
+func canonicalConfigKeys() []string {
+	t := reflect.TypeOf(shardConfig{})
+	keys := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		if key := configKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// configKey returns the config key of a shardConfig field: its mapstructure
+// tag, or its config tag for a field that viper.Unmarshal skips
+// (mapstructure:"-") because loadShardConfig decodes it by hand. It is empty
+// for a field that is not a setting.
+func configKey(field reflect.StructField) string {
+	key := field.Tag.Get("mapstructure")
+	if key == "-" {
+		return field.Tag.Get("config")
+	}
+	return key
+}
+
+// resolveConfigKey maps a raw config key to its canonical form. Matching is
+// case-insensitive and treats '-' and '_' as equivalent. Returns false when
+// the key is not recognised.
+func resolveConfigKey(key string, canonical map[string]bool) (string, bool) {
+	k := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+	if canonical[k] {
+		return k, true
+	}
+	if alias, ok := configKeyAliases[k]; ok {
+		return alias, true
+	}
+	for flag, cfgKey := range shardFlagKeys {
+		if strings.ReplaceAll(flag, "-", "_") == k {
+			return cfgKey, true
+		}
+	}
+	return "", false
+}
+
+// normalizeConfigMap renames aliased keys to their canonical names and drops
+// unknown keys. When an alias and its canonical key are both present, the
+// canonical key wins. Returns the cleaned map and a warning per change.
+func normalizeConfigMap(raw map[string]any) (map[string]any, []string) {
+	canonical := make(map[string]bool)
+	for _, k := range canonicalConfigKeys() {
+		canonical[k] = true
+	}
+
+	// Process keys in a stable order so warnings are deterministic.
+	rawKeys := make([]string, 0, len(raw))
+	for k := range raw {
+		rawKeys = append(rawKeys, k)
+	}
+	slices.Sort(rawKeys)
+
+	out := make(map[string]any, len(raw))
+	var warnings []string
+	for _, key := range rawKeys {
+		target, ok := resolveConfigKey(key, canonical)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("dropping unknown key %q", key))
+			continue
+		}
+		if target == key {
+			out[target] = raw[key]
+			continue
+		}
+		if _, exists := raw[target]; exists {
+			warnings = append(warnings,
+				fmt.Sprintf("dropping %q: canonical key %q is also set and takes precedence", key, target))
+			continue
+		}
+		if _, exists := out[target]; exists {
+			warnings = append(warnings,
+				fmt.Sprintf("dropping %q: another alias for %q was already applied", key, target))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("renaming %q to %q", key, target))
+		out[target] = raw[key]
+	}
+	return out, warnings
+}
+
+// marshalOrderedConfig serialises cfg with keys in canonicalConfigKeys order,
+// as JSON when asJSON is set and YAML otherwise.
+func marshalOrderedConfig(cfg map[string]any, asJSON bool) ([]byte, error) {
+	var ordered []string
+	for _, k := range canonicalConfigKeys() {
+		if _, ok := cfg[k]; ok {
+			ordered = append(ordered, k)
+		}
+	}
+
+	if asJSON {
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		for i, k := range ordered {
+			value, err := json.MarshalIndent(cfg[k], "  ", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %q as json: %w", k, err)
+			}
+			fmt.Fprintf(&buf, "  %q: %s", k, value)
+			if i < len(ordered)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes(), nil
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range ordered {
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(cfg[k]); err != nil {
+			return nil, fmt.Errorf("failed to marshal %q as yaml: %w", k, err)
+		}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: k},
+			valueNode,
+		)
+	}
+	return yaml.Marshal(root)
+}
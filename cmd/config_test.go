@@ -0,0 +1,155 @@
+package cmd
+
+// config_test.go contains unit tests for the `config normalize` helpers in
+// config.go.
+//
+//   TestNormalizeConfigMap        — alias renaming, unknown keys, precedence
+//   TestMarshalOrderedConfig_*    — canonical key ordering for YAML and JSON
+//   TestRunConfigNormalize_*      — end-to-end file rewrite and dry run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeConfigMap(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        map[string]any
+		want         map[string]any
+		wantWarnings []string
+	}{
+		{
+			name:  "canonical keys pass through unchanged",
+			input: map[string]any{"shard_count": 3, "strategy": "round-robin"},
+			want:  map[string]any{"shard_count": 3, "strategy": "round-robin"},
+		},
+		{
+			name:         "flag-style keys are renamed",
+			input:        map[string]any{"shard-count": 3, "output": "yaml"},
+			want:         map[string]any{"shard_count": 3, "output_format": "yaml"},
+			wantWarnings: []string{`renaming "output" to "output_format"`, `renaming "shard-count" to "shard_count"`},
+		},
+		{
+			name:         "case and known misspellings are corrected",
+			input:        map[string]any{"Shard_Count": 2, "retry_eligible_requests": true},
+			want:         map[string]any{"shard_count": 2, "retry_eligiable_requests": true},
+			wantWarnings: []string{`renaming "Shard_Count"`, `renaming "retry_eligible_requests"`},
+		},
+		{
+			name:         "unknown keys are dropped",
+			input:        map[string]any{"strategy": "size", "shard_cuont": 4},
+			want:         map[string]any{"strategy": "size"},
+			wantWarnings: []string{`dropping unknown key "shard_cuont"`},
+		},
+		{
+			name:         "canonical key wins over alias",
+			input:        map[string]any{"shard_count": 5, "shard-count": 2},
+			want:         map[string]any{"shard_count": 5},
+			wantWarnings: []string{`canonical key "shard_count" is also set`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, warnings := normalizeConfigMap(tc.input)
+			assert.Equal(t, tc.want, got)
+			require.Len(t, warnings, len(tc.wantWarnings))
+			for i, w := range tc.wantWarnings {
+				assert.Contains(t, warnings[i], w)
+			}
+		})
+	}
+}
+
+func TestMarshalOrderedConfig_YAML(t *testing.T) {
+	cfg := map[string]any{
+		"output_format":   "json",
+		"shard_count":     3,
+		"instance_domain": "example.jamfcloud.com",
+	}
+
+	out, err := marshalOrderedConfig(cfg, false)
+	require.NoError(t, err)
+
+	text := string(out)
+	assert.Less(t, strings.Index(text, "instance_domain"), strings.Index(text, "shard_count"))
+	assert.Less(t, strings.Index(text, "shard_count"), strings.Index(text, "output_format"))
+
+	var roundTrip map[string]any
+	require.NoError(t, yaml.Unmarshal(out, &roundTrip))
+	assert.Equal(t, 3, roundTrip["shard_count"])
+}
+
+func TestMarshalOrderedConfig_JSON(t *testing.T) {
+	cfg := map[string]any{
+		"exclude_ids": []any{"1", "2"},
+		"strategy":    "rendezvous",
+	}
+
+	out, err := marshalOrderedConfig(cfg, true)
+	require.NoError(t, err)
+
+	text := string(out)
+	assert.Less(t, strings.Index(text, "strategy"), strings.Index(text, "exclude_ids"))
+
+	var roundTrip map[string]any
+	require.NoError(t, json.Unmarshal(out, &roundTrip))
+	assert.Equal(t, []any{"1", "2"}, roundTrip["exclude_ids"])
+}
+
+func newConfigNormalizeTestCmd() *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("dry-run", false, "")
+	return cmd
+}
+
+func TestRunConfigNormalize_RewritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("shard-count: 4\nstrategy: round-robin\nbogus: 1\n"), 0o600))
+
+	require.NoError(t, runConfigNormalize(newConfigNormalizeTestCmd(), []string{path}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "strategy: round-robin\nshard_count: 4\n", string(data))
+}
+
+func TestRunConfigNormalize_DryRunLeavesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{"shard-count": 4}`
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o600))
+
+	cmd := newConfigNormalizeTestCmd()
+	require.NoError(t, cmd.Flags().Set("dry-run", "true"))
+	require.NoError(t, runConfigNormalize(cmd, []string{path}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(data))
+}
+
+func TestRunConfigNormalize_KeepsPerShardSeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("per-shard-seeds:\n  shard_1: beta\nshard_count: 2\n"), 0o600))
+
+	require.NoError(t, runConfigNormalize(newConfigNormalizeTestCmd(), []string{path}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "shard_count: 2\nper_shard_seeds:\n    shard_1: beta\n", string(data))
+}
+
+func TestRunConfigNormalize_MissingFile(t *testing.T) {
+	err := runConfigNormalize(newConfigNormalizeTestCmd(), []string{filepath.Join(t.TempDir(), "missing.yaml")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read config file")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+// count.go implements the `count` command: print how many IDs a source would
+// contribute to a shard run, after exclusions, and nothing else.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var countCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Print the number of IDs a source would shard",
+	Long: `Connects to Jamf Pro, fetches IDs from the specified source, applies any
+exclusions, and prints the number that remain as a single integer. Use --json
+to print {"count": N} instead.
+
+Examples:
+  go-jamf-guid-sharder count --config ./config.yaml --source-type mobile_device_inventory
+
+  go-jamf-guid-sharder count --config ./config.yaml \
+    --source-type computer_group_membership --group-id 42 --json`,
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd) },
+	RunE:   runCount,
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+
+	addConnectionFlags(countCmd)
+	addSourceFlags(countCmd)
+	countCmd.Flags().StringSlice("exclude-ids", []string{}, "IDs to exclude from the count (comma-separated)")
+	countCmd.Flags().String("exclude-from-result", "", "Path to a previous result file; every ID in any of its shards is excluded")
+	countCmd.Flags().String("exclude-id-pattern", "", "Regular expression; every fetched ID it matches is excluded")
+	countCmd.Flags().Bool("json", false, `Print {"count": N} instead of a bare integer`)
+}
+
+func runCount(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadShardConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	_, remaining, err := fetchRemainingIDs(cfg)
+	if err != nil {
+		return err
+	}
+
+	asJSON, _ := cmd.Flags().GetBool("json")
+	if asJSON {
+		return json.NewEncoder(cmd.OutOrStdout()).Encode(map[string]int{"count": len(remaining)})
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), len(remaining))
+	return err
+}
@@ -0,0 +1,75 @@
+package cmd
+
+// count_test.go contains tests for the `count` command in count.go.
+//
+//   TestRunCount_*   — end-to-end against the integration mock server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCountCmd returns a bare command carrying count's --json flag, writing
+// stdout to buf.
+func newCountCmd(buf *bytes.Buffer, asJSON bool) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("json", asJSON, "")
+	cmd.SetOut(buf)
+	return cmd
+}
+
+func TestRunCount_PrintsRemainingAfterExclusions(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("exclude_ids", []string{"1", "2", "999"})
+
+	var buf bytes.Buffer
+	require.NoError(t, runCount(newCountCmd(&buf, false), []string{}))
+
+	assert.Equal(t, "48\n", buf.String())
+}
+
+func TestRunCount_JSON(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "mobile_device_inventory")
+
+	var buf bytes.Buffer
+	require.NoError(t, runCount(newCountCmd(&buf, true), []string{}))
+
+	assert.JSONEq(t, `{"count": 30}`, buf.String())
+}
+
+func TestRunCount_DoesNotRequireStrategy(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("instance_domain", "https://example.jamfcloud.com")
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "id")
+	viper.Set("client_secret", "secret")
+
+	var buf bytes.Buffer
+	err := runCount(newCountCmd(&buf, false), []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source_type is required")
+	assert.NotContains(t, err.Error(), "strategy")
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,203 @@
+package cmd
+
+// drift.go implements the `drift` command: compare the IDs a source holds now
+// with those placed by a prior shard run, to tell when the fleet has changed
+// enough to warrant re-sharding.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
+	"github.com/spf13/cobra"
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift <prior-result-file>",
+	Short: "Report how far a source has drifted from a prior shard result",
+	Long: `Connects to Jamf Pro, fetches IDs from the specified source, applies any
+exclusions exactly as shard does, and compares them with every ID placed in a
+prior result file, including its holdback cohort. Reports the IDs added to
+and removed from the source since that run, and the drift: added plus
+removed, as a percentage of the prior total.
+
+With --drift-threshold, exits non-zero when the drift is above the threshold,
+so a scheduled job can decide whether to re-shard. Use the same source
+settings, including --namespace-ids, as the prior run. A prior result that
+does not hold the whole source, because it was sharded from a sample_size
+sample or left IDs out of every shard, is refused.
+
+Examples:
+  go-jamf-guid-sharder drift wave1.json --config ./config.yaml
+
+  go-jamf-guid-sharder drift wave1.json --config ./config.yaml \
+    --drift-threshold 10 --output json`,
+	Args:   cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd, "output") },
+	RunE:   runDrift,
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+
+	addConnectionFlags(driftCmd)
+	addSourceFlags(driftCmd)
+	driftCmd.Flags().StringSlice("exclude-ids", []string{}, "IDs to leave out of the current source (comma-separated)")
+	driftCmd.Flags().String("exclude-from-result", "", "Path to a previous result file; every ID in any of its shards is left out of the current source")
+	driftCmd.Flags().String("exclude-id-pattern", "", "Regular expression; every fetched ID it matches is left out of the current source")
+	driftCmd.Flags().Float64("drift-threshold", 0, "Exit non-zero when the drift percentage is above this (0 = never)")
+	driftCmd.Flags().String("output", "text", "Report format: text or json")
+}
+
+// driftReport is the comparison printed by the drift command.
+type driftReport struct {
+	PriorIDCount   int      `json:"prior_id_count"`
+	CurrentIDCount int      `json:"current_id_count"`
+	Added          []string `json:"added"`
+	Removed        []string `json:"removed"`
+	DriftPercent   float64  `json:"drift_percent"`
+	Threshold      float64  `json:"threshold,omitempty"`
+	Exceeded       bool     `json:"exceeded"`
+}
+
+func runDrift(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	threshold, _ := cmd.Flags().GetFloat64("drift-threshold")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid --output %q: must be one of: text, json", output)
+	}
+	if threshold < 0 {
+		return fmt.Errorf("invalid --drift-threshold %g: must be >= 0", threshold)
+	}
+
+	prior, err := loadShardResult(args[0])
+	if err != nil {
+		return err
+	}
+	priorIDs, err := driftPriorIDs(args[0], prior)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadShardConfig(cmd)
+	if err != nil {
+		return err
+	}
+	_, current, err := fetchRemainingIDs(cfg)
+	if err != nil {
+		return err
+	}
+
+	report := buildDriftReport(priorIDs, current, threshold)
+	if output == "json" {
+		if err := json.NewEncoder(cmd.OutOrStdout()).Encode(report); err != nil {
+			return err
+		}
+	} else if err := writeDriftReport(cmd.OutOrStdout(), report); err != nil {
+		return err
+	}
+	if report.Exceeded {
+		return fmt.Errorf("drift of %.2f%% is above --drift-threshold %g%%", report.DriftPercent, threshold)
+	}
+	return nil
+}
+
+// driftPriorIDs returns the pool prior, read from path, was sharded from:
+// every ID placed in a shard plus the holdback cohort, which was in the
+// source but left out of every shard. A prior sharded from a sample_size
+// sample is refused, since every unsampled ID would count as added, as is a
+// prior that left IDs undistributed, since it does not record which.
+func driftPriorIDs(path string, prior *ShardResult) ([]string, error) {
+	if prior.Metadata.SampleSize > 0 {
+		return nil, fmt.Errorf("result file %s was sharded from a sample of %d ID(s) (sample_size), not the whole source, "+
+			"so drift would report every unsampled ID as added — compare against a result written without sample_size",
+			path, prior.Metadata.SampleSize)
+	}
+	if prior.Metadata.UndistributedIDCount > 0 {
+		return nil, fmt.Errorf("result file %s left %d ID(s) out of every shard (undistributed_id_count), so drift would report them as added — "+
+			"compare against a result that places every ID, written without allow_partial or with a -1 in shard_sizes",
+			path, prior.Metadata.UndistributedIDCount)
+	}
+	ids := resultIDs(prior)
+	if prior.Metadata.Holdback != nil {
+		ids = append(ids, prior.Metadata.Holdback.IDs...)
+	}
+	return ids, nil
+}
+
+// buildDriftReport compares the prior and current ID pools. Drift is the
+// number of IDs added plus removed, as a percentage of the prior pool; an
+// empty prior pool drifts 100% when the current one is not empty. A
+// threshold of 0 is never exceeded.
+func buildDriftReport(prior, current []string, threshold float64) *driftReport {
+	priorSet := make(map[string]bool, len(prior))
+	for _, id := range prior {
+		priorSet[id] = true
+	}
+	currentSet := make(map[string]bool, len(current))
+	for _, id := range current {
+		currentSet[id] = true
+	}
+
+	report := &driftReport{
+		PriorIDCount:   len(priorSet),
+		CurrentIDCount: len(currentSet),
+		Added:          []string{},
+		Removed:        []string{},
+		Threshold:      threshold,
+	}
+	for id := range currentSet {
+		if !priorSet[id] {
+			report.Added = append(report.Added, id)
+		}
+	}
+	for id := range priorSet {
+		if !currentSet[id] {
+			report.Removed = append(report.Removed, id)
+		}
+	}
+	sharding.SortIDsNumerically(report.Added)
+	sharding.SortIDsNumerically(report.Removed)
+
+	changed := len(report.Added) + len(report.Removed)
+	switch {
+	case report.PriorIDCount > 0:
+		report.DriftPercent = float64(changed) * 100 / float64(report.PriorIDCount)
+	case changed > 0:
+		report.DriftPercent = 100
+	}
+	report.Exceeded = threshold > 0 && report.DriftPercent > threshold
+	return report
+}
+
+// driftListLimit is the most added or removed IDs the text report lists;
+// --output json always lists them all.
+const driftListLimit = 20
+
+// writeDriftReport prints report as an aligned, human-readable summary.
+func writeDriftReport(w io.Writer, report *driftReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Prior IDs:\t%d\n", report.PriorIDCount)
+	fmt.Fprintf(tw, "Current IDs:\t%d\n", report.CurrentIDCount)
+	fmt.Fprintf(tw, "Added:\t%d%s\n", len(report.Added), driftIDList(report.Added))
+	fmt.Fprintf(tw, "Removed:\t%d%s\n", len(report.Removed), driftIDList(report.Removed))
+	fmt.Fprintf(tw, "Drift:\t%.2f%%\n", report.DriftPercent)
+	if report.Threshold > 0 {
+		fmt.Fprintf(tw, "Threshold:\t%g%%\n", report.Threshold)
+	}
+	return tw.Flush()
+}
+
+// driftIDList formats ids as " (1, 2, …)", listing at most driftListLimit.
+func driftIDList(ids []string) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	shown := append([]string{}, ids[:min(len(ids), driftListLimit)]...)
+	if len(ids) > driftListLimit {
+		shown = append(shown, fmt.Sprintf("… %d more", len(ids)-driftListLimit))
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(shown, ", "))
+}
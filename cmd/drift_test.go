@@ -0,0 +1,230 @@
+package cmd
+
+// drift_test.go contains tests for the `drift` command in drift.go.
+//
+//   TestDriftPriorIDs_*     — holdback IDs counted, sampled and partial priors refused
+//   TestBuildDriftReport_*  — added/removed IDs, drift percentage, threshold
+//   TestWriteDriftReport_*  — text layout and ID list truncation
+//   TestRunDrift_*          — end-to-end against the integration mock server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftPriorIDs_IncludesHoldback(t *testing.T) {
+	prior := &ShardResult{
+		Metadata: ShardMetadata{Holdback: &HoldbackSummary{Percentage: 10, IDCount: 1, IDs: []string{"7"}}},
+		Shards:   map[string][]string{"shard_0": {"1", "3"}, "shard_1": {"2"}},
+	}
+
+	ids, err := driftPriorIDs("prior.json", prior)
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3", "7"}, ids)
+	assert.Empty(t, buildDriftReport(ids, []string{"1", "2", "3", "7"}, 0).Added, "Held-back IDs are not drift")
+}
+
+func TestDriftPriorIDs_RefusesSample(t *testing.T) {
+	prior := &ShardResult{
+		Metadata: ShardMetadata{SampleSize: 10},
+		Shards:   map[string][]string{"shard_0": {"1", "3"}},
+	}
+
+	_, err := driftPriorIDs("prior.json", prior)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "result file prior.json was sharded from a sample of 10 ID(s) (sample_size)")
+}
+
+func TestDriftPriorIDs_RefusesUndistributed(t *testing.T) {
+	prior := &ShardResult{
+		Metadata: ShardMetadata{UndistributedIDCount: 3},
+		Shards:   map[string][]string{"shard_0": {"1", "2"}, "shard_1": {"3"}},
+	}
+
+	_, err := driftPriorIDs("prior.json", prior)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "result file prior.json left 3 ID(s) out of every shard (undistributed_id_count)")
+}
+
+func TestBuildDriftReport_AddedAndRemoved(t *testing.T) {
+	report := buildDriftReport([]string{"10", "2", "3", "4"}, []string{"3", "4", "11", "5", "2"}, 0)
+
+	assert.Equal(t, 4, report.PriorIDCount)
+	assert.Equal(t, 5, report.CurrentIDCount)
+	assert.Equal(t, []string{"5", "11"}, report.Added, "Added IDs are sorted numerically")
+	assert.Equal(t, []string{"10"}, report.Removed)
+	assert.InDelta(t, 75.0, report.DriftPercent, 0.001, "Three changes against a prior total of four")
+	assert.False(t, report.Exceeded, "A threshold of 0 is never exceeded")
+}
+
+func TestBuildDriftReport_NoDrift(t *testing.T) {
+	report := buildDriftReport([]string{"1", "2"}, []string{"2", "1"}, 5)
+
+	assert.Equal(t, []string{}, report.Added)
+	assert.Equal(t, []string{}, report.Removed)
+	assert.Zero(t, report.DriftPercent)
+	assert.False(t, report.Exceeded)
+}
+
+func TestBuildDriftReport_EmptyPrior(t *testing.T) {
+	assert.InDelta(t, 100.0, buildDriftReport(nil, []string{"1"}, 0).DriftPercent, 0.001)
+	assert.Zero(t, buildDriftReport(nil, nil, 0).DriftPercent)
+}
+
+func TestBuildDriftReport_Threshold(t *testing.T) {
+	prior := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	current := prior[:9]
+
+	assert.False(t, buildDriftReport(prior, current, 10).Exceeded, "Drift equal to the threshold passes")
+	assert.True(t, buildDriftReport(prior, current, 9.5).Exceeded)
+}
+
+func TestWriteDriftReport_Layout(t *testing.T) {
+	var buf bytes.Buffer
+	report := buildDriftReport([]string{"1", "2", "3", "4"}, []string{"2", "3", "4", "5"}, 10)
+
+	require.NoError(t, writeDriftReport(&buf, report))
+
+	out := buf.String()
+	assert.Contains(t, out, "Prior IDs:    4")
+	assert.Contains(t, out, "Added:        1 (5)")
+	assert.Contains(t, out, "Removed:      1 (1)")
+	assert.Contains(t, out, "Drift:        50.00%")
+	assert.Contains(t, out, "Threshold:    10%")
+}
+
+func TestWriteDriftReport_TruncatesLongLists(t *testing.T) {
+	var current []string
+	for i := range driftListLimit + 5 {
+		current = append(current, fmt.Sprintf("%d", i+1))
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, writeDriftReport(&buf, buildDriftReport(nil, current, 0)))
+
+	assert.Contains(t, buf.String(), "19, 20, … 5 more)")
+	assert.NotContains(t, buf.String(), "Threshold")
+}
+
+func TestRunDrift_ReportsAgainstPriorResult(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+
+	prior := make([]string, 0, 49)
+	for i := range 48 {
+		prior = append(prior, fmt.Sprintf("%d", i+1))
+	}
+	prior = append(prior, "99")
+	priorFile := filepath.Join(t.TempDir(), "prior.json")
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: priorFile}, &ShardResult{
+		Shards: map[string][]string{"shard_0": prior[:25], "shard_1": prior[25:]},
+	}))
+
+	var buf bytes.Buffer
+	cmd := newDriftTestCommand(&buf, "json", 0)
+
+	require.NoError(t, runDrift(cmd, []string{priorFile}))
+
+	var report driftReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 49, report.PriorIDCount)
+	assert.Equal(t, 50, report.CurrentIDCount)
+	assert.Equal(t, []string{"49", "50"}, report.Added)
+	assert.Equal(t, []string{"99"}, report.Removed)
+	assert.InDelta(t, 300.0/49, report.DriftPercent, 0.001)
+
+	buf.Reset()
+	err := runDrift(newDriftTestCommand(&buf, "text", 5), []string{priorFile})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "drift of 6.12% is above --drift-threshold 5%")
+	assert.Contains(t, buf.String(), "Added:        2 (49, 50)", "The report is printed before failing")
+}
+
+func TestRunDrift_MergedPriorKeepsHoldback(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+
+	// The prior covers the mock server's 50 computers, with 4 and 10 held
+	// back by the first of the two merged runs.
+	var first, second []string
+	for i := range 50 {
+		id := fmt.Sprintf("%d", i+1)
+		switch {
+		case id == "4" || id == "10":
+		case i < 25:
+			first = append(first, id)
+		default:
+			second = append(second, id)
+		}
+	}
+	dir := t.TempDir()
+	firstFile := filepath.Join(dir, "first.json")
+	secondFile := filepath.Join(dir, "second.json")
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: firstFile}, &ShardResult{
+		Metadata: ShardMetadata{Holdback: &HoldbackSummary{Percentage: 8, Seed: "hold", IDCount: 2, IDs: []string{"4", "10"}}},
+		Shards:   map[string][]string{"shard_0": first},
+	}))
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: secondFile}, &ShardResult{
+		Shards: map[string][]string{"shard_0": second},
+	}))
+	mergedFile := filepath.Join(dir, "merged.json")
+	mergeCmd := &cobra.Command{}
+	mergeCmd.Flags().String("output", "json", "")
+	mergeCmd.Flags().String("output-file", mergedFile, "")
+	mergeCmd.Flags().Bool("pad-shorter", false, "")
+	require.NoError(t, runMerge(mergeCmd, []string{firstFile, secondFile}))
+
+	var buf bytes.Buffer
+	require.NoError(t, runDrift(newDriftTestCommand(&buf, "json", 0), []string{mergedFile}))
+
+	var report driftReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 50, report.PriorIDCount)
+	assert.Empty(t, report.Added, "Held-back IDs are still part of the merged prior")
+	assert.Empty(t, report.Removed)
+}
+
+func TestRunDrift_InvalidFlags(t *testing.T) {
+	err := runDrift(newDriftTestCommand(&bytes.Buffer{}, "yaml", 0), []string{"prior.json"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --output")
+
+	err = runDrift(newDriftTestCommand(&bytes.Buffer{}, "text", -1), []string{"prior.json"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --drift-threshold")
+}
+
+// newDriftTestCommand returns a command carrying the drift flags runDrift
+// reads directly, writing to out.
+func newDriftTestCommand(out *bytes.Buffer, output string, threshold float64) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", output, "")
+	cmd.Flags().Float64("drift-threshold", threshold, "")
+	cmd.SetOut(out)
+	return cmd
+}
@@ -0,0 +1,40 @@
+package cmd
+
+// fixture.go implements the hidden --fixture option: serve source IDs from a
+// JSON file in place of Jamf Pro, so the whole shard pipeline — exclusions,
+// reservations, strategy, and output — can be run end to end without a live
+// instance or the SDK.
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// loadFixture reads a fixture file: a JSON object mapping source types to
+// the IDs each returns, e.g. {"computer_inventory": ["1", "2", "3"]}.
+func loadFixture(path string) (map[string][]string, error) {
+	data, err := readIDFile(path, "--fixture")
+	if err != nil {
+		return nil, err
+	}
+	fixture := make(map[string][]string)
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse --fixture %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// fetchFixtureSource returns the IDs the fixture lists for cfg.SourceType,
+// in its order. It stands in for dispatchSourceFetch, so deduplication and
+// namespacing still apply as they do to a real fetch.
+func fetchFixtureSource(cfg *shardConfig) (*sourceFetchResult, error) {
+	fixture, err := loadFixture(cfg.Fixture)
+	if err != nil {
+		return nil, err
+	}
+	ids, ok := fixture[cfg.SourceType]
+	if !ok {
+		return nil, fmt.Errorf("fixture %s has no IDs for source_type %s", cfg.Fixture, cfg.SourceType)
+	}
+	return &sourceFetchResult{IDs: ids}, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+// fixture_test.go contains tests for the hidden --fixture option in fixture.go.
+//
+//   TestFetchFixtureSource_*  — reading a fixture and its errors
+//   TestValidate_Fixture      — no credentials required, no inventory filters
+//   TestRunShard_Fixture      — the full shard pipeline with no Jamf Pro
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFixture writes content to a fixture file in a temporary directory and
+// returns its path.
+func writeFixture(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestFetchFixtureSource_Success(t *testing.T) {
+	path := writeFixture(t, `{"computer_inventory": ["3", "1", "2"], "user_accounts": ["7"]}`)
+
+	fetched, err := fetchFixtureSource(&shardConfig{Fixture: path, SourceType: "computer_inventory"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "1", "2"}, fetched.IDs, "IDs keep the fixture's order")
+}
+
+func TestFetchFixtureSource_Errors(t *testing.T) {
+	path := writeFixture(t, `{"computer_inventory": ["1"]}`)
+	_, err := fetchFixtureSource(&shardConfig{Fixture: path, SourceType: "user_accounts"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no IDs for source_type user_accounts")
+
+	_, err = fetchFixtureSource(&shardConfig{Fixture: writeFixture(t, `["1"]`), SourceType: "computer_inventory"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse --fixture")
+
+	_, err = fetchFixtureSource(&shardConfig{Fixture: filepath.Join(t.TempDir(), "missing.json")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read --fixture")
+}
+
+func TestValidate_Fixture(t *testing.T) {
+	cfg := &shardConfig{
+		Fixture:       "fixture.json",
+		SourceType:    "computer_inventory",
+		CustomTimeout: 60,
+		Strategy:      "round-robin",
+		ShardCount:    2,
+		OutputFormat:  "json",
+	}
+	assert.Empty(t, shardConfigIssues(cfg), "No instance or credentials are needed")
+
+	cfg.SiteID = "1"
+	issues := shardConfigIssues(cfg)
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0], "site_id cannot be combined with fixture")
+}
+
+func TestRunShard_Fixture(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	fixture := writeFixture(t, `{
+		"computer_inventory": ["1", "2", "3", "4", "5", "6", "7", "8", "2"],
+		"mobile_device_inventory": ["1", "2"]
+	}`)
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("fixture", fixture)
+	viper.Set("check_auth", true)
+	viper.Set("source_type", "computer_inventory,mobile_device_inventory")
+	viper.Set("namespace_ids", true)
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("custom_timeout_seconds", 60)
+	viper.Set("exclude_ids", []string{"computer:8"})
+	viper.Set("reserved_ids", map[string][]string{"shard_1": {"mobile_device:2"}})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Metadata.TotalIDsFetched)
+	assert.Equal(t, 1, result.Metadata.DuplicatesRemoved)
+	assert.Equal(t, 1, result.Metadata.ExcludedIDCount)
+	assert.Equal(t, map[string][]string{
+		"shard_0": {"computer:1", "computer:3", "computer:5", "computer:7"},
+		"shard_1": {"computer:2", "computer:4", "computer:6", "mobile_device:1", "mobile_device:2"},
+	}, result.Shards)
+}
@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -35,15 +40,25 @@ func setupIntegrationTest(t *testing.T) (*httptest.Server, func()) {
 				"expires": "2026-03-11T23:59:59Z",
 			})
 		},
+		"/api/v1/jamf-pro-version": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"Version": "11.14.0"})
+		},
 		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 
+			// Computers 1-20 are in site 1, the rest in site 2.
 			results := make([]map[string]any, 50)
 			for i := range 50 {
+				site := "1"
+				if i >= 20 {
+					site = "2"
+				}
 				results[i] = map[string]any{
 					"id": fmt.Sprintf("%d", i+1),
 					"general": map[string]any{
 						"name": fmt.Sprintf("Computer%d", i+1),
+						"site": map[string]any{"id": site},
 						"remoteManagement": map[string]any{
 							"managed": true,
 						},
@@ -57,34 +72,25 @@ func setupIntegrationTest(t *testing.T) (*httptest.Server, func()) {
 			}
 			json.NewEncoder(w).Encode(response)
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/xml")
-
-			type MobileDevice struct {
-				XMLName xml.Name `xml:"mobile_device"`
-				ID      int      `xml:"id"`
-				Name    string   `xml:"name"`
-				Managed bool     `xml:"managed"`
-			}
-
-			type MobileDevices struct {
-				XMLName xml.Name       `xml:"mobile_devices"`
-				Size    int            `xml:"size"`
-				Devices []MobileDevice `xml:"mobile_device"`
-			}
+		"/api/v2/mobile-devices/detail": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
 
-			devices := MobileDevices{
-				Size: 30,
-			}
+			results := make([]map[string]any, 30)
 			for i := range 30 {
-				devices.Devices = append(devices.Devices, MobileDevice{
-					ID:      i + 100,
-					Name:    fmt.Sprintf("iPad%d", i+1),
-					Managed: true,
-				})
+				results[i] = map[string]any{
+					"mobileDeviceId": fmt.Sprintf("%d", i+100),
+					"deviceType":     "iOS",
+					"general": map[string]any{
+						"displayName": fmt.Sprintf("iPad%d", i+1),
+						"managed":     true,
+					},
+				}
 			}
 
-			xml.NewEncoder(w).Encode(devices)
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": 30,
+				"results":    results,
+			})
 		},
 		"/JSSResource/users": func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/xml")
@@ -190,6 +196,10 @@ func setupIntegrationTest(t *testing.T) (*httptest.Server, func()) {
 
 	server := httptest.NewServer(mux)
 
+	// Tests set config through viper without binding flags, so flag defaults
+	// that validation depends on are applied here.
+	viper.Set("custom_timeout_seconds", 60)
+
 	cleanup := func() {
 		server.Close()
 		viper.Reset()
@@ -336,6 +346,105 @@ func TestRunShard_WithExclusions(t *testing.T) {
 	assert.Equal(t, 47, result.Metadata.UnreservedIDsDistributed)
 }
 
+func TestRunShard_UnusedExcludeIDs(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("exclude_ids", []string{"5", "999"})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Metadata.ExcludedIDCount)
+	assert.Contains(t, result.Warnings, "1 excluded ID(s) not found in the source pool: 999")
+
+	viper.Set("fail_on_unused_excludes", true)
+	err = runShard(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--fail-on-unused-excludes is set")
+}
+
+func TestRunShard_FailOnWarnings(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("exclude_ids", []string{"998", "999"})
+	viper.Set("reserved_ids", map[string][]string{"shard_0": {"997"}})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+	viper.Set("fail_on_warnings", true)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 warning(s) with --fail-on-warnings set:")
+	assert.Contains(t, err.Error(), "\n  - 2 excluded ID(s) not found in the source pool: 998, 999")
+	assert.Contains(t, err.Error(), "\n  - 1 reserved ID(s) not found in the source pool: 997")
+	assert.NoFileExists(t, outputFile, "Output is not written")
+
+	viper.Set("exclude_ids", []string{"5"})
+	viper.Set("reserved_ids", map[string][]string{"shard_0": {"6"}})
+	require.NoError(t, runShard(cmd, []string{}), "A run without warnings succeeds")
+	assert.FileExists(t, outputFile)
+}
+
+func TestRunShard_WithExcludeIDPattern(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("exclude_ids", []string{"1", "41"})
+	viper.Set("exclude_id_pattern", "^4[0-9]$")
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, 11, result.Metadata.ExcludedIDCount)
+	assert.Equal(t, 9, result.Metadata.ExcludedByPatternCount, "41 is counted under exclude_ids, not the pattern")
+	assert.NotContains(t, resultIDs(result), "40")
+	assert.Contains(t, resultIDs(result), "4")
+}
+
 func TestRunShard_WithReservations(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
@@ -375,6 +484,49 @@ func TestRunShard_WithReservations(t *testing.T) {
 	assert.Contains(t, result.Shards["shard_2"], "10")
 }
 
+func TestRunShard_ShardPrefix(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "rendezvous")
+	viper.Set("shard_count", 3)
+	viper.Set("seed", "waves")
+	viper.Set("shard_prefix", "wave_")
+	viper.Set("reserved_ids", map[string][]string{"wave_2": {"1"}})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"wave_0", "wave_1", "wave_2"}, slices.Collect(maps.Keys(result.Shards)))
+	assert.Contains(t, result.Shards["wave_2"], "1", "reserved_ids keys use the prefix")
+	assert.Equal(t, 1, result.ShardBreakdown["wave_2"].Reserved)
+	assert.Equal(t, "wave_", result.Metadata.ShardPrefix)
+
+	// The prefix only renames shards: every ID is placed as without it.
+	viper.Set("shard_prefix", "")
+	viper.Set("reserved_ids", map[string][]string{"shard_2": {"1"}})
+	require.NoError(t, runShard(cmd, []string{}))
+	unprefixed, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	for i := range 3 {
+		assert.Equal(t, unprefixed.Shards[fmt.Sprintf("shard_%d", i)], result.Shards[fmt.Sprintf("wave_%d", i)])
+	}
+	assert.Empty(t, unprefixed.Metadata.ShardPrefix, "The default prefix is left out of the metadata")
+}
+
 func TestRunShard_WithReservationsFromFlag(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
@@ -411,10 +563,12 @@ func TestRunShard_WithReservationsFromFlag(t *testing.T) {
 	assert.Contains(t, result.Shards["shard_1"], "5")
 }
 
-func TestRunShard_InvalidReservedIDsJSON(t *testing.T) {
+func TestRunShard_PerShardSeedsFromFlag(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
 
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
 	viper.Set("instance_domain", server.URL)
 	viper.Set("auth_method", "oauth2")
 	viper.Set("client_id", "test-client")
@@ -422,32 +576,115 @@ func TestRunShard_InvalidReservedIDsJSON(t *testing.T) {
 	viper.Set("source_type", "computer_inventory")
 	viper.Set("strategy", "round-robin")
 	viper.Set("shard_count", 2)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
 
 	cmd := &cobra.Command{}
 	cmd.Flags().String("reserved-ids", "", "")
-	cmd.Flags().Set("reserved-ids", `{invalid json}`)
+	cmd.Flags().String("per-shard-seeds", "", "")
+	cmd.Flags().Set("per-shard-seeds", `{"shard_1":"beta"}`)
 
-	err := runShard(cmd, []string{})
+	require.NoError(t, runShard(cmd, []string{}))
 
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid --reserved-ids JSON")
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	sorted := slices.Clone(result.Shards["shard_0"])
+	sharding.SortIDsNumerically(sorted)
+	assert.Equal(t, sorted, result.Shards["shard_0"], "Unseeded shards stay sorted")
+	sorted = slices.Clone(result.Shards["shard_1"])
+	sharding.SortIDsNumerically(sorted)
+	assert.Equal(t, sharding.DistributionOrder(sorted, "beta"), result.Shards["shard_1"])
+	assert.Equal(t, map[string]string{"shard_1": "beta"}, result.Metadata.PerShardSeeds)
 }
 
-func TestRunShard_ComputerGroupMembership(t *testing.T) {
+func TestRunShard_SampleSize(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("sample_size", 10)
+	viper.Set("sample_seed", "dry-run")
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, 50, result.Metadata.TotalIDsFetched)
+	assert.Equal(t, 10, result.Metadata.SampleSize)
+	assert.Equal(t, "dry-run", result.Metadata.SampleSeed)
+	assert.Equal(t, 0, result.Metadata.ExcludedIDCount, "Unsampled IDs are not counted as excluded")
+	assert.Equal(t, 10, result.Metadata.UnreservedIDsDistributed)
+}
+
+func TestRunShard_RunLog(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	runLogPath := filepath.Join(tmpDir, "run.log")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("exclude_ids", []string{"1", "2"})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", filepath.Join(tmpDir, "output.json"))
+	viper.Set("run_log", runLogPath)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	records := readRunLog(t, runLogPath)
+	phases := make([]string, len(records))
+	counts := make([]int, len(records))
+	for i, record := range records {
+		phases[i], counts[i] = record.Phase, record.Count
+	}
+	assert.Equal(t, []string{"fetch", "exclude", "reserve", "shard", "write", "run"}, phases)
+	assert.Equal(t, []int{50, 48, 0, 48, 48, 48}, counts)
+}
+
+func TestRunShard_WithReservationsFromEnv(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
 
 	tmpDir := t.TempDir()
 	outputFile := filepath.Join(tmpDir, "output.json")
 
+	t.Setenv("JAMF_RESERVED_IDS", `{"shard_1":["7","8"]}`)
+	viper.SetEnvPrefix("JAMF")
+	viper.AutomaticEnv()
+
 	viper.Set("instance_domain", server.URL)
 	viper.Set("auth_method", "oauth2")
 	viper.Set("client_id", "test-client")
 	viper.Set("client_secret", "test-secret")
-	viper.Set("source_type", "computer_group_membership")
-	viper.Set("group_id", "10")
-	viper.Set("strategy", "size")
-	viper.Set("shard_sizes", []int{10, 15})
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
 	viper.Set("output_format", "json")
 	viper.Set("output_file", outputFile)
 
@@ -464,12 +701,46 @@ func TestRunShard_ComputerGroupMembership(t *testing.T) {
 	var result ShardResult
 	err = json.Unmarshal(data, &result)
 	require.NoError(t, err)
-	assert.Equal(t, "computer_group_membership", result.Metadata.SourceType)
-	assert.Equal(t, "10", result.Metadata.GroupID)
-	assert.Equal(t, 25, result.Metadata.TotalIDsFetched)
+	assert.Equal(t, 2, result.Metadata.ReservedIDCount)
+	assert.Contains(t, result.Shards["shard_1"], "7")
+	assert.Contains(t, result.Shards["shard_1"], "8")
 }
 
-func TestRunShard_MobileDeviceGroupMembership(t *testing.T) {
+func TestRunShard_InvalidReservedIDsEnvJSON(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	t.Setenv("JAMF_RESERVED_IDS", `{not json`)
+	viper.SetEnvPrefix("JAMF")
+	viper.AutomaticEnv()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid JAMF_RESERVED_IDS JSON")
+}
+
+// emptyShardExclusions excludes every mock computer except IDs 1 and 2.
+func emptyShardExclusions() []string {
+	var ids []string
+	for i := 3; i <= 50; i++ {
+		ids = append(ids, fmt.Sprintf("%d", i))
+	}
+	return ids
+}
+
+func TestRunShard_MoreShardsThanIDs_EmitsEmptyArrays(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
 
@@ -480,10 +751,10 @@ func TestRunShard_MobileDeviceGroupMembership(t *testing.T) {
 	viper.Set("auth_method", "oauth2")
 	viper.Set("client_id", "test-client")
 	viper.Set("client_secret", "test-secret")
-	viper.Set("source_type", "mobile_device_group_membership")
-	viper.Set("group_id", "20")
+	viper.Set("source_type", "computer_inventory")
 	viper.Set("strategy", "round-robin")
-	viper.Set("shard_count", 3)
+	viper.Set("shard_count", 4)
+	viper.Set("exclude_ids", emptyShardExclusions())
 	viper.Set("output_format", "json")
 	viper.Set("output_file", outputFile)
 
@@ -496,16 +767,16 @@ func TestRunShard_MobileDeviceGroupMembership(t *testing.T) {
 
 	data, err := os.ReadFile(outputFile)
 	require.NoError(t, err)
+	assert.Contains(t, string(data), `"shard_3": []`)
 
 	var result ShardResult
 	err = json.Unmarshal(data, &result)
 	require.NoError(t, err)
-	assert.Equal(t, "mobile_device_group_membership", result.Metadata.SourceType)
-	assert.Equal(t, "20", result.Metadata.GroupID)
-	assert.Equal(t, 15, result.Metadata.TotalIDsFetched)
+	assert.Len(t, result.Shards, 4)
+	assert.Empty(t, result.Shards["shard_2"])
 }
 
-func TestRunShard_ValidationFailure(t *testing.T) {
+func TestRunShard_FailOnEmptyShards(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
 
@@ -514,8 +785,11 @@ func TestRunShard_ValidationFailure(t *testing.T) {
 	viper.Set("client_id", "test-client")
 	viper.Set("client_secret", "test-secret")
 	viper.Set("source_type", "computer_inventory")
-	viper.Set("strategy", "invalid-strategy")
-	viper.Set("shard_count", 3)
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 4)
+	viper.Set("exclude_ids", emptyShardExclusions())
+	viper.Set("fail_on_empty_shards", true)
+	viper.Set("output_format", "json")
 
 	cmd := &cobra.Command{}
 	cmd.Flags().String("reserved-ids", "", "")
@@ -523,10 +797,10 @@ func TestRunShard_ValidationFailure(t *testing.T) {
 	err := runShard(cmd, []string{})
 
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "validation failed")
+	assert.Contains(t, err.Error(), "--fail-on-empty-shards")
 }
 
-func TestRunShard_SizeStrategy(t *testing.T) {
+func TestRunShard_PrintHashOnly(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
 
@@ -537,27 +811,927 @@ func TestRunShard_SizeStrategy(t *testing.T) {
 	viper.Set("auth_method", "oauth2")
 	viper.Set("client_id", "test-client")
 	viper.Set("client_secret", "test-secret")
-	viper.Set("source_type", "user_accounts")
-	viper.Set("strategy", "size")
-	viper.Set("shard_sizes", []int{5, 10, -1})
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "rendezvous")
+	viper.Set("shard_count", 3)
+	viper.Set("seed", "hash-test")
 	viper.Set("output_format", "json")
 	viper.Set("output_file", outputFile)
-	viper.Set("seed", "size-test")
 
 	cmd := &cobra.Command{}
 	cmd.Flags().String("reserved-ids", "", "")
 
-	err := runShard(cmd, []string{})
+	require.NoError(t, runShard(cmd, []string{}))
 
+	data, err := os.ReadFile(outputFile)
 	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	require.NotEmpty(t, result.Metadata.ResultHash)
+
+	require.NoError(t, os.Remove(outputFile))
+	viper.Set("print_hash_only", true)
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err = runShard(cmd, []string{})
+
+	w.Close()
+	os.Stdout = oldStdout
+	printed, _ := io.ReadAll(r)
+	r.Close()
 
-	data, err := os.ReadFile(outputFile)
 	require.NoError(t, err)
+	assert.Equal(t, result.Metadata.ResultHash+"\n", string(printed))
+	assert.NoFileExists(t, outputFile, "print-hash-only should not write the normal output")
+}
 
-	var result ShardResult
-	err = json.Unmarshal(data, &result)
+func TestRunShard_Seeds(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputDir := filepath.Join(t.TempDir(), "seeds")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "rendezvous")
+	viper.Set("shard_count", 3)
+	viper.Set("seeds", []string{"alpha", "beta"})
+	viper.Set("output_format", "json")
+	viper.Set("output_dir", outputDir)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	alpha, err := loadShardResult(filepath.Join(outputDir, "alpha.json"))
 	require.NoError(t, err)
-	assert.Equal(t, "size", result.Metadata.Strategy)
+	beta, err := loadShardResult(filepath.Join(outputDir, "beta.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "alpha", alpha.Metadata.Seed)
+	assert.Equal(t, "beta", beta.Metadata.Seed)
+	assert.Equal(t, 50, alpha.Metadata.TotalIDsFetched)
+	assert.Equal(t, 50, beta.Metadata.TotalIDsFetched)
+	assert.NotEqual(t, alpha.Metadata.ResultHash, beta.Metadata.ResultHash)
+
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "one result file per seed")
+}
+
+func TestRunShard_ReportsMissingReservedIDs(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("reserved_ids", map[string][]string{"shard_0": {"5", "999"}})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, []string{"999"}, result.Metadata.MissingReservedIDs)
+	assert.Equal(t, 1, result.Metadata.ReservedIDCount)
+
+	viper.Set("fail_on_missing_reserved", true)
+	err = runShard(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found in the source pool: 999")
+}
+
+func TestRunShard_ShardBreakdown(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("reserved_ids", map[string][]string{
+		"shard_0": {"1", "2", "3", "4"},
+		"shard_2": {"50"},
+	})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+
+	require.Len(t, result.ShardBreakdown, 3)
+	assert.Equal(t, ShardCounts{Reserved: 4, Distributed: 15}, result.ShardBreakdown["shard_0"])
+	assert.Equal(t, ShardCounts{Reserved: 0, Distributed: 15}, result.ShardBreakdown["shard_1"])
+	assert.Equal(t, ShardCounts{Reserved: 1, Distributed: 15}, result.ShardBreakdown["shard_2"])
+	for name, counts := range result.ShardBreakdown {
+		assert.Len(t, result.Shards[name], counts.Reserved+counts.Distributed)
+	}
+}
+
+func TestRunShard_CombinedSources(t *testing.T) {
+	tests := []struct {
+		name          string
+		sourceType    string
+		groupID       string
+		namespaceIDs  bool
+		wantIDs       int
+		wantBreakdown map[string]int
+		wantContains  []string
+	}{
+		{
+			name:          "computers and mobile devices namespaced",
+			sourceType:    "computer_inventory,mobile_device_inventory",
+			namespaceIDs:  true,
+			wantIDs:       80,
+			wantBreakdown: map[string]int{"computer_inventory": 50, "mobile_device_inventory": 30},
+			wantContains:  []string{"computer:1", "computer:50", "mobile_device:100", "mobile_device:129"},
+		},
+		{
+			name:          "inventory and group of the same type are unioned",
+			sourceType:    "computer_inventory,computer_group_membership",
+			groupID:       "10",
+			wantIDs:       50,
+			wantBreakdown: map[string]int{"computer_inventory": 50, "computer_group_membership": 25},
+			wantContains:  []string{"1", "25", "50"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			outputFile := filepath.Join(t.TempDir(), "output.json")
+
+			viper.Set("instance_domain", server.URL)
+			viper.Set("auth_method", "oauth2")
+			viper.Set("client_id", "test-client")
+			viper.Set("client_secret", "test-secret")
+			viper.Set("source_type", tt.sourceType)
+			viper.Set("group_id", tt.groupID)
+			viper.Set("namespace_ids", tt.namespaceIDs)
+			viper.Set("strategy", "round-robin")
+			viper.Set("shard_count", 4)
+			viper.Set("output_format", "json")
+			viper.Set("output_file", outputFile)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("reserved-ids", "", "")
+
+			require.NoError(t, runShard(cmd, []string{}))
+
+			data, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			var result ShardResult
+			require.NoError(t, json.Unmarshal(data, &result))
+
+			assert.Equal(t, tt.wantIDs, result.Metadata.TotalIDsFetched)
+			assert.Equal(t, tt.wantBreakdown, result.Metadata.SourceBreakdown, "Counted per source before the union")
+			assert.Equal(t, 0, result.Metadata.DuplicatesRemoved, "Overlap between sources is not an API duplicate")
+			var all []string
+			for _, ids := range result.Shards {
+				all = append(all, ids...)
+			}
+			assert.Len(t, all, tt.wantIDs)
+			for _, id := range tt.wantContains {
+				assert.Contains(t, all, id)
+			}
+		})
+	}
+}
+
+func TestRunShard_AllowPartial(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "percentage")
+	viper.Set("shard_percentages", []int{10, 50})
+	viper.Set("allow_partial", true)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+
+	assert.Len(t, result.Shards["shard_0"], 5)
+	assert.Len(t, result.Shards["shard_1"], 25)
+	assert.Equal(t, 30, result.Metadata.UnreservedIDsDistributed)
+	assert.Equal(t, 20, result.Metadata.UndistributedIDCount)
+}
+
+func TestRunShard_RunTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/oauth/token" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+			return
+		}
+		// Hang until the client gives up.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("output_format", "json")
+	viper.Set("run_timeout", "100ms")
+	viper.Set("custom_timeout_seconds", 60)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	start := time.Now()
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run timed out after 100ms (run_timeout) while fetching source IDs")
+	assert.Less(t, time.Since(start), 10*time.Second, "The run should not wait for the per-request timeout")
+}
+
+func TestRunShard_SourceTimeout(t *testing.T) {
+	serve := mobileDeviceDetailHandler(mockMobileDevices(450))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/oauth/token":
+			oauthTokenHandler(w, r)
+		case r.URL.Query().Get("page") == "0":
+			serve(w, r)
+		default:
+			// Hang on every later page until the client gives up.
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "mobile_device_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("output_format", "json")
+	viper.Set("source_timeout", "300ms")
+	viper.Set("run_timeout", "1m")
+	viper.Set("custom_timeout_seconds", 60)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	start := time.Now()
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source fetch timed out after 300ms (source_timeout) with 1 page(s) and 200 record(s) collected")
+	assert.NotContains(t, err.Error(), "run_timeout")
+	assert.Less(t, time.Since(start), 10*time.Second, "The fetch should not wait for the per-request timeout")
+}
+
+func TestRunShard_CheckAuth(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("check_auth", true)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", filepath.Join(t.TempDir(), "output.json"))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+}
+
+// checkAuthTestServer serves a valid token, answers the auth check with
+// checkStatus, and counts requests for computer inventory.
+func checkAuthTestServer(t *testing.T, tokenStatus, checkStatus int, inventoryRequests *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/oauth/token":
+			if tokenStatus != http.StatusOK {
+				w.WriteHeader(tokenStatus)
+				return
+			}
+			oauthTokenHandler(w, r)
+		case "/api/v1/jamf-pro-version":
+			w.WriteHeader(checkStatus)
+		default:
+			*inventoryRequests++
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("check_auth", true)
+	viper.Set("output_format", "json")
+	viper.Set("custom_timeout_seconds", 60)
+	viper.Set("max_retry_attempts", 0)
+	return server
+}
+
+func TestRunShard_CheckAuthRejected(t *testing.T) {
+	var inventoryRequests int
+	checkAuthTestServer(t, http.StatusOK, http.StatusUnauthorized, &inventoryRequests)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication failed")
+	assert.Contains(t, err.Error(), "check client_id and client_secret")
+	assert.Zero(t, inventoryRequests, "No records are fetched once the check fails")
+}
+
+func TestRunShard_TokenRejected(t *testing.T) {
+	var inventoryRequests int
+	checkAuthTestServer(t, http.StatusUnauthorized, http.StatusOK, &inventoryRequests)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication failed")
+	assert.Zero(t, inventoryRequests)
+}
+
+func TestRunShard_ShardLabels(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("shard_labels", map[string]any{
+		"shard_1": map[string]any{"owner": "desktop", "maintenance_window": "sat 02:00"},
+	})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"shard_1": {"owner": "desktop", "maintenance_window": "sat 02:00"},
+	}, result.Labels)
+	assert.Len(t, result.Shards["shard_1"], 25, "Labels do not affect distribution")
+}
+
+func TestRunShard_RetryAfter(t *testing.T) {
+	var inventoryRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/oauth/token":
+			oauthTokenHandler(w, r)
+		case "/api/v3/computers-inventory":
+			inventoryRequests++
+			if inventoryRequests == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": 2,
+				"results": []map[string]any{
+					{"id": "1", "general": map[string]any{"remoteManagement": map[string]any{"managed": true}}},
+					{"id": "2", "general": map[string]any{"remoteManagement": map[string]any{"managed": true}}},
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	viper.Reset()
+	defer viper.Reset()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("max_retry_attempts", 1)
+	viper.Set("custom_timeout_seconds", 60)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	// The HTTP client under the SDK retries the 429 after the Retry-After.
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inventoryRequests)
+	assert.Equal(t, 2, result.Metadata.TotalIDsFetched)
+	assert.GreaterOrEqual(t, result.Metadata.RateLimitWaitsMs, int64(1000))
+}
+
+func TestRunShard_SiteID(t *testing.T) {
+	tests := []struct {
+		name       string
+		sourceType string
+		groupID    string
+		siteID     string
+		wantIDs    int
+	}{
+		{name: "inventory", sourceType: "computer_inventory", siteID: "2", wantIDs: 30},
+		{name: "group members checked against site inventory", sourceType: "computer_group_membership", groupID: "10", siteID: "1", wantIDs: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup := setupIntegrationTest(t)
+			defer cleanup()
+
+			outputFile := filepath.Join(t.TempDir(), "output.json")
+
+			viper.Set("instance_domain", server.URL)
+			viper.Set("auth_method", "oauth2")
+			viper.Set("client_id", "test-client")
+			viper.Set("client_secret", "test-secret")
+			viper.Set("source_type", tt.sourceType)
+			viper.Set("group_id", tt.groupID)
+			viper.Set("site_id", tt.siteID)
+			viper.Set("strategy", "round-robin")
+			viper.Set("shard_count", 2)
+			viper.Set("output_format", "json")
+			viper.Set("output_file", outputFile)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("reserved-ids", "", "")
+
+			require.NoError(t, runShard(cmd, []string{}))
+
+			data, err := os.ReadFile(outputFile)
+			require.NoError(t, err)
+			var result ShardResult
+			require.NoError(t, json.Unmarshal(data, &result))
+
+			assert.Equal(t, tt.siteID, result.Metadata.SiteID)
+			assert.Equal(t, tt.wantIDs, result.Metadata.TotalIDsFetched)
+		})
+	}
+}
+
+func TestRunShard_ReservedIDsFile(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	reservedFile := filepath.Join(tmpDir, "reserved.yaml")
+	outputFile := filepath.Join(tmpDir, "output.json")
+	require.NoError(t, os.WriteFile(reservedFile, []byte("shard_2:\n  - \"10\"\n  - \"11\"\n"), 0o644))
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("reserved_ids_file", reservedFile)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	require.NoError(t, cmd.Flags().Set("reserved-ids", `{"shard_0":["1"]}`))
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Contains(t, result.Shards["shard_0"], "1")
+	assert.Contains(t, result.Shards["shard_2"], "10")
+	assert.Contains(t, result.Shards["shard_2"], "11")
+	assert.Equal(t, 3, result.Metadata.ReservedIDCount)
+
+	// File contents go through the same validation as inline reservations.
+	require.NoError(t, os.WriteFile(reservedFile, []byte(`{"shard_1":["abc"]}`), 0o644))
+	err = runShard(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"abc"`)
+
+	// The same shard may not be reserved in both places.
+	require.NoError(t, os.WriteFile(reservedFile, []byte(`{"shard_0":["2"]}`), 0o644))
+	err = runShard(cmd, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reserved both inline and in --reserved-ids-file")
+}
+
+func TestRunShard_JSONDetailedTagsUnmanaged(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "101", Managed: true},
+			{ID: "102", Managed: false},
+			{ID: "103", Managed: true},
+		}),
+	}
+	server, _ := setupMockServer(t, handlers)
+	t.Cleanup(viper.Reset)
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "mobile_device_inventory")
+	viper.Set("include_unmanaged", true)
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 1)
+	viper.Set("output_format", "json-detailed")
+	viper.Set("output_file", outputFile)
+	viper.Set("custom_timeout_seconds", 60)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result DetailedShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, []ShardEntry{
+		{ID: "101", Managed: true},
+		{ID: "102", Managed: false},
+		{ID: "103", Managed: true},
+	}, result.Shards["shard_0"])
+}
+
+func TestRunShard_IncludeNames(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("output_format", "json-detailed")
+	viper.Set("include_names", true)
+	viper.Set("output_file", outputFile)
+	viper.Set("custom_timeout_seconds", 60)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result DetailedShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	total := 0
+	for _, entries := range result.Shards {
+		for _, entry := range entries {
+			assert.Equal(t, "Computer"+entry.ID, entry.Name)
+			total++
+		}
+	}
+	assert.Equal(t, 50, total)
+}
+
+func TestRunShard_SeedFileRecordedInMetadata(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	seedFile := filepath.Join(tmpDir, "seed.txt")
+	require.NoError(t, os.WriteFile(seedFile, []byte("team-seed\n"), 0o600))
+
+	run := func(outputFile string, setSeed func()) ShardResult {
+		viper.Set("instance_domain", server.URL)
+		viper.Set("auth_method", "oauth2")
+		viper.Set("client_id", "test-client")
+		viper.Set("client_secret", "test-secret")
+		viper.Set("source_type", "computer_inventory")
+		viper.Set("strategy", "round-robin")
+		viper.Set("shard_count", 3)
+		viper.Set("output_format", "json")
+		viper.Set("output_file", outputFile)
+		viper.Set("custom_timeout_seconds", 60)
+		setSeed()
+
+		cmd := &cobra.Command{}
+		cmd.Flags().String("reserved-ids", "", "")
+		require.NoError(t, runShard(cmd, []string{}))
+
+		data, err := os.ReadFile(outputFile)
+		require.NoError(t, err)
+		var result ShardResult
+		require.NoError(t, json.Unmarshal(data, &result))
+		return result
+	}
+
+	fromFile := run(filepath.Join(tmpDir, "file.json"), func() { viper.Set("seed_file", seedFile) })
+	viper.Reset()
+	fromFlag := run(filepath.Join(tmpDir, "flag.json"), func() { viper.Set("seed", "team-seed") })
+
+	assert.Equal(t, "team-seed", fromFile.Metadata.Seed)
+	assert.Equal(t, fromFlag.Shards, fromFile.Shards, "A seed file should shard exactly like the same --seed")
+}
+
+func TestRunShard_ExcludeFromResult(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	priorFile := filepath.Join(tmpDir, "wave1.json")
+	outputFile := filepath.Join(tmpDir, "wave2.json")
+
+	prior := ShardResult{Shards: map[string][]string{
+		"shard_0": {"1", "2", "3"},
+		"shard_1": {"4", "5"},
+	}}
+	data, err := json.Marshal(prior)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(priorFile, data, 0o644))
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("exclude_ids", []string{"50"})
+	viper.Set("exclude_from_result", priorFile)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err = os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, 6, result.Metadata.ExcludedIDCount)
+	for _, shard := range result.Shards {
+		for _, id := range []string{"1", "2", "3", "4", "5", "50"} {
+			assert.NotContains(t, shard, id)
+		}
+	}
+}
+
+func TestRunShard_InvalidReservedIDsJSON(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	cmd.Flags().Set("reserved-ids", `{invalid json}`)
+
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --reserved-ids JSON")
+}
+
+func TestRunShard_ComputerGroupMembership(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_group_membership")
+	viper.Set("group_id", "10")
+	viper.Set("strategy", "size")
+	viper.Set("shard_sizes", []int{10, 15})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var result ShardResult
+	err = json.Unmarshal(data, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "computer_group_membership", result.Metadata.SourceType)
+	assert.Equal(t, "10", result.Metadata.GroupID)
+	assert.Equal(t, 25, result.Metadata.TotalIDsFetched)
+}
+
+func TestRunShard_MobileDeviceGroupMembership(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "mobile_device_group_membership")
+	viper.Set("group_id", "20")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var result ShardResult
+	err = json.Unmarshal(data, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "mobile_device_group_membership", result.Metadata.SourceType)
+	assert.Equal(t, "20", result.Metadata.GroupID)
+	assert.Equal(t, 15, result.Metadata.TotalIDsFetched)
+}
+
+func TestRunShard_ValidationFailure(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "invalid-strategy")
+	viper.Set("shard_count", 3)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "validation failed")
+}
+
+func TestRunShard_SizeStrategy(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "user_accounts")
+	viper.Set("strategy", "size")
+	viper.Set("shard_sizes", []int{5, 10, -1})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+	viper.Set("seed", "size-test")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var result ShardResult
+	err = json.Unmarshal(data, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "size", result.Metadata.Strategy)
 	assert.Equal(t, 20, result.Metadata.TotalIDsFetched)
 	assert.Len(t, result.Shards, 3)
 	assert.Equal(t, 5, len(result.Shards["shard_0"]))
@@ -565,6 +1739,109 @@ func TestRunShard_SizeStrategy(t *testing.T) {
 	assert.Equal(t, 5, len(result.Shards["shard_2"]))
 }
 
+func TestRunShard_SizeStrategyAutoShards(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "size")
+	viper.Set("shard_sizes", []int{20})
+	viper.Set("auto_shards", true)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, 3, result.Metadata.ShardCount)
+	assert.Len(t, result.Shards["shard_0"], 20)
+	assert.Len(t, result.Shards["shard_1"], 20)
+	assert.Len(t, result.Shards["shard_2"], 10, "The last shard holds the remainder")
+}
+
+func TestRunShard_ExplainIDs(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "hash-ring")
+	viper.Set("shard_count", 3)
+	viper.Set("virtual_nodes", 20)
+	viper.Set("explain", true)
+	viper.Set("explain_ids", []string{"7", "42"})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	require.Len(t, result.Placements, 2)
+	for _, id := range []string{"7", "42"} {
+		p := result.Placements[id]
+		assert.Contains(t, result.Shards[p.Shard], id)
+		require.NotNil(t, p.RingHash)
+		require.NotNil(t, p.RingPoint)
+	}
+}
+
+func TestRunShard_WarningsInOutput(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+	setOutputMode(t, true, false)
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "percentage")
+	viper.Set("shard_percentages", []int{10, 20})
+	viper.Set("allow_partial", true)
+	viper.Set("reserved_ids", map[string][]string{"shard_0": {"9999"}})
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var result ShardResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, []string{
+		"1 reserved ID(s) not found in the source pool: 9999",
+		"35 ID(s) were left out of every shard (see undistributed_id_count)",
+	}, result.Warnings)
+}
+
 func TestRunShard_ComplexWorkflow(t *testing.T) {
 	server, cleanup := setupIntegrationTest(t)
 	defer cleanup()
@@ -0,0 +1,373 @@
+package cmd
+
+// merge.go implements the `merge` command: combine result files from
+// separate shard runs, such as one for computers and one for mobile devices,
+// into a single result with one set of shard keys.
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <result-file> <result-file>...",
+	Short: "Combine shard result files into one",
+	Long: `Reads two or more result files written by shard and combines them: shard_0
+of every file becomes shard_0 of the merged result, and so on. An ID found in
+the same shard of several files is kept once; an ID found in different shards
+is an error. Metadata counts are summed, holdback cohorts are combined, and
+the input files are recorded in metadata.merged_from.
+
+Results from different object types can only be merged when their IDs are
+namespaced (shard --namespace-ids), since computer 101 and mobile device 101
+would otherwise be indistinguishable.
+
+Every file must have the same number of shards unless --pad-shorter is set,
+in which case the shards missing from the shorter results are left empty.
+Files written with a size-based --shard-order are matched on each shard's
+original index and the merged result is renumbered by size the same way;
+files with different shard orders cannot be merged.
+
+Examples:
+  go-jamf-guid-sharder merge computers.json mobile-devices.json
+
+  go-jamf-guid-sharder merge wave1-*.json --pad-shorter \
+    --output yaml --output-file merged.yaml`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runMerge,
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringP("output", "o", "json", "Output format: json, yaml, or ndjson")
+	mergeCmd.Flags().String("output-file", "", "Write output to this file path instead of stdout")
+	mergeCmd.Flags().Bool("pad-shorter", false, "Merge results with different shard counts, leaving missing shards empty")
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	outputFile, _ := cmd.Flags().GetString("output-file")
+	padShorter, _ := cmd.Flags().GetBool("pad-shorter")
+
+	validFormats := []string{"json", "yaml", "ndjson"}
+	if !slices.Contains(validFormats, output) {
+		return fmt.Errorf("invalid --output %q: must be one of %s", output, quotedList(validFormats))
+	}
+
+	results := make([]*ShardResult, len(args))
+	for i, path := range args {
+		result, err := loadShardResult(path)
+		if err != nil {
+			return err
+		}
+		results[i] = result
+	}
+
+	merged, err := mergeShardResults(args, results, padShorter)
+	if err != nil {
+		return err
+	}
+	return writeOutput(context.Background(), &shardConfig{OutputFormat: output, OutputFile: outputFile}, merged)
+}
+
+// mergeShardResults combines results, read from paths, shard by shard.
+// Fields describing how each run was made (strategy, seed, group, site) are
+// kept when every result agrees and left empty otherwise; source types are
+// listed once each, and counts are summed.
+func mergeShardResults(paths []string, results []*ShardResult, padShorter bool) (*ShardResult, error) {
+	shardCount := 0
+	for _, result := range results {
+		shardCount = max(shardCount, len(result.Shards))
+	}
+	if !padShorter {
+		for i, result := range results {
+			if len(result.Shards) != shardCount {
+				return nil, fmt.Errorf("%s has %d shard(s) but %s has %d — pass --pad-shorter to merge them "+
+					"with the missing shards left empty", paths[i], len(result.Shards), longestPath(paths, results), shardCount)
+			}
+		}
+	}
+	if err := checkMergeNamespaces(paths, results); err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if prefix := result.Metadata.ShardPrefix; prefix != results[0].Metadata.ShardPrefix {
+			return nil, fmt.Errorf("%s names its shards %s, … but %s names them %s, … — results with different "+
+				"shard_prefix values cannot be merged", paths[i], shardName(prefix, 0), paths[0],
+				shardName(results[0].Metadata.ShardPrefix, 0))
+		}
+	}
+	// Results renumbered by shard_order are merged in the strategy's
+	// numbering, so shard_0 of each file is the same strategy shard, and the
+	// merged result is renumbered the same way.
+	order := results[0].Metadata.ShardOrder
+	for i, result := range results {
+		if result.Metadata.ShardOrder != order {
+			return nil, fmt.Errorf("%s numbers its shards by shard_order %s but %s by %s — results with different "+
+				"shard_order values cannot be merged", paths[i], cmp.Or(result.Metadata.ShardOrder, "index"),
+				paths[0], cmp.Or(order, "index"))
+		}
+	}
+	if order != "" {
+		results = slices.Clone(results)
+		for i, result := range results {
+			restored, err := restoreStrategyNumbering(paths[i], result)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = restored
+		}
+	}
+
+	merged := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt: time.Now().UTC(),
+			MergedFrom:  paths,
+		},
+		Shards: make(map[string][]string, shardCount),
+	}
+	// placedIn records the shard and file each ID was first found in, so an
+	// ID placed differently by two runs can be reported.
+	type placement struct{ shard, path string }
+	placedIn := make(map[string]placement)
+	for i, result := range results {
+		for _, name := range sortedShardNames(result.Shards) {
+			for _, id := range result.Shards[name] {
+				if prev, ok := placedIn[id]; ok {
+					if prev.shard != name {
+						return nil, fmt.Errorf("ID %s is in %s of %s but %s of %s — results that place an ID "+
+							"differently cannot be merged", id, prev.shard, prev.path, name, paths[i])
+					}
+					continue
+				}
+				placedIn[id] = placement{shard: name, path: paths[i]}
+				merged.Shards[name] = append(merged.Shards[name], id)
+			}
+		}
+
+		for name, counts := range result.ShardBreakdown {
+			if merged.ShardBreakdown == nil {
+				merged.ShardBreakdown = make(map[string]ShardCounts)
+			}
+			sum := merged.ShardBreakdown[name]
+			sum.Reserved += counts.Reserved
+			sum.Distributed += counts.Distributed
+			merged.ShardBreakdown[name] = sum
+		}
+		mergeLabels(merged, result.Labels)
+		for _, warning := range result.Warnings {
+			merged.Warnings = append(merged.Warnings, paths[i]+": "+warning)
+		}
+		mergeMetadata(&merged.Metadata, &result.Metadata, i == 0)
+	}
+
+	// Padded shards are emitted as [] rather than left out.
+	for i := range shardCount {
+		name := shardName(merged.Metadata.ShardPrefix, i)
+		if merged.Shards[name] == nil {
+			merged.Shards[name] = []string{}
+		}
+	}
+	for _, ids := range merged.Shards {
+		sharding.SortIDsNumerically(ids)
+	}
+	sharding.SortIDsNumerically(merged.Metadata.MissingReservedIDs)
+	if merged.Metadata.Holdback != nil {
+		sharding.SortIDsNumerically(merged.Metadata.Holdback.IDs)
+	}
+	// As for a single run, the breakdown is only kept for combined sources.
+	if len(merged.Metadata.SourceBreakdown) < 2 {
+		merged.Metadata.SourceBreakdown = nil
+	}
+	merged.Metadata.ShardCount = len(merged.Shards)
+	merged.Metadata.ResultHash = computeResultHash(merged.Shards)
+	applyShardOrder(merged, order)
+	return merged, nil
+}
+
+// restoreStrategyNumbering returns a copy of result, read from path, with
+// the shard_order renumbering undone: each shard takes back the name of the
+// original_index its shard_breakdown entry records. result is not modified.
+func restoreStrategyNumbering(path string, result *ShardResult) (*ShardResult, error) {
+	prefix := result.Metadata.ShardPrefix
+	renames := make(map[string]string, len(result.Shards))
+	for name := range result.Shards {
+		counts, ok := result.ShardBreakdown[name]
+		if !ok || counts.OriginalIndex == nil {
+			return nil, fmt.Errorf("%s was written with shard_order %s but has no shard_breakdown original_index "+
+				"for %s, so its shards cannot be matched to the other results", path, result.Metadata.ShardOrder, name)
+		}
+		renames[name] = shardName(prefix, *counts.OriginalIndex)
+	}
+	restored := *result
+	renameShards(&restored, renames)
+	for name, counts := range restored.ShardBreakdown {
+		counts.OriginalIndex = nil
+		restored.ShardBreakdown[name] = counts
+	}
+	restored.Metadata.ShardOrder = ""
+	return &restored, nil
+}
+
+// mergeLabels adds labels to merged's shard labels. A label already set by
+// an earlier result keeps its value.
+func mergeLabels(merged *ShardResult, labels map[string]map[string]string) {
+	for name, shardLabels := range labels {
+		if merged.Labels == nil {
+			merged.Labels = make(map[string]map[string]string)
+		}
+		if merged.Labels[name] == nil {
+			merged.Labels[name] = make(map[string]string, len(shardLabels))
+		}
+		for key, value := range shardLabels {
+			if _, ok := merged.Labels[name][key]; !ok {
+				merged.Labels[name][key] = value
+			}
+		}
+	}
+}
+
+// mergeMetadata folds one result's metadata into the merged metadata. first
+// marks the first result, whose descriptive fields seed the comparison.
+func mergeMetadata(merged, from *ShardMetadata, first bool) {
+	if first {
+		merged.GroupID = from.GroupID
+		merged.PrestageID = from.PrestageID
+		merged.RawPath = from.RawPath
+		merged.ShardPrefix = from.ShardPrefix
+		merged.SiteID = from.SiteID
+		merged.Strategy = from.Strategy
+		merged.Seed = from.Seed
+		merged.SeedSalt = from.SeedSalt
+		merged.SampleSeed = from.SampleSeed
+	}
+	keepIfEqual := func(field *string, value string) {
+		if *field != value {
+			*field = ""
+		}
+	}
+	keepIfEqual(&merged.GroupID, from.GroupID)
+	keepIfEqual(&merged.PrestageID, from.PrestageID)
+	keepIfEqual(&merged.RawPath, from.RawPath)
+	keepIfEqual(&merged.SiteID, from.SiteID)
+	keepIfEqual(&merged.Strategy, from.Strategy)
+	keepIfEqual(&merged.Seed, from.Seed)
+	keepIfEqual(&merged.SeedSalt, from.SeedSalt)
+	keepIfEqual(&merged.SampleSeed, from.SampleSeed)
+
+	sources := sourceTypes(merged.SourceType)
+	for _, source := range sourceTypes(from.SourceType) {
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	merged.SourceType = strings.Join(sources, ",")
+
+	merged.TotalIDsFetched += from.TotalIDsFetched
+	// A merged result is a sample when any input is, so drift still refuses
+	// it.
+	merged.SampleSize += from.SampleSize
+	// An input fetched from a single source contributed its whole total to
+	// that source.
+	breakdown := from.SourceBreakdown
+	if breakdown == nil && from.SourceType != "" && len(sourceTypes(from.SourceType)) == 1 {
+		breakdown = map[string]int{from.SourceType: from.TotalIDsFetched}
+	}
+	for source, count := range breakdown {
+		if merged.SourceBreakdown == nil {
+			merged.SourceBreakdown = make(map[string]int)
+		}
+		merged.SourceBreakdown[source] += count
+	}
+	merged.DuplicatesRemoved += from.DuplicatesRemoved
+	merged.ExcludedIDCount += from.ExcludedIDCount
+	merged.ExcludedByPatternCount += from.ExcludedByPatternCount
+	merged.ReservedIDCount += from.ReservedIDCount
+	merged.UnreservedIDsDistributed += from.UnreservedIDsDistributed
+	merged.UndistributedIDCount += from.UndistributedIDCount
+	merged.RateLimitWaitsMs += from.RateLimitWaitsMs
+	// A merged result is only as fresh as its oldest input.
+	if from.ExpiresAt != nil && (merged.ExpiresAt == nil || from.ExpiresAt.Before(*merged.ExpiresAt)) {
+		merged.ExpiresAt = from.ExpiresAt
+	}
+	for _, name := range from.RebalancedShards {
+		if !slices.Contains(merged.RebalancedShards, name) {
+			merged.RebalancedShards = append(merged.RebalancedShards, name)
+		}
+	}
+	for _, id := range from.MissingReservedIDs {
+		if !slices.Contains(merged.MissingReservedIDs, id) {
+			merged.MissingReservedIDs = append(merged.MissingReservedIDs, id)
+		}
+	}
+	if from.Holdback != nil {
+		mergeHoldback(merged, from.Holdback)
+	}
+}
+
+// mergeHoldback adds holdback's cohort to merged's, so the held-back IDs of
+// every input stay part of the merged pool. The percentage and seed are kept
+// when every input with a holdback agrees and cleared otherwise; the count
+// is that of the union, the sum of the inputs' counts when they are disjoint.
+func mergeHoldback(merged *ShardMetadata, holdback *HoldbackSummary) {
+	if merged.Holdback == nil {
+		merged.Holdback = &HoldbackSummary{Percentage: holdback.Percentage, Seed: holdback.Seed, IDs: []string{}}
+	}
+	if merged.Holdback.Percentage != holdback.Percentage {
+		merged.Holdback.Percentage = 0
+	}
+	if merged.Holdback.Seed != holdback.Seed {
+		merged.Holdback.Seed = ""
+	}
+	for _, id := range holdback.IDs {
+		if !slices.Contains(merged.Holdback.IDs, id) {
+			merged.Holdback.IDs = append(merged.Holdback.IDs, id)
+		}
+	}
+	merged.Holdback.IDCount = len(merged.Holdback.IDs)
+}
+
+// checkMergeNamespaces rejects merging results of different object types
+// unless every ID is namespaced, since plain IDs are numbered independently
+// per type and would collide.
+func checkMergeNamespaces(paths []string, results []*ShardResult) error {
+	namespaces := make(map[string]bool)
+	for _, result := range results {
+		for _, source := range sourceTypes(result.Metadata.SourceType) {
+			if ns, ok := idNamespaces[source]; ok {
+				namespaces[ns] = true
+			}
+		}
+	}
+	if len(namespaces) < 2 {
+		return nil
+	}
+	for i, result := range results {
+		for _, id := range resultIDs(result) {
+			if !namespacedIDRe.MatchString(id) {
+				return fmt.Errorf("the result files combine different object types whose IDs can collide, "+
+					"but %s holds the plain ID %s — rerun each shard with --namespace-ids", paths[i], id)
+			}
+		}
+	}
+	return nil
+}
+
+// longestPath returns the path of the result with the most shards.
+func longestPath(paths []string, results []*ShardResult) string {
+	longest := 0
+	for i, result := range results {
+		if len(result.Shards) > len(results[longest].Shards) {
+			longest = i
+		}
+	}
+	return paths[longest]
+}
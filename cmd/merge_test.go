@@ -0,0 +1,287 @@
+package cmd
+
+// merge_test.go contains tests for the `merge` command in merge.go.
+//
+//   TestMergeShardResults_*  — shard union, metadata, and merge conflicts
+//   TestRunMerge_*           — end-to-end through result files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeShardResults_UnionAndSums(t *testing.T) {
+	computers := &ShardResult{
+		Metadata: ShardMetadata{
+			SourceType: "computer_inventory", Strategy: "round-robin", Seed: "wave-1",
+			TotalIDsFetched: 4, ExcludedIDCount: 1, UnreservedIDsDistributed: 3,
+		},
+		Shards:   map[string][]string{"shard_0": {"computer:3", "computer:1"}, "shard_1": {"computer:2"}},
+		Warnings: []string{"shard_1 is small"},
+	}
+	devices := &ShardResult{
+		Metadata: ShardMetadata{
+			SourceType: "mobile_device_inventory", Strategy: "round-robin", Seed: "wave-2",
+			TotalIDsFetched: 2, UnreservedIDsDistributed: 2,
+		},
+		Shards: map[string][]string{"shard_0": {"mobile_device:1"}, "shard_1": {"mobile_device:2"}},
+	}
+
+	merged, err := mergeShardResults([]string{"computers.json", "devices.json"}, []*ShardResult{computers, devices}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"shard_0": {"computer:1", "computer:3", "mobile_device:1"},
+		"shard_1": {"computer:2", "mobile_device:2"},
+	}, merged.Shards)
+	assert.Equal(t, "computer_inventory,mobile_device_inventory", merged.Metadata.SourceType)
+	assert.Equal(t, "round-robin", merged.Metadata.Strategy, "Agreeing fields are kept")
+	assert.Empty(t, merged.Metadata.Seed, "Differing fields are left empty")
+	assert.Equal(t, 6, merged.Metadata.TotalIDsFetched)
+	assert.Equal(t, map[string]int{"computer_inventory": 4, "mobile_device_inventory": 2}, merged.Metadata.SourceBreakdown)
+	assert.Equal(t, 1, merged.Metadata.ExcludedIDCount)
+	assert.Equal(t, 5, merged.Metadata.UnreservedIDsDistributed)
+	assert.Equal(t, 2, merged.Metadata.ShardCount)
+	assert.Equal(t, []string{"computers.json", "devices.json"}, merged.Metadata.MergedFrom)
+	assert.Equal(t, []string{"computers.json: shard_1 is small"}, merged.Warnings)
+	assert.Equal(t, computeResultHash(merged.Shards), merged.Metadata.ResultHash)
+}
+
+func TestMergeShardResults_SameShardDeduped(t *testing.T) {
+	a := &ShardResult{Shards: map[string][]string{"shard_0": {"1", "2"}}}
+	b := &ShardResult{Shards: map[string][]string{"shard_0": {"2", "3"}}}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, merged.Shards["shard_0"])
+}
+
+func TestMergeShardResults_SourceBreakdown(t *testing.T) {
+	combined := &ShardResult{
+		Metadata: ShardMetadata{
+			SourceType: "computer_inventory,computer_group_membership", TotalIDsFetched: 3,
+			SourceBreakdown: map[string]int{"computer_inventory": 3, "computer_group_membership": 2},
+		},
+		Shards: map[string][]string{"shard_0": {"1", "2", "3"}},
+	}
+	computers := &ShardResult{
+		Metadata: ShardMetadata{SourceType: "computer_inventory", TotalIDsFetched: 2},
+		Shards:   map[string][]string{"shard_0": {"4", "5"}},
+	}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{combined, computers}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"computer_inventory": 5, "computer_group_membership": 2}, merged.Metadata.SourceBreakdown)
+
+	merged, err = mergeShardResults([]string{"b.json", "c.json"}, []*ShardResult{computers, computers}, false)
+
+	require.NoError(t, err)
+	assert.Nil(t, merged.Metadata.SourceBreakdown, "A single source has no breakdown")
+}
+
+func TestMergeShardResults_Labels(t *testing.T) {
+	a := &ShardResult{
+		Shards: map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}},
+		Labels: map[string]map[string]string{"shard_0": {"owner": "it-ops", "window": "sat 02:00"}},
+	}
+	b := &ShardResult{
+		Shards: map[string][]string{"shard_0": {"3"}, "shard_1": {"4"}},
+		Labels: map[string]map[string]string{
+			"shard_0": {"owner": "desktop", "ticket": "CHG-42"},
+			"shard_1": {"owner": "desktop"},
+		},
+	}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"shard_0": {"owner": "it-ops", "window": "sat 02:00", "ticket": "CHG-42"},
+		"shard_1": {"owner": "desktop"},
+	}, merged.Labels, "The first result's value wins for a label set twice")
+}
+
+func TestMergeShardResults_EarliestExpiry(t *testing.T) {
+	early := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(24 * time.Hour)
+	a := &ShardResult{Metadata: ShardMetadata{ExpiresAt: &late}, Shards: map[string][]string{"shard_0": {"1"}}}
+	b := &ShardResult{Metadata: ShardMetadata{ExpiresAt: &early}, Shards: map[string][]string{"shard_0": {"2"}}}
+	c := &ShardResult{Shards: map[string][]string{"shard_0": {"3"}}}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json", "c.json"}, []*ShardResult{a, b, c}, false)
+
+	require.NoError(t, err)
+	require.NotNil(t, merged.Metadata.ExpiresAt)
+	assert.Equal(t, early, *merged.Metadata.ExpiresAt)
+}
+
+func TestMergeShardResults_HoldbackAndSample(t *testing.T) {
+	first := &ShardResult{
+		Metadata: ShardMetadata{Holdback: &HoldbackSummary{Percentage: 20, Seed: "hold", IDCount: 2, IDs: []string{"10", "4"}}},
+		Shards:   map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}},
+	}
+	second := &ShardResult{
+		Metadata: ShardMetadata{SampleSize: 2, Holdback: &HoldbackSummary{Percentage: 10, Seed: "hold", IDCount: 1, IDs: []string{"7"}}},
+		Shards:   map[string][]string{"shard_0": {"5"}, "shard_1": {"6"}},
+	}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{first, second}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, &HoldbackSummary{Seed: "hold", IDCount: 3, IDs: []string{"4", "7", "10"}}, merged.Metadata.Holdback,
+		"The cohorts are combined; differing percentages are cleared")
+	assert.Equal(t, 2, merged.Metadata.SampleSize, "A sampled input keeps the merged result a sample")
+}
+
+func TestMergeShardResults_ShardOrder(t *testing.T) {
+	ordered := func(shards map[string][]string) *ShardResult {
+		result := &ShardResult{Shards: shards, ShardBreakdown: make(map[string]ShardCounts)}
+		for name, ids := range shards {
+			result.ShardBreakdown[name] = ShardCounts{Distributed: len(ids)}
+		}
+		applyShardOrder(result, "size-desc")
+		return result
+	}
+	first := ordered(map[string][]string{"shard_0": {"1", "2", "3", "9"}, "shard_1": {"4"}})
+	second := ordered(map[string][]string{"shard_0": {"5"}, "shard_1": {"6", "7", "8"}})
+	require.Equal(t, []string{"6", "7", "8"}, second.Shards["shard_0"], "The second file's shard_0 is its strategy shard_1")
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{first, second}, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"shard_0": {"1", "2", "3", "5", "9"}, "shard_1": {"4", "6", "7", "8"}}, merged.Shards,
+		"Shards are matched on their original index")
+	assert.Equal(t, "size-desc", merged.Metadata.ShardOrder)
+	require.NotNil(t, merged.ShardBreakdown["shard_1"].OriginalIndex)
+	assert.Equal(t, 1, *merged.ShardBreakdown["shard_1"].OriginalIndex)
+	assert.Equal(t, computeResultHash(merged.Shards), merged.Metadata.ResultHash)
+	assert.Equal(t, []string{"6", "7", "8"}, second.Shards["shard_0"], "The inputs are left alone")
+}
+
+func TestMergeShardResults_ShardOrderMismatch(t *testing.T) {
+	first := &ShardResult{Metadata: ShardMetadata{ShardOrder: "size-desc"}, Shards: map[string][]string{"shard_0": {"1"}}}
+	second := &ShardResult{Shards: map[string][]string{"shard_0": {"2"}}}
+
+	_, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{first, second}, false)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.json numbers its shards by shard_order index but a.json by size-desc")
+}
+
+func TestMergeShardResults_DifferentShardsConflict(t *testing.T) {
+	a := &ShardResult{Shards: map[string][]string{"shard_0": {"1"}, "shard_1": {}}}
+	b := &ShardResult{Shards: map[string][]string{"shard_0": {}, "shard_1": {"1"}}}
+
+	_, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, false)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ID 1 is in shard_0 of a.json but shard_1 of b.json")
+}
+
+func TestMergeShardResults_ShardCountMismatch(t *testing.T) {
+	a := &ShardResult{Shards: map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}, "shard_2": {"3"}}}
+	b := &ShardResult{Shards: map[string][]string{"shard_0": {"4"}}}
+
+	_, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.json has 1 shard(s) but a.json has 3")
+	assert.Contains(t, err.Error(), "--pad-shorter")
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, true)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"shard_0": {"1", "4"}, "shard_1": {"2"}, "shard_2": {"3"}}, merged.Shards)
+}
+
+func TestMergeShardResults_PadsMissingShardsEmpty(t *testing.T) {
+	a := &ShardResult{Shards: map[string][]string{"shard_0": {"1"}, "shard_1": {}}}
+	b := &ShardResult{Shards: map[string][]string{"shard_0": {"2"}}}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, true)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, merged.Shards["shard_1"], "Empty shards stay [] rather than null")
+}
+
+func TestMergeShardResults_ShardPrefix(t *testing.T) {
+	a := &ShardResult{Metadata: ShardMetadata{ShardPrefix: "wave_"}, Shards: map[string][]string{"wave_0": {"1"}, "wave_1": {}}}
+	b := &ShardResult{Metadata: ShardMetadata{ShardPrefix: "wave_"}, Shards: map[string][]string{"wave_0": {"2"}}}
+
+	merged, err := mergeShardResults([]string{"a.json", "b.json"}, []*ShardResult{a, b}, true)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"wave_0": {"1", "2"}, "wave_1": {}}, merged.Shards)
+	assert.Equal(t, "wave_", merged.Metadata.ShardPrefix)
+
+	c := &ShardResult{Shards: map[string][]string{"shard_0": {"3"}, "shard_1": {}}}
+
+	_, err = mergeShardResults([]string{"a.json", "c.json"}, []*ShardResult{a, c}, false)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "c.json names its shards shard_0, … but a.json names them wave_0")
+}
+
+func TestMergeShardResults_MixedTypesRequireNamespaces(t *testing.T) {
+	computers := &ShardResult{
+		Metadata: ShardMetadata{SourceType: "computer_inventory"},
+		Shards:   map[string][]string{"shard_0": {"101"}},
+	}
+	devices := &ShardResult{
+		Metadata: ShardMetadata{SourceType: "mobile_device_inventory"},
+		Shards:   map[string][]string{"shard_0": {"101"}},
+	}
+
+	_, err := mergeShardResults([]string{"computers.json", "devices.json"}, []*ShardResult{computers, devices}, false)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "computers.json holds the plain ID 101")
+	assert.Contains(t, err.Error(), "--namespace-ids")
+}
+
+func TestRunMerge_WritesMergedFile(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.yaml")
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: first}, &ShardResult{
+		Metadata: ShardMetadata{SourceType: "computer_group_membership", TotalIDsFetched: 2},
+		Shards:   map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}},
+	}))
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "yaml", OutputFile: second}, &ShardResult{
+		Metadata: ShardMetadata{SourceType: "computer_inventory", TotalIDsFetched: 1},
+		Shards:   map[string][]string{"shard_0": {"3"}, "shard_1": {}},
+	}))
+
+	outputFile := filepath.Join(dir, "merged.json")
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", "json", "")
+	cmd.Flags().String("output-file", outputFile, "")
+	cmd.Flags().Bool("pad-shorter", false, "")
+
+	require.NoError(t, runMerge(cmd, []string{first, second}))
+
+	merged, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"shard_0": {"1", "3"}, "shard_1": {"2"}}, merged.Shards)
+	assert.Equal(t, 3, merged.Metadata.TotalIDsFetched)
+	assert.Equal(t, []string{first, second}, merged.Metadata.MergedFrom)
+}
+
+func TestRunMerge_MissingFile(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", "json", "")
+	cmd.Flags().String("output-file", "", "")
+	cmd.Flags().Bool("pad-shorter", false, "")
+
+	err := runMerge(cmd, []string{filepath.Join(t.TempDir(), "missing.json"), os.DevNull})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read result file")
+}
@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro"
@@ -15,6 +17,54 @@ import (
 
 // ── HTTP Mock Server Helpers ──────────────────────────────────────────────────
 
+// oauthTokenHandler serves /api/v1/oauth/token with a long-lived mock token.
+func oauthTokenHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "mock-token",
+		"expires_in":   3600,
+		"token_type":   "Bearer",
+	})
+}
+
+// mockMobileDevice is one record served by mobileDeviceDetailHandler.
+type mockMobileDevice struct {
+	ID      string
+	Managed bool
+	SiteID  string
+}
+
+// mobileDeviceDetailHandler serves /api/v2/mobile-devices/detail, returning
+// the page of devices selected by the page and page-size query parameters.
+func mobileDeviceDetailHandler(devices []mockMobileDevice) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, err := strconv.Atoi(r.URL.Query().Get("page-size"))
+		if err != nil || pageSize <= 0 {
+			pageSize = 100
+		}
+
+		results := []map[string]any{}
+		for i := page * pageSize; i < len(devices) && i < (page+1)*pageSize; i++ {
+			results = append(results, map[string]any{
+				"mobileDeviceId": devices[i].ID,
+				"deviceType":     "iOS",
+				"general": map[string]any{
+					"displayName": "iPad" + devices[i].ID,
+					"managed":     devices[i].Managed,
+					"siteId":      devices[i].SiteID,
+				},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"totalCount": len(devices),
+			"results":    results,
+		})
+	}
+}
+
 func setupMockServer(t *testing.T, handlers map[string]http.HandlerFunc) (*httptest.Server, *jamfpro.Client) {
 	mux := http.NewServeMux()
 	for path, handler := range handlers {
@@ -89,13 +139,13 @@ func TestFetchComputerInventory_Success(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerInventory(client)
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Len(t, ids, 2, "Should only return managed computers")
-	assert.Contains(t, ids, "1")
-	assert.Contains(t, ids, "3")
-	assert.NotContains(t, ids, "2", "Unmanaged computer should be excluded")
+	assert.Len(t, fetched.IDs, 2, "Should only return managed computers")
+	assert.Contains(t, fetched.IDs, "1")
+	assert.Contains(t, fetched.IDs, "3")
+	assert.NotContains(t, fetched.IDs, "2", "Unmanaged computer should be excluded")
 }
 
 func TestFetchComputerInventory_AllUnmanaged(t *testing.T) {
@@ -137,10 +187,10 @@ func TestFetchComputerInventory_AllUnmanaged(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerInventory(client)
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Empty(t, ids, "Should return empty list when all computers are unmanaged")
+	assert.Empty(t, fetched.IDs, "Should return empty list when all computers are unmanaged")
 }
 
 func TestFetchComputerInventory_EmptyResponse(t *testing.T) {
@@ -164,10 +214,10 @@ func TestFetchComputerInventory_EmptyResponse(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerInventory(client)
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Empty(t, ids)
+	assert.Empty(t, fetched.IDs)
 }
 
 func TestFetchComputerInventory_APIError(t *testing.T) {
@@ -188,13 +238,193 @@ func TestFetchComputerInventory_APIError(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerInventory(client)
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{})
 
 	require.Error(t, err)
-	assert.Nil(t, ids)
+	assert.Nil(t, fetched)
 	assert.Contains(t, err.Error(), "failed to retrieve computer inventory")
 }
 
+func TestFetchComputerInventory_IncludeUnmanaged(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			response := map[string]any{
+				"totalCount": 2,
+				"results": []map[string]any{
+					{"id": "1", "general": map[string]any{"remoteManagement": map[string]any{"managed": true}}},
+					{"id": "2", "general": map[string]any{"remoteManagement": map[string]any{"managed": false}}},
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{IncludeUnmanaged: true})
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, fetched.IDs)
+	assert.Equal(t, map[string]bool{"2": true}, fetched.Unmanaged)
+}
+
+func TestFetchComputerInventory_SiteFilter(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			managedIn := func(site string) map[string]any {
+				return map[string]any{
+					"site":             map[string]any{"id": site},
+					"remoteManagement": map[string]any{"managed": true},
+				}
+			}
+			response := map[string]any{
+				"totalCount": 3,
+				"results": []map[string]any{
+					{"id": "1", "general": managedIn("1")},
+					{"id": "2", "general": managedIn("2")},
+					{"id": "3", "general": managedIn("1")},
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{SiteID: "1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, fetched.IDs)
+}
+
+func TestFetchComputerInventory_ManagementID(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			managed := func(name, managementID string) map[string]any {
+				return map[string]any{
+					"name":             name,
+					"managementId":     managementID,
+					"remoteManagement": map[string]any{"managed": true},
+				}
+			}
+			response := map[string]any{
+				"totalCount": 3,
+				"results": []map[string]any{
+					{"id": "1", "general": managed("Mac-1", "9B2C1E4F-0D3A-4C5B-8E7F-1A2B3C4D5E6F")},
+					{"id": "2", "general": managed("Mac-2", "")},
+					{"id": "3", "general": managed("Mac-3", "0A1B2C3D-4E5F-6A7B-8C9D-0E1F2A3B4C5D")},
+				},
+			}
+			json.NewEncoder(w).Encode(response)
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{IDField: "management-id"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9B2C1E4F-0D3A-4C5B-8E7F-1A2B3C4D5E6F", "0A1B2C3D-4E5F-6A7B-8C9D-0E1F2A3B4C5D"}, fetched.IDs)
+	assert.Equal(t, "Mac-3", fetched.Names["0A1B2C3D-4E5F-6A7B-8C9D-0E1F2A3B4C5D"])
+	assert.Equal(t, []string{"1 computer(s) have no management ID and were skipped: 2"}, fetched.Warnings)
+}
+
+// ── Paginated Fetch Tests ─────────────────────────────────────────────────────
+
+// flakyMobileDeviceHandler serves mobileDeviceDetailHandler's pages, except
+// that the given page answers 501 for its first failures requests. Neither
+// the SDK nor resty retries 501 itself, so every failure reaches the
+// sharder's own retry.
+// It returns the number of requests made for that page.
+func flakyMobileDeviceHandler(devices []mockMobileDevice, page, failures int) (http.HandlerFunc, *int) {
+	serve := mobileDeviceDetailHandler(devices)
+	requests := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == strconv.Itoa(page) {
+			requests++
+			if requests <= failures {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+		}
+		serve(w, r)
+	}, &requests
+}
+
+// mockMobileDevices returns count managed devices with IDs 1..count.
+func mockMobileDevices(count int) []mockMobileDevice {
+	devices := make([]mockMobileDevice, count)
+	for i := range devices {
+		devices[i] = mockMobileDevice{ID: strconv.Itoa(i + 1), Managed: true}
+	}
+	return devices
+}
+
+func TestFetchPaginated_RetriesFailedPage(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	handler, requests := flakyMobileDeviceHandler(mockMobileDevices(450), 1, 2)
+	_, client := setupMockServer(t, map[string]http.HandlerFunc{
+		"/api/v1/oauth/token":           oauthTokenHandler,
+		"/api/v2/mobile-devices/detail": handler,
+	})
+
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{FetchPageRetries: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, fetched.IDs, 450)
+	assert.Equal(t, 3, *requests, "page 1 should be requested once per attempt")
+}
+
+func TestFetchPaginated_ExhaustedNamesPageAndOffset(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	handler, requests := flakyMobileDeviceHandler(mockMobileDevices(450), 2, 10)
+	_, client := setupMockServer(t, map[string]http.HandlerFunc{
+		"/api/v1/oauth/token":           oauthTokenHandler,
+		"/api/v2/mobile-devices/detail": handler,
+	})
+
+	_, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{FetchPageRetries: 1})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "page 2 (offset 400)")
+	assert.Contains(t, err.Error(), "giving up after 2 attempt(s), last HTTP status 501")
+	assert.Equal(t, 2, *requests)
+}
+
+func TestFetchPaginated_NoRetriesByDefault(t *testing.T) {
+	handler, requests := flakyMobileDeviceHandler(mockMobileDevices(10), 0, 1)
+	_, client := setupMockServer(t, map[string]http.HandlerFunc{
+		"/api/v1/oauth/token":           oauthTokenHandler,
+		"/api/v2/mobile-devices/detail": handler,
+	})
+
+	_, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "page 0 (offset 0)")
+	assert.Equal(t, 1, *requests)
+}
+
 // ── Fetch Mobile Device Inventory Tests ───────────────────────────────────────
 
 func TestFetchMobileDeviceInventory_Success(t *testing.T) {
@@ -207,40 +437,22 @@ func TestFetchMobileDeviceInventory_Success(t *testing.T) {
 				"token_type":   "Bearer",
 			})
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/xml")
-			response := `<?xml version="1.0" encoding="UTF-8"?>
-<mobile_devices>
-	<size>3</size>
-	<mobile_device>
-		<id>101</id>
-		<name>iPad1</name>
-		<managed>true</managed>
-	</mobile_device>
-	<mobile_device>
-		<id>102</id>
-		<name>iPad2</name>
-		<managed>false</managed>
-	</mobile_device>
-	<mobile_device>
-		<id>103</id>
-		<name>iPad3</name>
-		<managed>true</managed>
-	</mobile_device>
-</mobile_devices>`
-			w.Write([]byte(response))
-		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "101", Managed: true},
+			{ID: "102", Managed: false},
+			{ID: "103", Managed: true},
+		}),
 	}
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceInventory(client)
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Len(t, ids, 2, "Should only return managed devices")
-	assert.Contains(t, ids, "101")
-	assert.Contains(t, ids, "103")
-	assert.NotContains(t, ids, "102", "Unmanaged device should be excluded")
+	assert.Len(t, fetched.IDs, 2, "Should only return managed devices")
+	assert.Contains(t, fetched.IDs, "101")
+	assert.Contains(t, fetched.IDs, "103")
+	assert.NotContains(t, fetched.IDs, "102", "Unmanaged device should be excluded")
 }
 
 func TestFetchMobileDeviceInventory_EmptyResponse(t *testing.T) {
@@ -253,22 +465,15 @@ func TestFetchMobileDeviceInventory_EmptyResponse(t *testing.T) {
 				"token_type":   "Bearer",
 			})
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/xml")
-			response := `<?xml version="1.0" encoding="UTF-8"?>
-<mobile_devices>
-	<size>0</size>
-</mobile_devices>`
-			w.Write([]byte(response))
-		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler(nil),
 	}
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceInventory(client)
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Empty(t, ids)
+	assert.Empty(t, fetched.IDs)
 }
 
 func TestFetchMobileDeviceInventory_APIError(t *testing.T) {
@@ -281,7 +486,7 @@ func TestFetchMobileDeviceInventory_APIError(t *testing.T) {
 				"token_type":   "Bearer",
 			})
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
+		"/api/v2/mobile-devices/detail": func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusForbidden)
 			w.Write([]byte("Forbidden"))
 		},
@@ -289,15 +494,151 @@ func TestFetchMobileDeviceInventory_APIError(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceInventory(client)
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
 
 	require.Error(t, err)
-	assert.Nil(t, ids)
+	assert.Nil(t, fetched)
 	assert.Contains(t, err.Error(), "failed to retrieve mobile devices")
 }
 
+func TestFetchMobileDeviceInventory_Paginates(t *testing.T) {
+	var devices []mockMobileDevice
+	for i := range 450 {
+		devices = append(devices, mockMobileDevice{ID: strconv.Itoa(i + 1), Managed: true})
+	}
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler(devices),
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
+
+	require.NoError(t, err)
+	assert.Len(t, fetched.IDs, 450, "All pages should be fetched")
+	assert.Contains(t, fetched.IDs, "1")
+	assert.Contains(t, fetched.IDs, "450")
+}
+
+func TestFetchMobileDeviceInventory_IncludeUnmanaged(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "101", Managed: true},
+			{ID: "102", Managed: false},
+		}),
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{IncludeUnmanaged: true})
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"101", "102"}, fetched.IDs)
+	assert.Equal(t, map[string]bool{"102": true}, fetched.Unmanaged)
+}
+
 // ── Fetch Computer Group Members Tests ────────────────────────────────────────
 
+func TestFetchMobileDeviceInventory_SiteFilter(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "1", Managed: true, SiteID: "5"},
+			{ID: "2", Managed: true, SiteID: "6"},
+			{ID: "3", Managed: false, SiteID: "5"},
+		}),
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{IncludeUnmanaged: true, SiteID: "5"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, fetched.IDs)
+	assert.Equal(t, map[string]bool{"3": true}, fetched.Unmanaged)
+	assert.Equal(t, map[string]string{"1": "iPad1", "3": "iPad3"}, fetched.Names)
+}
+
+func TestFetchComputerPrestageScope(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/api/v2/computer-prestages/3/scope": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"prestageId": "3",
+				"assignments": []map[string]any{
+					{"serialNumber": "C02B"},
+					{"serialNumber": "NOTENROLLED"},
+					{"serialNumber": "C02A"},
+				},
+				"versionLock": 1,
+			})
+		},
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "HARDWARE", r.URL.Query().Get("section"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": 3,
+				"results": []map[string]any{
+					{"id": "1", "hardware": map[string]any{"serialNumber": "C02A"}},
+					{"id": "2", "hardware": map[string]any{"serialNumber": "C02B"}},
+					{"id": "3", "hardware": map[string]any{"serialNumber": "C02C"}},
+				},
+			})
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchComputerPrestageScope(context.Background(), client, &shardConfig{PrestageID: "3"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, fetched.IDs, "IDs follow scope order; unscoped computers are left out")
+	require.Len(t, fetched.Warnings, 1)
+	assert.Contains(t, fetched.Warnings[0], "1 serial number(s) scoped to computer prestage 3 have no computer inventory record")
+	assert.Contains(t, fetched.Warnings[0], "NOTENROLLED")
+}
+
+func TestFetchComputerPrestageScope_Error(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/api/v2/computer-prestages/3/scope": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	fetched, err := fetchComputerPrestageScope(context.Background(), client, &shardConfig{PrestageID: "3"})
+
+	require.Error(t, err)
+	assert.Nil(t, fetched)
+	assert.Contains(t, err.Error(), "failed to retrieve computer prestage 3 scope")
+}
+
 func TestFetchComputerGroupMembers_Success(t *testing.T) {
 	handlers := map[string]http.HandlerFunc{
 		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
@@ -336,7 +677,7 @@ func TestFetchComputerGroupMembers_Success(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerGroupMembers(client, "42")
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "42")
 
 	require.NoError(t, err)
 	assert.Len(t, ids, 3)
@@ -368,7 +709,7 @@ func TestFetchComputerGroupMembers_EmptyGroup(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerGroupMembers(client, "42")
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "42")
 
 	require.NoError(t, err)
 	assert.Empty(t, ids)
@@ -388,7 +729,7 @@ func TestFetchComputerGroupMembers_InvalidGroupID(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerGroupMembers(client, "not-a-number")
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "not-a-number")
 
 	require.Error(t, err)
 	assert.Nil(t, ids)
@@ -396,7 +737,7 @@ func TestFetchComputerGroupMembers_InvalidGroupID(t *testing.T) {
 	assert.Contains(t, err.Error(), "must be numeric")
 }
 
-func TestFetchComputerGroupMembers_APIError(t *testing.T) {
+func TestFetchComputerGroupMembers_NotFound(t *testing.T) {
 	handlers := map[string]http.HandlerFunc{
 		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
@@ -414,11 +755,37 @@ func TestFetchComputerGroupMembers_APIError(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerGroupMembers(client, "999")
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "999")
 
 	require.Error(t, err)
 	assert.Nil(t, ids)
-	assert.Contains(t, err.Error(), "failed to retrieve computer group")
+	assert.Equal(t, "computer group 999 does not exist — check --group-id", err.Error())
+}
+
+func TestFetchComputerGroupMembers_RequestError(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/JSSResource/computergroups/id/42": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Bad request"))
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "42")
+
+	require.Error(t, err)
+	assert.Nil(t, ids)
+	assert.Contains(t, err.Error(), "failed to retrieve computer group 42")
+	assert.NotContains(t, err.Error(), "does not exist")
 }
 
 // ── Fetch Mobile Device Group Members Tests ───────────────────────────────────
@@ -457,7 +824,7 @@ func TestFetchMobileDeviceGroupMembers_Success(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceGroupMembers(client, "50")
+	ids, err := fetchMobileDeviceGroupMembers(context.Background(), client, "50")
 
 	require.NoError(t, err)
 	assert.Len(t, ids, 2)
@@ -489,7 +856,7 @@ func TestFetchMobileDeviceGroupMembers_EmptyGroup(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceGroupMembers(client, "50")
+	ids, err := fetchMobileDeviceGroupMembers(context.Background(), client, "50")
 
 	require.NoError(t, err)
 	assert.Empty(t, ids)
@@ -509,7 +876,7 @@ func TestFetchMobileDeviceGroupMembers_InvalidGroupID(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceGroupMembers(client, "invalid-id")
+	ids, err := fetchMobileDeviceGroupMembers(context.Background(), client, "invalid-id")
 
 	require.Error(t, err)
 	assert.Nil(t, ids)
@@ -517,7 +884,7 @@ func TestFetchMobileDeviceGroupMembers_InvalidGroupID(t *testing.T) {
 	assert.Contains(t, err.Error(), "must be numeric")
 }
 
-func TestFetchMobileDeviceGroupMembers_APIError(t *testing.T) {
+func TestFetchMobileDeviceGroupMembers_NotFound(t *testing.T) {
 	handlers := map[string]http.HandlerFunc{
 		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
@@ -535,11 +902,115 @@ func TestFetchMobileDeviceGroupMembers_APIError(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceGroupMembers(client, "999")
+	ids, err := fetchMobileDeviceGroupMembers(context.Background(), client, "999")
+
+	require.Error(t, err)
+	assert.Nil(t, ids)
+	assert.Equal(t, "mobile device group 999 does not exist — check --group-id", err.Error())
+}
+
+func TestFetchMobileDeviceGroupMembers_RequestError(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/JSSResource/mobiledevicegroups/id/42": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Bad request"))
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	ids, err := fetchMobileDeviceGroupMembers(context.Background(), client, "42")
 
 	require.Error(t, err)
 	assert.Nil(t, ids)
-	assert.Contains(t, err.Error(), "failed to retrieve mobile device group")
+	assert.Contains(t, err.Error(), "failed to retrieve mobile device group 42")
+	assert.NotContains(t, err.Error(), "does not exist")
+}
+
+// ── Fetch User Group Members Tests ────────────────────────────────────────────
+
+func TestFetchUserGroupMembers_Success(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/JSSResource/usergroups/id/7": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<user_group>
+	<id>7</id>
+	<name>Self Service Pilot</name>
+	<is_smart>true</is_smart>
+	<users>
+		<size>2</size>
+		<user>
+			<id>31</id>
+			<username>alice</username>
+		</user>
+		<user>
+			<id>12</id>
+			<username>bob</username>
+		</user>
+	</users>
+</user_group>`))
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	ids, err := fetchUserGroupMembers(context.Background(), client, "7")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"31", "12"}, ids)
+}
+
+func TestFetchUserGroupMembers_EmptyGroup(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/JSSResource/usergroups/id/8": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<user_group>
+	<id>8</id>
+	<name>Empty</name>
+	<is_smart>false</is_smart>
+	<users>
+		<size>0</size>
+	</users>
+</user_group>`))
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	ids, err := fetchUserGroupMembers(context.Background(), client, "8")
+
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestFetchUserGroupMembers_NotFound(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/JSSResource/usergroups/id/999": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Group not found"))
+		},
+	}
+
+	_, client := setupMockServer(t, handlers)
+
+	ids, err := fetchUserGroupMembers(context.Background(), client, "999")
+
+	require.Error(t, err)
+	assert.Nil(t, ids)
+	assert.Equal(t, "user group 999 does not exist — check --group-id", err.Error())
 }
 
 // ── Fetch Users Tests ─────────────────────────────────────────────────────────
@@ -582,7 +1053,7 @@ func TestFetchUsers_Success(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchUsers(client)
+	ids, err := fetchUsers(context.Background(), client)
 
 	require.NoError(t, err)
 	assert.Len(t, ids, 4)
@@ -611,7 +1082,7 @@ func TestFetchUsers_EmptyResponse(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchUsers(client)
+	ids, err := fetchUsers(context.Background(), client)
 
 	require.NoError(t, err)
 	assert.Empty(t, ids)
@@ -635,7 +1106,7 @@ func TestFetchUsers_APIError(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchUsers(client)
+	ids, err := fetchUsers(context.Background(), client)
 
 	require.Error(t, err)
 	assert.Nil(t, ids)
@@ -687,9 +1158,10 @@ func TestFetchSourceIDs_ComputerInventory(t *testing.T) {
 		SourceType: "computer_inventory",
 	}
 
-	ids, err := fetchSourceIDs(client, cfg)
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
 
 	require.NoError(t, err)
+	ids := fetched.IDs
 	assert.Len(t, ids, 2)
 	assert.Contains(t, ids, "100")
 	assert.Contains(t, ids, "101")
@@ -705,24 +1177,10 @@ func TestFetchSourceIDs_MobileDeviceInventory(t *testing.T) {
 				"token_type":   "Bearer",
 			})
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/xml")
-			response := `<?xml version="1.0" encoding="UTF-8"?>
-<mobile_devices>
-	<size>2</size>
-	<mobile_device>
-		<id>200</id>
-		<name>iPad1</name>
-		<managed>true</managed>
-	</mobile_device>
-	<mobile_device>
-		<id>201</id>
-		<name>iPad2</name>
-		<managed>true</managed>
-	</mobile_device>
-</mobile_devices>`
-			w.Write([]byte(response))
-		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "200", Managed: true},
+			{ID: "201", Managed: true},
+		}),
 	}
 
 	_, client := setupMockServer(t, handlers)
@@ -731,9 +1189,10 @@ func TestFetchSourceIDs_MobileDeviceInventory(t *testing.T) {
 		SourceType: "mobile_device_inventory",
 	}
 
-	ids, err := fetchSourceIDs(client, cfg)
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
 
 	require.NoError(t, err)
+	ids := fetched.IDs
 	assert.Len(t, ids, 2)
 	assert.Contains(t, ids, "200")
 	assert.Contains(t, ids, "201")
@@ -771,9 +1230,10 @@ func TestFetchSourceIDs_ComputerGroupMembership(t *testing.T) {
 		GroupID:    "10",
 	}
 
-	ids, err := fetchSourceIDs(client, cfg)
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
 
 	require.NoError(t, err)
+	ids := fetched.IDs
 	assert.Len(t, ids, 2)
 	assert.Contains(t, ids, "5")
 	assert.Contains(t, ids, "6")
@@ -812,9 +1272,10 @@ func TestFetchSourceIDs_MobileDeviceGroupMembership(t *testing.T) {
 		GroupID:    "20",
 	}
 
-	ids, err := fetchSourceIDs(client, cfg)
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
 
 	require.NoError(t, err)
+	ids := fetched.IDs
 	assert.Len(t, ids, 3)
 	assert.Contains(t, ids, "301")
 	assert.Contains(t, ids, "302")
@@ -859,15 +1320,204 @@ func TestFetchSourceIDs_UserAccounts(t *testing.T) {
 		SourceType: "user_accounts",
 	}
 
-	ids, err := fetchSourceIDs(client, cfg)
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
 
 	require.NoError(t, err)
+	ids := fetched.IDs
 	assert.Len(t, ids, 3)
 	assert.Contains(t, ids, "401")
 	assert.Contains(t, ids, "402")
 	assert.Contains(t, ids, "403")
 }
 
+// duplicateComputerInventoryHandlers returns handlers whose inventory
+// response repeats ID "100", as the API occasionally does across pages.
+func duplicateComputerInventoryHandlers() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			results := []map[string]any{}
+			for _, id := range []string{"100", "101", "100"} {
+				results = append(results, map[string]any{
+					"id": id,
+					"general": map[string]any{
+						"remoteManagement": map[string]any{
+							"managed": true,
+						},
+					},
+				})
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": len(results),
+				"results":    results,
+			})
+		},
+	}
+}
+
+func TestFetchSourceIDs_RemovesDuplicates(t *testing.T) {
+	_, client := setupMockServer(t, duplicateComputerInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType: "computer_inventory",
+	}
+
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"100", "101"}, fetched.IDs)
+	assert.Equal(t, 1, fetched.DuplicatesRemoved)
+}
+
+func TestFetchSourceIDs_FailOnDuplicates(t *testing.T) {
+	_, client := setupMockServer(t, duplicateComputerInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType:       "computer_inventory",
+		FailOnDuplicates: true,
+	}
+
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.Error(t, err)
+	assert.Nil(t, fetched)
+	assert.Contains(t, err.Error(), "1 duplicate ID(s): 100")
+}
+
+// locationInventoryHandlers returns handlers for four managed computers with
+// department/building IDs: 1 (dept 5, bldg 1), 2 (dept 5, bldg 2),
+// 3 (dept 6, bldg 1), 4 (no location). The inventory handler answers both the
+// GENERAL and USER_AND_LOCATION sections.
+func locationInventoryHandlers() map[string]http.HandlerFunc {
+	locations := map[string][2]string{
+		"1": {"5", "1"},
+		"2": {"5", "2"},
+		"3": {"6", "1"},
+		"4": {"", ""},
+	}
+	return map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "mock-token",
+				"expires_in":   3600,
+				"token_type":   "Bearer",
+			})
+		},
+		"/api/v3/computers-inventory": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			results := []map[string]any{}
+			for _, id := range []string{"1", "2", "3", "4"} {
+				record := map[string]any{"id": id}
+				if r.URL.Query().Get("section") == "USER_AND_LOCATION" {
+					record["userAndLocation"] = map[string]any{
+						"departmentId": locations[id][0],
+						"buildingId":   locations[id][1],
+					}
+				} else {
+					record["general"] = map[string]any{
+						"remoteManagement": map[string]any{"managed": true},
+					}
+				}
+				results = append(results, record)
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": len(results),
+				"results":    results,
+			})
+		},
+		"/api/v1/departments": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": 2,
+				"results": []map[string]any{
+					{"id": "5", "name": "Engineering"},
+					{"id": "6", "name": "Sales"},
+				},
+			})
+		},
+		"/api/v1/buildings": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"totalCount": 2,
+				"results": []map[string]any{
+					{"id": "1", "name": "HQ"},
+					{"id": "2", "name": "Annex"},
+				},
+			})
+		},
+	}
+}
+
+func TestFetchSourceIDs_FilterDepartmentByID(t *testing.T) {
+	_, client := setupMockServer(t, locationInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType:       "computer_inventory",
+		FilterDepartment: "5",
+	}
+
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, fetched.IDs)
+	require.NotNil(t, fetched.LocationFilter)
+	assert.Equal(t, 2, fetched.LocationFilter.IDsRemoved)
+}
+
+func TestFetchSourceIDs_FilterDepartmentAndBuildingByName(t *testing.T) {
+	_, client := setupMockServer(t, locationInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType:       "computer_inventory",
+		FilterDepartment: "engineering",
+		FilterBuilding:   "HQ",
+	}
+
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, fetched.IDs)
+	assert.Equal(t, 3, fetched.LocationFilter.IDsRemoved)
+	assert.Equal(t, "HQ", fetched.LocationFilter.Building)
+}
+
+func TestFetchSourceIDs_UnknownBuildingName(t *testing.T) {
+	_, client := setupMockServer(t, locationInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType:     "computer_inventory",
+		FilterBuilding: "Warehouse",
+	}
+
+	_, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `filter_building "Warehouse" does not match any building`)
+}
+
+func TestFetchSourceIDs_NoLocationFilter(t *testing.T) {
+	_, client := setupMockServer(t, locationInventoryHandlers())
+
+	cfg := &shardConfig{
+		SourceType: "computer_inventory",
+	}
+
+	fetched, err := fetchSourceIDs(context.Background(), client, cfg)
+
+	require.NoError(t, err)
+	assert.Len(t, fetched.IDs, 4)
+	assert.Nil(t, fetched.LocationFilter)
+}
+
 // ── Additional Edge Cases ─────────────────────────────────────────────────────
 
 func TestFetchComputerInventory_LargeDataset(t *testing.T) {
@@ -905,13 +1555,13 @@ func TestFetchComputerInventory_LargeDataset(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerInventory(client)
+	fetched, err := fetchComputerInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Len(t, ids, 100)
-	assert.Contains(t, ids, "1")
-	assert.Contains(t, ids, "50")
-	assert.Contains(t, ids, "100")
+	assert.Len(t, fetched.IDs, 100)
+	assert.Contains(t, fetched.IDs, "1")
+	assert.Contains(t, fetched.IDs, "50")
+	assert.Contains(t, fetched.IDs, "100")
 }
 
 func TestFetchMobileDeviceInventory_MixedManagedStatus(t *testing.T) {
@@ -924,59 +1574,36 @@ func TestFetchMobileDeviceInventory_MixedManagedStatus(t *testing.T) {
 				"token_type":   "Bearer",
 			})
 		},
-		"/JSSResource/mobiledevices": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/xml")
-
-			type MobileDevice struct {
-				XMLName xml.Name `xml:"mobile_device"`
-				ID      int      `xml:"id"`
-				Name    string   `xml:"name"`
-				Managed bool     `xml:"managed"`
-			}
-
-			type MobileDevices struct {
-				XMLName xml.Name       `xml:"mobile_devices"`
-				Size    int            `xml:"size"`
-				Devices []MobileDevice `xml:"mobile_device"`
-			}
-
-			devices := MobileDevices{
-				Size: 10,
-				Devices: []MobileDevice{
-					{ID: 1, Name: "Device1", Managed: true},
-					{ID: 2, Name: "Device2", Managed: false},
-					{ID: 3, Name: "Device3", Managed: true},
-					{ID: 4, Name: "Device4", Managed: false},
-					{ID: 5, Name: "Device5", Managed: true},
-					{ID: 6, Name: "Device6", Managed: false},
-					{ID: 7, Name: "Device7", Managed: true},
-					{ID: 8, Name: "Device8", Managed: false},
-					{ID: 9, Name: "Device9", Managed: true},
-					{ID: 10, Name: "Device10", Managed: true},
-				},
-			}
-
-			w.Header().Set("Content-Type", "application/xml")
-			xml.NewEncoder(w).Encode(devices)
-		},
+		"/api/v2/mobile-devices/detail": mobileDeviceDetailHandler([]mockMobileDevice{
+			{ID: "1", Managed: true},
+			{ID: "2", Managed: false},
+			{ID: "3", Managed: true},
+			{ID: "4", Managed: false},
+			{ID: "5", Managed: true},
+			{ID: "6", Managed: false},
+			{ID: "7", Managed: true},
+			{ID: "8", Managed: false},
+			{ID: "9", Managed: true},
+			{ID: "10", Managed: true},
+		}),
 	}
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchMobileDeviceInventory(client)
+	fetched, err := fetchMobileDeviceInventory(context.Background(), client, &shardConfig{})
 
 	require.NoError(t, err)
-	assert.Len(t, ids, 6, "Should only return 6 managed devices out of 10")
-	assert.Contains(t, ids, "1")
-	assert.Contains(t, ids, "3")
-	assert.Contains(t, ids, "5")
-	assert.Contains(t, ids, "7")
-	assert.Contains(t, ids, "9")
-	assert.Contains(t, ids, "10")
-	assert.NotContains(t, ids, "2")
-	assert.NotContains(t, ids, "4")
-	assert.NotContains(t, ids, "6")
-	assert.NotContains(t, ids, "8")
+	assert.Len(t, fetched.IDs, 6, "Should only return 6 managed devices out of 10")
+	assert.Contains(t, fetched.IDs, "1")
+	assert.Contains(t, fetched.IDs, "3")
+	assert.Contains(t, fetched.IDs, "5")
+	assert.Contains(t, fetched.IDs, "7")
+	assert.Contains(t, fetched.IDs, "9")
+	assert.Contains(t, fetched.IDs, "10")
+	assert.NotContains(t, fetched.IDs, "2")
+	assert.NotContains(t, fetched.IDs, "4")
+	assert.NotContains(t, fetched.IDs, "6")
+	assert.NotContains(t, fetched.IDs, "8")
 }
 
 func TestFetchComputerGroupMembers_LargeGroup(t *testing.T) {
@@ -1028,7 +1655,7 @@ func TestFetchComputerGroupMembers_LargeGroup(t *testing.T) {
 
 	_, client := setupMockServer(t, handlers)
 
-	ids, err := fetchComputerGroupMembers(client, "100")
+	ids, err := fetchComputerGroupMembers(context.Background(), client, "100")
 
 	require.NoError(t, err)
 	assert.Len(t, ids, 50)
@@ -1,6 +1,10 @@
 package cmd
 
-import "time"
+import (
+	"time"
+
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
+)
 
 // shardConfig represents the complete CLI configuration.
 // Field names mirror the jamfpro.ConfigContainer JSON tags so that the same
@@ -13,6 +17,8 @@ type shardConfig struct {
 	ClientSecret   string `mapstructure:"client_secret"`
 	Username       string `mapstructure:"basic_auth_username"`
 	Password       string `mapstructure:"basic_auth_password"`
+	CheckAuth      bool   `mapstructure:"check_auth"` // one authenticated call before fetching
+	Fixture        string `mapstructure:"fixture"`    // serve source IDs from this file instead of Jamf Pro
 
 	// HTTP client tuning — mirrors jamfpro.ConfigContainer fields exactly
 	LogLevel                    string `mapstructure:"log_level"`
@@ -23,54 +29,330 @@ type shardConfig struct {
 	MaxConcurrentRequests       int    `mapstructure:"max_concurrent_requests"`
 	EnableDynamicRateLimiting   bool   `mapstructure:"enable_dynamic_rate_limiting"`
 	CustomTimeout               int    `mapstructure:"custom_timeout_seconds"`
+	CustomTimeoutMs             int    `mapstructure:"custom_timeout_milliseconds"` // overrides CustomTimeout when set
 	TokenRefreshBufferPeriod    int    `mapstructure:"token_refresh_buffer_period_seconds"`
 	TotalRetryDuration          int    `mapstructure:"total_retry_duration_seconds"`
+	FetchPageRetries            int    `mapstructure:"fetch_page_retries"`
 	FollowRedirects             bool   `mapstructure:"follow_redirects"`
 	MaxRedirects                int    `mapstructure:"max_redirects"`
 	EnableConcurrencyManagement bool   `mapstructure:"enable_concurrency_management"`
 	MandatoryRequestDelay       int    `mapstructure:"mandatory_request_delay_milliseconds"`
 	RetryEligiableRequests      bool   `mapstructure:"retry_eligiable_requests"`
 
+	// Proxy; each falls back to the matching standard environment variable
+	HTTPProxy  string `mapstructure:"http_proxy"`
+	HTTPSProxy string `mapstructure:"https_proxy"`
+	NoProxy    string `mapstructure:"no_proxy"`
+
+	// Run limits
+	RunTimeout    time.Duration `mapstructure:"run_timeout"`    // 0 means no limit
+	SourceTimeout time.Duration `mapstructure:"source_timeout"` // limits the fetch phase alone; 0 means no limit
+
+	// Source ID cache
+	CacheIDs     string        `mapstructure:"cache_ids"`
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"`
+	RefreshCache bool          `mapstructure:"refresh_cache"`
+
 	// Sharding parameters
-	SourceType       string              `mapstructure:"source_type"`
-	GroupID          string              `mapstructure:"group_id"`
-	Strategy         string              `mapstructure:"strategy"`
-	ShardCount       int                 `mapstructure:"shard_count"`
-	ShardPercentages []int               `mapstructure:"shard_percentages"`
-	ShardSizes       []int               `mapstructure:"shard_sizes"`
-	Seed             string              `mapstructure:"seed"`
-	ExcludeIDs       []string            `mapstructure:"exclude_ids"`
-	ReservedIDs      map[string][]string `mapstructure:"reserved_ids"`
+	SourceType        string              `mapstructure:"source_type"` // one source, or several comma-separated
+	NamespaceIDs      bool                `mapstructure:"namespace_ids"`
+	IDField           string              `mapstructure:"id_field"` // "jamf-id" or "management-id"
+	GroupID           string              `mapstructure:"group_id"`
+	PrestageID        string              `mapstructure:"prestage_id"`
+	RawPath           string              `mapstructure:"raw_path"`        // raw_endpoint source: API path to GET
+	RawIDJSONPath     string              `mapstructure:"raw_id_jsonpath"` // raw_endpoint source: JSONPath to the IDs
+	SiteID            string              `mapstructure:"site_id"`
+	IncludeUnmanaged  bool                `mapstructure:"include_unmanaged"`
+	FilterDepartment  string              `mapstructure:"filter_department"`
+	FilterBuilding    string              `mapstructure:"filter_building"`
+	Strategy          string              `mapstructure:"strategy"`
+	ShardCount        int                 `mapstructure:"shard_count"`
+	ShardPercentages  []float64           `mapstructure:"shard_percentages"`
+	AllowPartial      bool                `mapstructure:"allow_partial"`
+	BalanceReserved   bool                `mapstructure:"balance_after_reservations"`
+	ShardSizes        []int               `mapstructure:"shard_sizes"`
+	AutoShards        bool                `mapstructure:"auto_shards"`
+	ShardWeights      []float64           `mapstructure:"shard_weights"`
+	RoundRobinOffset  int                 `mapstructure:"round_robin_offset"`
+	VirtualNodes      int                 `mapstructure:"virtual_nodes"`
+	Parallel          bool                `mapstructure:"parallel"`
+	ShardPrefix       string              `mapstructure:"shard_prefix"` // shard names are ShardPrefix + index
+	Seed              string              `mapstructure:"seed"`
+	SeedFile          string              `mapstructure:"seed_file"`
+	SeedSalt          string              `mapstructure:"seed_salt"`
+	Seeds             []string            `mapstructure:"seeds"`
+	Stable            bool                `mapstructure:"stable"`                     // numeric order instead of API order when unseeded
+	PerShardSeeds     map[string]string   `mapstructure:"-" config:"per_shard_seeds"` // decoded by loadShardConfig
+	ExcludeIDs        []string            `mapstructure:"exclude_ids"`
+	ExcludeIDsFile    string              `mapstructure:"exclude_ids_file"`
+	ExcludeFromResult string              `mapstructure:"exclude_from_result"`
+	ExcludeIDPattern  string              `mapstructure:"exclude_id_pattern"`
+	SampleSize        int                 `mapstructure:"sample_size"`
+	SampleSeed        string              `mapstructure:"sample_seed"`
+	HoldbackPercent   float64             `mapstructure:"holdback_percentage"`
+	HoldbackSeed      string              `mapstructure:"holdback_seed"`
+	ReservedIDs       map[string][]string `mapstructure:"reserved_ids"`
+	ReservedIDsFile   string              `mapstructure:"reserved_ids_file"`
+	MaxIDsPerShard    int                 `mapstructure:"max_ids_per_shard"`
+	OverflowPolicy    string              `mapstructure:"overflow_policy"` // "error", "spill", or "new-shard"
+	MinShardSize      int                 `mapstructure:"min_shard_size"`
+
+	// Safety checks
+	FailOnDuplicates      bool `mapstructure:"fail_on_duplicates"`
+	FailOnEmptyShards     bool `mapstructure:"fail_on_empty_shards"`
+	FailOnEmptySource     bool `mapstructure:"fail_on_empty_source"`
+	FailOnMissingReserved bool `mapstructure:"fail_on_missing_reserved"`
+	FailOnOversized       bool `mapstructure:"fail_on_oversized"`
+	FailOnUndersized      bool `mapstructure:"fail_on_undersized"`
+	FailOnUnusedExcludes  bool `mapstructure:"fail_on_unused_excludes"`
+	FailOnWarnings        bool `mapstructure:"fail_on_warnings"`
+	StrictSourceMatch     bool `mapstructure:"strict_source_match"` // fail on non-numeric IDs from the API
 
 	// Output
-	OutputFormat string `mapstructure:"output_format"`
-	OutputFile   string `mapstructure:"output_file"`
+	OutputFormat   string   `mapstructure:"output_format"`
+	OutputFile     string   `mapstructure:"output_file"`
+	OutputDir      string   `mapstructure:"output_dir"`
+	OutputFileMode string   `mapstructure:"output_file_mode"` // octal, e.g. "0600"
+	AtomicWrite    bool     `mapstructure:"atomic_write"`
+	PrintHashOnly  bool     `mapstructure:"print_hash_only"`
+	SelectShard    string   `mapstructure:"select_shard"`  // emit only this shard's IDs
+	OnlyShards     []string `mapstructure:"only_shards"`   // emit only these shards
+	PreviewCount   int      `mapstructure:"preview_count"` // emit only the first N IDs of each shard
+	Histogram      bool     `mapstructure:"histogram"`
+	SortOrder      string   `mapstructure:"sort_order"` // "numeric-asc", "numeric-desc", or "api"
+	ShardOrder     string   `mapstructure:"shard_order"`
+	Explain        bool     `mapstructure:"explain"`
+	ExplainIDs     []string `mapstructure:"explain_ids"` // limits explain to these IDs
+	IncludeNames   bool     `mapstructure:"include_names"`
+	YAMLHeader     bool     `mapstructure:"yaml_header"`
+	Canonical      bool     `mapstructure:"canonical"`
+	RunLog         string   `mapstructure:"run_log"`    // JSON lines of phase timings; distinct from log_export_path
+	AuditFile      string   `mapstructure:"audit_file"` // JSON line per result, secrets redacted
+
+	// Shard labels: passthrough metadata per shard, copied into the result
+	ShardLabels map[string]map[string]string `mapstructure:"shard_labels"`
+
+	// Result expiry: expires_at is set to generated_at plus this (0 = never)
+	ExpiresIn time.Duration `mapstructure:"expires_in"`
+}
+
+// sourceFetchResult is the deduplicated ID pool returned by fetchSourceIDs,
+// together with statistics about how the raw API response was cleaned up.
+type sourceFetchResult struct {
+	IDs               []string
+	DuplicatesRemoved int
+	LocationFilter    *LocationFilterSummary
+	// Unmanaged holds the IDs of unmanaged devices kept by include_unmanaged.
+	// Only the inventory sources report managed state.
+	Unmanaged map[string]bool
+	// Names maps each ID to its computer or device name. Only the inventory
+	// sources report names; they are used for display, never for sharding.
+	Names map[string]string
+	// Warnings holds the non-fatal conditions the fetch reported on stderr.
+	Warnings []string
+	// SourceBreakdown maps each source type to the IDs it contributed before
+	// the union removed IDs shared between sources. Only set when source_type
+	// combines more than one source.
+	SourceBreakdown map[string]int
+	// RateLimitWaitsMs is the time spent waiting to retry requests that Jamf
+	// Pro answered with 429 Too Many Requests.
+	RateLimitWaitsMs int64
+}
+
+// mobileDeviceDetail is the subset of a /api/v2/mobile-devices/detail record
+// needed to select devices: the ID and the GENERAL section's managed flag,
+// site, and display name.
+type mobileDeviceDetail struct {
+	MobileDeviceID string `json:"mobileDeviceId"`
+	General        struct {
+		DisplayName string `json:"displayName"`
+		Managed     bool   `json:"managed"`
+		SiteID      string `json:"siteId"`
+	} `json:"general"`
 }
 
 // shardReservations holds the separated reserved and unreserved ID lists
-// produced during reservation processing.
+// produced during reservation processing, as the strategies take them.
 type shardReservations struct {
-	IDsByShard    map[string][]string
-	CountsByShard map[int]int
-	UnreservedIDs []string
+	sharding.Reservations
+	// MissingIDs lists reserved IDs that were not present in the source pool,
+	// sorted numerically.
+	MissingIDs []string
 }
 
 // ShardMetadata describes the parameters and statistics of a sharding run.
 type ShardMetadata struct {
-	GeneratedAt              time.Time `json:"generated_at"                yaml:"generated_at"`
+	GeneratedAt              time.Time `json:"generated_at,omitzero"       yaml:"generated_at,omitempty"` // zero only with canonical
 	SourceType               string    `json:"source_type"                 yaml:"source_type"`
 	GroupID                  string    `json:"group_id,omitempty"          yaml:"group_id,omitempty"`
+	PrestageID               string    `json:"prestage_id,omitempty"       yaml:"prestage_id,omitempty"`
+	RawPath                  string    `json:"raw_path,omitempty"          yaml:"raw_path,omitempty"`
+	SiteID                   string    `json:"site_id,omitempty"           yaml:"site_id,omitempty"`
+	IDField                  string    `json:"id_field,omitempty"          yaml:"id_field,omitempty"`
 	Strategy                 string    `json:"strategy"                    yaml:"strategy"`
 	Seed                     string    `json:"seed"                        yaml:"seed"`
+	SeedSalt                 string    `json:"seed_salt,omitempty"         yaml:"seed_salt,omitempty"`
+	Stable                   bool      `json:"stable,omitempty"            yaml:"stable,omitempty"`
 	TotalIDsFetched          int       `json:"total_ids_fetched"           yaml:"total_ids_fetched"`
+	SampleSize               int       `json:"sample_size,omitempty"       yaml:"sample_size,omitempty"`
+	SampleSeed               string    `json:"sample_seed,omitempty"       yaml:"sample_seed,omitempty"`
+	DuplicatesRemoved        int       `json:"duplicates_removed"          yaml:"duplicates_removed"`
 	ExcludedIDCount          int       `json:"excluded_id_count"           yaml:"excluded_id_count"`
+	ExcludedByPatternCount   int       `json:"excluded_by_pattern_count,omitempty" yaml:"excluded_by_pattern_count,omitempty"` // of excluded_id_count
 	ReservedIDCount          int       `json:"reserved_id_count"           yaml:"reserved_id_count"`
 	UnreservedIDsDistributed int       `json:"unreserved_ids_distributed"  yaml:"unreserved_ids_distributed"`
+	UndistributedIDCount     int       `json:"undistributed_id_count,omitempty" yaml:"undistributed_id_count,omitempty"`
 	ShardCount               int       `json:"shard_count"                 yaml:"shard_count"`
+	ShardOrder               string    `json:"shard_order,omitempty"       yaml:"shard_order,omitempty"`
+	ShardPrefix              string    `json:"shard_prefix,omitempty"      yaml:"shard_prefix,omitempty"` // empty for the default, shard_
+	OnlyShards               []string  `json:"only_shards,omitempty" yaml:"only_shards,omitempty"`        // the shards output, when only_shards left the rest out
+	ResultHash               string    `json:"result_hash"                 yaml:"result_hash"`
+	MissingReservedIDs       []string  `json:"missing_reserved_ids,omitempty" yaml:"missing_reserved_ids,omitempty"`
+	RebalancedShards         []string  `json:"rebalanced_shards,omitempty" yaml:"rebalanced_shards,omitempty"`
+	MergedFrom               []string  `json:"merged_from,omitempty"       yaml:"merged_from,omitempty"` // result files combined by merge
+	RateLimitWaitsMs         int64     `json:"rate_limit_waits_ms,omitempty" yaml:"rate_limit_waits_ms,omitempty"`
+
+	SourceBreakdown map[string]int         `json:"source_breakdown,omitempty" yaml:"source_breakdown,omitempty"` // per source, before the union
+	PerShardSeeds   map[string]string      `json:"per_shard_seeds,omitempty" yaml:"per_shard_seeds,omitempty"`
+	ExpiresAt       *time.Time             `json:"expires_at,omitempty"      yaml:"expires_at,omitempty"`
+	Overflow        *OverflowSummary       `json:"overflow,omitempty"        yaml:"overflow,omitempty"`
+	MinShardSize    *MinShardSizeSummary   `json:"min_shard_size,omitempty"  yaml:"min_shard_size,omitempty"`
+	Holdback        *HoldbackSummary       `json:"holdback,omitempty"        yaml:"holdback,omitempty"`
+	LocationFilter  *LocationFilterSummary `json:"location_filter,omitempty" yaml:"location_filter,omitempty"`
+}
+
+// LocationFilterSummary records the department/building filters applied to a
+// computer source. It is only present when at least one filter was set.
+type LocationFilterSummary struct {
+	Department string `json:"department,omitempty" yaml:"department,omitempty"`
+	Building   string `json:"building,omitempty"   yaml:"building,omitempty"`
+	IDsRemoved int    `json:"ids_removed"          yaml:"ids_removed"`
+}
+
+// HoldbackSummary records the cohort held back from every shard by
+// holdback_percentage. It is only present when holdback_percentage is set.
+type HoldbackSummary struct {
+	Percentage float64  `json:"percentage" yaml:"percentage"`
+	Seed       string   `json:"seed"       yaml:"seed"`
+	IDCount    int      `json:"id_count"   yaml:"id_count"`
+	IDs        []string `json:"ids"        yaml:"ids"`
+}
+
+// OverflowSummary records how max_ids_per_shard was enforced. It is only
+// present when at least one shard exceeded the cap and IDs were moved.
+type OverflowSummary struct {
+	MaxIDsPerShard      int    `json:"max_ids_per_shard"     yaml:"max_ids_per_shard"`
+	Policy              string `json:"policy"                yaml:"policy"`
+	IDsMoved            int    `json:"ids_moved"             yaml:"ids_moved"`
+	RequestedShardCount int    `json:"requested_shard_count" yaml:"requested_shard_count"`
+}
+
+// MinShardSizeSummary records how min_shard_size was enforced. It is only
+// present when at least one shard was topped up.
+type MinShardSizeSummary struct {
+	MinShardSize   int      `json:"min_shard_size"   yaml:"min_shard_size"`
+	IDsMoved       int      `json:"ids_moved"        yaml:"ids_moved"`
+	ToppedUpShards []string `json:"topped_up_shards" yaml:"topped_up_shards"`
 }
 
 // ShardResult is the serialisable top-level output of the sharding operation.
 type ShardResult struct {
-	Metadata ShardMetadata       `json:"metadata" yaml:"metadata"`
-	Shards   map[string][]string `json:"shards"   yaml:"shards"`
+	Metadata       ShardMetadata          `json:"metadata"                  yaml:"metadata"`
+	Shards         map[string][]string    `json:"shards"                    yaml:"shards"`
+	ShardBreakdown map[string]ShardCounts `json:"shard_breakdown,omitempty" yaml:"shard_breakdown,omitempty"`
+
+	// Labels carries shard_labels, such as a wave's maintenance window or
+	// owner, for downstream automation. It has no effect on distribution.
+	Labels map[string]map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// Placements explains, per ID, how the ID was placed. It is only set with
+	// explain; json-detailed output reports it per ID instead.
+	Placements map[string]PlacementExplanation `json:"placements,omitempty" yaml:"placements,omitempty"`
+
+	// Warnings holds the non-fatal conditions reported on stderr during the
+	// run, such as empty shards or missing reserved IDs, so file output
+	// keeps a record of them.
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+
+	// Truncated is set when preview_count cut the shard lists short. The
+	// metadata, breakdown, and result hash still describe the full result.
+	Truncated bool `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+
+	// Unmanaged holds the IDs of unmanaged devices kept by include_unmanaged.
+	// It is not serialised directly; json-detailed output reports it per ID.
+	Unmanaged map[string]bool `json:"-" yaml:"-"`
+
+	// Names maps IDs to device names when include_names is set. It is not
+	// serialised directly; json-detailed output reports it per ID.
+	Names map[string]string `json:"-" yaml:"-"`
+}
+
+// DetailedShardResult is the json-detailed output: a ShardResult in which
+// every ID is expanded into a ShardEntry.
+type DetailedShardResult struct {
+	Metadata       ShardMetadata                `json:"metadata"`
+	Shards         map[string][]ShardEntry      `json:"shards"`
+	ShardBreakdown map[string]ShardCounts       `json:"shard_breakdown,omitempty"`
+	Labels         map[string]map[string]string `json:"labels,omitempty"`
+	Warnings       []string                     `json:"warnings,omitempty"`
+	Truncated      bool                         `json:"truncated,omitempty"`
+}
+
+// ShardEntry is one ID in json-detailed output.
+type ShardEntry struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name,omitempty"`
+	Managed   bool                  `json:"managed"`
+	Placement *PlacementExplanation `json:"placement,omitempty"`
+}
+
+// PlacementExplanation records why explain found an ID in its shard. Which
+// fields are set depends on the strategy:
+//
+//   - reserved IDs set only Reserved;
+//   - round-robin, percentage, size, and balanced set DistributionIndex, the
+//     ID's position in the (seed-shuffled) order IDs were handed out in;
+//   - rendezvous sets RendezvousWeights, every shard's weight for the ID,
+//     plus RendezvousScores when shard_weights scales them;
+//   - hash-ring sets RingHash and RingPoint, the ID's position on the ring
+//     and the first shard point clockwise from it.
+//
+// MovedFromShard names the shard the strategy chose when max_ids_per_shard
+// or min_shard_size moved the ID elsewhere.
+type PlacementExplanation struct {
+	Shard             string             `json:"shard"                        yaml:"shard"`
+	Reserved          bool               `json:"reserved,omitempty"           yaml:"reserved,omitempty"`
+	DistributionIndex *int               `json:"distribution_index,omitempty" yaml:"distribution_index,omitempty"`
+	RendezvousWeights map[string]uint64  `json:"rendezvous_weights,omitempty" yaml:"rendezvous_weights,omitempty"`
+	RendezvousScores  map[string]float64 `json:"rendezvous_scores,omitempty"  yaml:"rendezvous_scores,omitempty"`
+	RingHash          *uint64            `json:"ring_hash,omitempty"          yaml:"ring_hash,omitempty"`
+	RingPoint         *uint64            `json:"ring_point,omitempty"         yaml:"ring_point,omitempty"`
+	MovedFromShard    string             `json:"moved_from_shard,omitempty"   yaml:"moved_from_shard,omitempty"`
+}
+
+// ShardCounts splits one shard's size into IDs pinned by reserved_ids and IDs
+// placed by the strategy. OriginalIndex is the index the strategy gave the
+// shard, set only when shard_order renumbered the shards by size.
+type ShardCounts struct {
+	Reserved      int  `json:"reserved"                 yaml:"reserved"`
+	Distributed   int  `json:"distributed"              yaml:"distributed"`
+	OriginalIndex *int `json:"original_index,omitempty" yaml:"original_index,omitempty"`
+}
+
+// ShardRecord is a single line of NDJSON output: one ID and the shard it
+// was placed in.
+type ShardRecord struct {
+	Shard string `json:"shard"`
+	ID    string `json:"id"`
+}
+
+// ShardMetadataRecord is the trailing line of NDJSON output, and the metadata
+// file written to output_dir. Wrapping the metadata under its own key lets
+// consumers tell it apart from ID records.
+type ShardMetadataRecord struct {
+	Metadata       ShardMetadata                `json:"metadata"                  yaml:"metadata"`
+	ShardBreakdown map[string]ShardCounts       `json:"shard_breakdown,omitempty" yaml:"shard_breakdown,omitempty"`
+	Labels         map[string]map[string]string `json:"labels,omitempty"          yaml:"labels,omitempty"`
+	Warnings       []string                     `json:"warnings,omitempty"        yaml:"warnings,omitempty"`
+	Truncated      bool                         `json:"truncated,omitempty"       yaml:"truncated,omitempty"`
 }
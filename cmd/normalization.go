@@ -7,6 +7,7 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -28,3 +29,46 @@ func parseTrimmedIntSlice(raw []string) ([]int, error) {
 	}
 	return out, nil
 }
+
+// parseTrimmedFloatSlice is the float64 counterpart of parseTrimmedIntSlice,
+// used for values such as shard weights that may be fractional.
+func parseTrimmedFloatSlice(raw []string) ([]float64, error) {
+	out := make([]float64, 0, len(raw))
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", s, err)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// normalizeInstanceDomain turns an instance_domain given as a bare host or a
+// URL, with or without a trailing slash, into the "https://host[:port]" base
+// URL the SDK expects. A bare host gets https://; an explicit http:// is
+// kept, for test servers and local proxies.
+func normalizeInstanceDomain(domain string) (string, error) {
+	trimmed := strings.TrimSpace(domain)
+	if !strings.Contains(trimmed, "://") {
+		trimmed = "https://" + trimmed
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("instance_domain %q is not a valid host: %w", domain, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("instance_domain %q must use https:// or http://, not %s://", domain, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("instance_domain %q has no host, e.g. company.jamfcloud.com", domain)
+	}
+	if strings.TrimRight(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("instance_domain %q must be just the host, e.g. company.jamfcloud.com, without a path", domain)
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host), nil
+}
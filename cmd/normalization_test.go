@@ -3,7 +3,9 @@ package cmd
 // normalization_test.go contains unit tests for every normalisation helper in
 // normalization.go.
 //
-//   TestParseTrimmedIntSlice — whitespace trimming and int conversion
+//   TestParseTrimmedIntSlice   — whitespace trimming and int conversion
+//   TestParseTrimmedFloatSlice — whitespace trimming and float conversion
+//   TestNormalizeInstanceDomain — bare hosts and URLs to one base URL
 
 import (
 	"testing"
@@ -97,3 +99,92 @@ func TestParseTrimmedIntSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTrimmedFloatSlice(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name:  "integers parse as floats",
+			input: []string{"1", "2", "1"},
+			want:  []float64{1, 2, 1},
+		},
+		{
+			name:  "fractional and space-padded values",
+			input: []string{"0.5", " 1.5 ", "\t2"},
+			want:  []float64{0.5, 1.5, 2},
+		},
+		{
+			name:  "empty strings are skipped",
+			input: []string{""},
+			want:  []float64{},
+		},
+		{
+			name:    "letters return error",
+			input:   []string{"1", "heavy"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTrimmedFloatSlice(tc.input)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNormalizeInstanceDomain(t *testing.T) {
+	for _, input := range []string{
+		"company.jamfcloud.com",
+		"company.jamfcloud.com/",
+		"https://company.jamfcloud.com",
+		"https://company.jamfcloud.com/",
+		"https://company.jamfcloud.com//",
+		"HTTPS://Company.JamfCloud.com",
+		"  https://company.jamfcloud.com/ ",
+	} {
+		t.Run(input, func(t *testing.T) {
+			got, err := normalizeInstanceDomain(input)
+			require.NoError(t, err)
+			assert.Equal(t, "https://company.jamfcloud.com", got)
+		})
+	}
+
+	got, err := normalizeInstanceDomain("http://127.0.0.1:8443/")
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8443", got, "An explicit http:// and port are kept")
+
+	got, err = normalizeInstanceDomain("jamf.example.com:8443")
+	require.NoError(t, err)
+	assert.Equal(t, "https://jamf.example.com:8443", got)
+}
+
+func TestNormalizeInstanceDomain_Invalid(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{input: "", wantErr: "has no host"},
+		{input: "https://", wantErr: "has no host"},
+		{input: "ftp://company.jamfcloud.com", wantErr: "must use https:// or http://, not ftp://"},
+		{input: "https://company.jamfcloud.com/api/v1", wantErr: "without a path"},
+		{input: "company.jamfcloud.com?x=1", wantErr: "without a path"},
+		{input: "https://admin@company.jamfcloud.com", wantErr: "without a path"},
+		{input: "company.jamfcloud.com:port", wantErr: "is not a valid host"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := normalizeInstanceDomain(tc.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+// objectstore.go implements object storage URLs for output_file: an
+// s3://bucket/key or gs://bucket/key output_file is uploaded instead of being
+// written to disk.
+//
+// S3 uploads use the AWS SDK, with credentials and region from the standard
+// AWS sources — environment variables, shared config files, or an instance or
+// task role. Google Cloud Storage uploads are a single media upload through
+// the JSON API, authenticated with Application Default Credentials —
+// GOOGLE_APPLICATION_CREDENTIALS, gcloud's application-default login, or the
+// metadata server.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/oauth2/google"
+)
+
+// objectStoreSchemes are the URL schemes output_file recognises as object
+// storage rather than a local path.
+var objectStoreSchemes = []string{"s3", "gs"}
+
+// newS3Client builds the client uploads use. Tests replace it to point the
+// client at a mock server.
+var newS3Client = func(awsCfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(awsCfg)
+}
+
+// gcsUploadEndpoint is the base URL of the Cloud Storage JSON API upload
+// endpoint. Tests replace it, with newGCSHTTPClient, to point uploads at a
+// mock server.
+var gcsUploadEndpoint = "https://storage.googleapis.com/upload/storage/v1"
+
+// newGCSHTTPClient builds the HTTP client gs:// uploads are sent with,
+// authorised by Application Default Credentials.
+var newGCSHTTPClient = func(ctx context.Context) (*http.Client, error) {
+	return google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+}
+
+// objectURL returns path parsed as an object storage URL, or nil when path
+// is a local file path.
+func objectURL(path string) *url.URL {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+	for _, scheme := range objectStoreSchemes {
+		if u.Scheme == scheme {
+			return u
+		}
+	}
+	return nil
+}
+
+// objectKey returns the object key of u, its path without the leading slash.
+func objectKey(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// validateObjectURL checks that u, from setting, names a bucket and an
+// object.
+func validateObjectURL(setting string, u *url.URL) error {
+	if u.Host == "" || objectKey(u) == "" || strings.HasSuffix(u.Path, "/") {
+		return fmt.Errorf("%s %q must name a bucket and an object key, e.g. %s://bucket/shards/output.json",
+			setting, u.String(), u.Scheme)
+	}
+	return nil
+}
+
+// uploadObject stores data as the object named by u.
+func uploadObject(ctx context.Context, u *url.URL, data []byte) error {
+	if err := validateObjectURL("output_file", u); err != nil {
+		return err
+	}
+	if u.Scheme == "gs" {
+		return uploadGCSObject(ctx, u, data)
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	_, err = newS3Client(awsCfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(objectKey(u)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// uploadGCSObject stores data as the Cloud Storage object named by u, with a
+// single media upload. The object is replaced if it exists.
+func uploadGCSObject(ctx context.Context, u *url.URL, data []byte) error {
+	client, err := newGCSHTTPClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load Google Cloud credentials: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/b/%s/o?uploadType=media&name=%s",
+		gcsUploadEndpoint, url.PathEscape(u.Host), url.QueryEscape(objectKey(u)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package cmd
+
+// objectstore_test.go contains tests for object storage output in
+// objectstore.go.
+//
+//   TestObjectURL                  — which output_file values are uploaded
+//   TestValidateObjectURL          — bucket and key
+//   TestRunShard_OutputFileS3*     — uploads to a mock S3 endpoint
+//   TestRunShard_OutputFileGCS     — uploads to a mock Cloud Storage endpoint
+//   TestRunShard_OutputFileGCSRunTimeout — a hung upload bounded by run_timeout
+//   TestUploadObject_GCSError      — a rejected Cloud Storage upload
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockS3 records the objects PUT to it, keyed by "bucket/key" path.
+type mockS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// setupMockS3 starts a mock S3 endpoint and points uploads at it, with
+// static credentials from the environment.
+func setupMockS3(t *testing.T) *mockS3 {
+	t.Helper()
+	mock := &mockS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mock.mu.Lock()
+		mock.objects[r.URL.Path] = body
+		mock.mu.Unlock()
+		w.Header().Set("ETag", `"mock"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-access-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret-key")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	original := newS3Client
+	newS3Client = func(awsCfg aws.Config) *s3.Client {
+		return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(server.URL)
+			o.UsePathStyle = true
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		})
+	}
+	t.Cleanup(func() { newS3Client = original })
+	return mock
+}
+
+// object returns the body uploaded to path, e.g. "/bucket/key".
+func (m *mockS3) object(path string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.objects[path]
+	return body, ok
+}
+
+// setupMockGCS starts a mock Cloud Storage upload endpoint and points gs://
+// uploads at it, without credentials. Objects are recorded in the returned
+// mockS3 under "/bucket/name", as for S3. status is the response to every
+// upload.
+func setupMockGCS(t *testing.T, status int) *mockS3 {
+	t.Helper()
+	mock := &mockS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, ok := strings.CutPrefix(r.URL.Path, "/b/")
+		bucket, _, found := strings.Cut(bucket, "/")
+		if !ok || !found || r.Method != http.MethodPost || r.URL.Query().Get("uploadType") != "media" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if status != http.StatusOK {
+			http.Error(w, `{"error": {"message": "denied"}}`, status)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mock.mu.Lock()
+		mock.objects["/"+bucket+"/"+r.URL.Query().Get("name")] = body
+		mock.mu.Unlock()
+		w.Write([]byte(`{"kind": "storage#object"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	originalEndpoint, originalClient := gcsUploadEndpoint, newGCSHTTPClient
+	gcsUploadEndpoint = server.URL
+	newGCSHTTPClient = func(context.Context) (*http.Client, error) {
+		return server.Client(), nil
+	}
+	t.Cleanup(func() { gcsUploadEndpoint, newGCSHTTPClient = originalEndpoint, originalClient })
+	return mock
+}
+
+// loadUploadedResult parses an uploaded result body, saved locally as name so
+// its extension selects the format.
+func loadUploadedResult(t *testing.T, body []byte, name string) *ShardResult {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, body, 0o644))
+	result, err := loadShardResult(path)
+	require.NoError(t, err)
+	return result
+}
+
+func TestObjectURL(t *testing.T) {
+	for _, path := range []string{"s3://bucket/out.json", "gs://bucket/out.json", "s3://bucket/shards-{{.Date}}.json"} {
+		assert.NotNil(t, objectURL(path), path)
+	}
+	for _, path := range []string{"", "out.json", "./shards/out.json", "/tmp/out.json", `C:\shards\out.json`, "https://example.com/out.json"} {
+		assert.Nil(t, objectURL(path), path)
+	}
+}
+
+func TestValidateObjectURL(t *testing.T) {
+	assert.NoError(t, validateObjectURL("output_file", objectURL("s3://bucket/rollout/out.json")))
+	assert.NoError(t, validateObjectURL("output_file", objectURL("gs://bucket/rollout/out.json")))
+
+	tests := []struct {
+		path, wantErr string
+	}{
+		{path: "s3://bucket", wantErr: "must name a bucket and an object key"},
+		{path: "s3://bucket/", wantErr: "must name a bucket and an object key"},
+		{path: "s3://bucket/rollout/", wantErr: "must name a bucket and an object key"},
+		{path: "s3:///out.json", wantErr: "must name a bucket and an object key"},
+		{path: "gs://bucket", wantErr: "e.g. gs://bucket/shards/output.json"},
+	}
+	for _, tt := range tests {
+		err := validateObjectURL("output_file", objectURL(tt.path))
+
+		require.Error(t, err, tt.path)
+		assert.Contains(t, err.Error(), tt.wantErr, tt.path)
+	}
+}
+
+func TestRunShard_OutputFileS3(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+	mock := setupMockS3(t)
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", "s3://shard-artifacts/rollout/{{.Strategy}}.json")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	body, ok := mock.object("/shard-artifacts/rollout/round-robin.json")
+	require.True(t, ok, "Object uploaded under the expanded key")
+	result := loadUploadedResult(t, body, "round-robin.json")
+	assert.Equal(t, 50, result.Metadata.TotalIDsFetched)
+	assert.Len(t, result.Shards, 3)
+}
+
+func TestRunShard_OutputFileS3_NDJSON(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+	mock := setupMockS3(t)
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("output_format", "ndjson")
+	viper.Set("output_file", "s3://shard-artifacts/output.ndjson")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	body, ok := mock.object("/shard-artifacts/output.ndjson")
+	require.True(t, ok)
+	result := loadUploadedResult(t, body, "output.ndjson")
+	assert.Equal(t, 50, len(resultIDs(result)))
+}
+
+func TestRunShard_OutputFileGCS(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+	mock := setupMockGCS(t, http.StatusOK)
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("output_format", "yaml")
+	viper.Set("output_file", "gs://shard-artifacts/rollout/{{.Strategy}}.yaml")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	body, ok := mock.object("/shard-artifacts/rollout/round-robin.yaml")
+	require.True(t, ok, "Object uploaded under the expanded name")
+	result := loadUploadedResult(t, body, "round-robin.yaml")
+	assert.Equal(t, 50, result.Metadata.TotalIDsFetched)
+	assert.Len(t, result.Shards, 3)
+}
+
+func TestRunShard_OutputFileGCSRunTimeout(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+	// The upload never gets a response; release frees the handler so the
+	// server can close.
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(hung.Close)
+	t.Cleanup(func() { close(release) })
+	originalEndpoint, originalClient := gcsUploadEndpoint, newGCSHTTPClient
+	gcsUploadEndpoint = hung.URL
+	newGCSHTTPClient = func(context.Context) (*http.Client, error) {
+		return hung.Client(), nil
+	}
+	t.Cleanup(func() { gcsUploadEndpoint, newGCSHTTPClient = originalEndpoint, originalClient })
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+	viper.Set("run_timeout", "2s")
+	viper.Set("output_format", "json")
+	viper.Set("output_file", "gs://shard-artifacts/output.json")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	err := runShard(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run timed out after 2s (run_timeout) while writing output")
+}
+
+func TestUploadObject_GCSError(t *testing.T) {
+	setupMockGCS(t, http.StatusForbidden)
+
+	err := uploadObject(context.Background(), objectURL("gs://shard-artifacts/out.json"), []byte("{}"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upload returned 403 Forbidden")
+	assert.Contains(t, err.Error(), "denied")
+}
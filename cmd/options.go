@@ -0,0 +1,72 @@
+package cmd
+
+// options.go implements the `options` command: list the accepted values of
+// the enumerated settings, for users and for wrappers that build configs.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var optionsCmd = &cobra.Command{
+	Use:   "options",
+	Short: "List the valid values of source_type, strategy, auth_method, and output_format",
+	Long: `Prints the values accepted for source_type, strategy, auth_method, and
+output_format. The lists are the ones the configuration is validated against,
+so they always match the running binary. Use --output json for a JSON object
+keyed by setting name.
+
+Examples:
+  go-jamf-guid-sharder options
+
+  go-jamf-guid-sharder options --output json`,
+	RunE: runOptions,
+}
+
+func init() {
+	rootCmd.AddCommand(optionsCmd)
+
+	optionsCmd.Flags().String("output", "text", "Output format: text or json")
+}
+
+// optionsInfo is the JSON form of the options command's output.
+type optionsInfo struct {
+	SourceType   []string `json:"source_type"`
+	Strategy     []string `json:"strategy"`
+	AuthMethod   []string `json:"auth_method"`
+	OutputFormat []string `json:"output_format"`
+}
+
+func runOptions(cmd *cobra.Command, _ []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	return writeOptions(cmd.OutOrStdout(), output)
+}
+
+// writeOptions prints the valid values of each enumerated setting to w in
+// the given format.
+func writeOptions(w io.Writer, output string) error {
+	info := optionsInfo{
+		SourceType:   validSourceTypes,
+		Strategy:     validStrategies,
+		AuthMethod:   validAuthMethods,
+		OutputFormat: validOutputFormats,
+	}
+	switch output {
+	case "", "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "source_type:\t%s\n", strings.Join(info.SourceType, ", "))
+		fmt.Fprintf(tw, "strategy:\t%s\n", strings.Join(info.Strategy, ", "))
+		fmt.Fprintf(tw, "auth_method:\t%s\n", strings.Join(info.AuthMethod, ", "))
+		fmt.Fprintf(tw, "output_format:\t%s\n", strings.Join(info.OutputFormat, ", "))
+		return tw.Flush()
+	case "json":
+		return json.NewEncoder(w).Encode(info)
+	default:
+		return fmt.Errorf("invalid --output %q: must be one of: text, json", output)
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+// options_test.go contains tests for the `options` command in options.go.
+//
+//   TestWriteOptions_*   — text and JSON output formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOptions_Text(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeOptions(&buf, "text"))
+
+	assert.Contains(t, buf.String(), "strategy:       round-robin, percentage, size, rendezvous, balanced, hash-ring\n")
+	assert.Contains(t, buf.String(), "auth_method:    oauth2, basic\n")
+}
+
+func TestWriteOptions_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeOptions(&buf, "json"))
+
+	var info optionsInfo
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &info))
+	assert.Equal(t, validSourceTypes, info.SourceType)
+	assert.Equal(t, validStrategies, info.Strategy)
+	assert.Equal(t, validAuthMethods, info.AuthMethod)
+	assert.Equal(t, validOutputFormats, info.OutputFormat)
+}
+
+func TestWriteOptions_ListsOnlyValidValues(t *testing.T) {
+	for _, strategy := range validStrategies {
+		var issues []string
+		validateShardingParameters(&shardConfig{Strategy: strategy, ShardCount: 2}, &issues)
+		for _, issue := range issues {
+			assert.NotContains(t, issue, "is not valid", "strategy %q", strategy)
+		}
+	}
+	for _, format := range validOutputFormats {
+		var issues []string
+		validateOutput(&shardConfig{OutputFormat: format}, &issues)
+		for _, issue := range issues {
+			assert.NotContains(t, issue, "is not valid", "output_format %q", format)
+		}
+	}
+}
+
+func TestWriteOptions_InvalidOutput(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeOptions(&buf, "yaml")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --output "yaml"`)
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,185 @@
+package cmd
+
+// rawsource.go implements source_type raw_endpoint, an escape hatch for
+// sources this tool does not model: raw_path is fetched with one GET through
+// the SDK's authenticated transport, and raw_id_jsonpath picks the IDs out of
+// the JSON response.
+//
+// raw_id_jsonpath supports the subset of JSONPath needed to reach a list of
+// IDs: the root $, child members (.name or ['name']), array indexes ([0]),
+// and wildcards (.* or [*]). Recursive descent, slices, and filters are not
+// supported.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro"
+)
+
+// jsonPathStep is one segment of a parsed JSONPath expression. A wildcard
+// step matches every member or element; otherwise name selects an object
+// member, or index an array element when isIndex is set.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// fetchRawEndpoint GETs raw_path and returns the IDs raw_id_jsonpath selects
+// from the response, in document order.
+func fetchRawEndpoint(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) ([]string, error) {
+	_, body, err := client.
+		GetTransport().
+		NewRequest(ctx).
+		SetHeader("Accept", "application/json").
+		GetBytes(cfg.RawPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve raw_path %s: %w", cfg.RawPath, err)
+	}
+	ids, err := extractJSONPathIDs(body, cfg.RawIDJSONPath)
+	if err != nil {
+		return nil, fmt.Errorf("raw_path %s: %w", cfg.RawPath, err)
+	}
+	return ids, nil
+}
+
+// extractJSONPathIDs evaluates expr against the JSON document body and
+// returns the matched values as IDs. Each match must be a string or a number;
+// numbers keep the digits they were written with.
+func extractJSONPathIDs(body []byte, expr string) ([]string, error) {
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("raw_id_jsonpath %q is not valid: %w", expr, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+
+	var ids []string
+	for _, match := range evalJSONPath(doc, steps) {
+		switch v := match.(type) {
+		case string:
+			if v == "" {
+				return nil, fmt.Errorf("raw_id_jsonpath %q matched an empty string", expr)
+			}
+			ids = append(ids, v)
+		case json.Number:
+			ids = append(ids, v.String())
+		default:
+			return nil, fmt.Errorf("raw_id_jsonpath %q matched %s, not a string or number — "+
+				"point it at the ID values themselves", expr, jsonKind(match))
+		}
+	}
+	return ids, nil
+}
+
+// evalJSONPath applies steps to doc and returns every value they reach.
+// Object wildcards visit members in key order, so the result is stable.
+func evalJSONPath(doc any, steps []jsonPathStep) []any {
+	nodes := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, key := range slices.Sorted(maps.Keys(v)) {
+						next = append(next, v[key])
+					}
+				} else if child, ok := v[step.name]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex && step.index < len(v) {
+					next = append(next, v[step.index])
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// parseJSONPath parses expr into steps, rejecting anything outside the
+// supported subset.
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return nil, fmt.Errorf("must start with $")
+	}
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, ".") {
+				return nil, fmt.Errorf("recursive descent (..) is not supported")
+			}
+			if strings.HasPrefix(rest, "*") {
+				steps = append(steps, jsonPathStep{wildcard: true})
+				rest = rest[1:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("missing member name after '.'")
+			}
+			steps = append(steps, jsonPathStep{name: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '['")
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{name: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("[%s] is not supported — use [N], [*], or ['name']", inner)
+				}
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q — expected '.' or '['", rest[:1])
+		}
+	}
+	return steps, nil
+}
+
+// jsonKind names the JSON type of a decoded value for error messages.
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case bool:
+		return "a boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
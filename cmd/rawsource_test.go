@@ -0,0 +1,165 @@
+package cmd
+
+// rawsource_test.go contains tests for source_type raw_endpoint in
+// rawsource.go.
+//
+//   TestParseJSONPath          — the supported subset and what it rejects
+//   TestExtractJSONPathIDs*    — selecting IDs from a response
+//   TestFetchRawEndpoint*      — the GET through the SDK transport
+//   TestRunShard_RawEndpoint   — sharding a raw endpoint end to end
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	steps, err := parseJSONPath(`$.results[*]['id']`)
+	require.NoError(t, err)
+	assert.Equal(t, []jsonPathStep{{name: "results"}, {wildcard: true}, {name: "id"}}, steps)
+
+	steps, err = parseJSONPath(`$.pages[2].*.id`)
+	require.NoError(t, err)
+	assert.Equal(t, []jsonPathStep{{name: "pages"}, {index: 2, isIndex: true}, {wildcard: true}, {name: "id"}}, steps)
+
+	tests := []struct {
+		expr, wantErr string
+	}{
+		{expr: "results[*].id", wantErr: "must start with $"},
+		{expr: "$..id", wantErr: "recursive descent"},
+		{expr: "$.results[*", wantErr: "unclosed"},
+		{expr: "$.results[?(@.managed)].id", wantErr: "is not supported"},
+		{expr: "$.results[0:2].id", wantErr: "is not supported"},
+		{expr: "$.results[-1].id", wantErr: "is not supported"},
+		{expr: "$.", wantErr: "missing member name"},
+		{expr: "$results", wantErr: "expected '.' or '['"},
+	}
+	for _, tt := range tests {
+		_, err := parseJSONPath(tt.expr)
+
+		require.Error(t, err, tt.expr)
+		assert.Contains(t, err.Error(), tt.wantErr, tt.expr)
+	}
+}
+
+func TestExtractJSONPathIDs(t *testing.T) {
+	body := []byte(`{
+		"totalCount": 3,
+		"results": [
+			{"id": "12", "name": "Pilot"},
+			{"id": 7, "name": "Finance"},
+			{"id": "12000000000000000001", "name": "Large"}
+		],
+		"byName": {"b": {"id": 2}, "a": {"id": 1}}
+	}`)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "$.results[*].id", want: []string{"12", "7", "12000000000000000001"}},
+		{expr: "$['results'][1]['id']", want: []string{"7"}},
+		{expr: "$.byName.*.id", want: []string{"1", "2"}},
+		{expr: "$.results[9].id", want: nil},
+		{expr: "$.missing[*].id", want: nil},
+	}
+	for _, tt := range tests {
+		ids, err := extractJSONPathIDs(body, tt.expr)
+
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, ids, tt.expr)
+	}
+}
+
+func TestExtractJSONPathIDs_Errors(t *testing.T) {
+	body := []byte(`{"results": [{"id": "1", "name": ""}], "managed": true}`)
+
+	tests := []struct {
+		body    []byte
+		expr    string
+		wantErr string
+	}{
+		{body: body, expr: "$.results[*]", wantErr: "matched an object, not a string or number"},
+		{body: body, expr: "$.results", wantErr: "matched an array"},
+		{body: body, expr: "$.managed", wantErr: "matched a boolean"},
+		{body: body, expr: "$.results[*].name", wantErr: "matched an empty string"},
+		{body: body, expr: "$..id", wantErr: "is not valid"},
+		{body: []byte(`<html>`), expr: "$.results[*].id", wantErr: "not valid JSON"},
+	}
+	for _, tt := range tests {
+		_, err := extractJSONPathIDs(tt.body, tt.expr)
+
+		require.Error(t, err, tt.expr)
+		assert.Contains(t, err.Error(), tt.wantErr, tt.expr)
+	}
+}
+
+func TestFetchRawEndpoint_Success(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/api/v1/departments": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer mock-token", r.Header.Get("Authorization"), "Sent through the authenticated transport")
+			assert.Equal(t, "200", r.URL.Query().Get("page-size"), "Query string in raw_path is kept")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"totalCount": 2, "results": [{"id": "4", "name": "IT"}, {"id": "9", "name": "Sales"}]}`))
+		},
+	}
+	_, client := setupMockServer(t, handlers)
+	cfg := &shardConfig{RawPath: "/api/v1/departments?page-size=200", RawIDJSONPath: "$.results[*].id"}
+
+	ids, err := fetchRawEndpoint(context.Background(), client, cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4", "9"}, ids)
+}
+
+func TestFetchRawEndpoint_NotFound(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/oauth/token": oauthTokenHandler,
+		"/api/v1/unknown": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		},
+	}
+	_, client := setupMockServer(t, handlers)
+	cfg := &shardConfig{RawPath: "/api/v1/unknown", RawIDJSONPath: "$.results[*].id"}
+
+	_, err := fetchRawEndpoint(context.Background(), client, cfg)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to retrieve raw_path /api/v1/unknown")
+}
+
+func TestRunShard_RawEndpoint(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	outputFile := filepath.Join(t.TempDir(), "output.json")
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "raw_endpoint")
+	viper.Set("raw_path", "/api/v3/computers-inventory?page-size=100")
+	viper.Set("raw_id_jsonpath", "$.results[*].id")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 2)
+	viper.Set("output_format", "json")
+	viper.Set("output_file", outputFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+
+	require.NoError(t, runShard(cmd, []string{}))
+
+	result, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v3/computers-inventory?page-size=100", result.Metadata.RawPath)
+	assert.Len(t, resultIDs(result), 50)
+}
@@ -3,13 +3,25 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile string
+	cfgEnv  string
+	quiet   bool
+	verbose bool
+
+	// configErr is a config file problem found by initConfig, which cannot
+	// return errors itself; rootCmd's PersistentPreRunE reports it.
+	configErr error
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "go-jamf-guid-sharder",
@@ -24,13 +36,17 @@ Supported sharding strategies:
   size          Fixed absolute shard sizes with optional remainder (-1)
   rendezvous    Highest Random Weight (HRW) consistent hashing — minimal
                 disruption when shard count changes
+  balanced      Greedy least-loaded assignment, counting reserved IDs
+  hash-ring     Consistent hashing with virtual nodes
 
 Configuration can be supplied via:
-  1. A config file (YAML or JSON) — default: ./go-jamf-guid-sharder.yaml
+  1. A config file (YAML or JSON) — default: ./go-jamf-guid-sharder.yaml,
+     .yml, or .json; --env <name> loads $JAMF_CONFIG_DIR/<name>.yaml instead
   2. Environment variables prefixed with JAMF_  (e.g. JAMF_INSTANCE_DOMAIN)
   3. Command-line flags
 
 Output is written as JSON or YAML to stdout or a file.`,
+	PersistentPreRunE: func(*cobra.Command, []string) error { return configErr },
 }
 
 // Execute is the entry point called from main.
@@ -43,19 +59,41 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file path (default: ./go-jamf-guid-sharder.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file path (default: ./go-jamf-guid-sharder.yaml, .yml, or .json)")
+	rootCmd.PersistentFlags().StringVar(&cfgEnv, "env", "", "load <env>.yaml, .yml, or .json from $JAMF_CONFIG_DIR (ignored when --config is set)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress all non-error output on stderr")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print the resolved configuration (secrets masked) and phase timings to stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
 	// Don't reprint the full usage block on every validation error — the error
 	// message itself is already actionable. Users can run --help explicitly.
 	rootCmd.SilenceUsage = true
 }
 
+// defaultConfigName is the config file looked for in the current directory
+// when --config is not given, with one of defaultConfigExts appended.
+const defaultConfigName = "go-jamf-guid-sharder"
+
+// defaultConfigExts lists the extensions tried for the default config file,
+// in order of preference.
+var defaultConfigExts = []string{"yaml", "yml", "json"}
+
 func initConfig() {
+	// SetConfigFile lets viper pick the parser from the file extension, so a
+	// .json file is read as JSON whether it was passed or discovered.
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
-	} else {
-		viper.AddConfigPath(".")
-		viper.SetConfigName("go-jamf-guid-sharder")
-		viper.SetConfigType("yaml")
+		if cfgEnv != "" {
+			warnf("--config is set; ignoring --env %q", cfgEnv)
+		}
+	} else if cfgEnv != "" {
+		path, err := envConfigPath(os.Getenv("JAMF_CONFIG_DIR"), cfgEnv)
+		if err != nil {
+			configErr = err
+			return
+		}
+		viper.SetConfigFile(path)
+	} else if path := findDefaultConfig("."); path != "" {
+		viper.SetConfigFile(path)
 	}
 
 	// Environment variable support: JAMF_INSTANCE_DOMAIN, JAMF_CLIENT_ID, etc.
@@ -64,6 +102,133 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		infof("Using config file: %s", viper.ConfigFileUsed())
+	}
+}
+
+// findDefaultConfig returns the go-jamf-guid-sharder.<ext> config file in dir,
+// or "" when there is none.
+func findDefaultConfig(dir string) string {
+	return findConfig(dir, defaultConfigName)
+}
+
+// envConfigPath returns the config file for --env: <env>.<ext> in dir, which
+// comes from JAMF_CONFIG_DIR.
+func envConfigPath(dir, env string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("--env %q needs JAMF_CONFIG_DIR set to the directory holding %s.yaml", env, env)
+	}
+	if strings.ContainsAny(env, `/\`) || env == "." || env == ".." {
+		return "", fmt.Errorf("--env %q must be a name, not a path — use --config for a path", env)
+	}
+	path := findConfig(dir, env)
+	if path == "" {
+		return "", fmt.Errorf("no config file for --env %q in %s (looked for %s.yaml, %s.yml, and %s.json)",
+			env, dir, env, env, env)
+	}
+	return path, nil
+}
+
+// findConfig returns the first <name>.<ext> in dir, trying defaultConfigExts
+// in order, or "" when there is none. When more than one exists, the others
+// are reported as ignored.
+func findConfig(dir, name string) string {
+	var found []string
+	for _, ext := range defaultConfigExts {
+		path := filepath.Join(dir, name+"."+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			found = append(found, path)
+		}
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	if len(found) > 1 {
+		warnf("found %s; using %s — pass --config to choose another", strings.Join(found, ", "), found[0])
+	}
+	return found[0]
+}
+
+// ── stderr messages ───────────────────────────────────────────────────────────
+
+// infof prints a status message to stderr unless --quiet is set.
+func infof(format string, args ...any) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// warnf prints a "Warning:" line to stderr unless --quiet is set.
+func warnf(format string, args ...any) {
+	infof("Warning: "+format, args...)
+}
+
+// verbosef prints a diagnostic message to stderr only when --verbose is set.
+func verbosef(format string, args ...any) {
+	if !verbose {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// logPhase reports, under --verbose, how long a phase of the run took.
+func logPhase(name string, start time.Time) {
+	verbosef("%s took %s", name, time.Since(start).Round(time.Millisecond))
+}
+
+// sensitiveConfigKeys are masked by logResolvedConfig when
+// hide_sensitive_data is set, and always in the audit_file.
+var sensitiveConfigKeys = map[string]bool{
+	"client_secret":       true,
+	"basic_auth_password": true,
+}
+
+// logResolvedConfig prints every config key and its resolved value under
+// --verbose, in struct declaration order.
+func logResolvedConfig(cfg *shardConfig) {
+	if !verbose {
+		return
+	}
+	verbosef("Resolved configuration:")
+	for _, line := range describeConfig(cfg) {
+		verbosef("  %s", line)
+	}
+}
+
+// describeConfig renders cfg as "key: value" lines keyed by mapstructure tag.
+// Non-empty secrets are replaced with "********" when HideSensitiveData is set.
+func describeConfig(cfg *shardConfig) []string {
+	fields := configFields(cfg, cfg.HideSensitiveData)
+	lines := make([]string, 0, len(fields))
+	for _, field := range fields {
+		lines = append(lines, fmt.Sprintf("%s: %v", field.key, field.value))
+	}
+	return lines
+}
+
+// configField is one config setting, keyed by its mapstructure tag.
+type configField struct {
+	key   string
+	value any
+}
+
+// configFields returns every setting of cfg in struct declaration order.
+// With redact set, non-empty secrets are replaced with "********".
+func configFields(cfg *shardConfig, redact bool) []configField {
+	v := reflect.ValueOf(*cfg)
+	t := v.Type()
+	fields := make([]configField, 0, t.NumField())
+	for i := range t.NumField() {
+		key := configKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+		var value any = v.Field(i).Interface()
+		if redact && sensitiveConfigKeys[key] && !v.Field(i).IsZero() {
+			value = "********"
+		}
+		fields = append(fields, configField{key: key, value: value})
 	}
+	return fields
 }
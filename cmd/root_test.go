@@ -0,0 +1,170 @@
+package cmd
+
+// root_test.go contains unit tests for the stderr helpers in root.go.
+//
+//   TestDescribeConfig_*        — key order, secret masking, hand-decoded keys
+//   TestInfof_* / TestVerbosef  — --quiet and --verbose gating
+//   TestFindDefaultConfig_*     — default config file discovery
+//   TestEnvConfigPath_*         — --env config file resolution
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureStderr returns everything written to os.Stderr while fn runs.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	original := os.Stderr
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = w
+
+	fn()
+
+	w.Close()
+	os.Stderr = original
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+// setOutputMode sets the --quiet and --verbose globals for one test.
+func setOutputMode(t *testing.T, q, v bool) {
+	oldQuiet, oldVerbose := quiet, verbose
+	quiet, verbose = q, v
+	t.Cleanup(func() { quiet, verbose = oldQuiet, oldVerbose })
+}
+
+func TestDescribeConfig_MasksSecretsWhenHidingSensitiveData(t *testing.T) {
+	cfg := &shardConfig{
+		InstanceDomain:    "https://example.jamfcloud.com",
+		ClientID:          "client",
+		ClientSecret:      "super-secret",
+		Password:          "hunter2",
+		HideSensitiveData: true,
+		ShardCount:        3,
+	}
+
+	lines := describeConfig(cfg)
+
+	assert.Equal(t, "instance_domain: https://example.jamfcloud.com", lines[0])
+	assert.Contains(t, lines, "client_id: client")
+	assert.Contains(t, lines, "client_secret: ********")
+	assert.Contains(t, lines, "basic_auth_password: ********")
+	assert.Contains(t, lines, "shard_count: 3")
+	for _, line := range lines {
+		assert.NotContains(t, line, "super-secret")
+		assert.NotContains(t, line, "hunter2")
+	}
+}
+
+func TestDescribeConfig_ShowsSecretsWhenNotHiding(t *testing.T) {
+	cfg := &shardConfig{ClientSecret: "super-secret"}
+
+	lines := describeConfig(cfg)
+
+	assert.Contains(t, lines, "client_secret: super-secret")
+	assert.Contains(t, lines, "basic_auth_password: ", "Empty secrets are not masked")
+}
+
+func TestDescribeConfig_IncludesPerShardSeeds(t *testing.T) {
+	cfg := &shardConfig{PerShardSeeds: map[string]string{"shard_1": "beta"}}
+
+	lines := describeConfig(cfg)
+
+	assert.Contains(t, lines, "per_shard_seeds: map[shard_1:beta]", "Decoded by hand, but still a setting")
+}
+
+func TestInfof_QuietSuppressesOutput(t *testing.T) {
+	setOutputMode(t, true, false)
+
+	out := captureStderr(t, func() {
+		infof("Output written to %s", "out.json")
+		warnf("something odd")
+	})
+
+	assert.Empty(t, out)
+}
+
+func TestInfof_DefaultPrints(t *testing.T) {
+	setOutputMode(t, false, false)
+
+	out := captureStderr(t, func() {
+		infof("Output written to %s", "out.json")
+		warnf("%d shard(s) empty", 2)
+		verbosef("hidden")
+	})
+
+	assert.Equal(t, "Output written to out.json\nWarning: 2 shard(s) empty\n", out)
+}
+
+func TestVerbosef_PrintsConfigAndPhases(t *testing.T) {
+	setOutputMode(t, false, true)
+
+	out := captureStderr(t, func() {
+		logResolvedConfig(&shardConfig{ClientSecret: "s", HideSensitiveData: true})
+	})
+
+	assert.Contains(t, out, "Resolved configuration:\n")
+	assert.Contains(t, out, "  client_secret: ********\n")
+}
+
+func TestFindDefaultConfig_None(t *testing.T) {
+	assert.Empty(t, findDefaultConfig(t.TempDir()))
+}
+
+func TestFindDefaultConfig_JSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go-jamf-guid-sharder.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"shard_count": 3}`), 0o644))
+
+	assert.Equal(t, path, findDefaultConfig(dir))
+}
+
+func TestFindDefaultConfig_PrefersYAML(t *testing.T) {
+	setOutputMode(t, false, false)
+	dir := t.TempDir()
+	for _, name := range []string{"go-jamf-guid-sharder.json", "go-jamf-guid-sharder.yml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644))
+	}
+
+	var path string
+	stderr := captureStderr(t, func() { path = findDefaultConfig(dir) })
+
+	assert.Equal(t, filepath.Join(dir, "go-jamf-guid-sharder.yml"), path)
+	assert.Contains(t, stderr, "Warning: found")
+	assert.Contains(t, stderr, "go-jamf-guid-sharder.json")
+}
+
+func TestEnvConfigPath_Found(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prod.yml")
+	require.NoError(t, os.WriteFile(path, []byte("shard_count: 3\n"), 0o644))
+
+	got, err := envConfigPath(dir, "prod")
+
+	require.NoError(t, err)
+	assert.Equal(t, path, got)
+}
+
+func TestEnvConfigPath_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := envConfigPath("", "prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `--env "prod" needs JAMF_CONFIG_DIR set`)
+
+	_, err = envConfigPath(dir, "staging")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no config file for --env "staging" in `+dir)
+
+	_, err = envConfigPath(dir, "../prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be a name, not a path")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+// runlog.go implements run_log: one JSON line per phase of a shard run, for
+// monitoring scheduled runs. It is separate from the SDK's HTTP logging
+// (log_export_path).
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runLogRecord is one line of the run log. Count is the number of IDs the
+// phase finished with; Error is only set on the final "run" record of a
+// failed run.
+type runLogRecord struct {
+	Time       time.Time `json:"time"`
+	Phase      string    `json:"phase"`
+	DurationMs int64     `json:"duration_ms"`
+	Count      int       `json:"count"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// runLogger appends runLogRecords to the run_log file. A nil *runLogger
+// discards every record, so callers need not check whether run_log is set.
+type runLogger struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openRunLog opens path for appending, creating it if needed, so scheduled
+// runs accumulate in one file. An empty path returns a nil logger.
+func openRunLog(path string) (*runLogger, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run_log %s: %w", path, err)
+	}
+	return &runLogger{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// phase records that the named phase, started at start, finished with count
+// IDs.
+func (l *runLogger) phase(name string, start time.Time, count int) {
+	l.write(runLogRecord{Phase: name, DurationMs: time.Since(start).Milliseconds(), Count: count}, nil)
+}
+
+// finish records the whole run as a final "run" phase, with runErr when it
+// failed, and closes the file.
+func (l *runLogger) finish(start time.Time, count int, runErr error) {
+	if l == nil {
+		return
+	}
+	l.write(runLogRecord{Phase: "run", DurationMs: time.Since(start).Milliseconds(), Count: count}, runErr)
+	if err := l.f.Close(); err != nil {
+		warnf("failed to close run_log %s: %v", l.f.Name(), err)
+	}
+}
+
+// write appends record. The run log is diagnostic, so a failed write is
+// reported as a warning rather than failing the run.
+func (l *runLogger) write(record runLogRecord, runErr error) {
+	if l == nil {
+		return
+	}
+	record.Time = time.Now().UTC()
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	if err := l.enc.Encode(record); err != nil {
+		warnf("failed to write run_log %s: %v", l.f.Name(), err)
+	}
+}
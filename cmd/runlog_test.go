@@ -0,0 +1,72 @@
+package cmd
+
+// runlog_test.go contains tests for the run_log writer in runlog.go.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRunLog decodes every line of the run log at path.
+func readRunLog(t *testing.T, path string) []runLogRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []runLogRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record runLogRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestOpenRunLog_Unset(t *testing.T) {
+	runLog, err := openRunLog("")
+
+	require.NoError(t, err)
+	assert.Nil(t, runLog)
+	// A nil logger discards records.
+	runLog.phase("fetch", time.Now(), 1)
+	runLog.finish(time.Now(), 1, nil)
+}
+
+func TestOpenRunLog_Unwritable(t *testing.T) {
+	_, err := openRunLog(filepath.Join(t.TempDir(), "missing", "run.log"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open run_log")
+}
+
+func TestRunLogger_AppendsAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.log")
+
+	for _, runErr := range []error{nil, errors.New("fetch failed")} {
+		runLog, err := openRunLog(path)
+		require.NoError(t, err)
+		runLog.phase("fetch", time.Now().Add(-1500*time.Millisecond), 4000)
+		runLog.finish(time.Now(), 4000, runErr)
+	}
+
+	records := readRunLog(t, path)
+	require.Len(t, records, 4)
+	assert.Equal(t, "fetch", records[0].Phase)
+	assert.GreaterOrEqual(t, records[0].DurationMs, int64(1500))
+	assert.Equal(t, 4000, records[0].Count)
+	assert.False(t, records[0].Time.IsZero())
+	assert.Equal(t, "run", records[1].Phase)
+	assert.Empty(t, records[1].Error)
+	assert.Equal(t, "fetch failed", records[3].Error)
+}
@@ -0,0 +1,185 @@
+package cmd
+
+// selftest.go implements the `selftest` command: shard the same fetched IDs
+// twice with one configuration and check that both runs produce the same
+// result, to catch non-determinism in a strategy or its options.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check that a shard configuration produces reproducible output",
+	Long: `Connects to Jamf Pro, fetches IDs from the specified source once, and runs
+every sharding step — exclusions, reservations, the strategy, overflow, and
+sort order — on that ID set twice. Passes when both runs produce the same
+result_hash, and exits non-zero otherwise, naming the first shard that
+differs.
+
+Because both runs see the same IDs, a failure means the configuration itself
+is not deterministic, not that the source changed between runs.
+
+Examples:
+  go-jamf-guid-sharder selftest --config ./config.yaml
+
+  go-jamf-guid-sharder selftest --config ./config.yaml \
+    --strategy rendezvous --shard-count 4 --seed wave-1 --output json`,
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd, "output") },
+	RunE:   runSelftest,
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+
+	addConnectionFlags(selftestCmd)
+	addSourceFlags(selftestCmd)
+	addShardingFlags(selftestCmd)
+	selftestCmd.Flags().String("sort-order", "numeric-asc", "Order of IDs within each shard: numeric-asc, numeric-desc, or api")
+	selftestCmd.Flags().String("output", "text", "Report format: text or json")
+}
+
+// selftestReport is the outcome printed by the selftest command.
+// FirstDifference names the first shard whose IDs differ between the runs.
+type selftestReport struct {
+	Reproducible    bool     `json:"reproducible"`
+	IDCount         int      `json:"id_count"`
+	ResultHashes    []string `json:"result_hashes"`
+	FirstDifference string   `json:"first_difference,omitempty"`
+}
+
+func runSelftest(cmd *cobra.Command, _ []string) (err error) {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid --output %q: must be one of: text, json", output)
+	}
+
+	cfg, err := loadShardConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := resolveSeed(cfg); err != nil {
+		return err
+	}
+	logResolvedConfig(cfg)
+	// --output here is the report format, so no flag supplies the
+	// output_format default that shard gets from its own --output.
+	if cfg.OutputFormat == "" {
+		cfg.OutputFormat = "json"
+	}
+	if err := validateShardConfig(cfg); err != nil {
+		return err
+	}
+
+	ctx, cancel := newRunContext(cfg)
+	defer cancel()
+	phase := "building the Jamf Pro client"
+	defer func() { err = runTimeoutError(ctx, cfg, phase, err) }()
+	enterPhase := func(name string) error {
+		phase = name
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	fetched, err := loadSourceIDs(ctx, cfg, enterPhase)
+	if err != nil {
+		return err
+	}
+	logPhase(fmt.Sprintf("Fetching %d ID(s) from %s", len(fetched.IDs), cfg.SourceType), start)
+
+	results := make([]*ShardResult, 2)
+	for i := range results {
+		start := time.Now()
+		results[i], err = shardFetched(selftestRunConfig(cfg), selftestRunIDs(fetched), nil, enterPhase)
+		if err != nil {
+			return fmt.Errorf("run %d: %w", i+1, err)
+		}
+		logPhase(fmt.Sprintf("Run %d with %s", i+1, cfg.Strategy), start)
+	}
+
+	report := compareSelftestResults(len(fetched.IDs), results[0], results[1])
+	if output == "json" {
+		if err := json.NewEncoder(cmd.OutOrStdout()).Encode(report); err != nil {
+			return err
+		}
+	} else if err := writeSelftestReport(cmd.OutOrStdout(), report); err != nil {
+		return err
+	}
+	if !report.Reproducible {
+		return fmt.Errorf("result_hash differs between runs (%s): the configuration does not shard deterministically",
+			report.FirstDifference)
+	}
+	return nil
+}
+
+// selftestRunConfig returns a copy of cfg for one run, so settings a run
+// rewrites, such as shard_sizes under auto_shards, start afresh each time.
+func selftestRunConfig(cfg *shardConfig) *shardConfig {
+	run := *cfg
+	run.ShardSizes = slices.Clone(cfg.ShardSizes)
+	return &run
+}
+
+// selftestRunIDs returns a copy of fetched with its own ID slice, so one run
+// cannot affect the next through the shared pool.
+func selftestRunIDs(fetched *sourceFetchResult) *sourceFetchResult {
+	run := *fetched
+	run.IDs = slices.Clone(fetched.IDs)
+	return &run
+}
+
+// compareSelftestResults reports whether first and second hold the same
+// shard assignment. When they differ, FirstDifference names the first shard,
+// in shard order, whose IDs are not the same in both.
+func compareSelftestResults(idCount int, first, second *ShardResult) *selftestReport {
+	report := &selftestReport{
+		Reproducible: first.Metadata.ResultHash == second.Metadata.ResultHash,
+		IDCount:      idCount,
+		ResultHashes: []string{first.Metadata.ResultHash, second.Metadata.ResultHash},
+	}
+	if report.Reproducible {
+		return report
+	}
+
+	names := sortedShardNames(first.Shards)
+	for _, name := range sortedShardNames(second.Shards) {
+		if _, ok := first.Shards[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		a, inFirst := first.Shards[name]
+		b, inSecond := second.Shards[name]
+		if !inFirst || !inSecond {
+			report.FirstDifference = fmt.Sprintf("%s is only in one run", name)
+			break
+		}
+		if !slices.Equal(a, b) {
+			report.FirstDifference = fmt.Sprintf("%s differs", name)
+			break
+		}
+	}
+	return report
+}
+
+// writeSelftestReport prints report as an aligned, human-readable summary.
+func writeSelftestReport(w io.Writer, report *selftestReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "IDs fetched:\t%d\n", report.IDCount)
+	for i, hash := range report.ResultHashes {
+		fmt.Fprintf(tw, "Run %d result_hash:\t%s\n", i+1, hash)
+	}
+	if report.Reproducible {
+		fmt.Fprintf(tw, "Result:\treproducible\n")
+	} else {
+		fmt.Fprintf(tw, "Result:\tNOT reproducible (%s)\n", report.FirstDifference)
+	}
+	return tw.Flush()
+}
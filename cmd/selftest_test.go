@@ -0,0 +1,111 @@
+package cmd
+
+// selftest_test.go contains tests for the `selftest` command in selftest.go.
+//
+//   TestCompareSelftestResults_*  — hash comparison and first differing shard
+//   TestRunSelftest_*             — end-to-end against the integration mock server
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selftestResult returns a ShardResult for shards with its hash filled in.
+func selftestResult(shards map[string][]string) *ShardResult {
+	return &ShardResult{
+		Metadata: ShardMetadata{ResultHash: computeResultHash(shards)},
+		Shards:   shards,
+	}
+}
+
+func TestCompareSelftestResults_Identical(t *testing.T) {
+	first := selftestResult(map[string][]string{"shard_0": {"1", "3"}, "shard_1": {"2"}})
+	second := selftestResult(map[string][]string{"shard_0": {"1", "3"}, "shard_1": {"2"}})
+
+	report := compareSelftestResults(3, first, second)
+
+	assert.True(t, report.Reproducible)
+	assert.Equal(t, 3, report.IDCount)
+	assert.Equal(t, []string{first.Metadata.ResultHash, first.Metadata.ResultHash}, report.ResultHashes)
+	assert.Empty(t, report.FirstDifference)
+}
+
+func TestCompareSelftestResults_FirstDifferingShard(t *testing.T) {
+	first := selftestResult(map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}, "shard_2": {"3"}})
+	second := selftestResult(map[string][]string{"shard_0": {"1"}, "shard_1": {"3"}, "shard_2": {"2"}})
+
+	report := compareSelftestResults(3, first, second)
+
+	assert.False(t, report.Reproducible)
+	assert.Equal(t, "shard_1 differs", report.FirstDifference)
+}
+
+func TestCompareSelftestResults_ShardOnlyInOneRun(t *testing.T) {
+	first := selftestResult(map[string][]string{"shard_0": {"1", "2"}})
+	second := selftestResult(map[string][]string{"shard_0": {"1", "2"}, "shard_1": {}})
+
+	report := compareSelftestResults(2, first, second)
+
+	assert.False(t, report.Reproducible)
+	assert.Equal(t, "shard_1 is only in one run", report.FirstDifference)
+}
+
+func TestWriteSelftestReport_Layout(t *testing.T) {
+	var buf bytes.Buffer
+	report := &selftestReport{IDCount: 50, ResultHashes: []string{"abc", "def"}, FirstDifference: "shard_0 differs"}
+
+	require.NoError(t, writeSelftestReport(&buf, report))
+
+	assert.Contains(t, buf.String(), "Run 2 result_hash:  def")
+	assert.Contains(t, buf.String(), "Result:             NOT reproducible (shard_0 differs)")
+}
+
+func TestRunSelftest_SeededStrategyIsReproducible(t *testing.T) {
+	server, cleanup := setupIntegrationTest(t)
+	defer cleanup()
+
+	viper.Set("instance_domain", server.URL)
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "test-client")
+	viper.Set("client_secret", "test-secret")
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "size")
+	viper.Set("shard_sizes", []string{"15"})
+	viper.Set("auto_shards", true)
+	viper.Set("seed", "selftest")
+	viper.Set("exclude_ids", []string{"1", "2"})
+
+	var buf bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	cmd.Flags().String("output", "json", "")
+	cmd.SetOut(&buf)
+
+	require.NoError(t, runSelftest(cmd, []string{}))
+
+	var report selftestReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.True(t, report.Reproducible)
+	assert.Equal(t, 50, report.IDCount)
+	require.Len(t, report.ResultHashes, 2)
+	assert.NotEmpty(t, report.ResultHashes[0])
+}
+
+func TestRunSelftest_InvalidConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", "text", "")
+
+	err := runSelftest(cmd, []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "configuration validation failed")
+}
@@ -1,17 +1,41 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
 	"github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro"
+	jamfclient "github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro/client"
+	"github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro/jamf_pro_api/computer_inventory"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/net/http/httpproxy"
 	"gopkg.in/yaml.v3"
+	"resty.dev/v3"
 )
 
 var shardCmd = &cobra.Command{
@@ -38,119 +62,654 @@ Examples:
   go-jamf-guid-sharder shard --config ./config.yaml \
     --strategy size --shard-sizes 50,200,-1 \
     --output yaml --output-file shards.yaml`,
-	RunE: runShard,
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd) },
+	RunE:   runShard,
 }
 
 func init() {
 	rootCmd.AddCommand(shardCmd)
 
+	addConnectionFlags(shardCmd)
+
+	// ── Sharding ──────────────────────────────────────────────────────────────
+	addSourceFlags(shardCmd)
+	addShardingFlags(shardCmd)
+
+	// ── Safety checks ─────────────────────────────────────────────────────────
+	shardCmd.Flags().Bool("fail-on-duplicates", false, "Fail instead of silently removing duplicate IDs returned by the source API")
+	shardCmd.Flags().Bool("fail-on-empty-source", false, "Fail instead of warning when the source returns no IDs")
+	shardCmd.Flags().Bool("fail-on-empty-shards", false, "Fail instead of warning when the shard count exceeds the number of distributable IDs")
+	shardCmd.Flags().Bool("fail-on-oversized", false, "Fail instead of warning when the fixed shard_sizes add up to more than the available IDs")
+	shardCmd.Flags().Bool("fail-on-missing-reserved", false, "Fail instead of warning when a reserved ID is not in the source pool")
+	shardCmd.Flags().Bool("fail-on-undersized", false, "Fail instead of topping up when a non-empty shard has fewer than --min-shard-size IDs")
+	shardCmd.Flags().Bool("fail-on-unused-excludes", false, "Fail instead of warning when an --exclude-ids entry is not in the source pool")
+	shardCmd.Flags().Bool("fail-on-warnings", false, "Fail, listing them, when the run produces any warning, before output is written")
+	shardCmd.Flags().Bool("strict-source-match", false, "Fail instead of warning when the source API returns an ID that is not numeric")
+
+	// ── Output ────────────────────────────────────────────────────────────────
+	shardCmd.Flags().StringP("output", "o", "json", "Output format: json, yaml, ndjson (one {shard, id} object per line),\n"+
+		"json-detailed (each shard entry is an {id, managed} object; *_inventory sources only),\n"+
+		"or null (run everything but discard the result, for benchmarking)")
+	shardCmd.Flags().String("output-file", "", "Write output to this file path, or upload it to an s3:// or gs://bucket/key URL, instead of stdout;\n"+
+		"may use {{.Date}}, {{.SourceType}}, {{.Strategy}}, and {{.Hash}}")
+	shardCmd.Flags().String("output-dir", "", "Write one file per shard plus a metadata file to this directory instead of stdout")
+	shardCmd.Flags().StringSlice("seeds", []string{}, "Shard the one fetch once per seed, writing <seed>.<format> for each to --output-dir, e.g. alpha,beta,gamma")
+	shardCmd.Flags().String("output-file-mode", "0644", "Permissions, in octal, for the files written by --output-file and --output-dir, e.g. 0600")
+	shardCmd.Flags().Bool("atomic-write", false, "Write each output file to a temporary file beside it and rename it into place, so an interrupted run never leaves a partial file")
+	shardCmd.Flags().String("sort-order", "numeric-asc", "Order of IDs within each shard:\n"+
+		"  numeric-asc   — ascending numeric order\n"+
+		"  numeric-desc  — descending numeric order\n"+
+		"  api           — the order IDs were returned by the Jamf Pro API")
+	shardCmd.Flags().String("shard-order", "index", "Numbering of the output shards:\n"+
+		"  index      — as the strategy numbered them\n"+
+		"  size-desc  — renumbered largest first\n"+
+		"  size-asc   — renumbered smallest first")
+	shardCmd.Flags().Bool("print-hash-only", false, "Print only the result hash to stdout instead of the full output")
+	shardCmd.Flags().StringSlice("only-shards", []string{}, "Output only these shards, keeping the shard map, e.g. shard_3,shard_4; metadata still describes every shard")
+	shardCmd.Flags().String("select-shard", "", "Output only this shard's IDs as a plain list, e.g. shard_2 (json or yaml output)")
+	shardCmd.Flags().Int("preview-count", 0, "Output only the first N IDs of each shard; metadata still describes the full result (0 = all)")
+	shardCmd.Flags().Bool("histogram", false, "Print an ASCII bar chart of shard sizes to stderr")
+	shardCmd.Flags().Bool("explain", false, "Record how each ID was placed (hash weights, ring position, or distribution index) in the output")
+	shardCmd.Flags().StringSlice("explain-ids", []string{}, "Limit --explain to these IDs (comma-separated)")
+	shardCmd.Flags().String("run-log", "", "Append one JSON line per run phase (fetch, exclude, reserve, shard, write) to this file")
+	shardCmd.Flags().String("audit-file", "", "Append one JSON line per run, with the redacted config, source counts, and result hash, to this file")
+	shardCmd.Flags().Bool("include-names", false, "Add each device's name to its shard entry (requires --output json-detailed)")
+	shardCmd.Flags().Duration("expires-in", 0, "Record metadata.expires_at this long after generation, e.g. 72h, so stale results are flagged when read back (0 = never)")
+	shardCmd.Flags().Bool("canonical", false, "Leave generated_at and other run-specific fields out of the output, so identical results are byte-for-byte identical")
+	shardCmd.Flags().Bool("yaml-header", false, "Start yaml output with a generated-by comment and a --- document marker (requires --output yaml)")
+}
+
+// addShardingFlags registers the strategy, seed, exclusion, reservation, and
+// shard size flags, shared by shard and validate.
+func addShardingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("strategy", "", "Sharding strategy: round-robin | percentage | size | rendezvous | balanced | hash-ring")
+	cmd.Flags().Int("shard-count", 0, "Number of shards (required for round-robin, rendezvous, balanced, and hash-ring)")
+	cmd.Flags().StringSlice("shard-percentages", []string{}, "Percentages summing to 100, e.g. 10,30,60 or 12.5,37.5,50 (percentage strategy)")
+	cmd.Flags().Bool("allow-partial", false, "Allow shard percentages summing to less than 100; the remainder is left out of every shard")
+	cmd.Flags().Bool("balance-after-reservations", false, "When a shard's reservations exceed its percentage, take the excess from the other shards in proportion (percentage strategy)")
+	cmd.Flags().StringSlice("shard-sizes", []string{}, "Absolute shard sizes; use -1 as last element for remainder, e.g. 50,200,-1 (size strategy)")
+	cmd.Flags().Bool("auto-shards", false, "With one --shard-sizes value, make as many shards of that size as the IDs need, the last holding the remainder")
+	cmd.Flags().StringSlice("shard-weights", []string{}, "Relative per-shard weights, one per shard, e.g. 1,2,1 (rendezvous strategy)")
+	cmd.Flags().Int("round-robin-offset", 0, "Shard the round-robin strategy starts at, e.g. 2 starts at shard_2 (wraps past the last shard)")
+	cmd.Flags().Int("virtual-nodes", 0, "Points each shard places on the ring (required for hash-ring; 100-200 is typical)")
+	cmd.Flags().Bool("parallel", false, "Compute rendezvous assignments on GOMAXPROCS goroutines; output is identical to a serial run (rendezvous strategy)")
+	cmd.Flags().String("seed", "", "Seed for deterministic distribution (supported by all strategies)")
+	cmd.Flags().String("seed-file", "", "Read the seed from this file (whitespace trimmed) when --seed is not set")
+	cmd.Flags().String("seed-salt", "", "Combined with the seed so runs sharing a seed get independent distributions")
+	cmd.Flags().String("per-shard-seeds", "",
+		`JSON map of shard names to seeds that shuffle the order of that shard's IDs,
+e.g. '{"shard_0":"alpha","shard_2":"beta"}'`)
+	cmd.Flags().Bool("stable", false, "Without a seed, distribute IDs in numeric order instead of API order, for reproducible output without shuffling")
+	cmd.Flags().StringSlice("exclude-ids", []string{}, "IDs to completely exclude from all shards (comma-separated)")
+	cmd.Flags().String("exclude-ids-file", "", "JSON or YAML list of IDs, or JSON Lines of {\"id\": ...} objects (.jsonl), to exclude; merged with --exclude-ids")
+	cmd.Flags().String("exclude-from-result", "", "Path to a previous result file; every ID in any of its shards is excluded")
+	cmd.Flags().String("exclude-id-pattern", "", "Regular expression; every fetched ID it matches is excluded from all shards")
+	cmd.Flags().Int("sample-size", 0, "Shard only a deterministic sample of this many fetched IDs, e.g. for a dry run (0 = all)")
+	cmd.Flags().String("sample-seed", "", "Seed that selects the --sample-size sample")
+	cmd.Flags().Float64("holdback-percentage", 0, "Percentage of IDs, e.g. 5, to hold back from every shard as a deterministic control cohort")
+	cmd.Flags().String("holdback-seed", "", "Seed that selects the --holdback-percentage cohort (required with it)")
+	cmd.Flags().String("shard-prefix", defaultShardPrefix, "Prefix of every shard name, e.g. wave_ names the shards wave_0, wave_1, …; also used to read shard names in reserved_ids and other settings")
+	cmd.Flags().String("reserved-ids", "",
+		`JSON map of shard names to ID lists to pin to specific shards,
+e.g. '{"shard_0":["101","102"],"shard_2":["201"]}'`)
+	cmd.Flags().String("reserved-ids-file", "", "JSON or YAML file holding a shard name to ID list map, or JSON Lines of\n"+
+		"{\"id\": ..., \"shard\": ...} objects (.jsonl); merged with --reserved-ids")
+	cmd.Flags().Int("max-ids-per-shard", 0, "Maximum number of IDs allowed in any shard (0 = unlimited)")
+	cmd.Flags().String("overflow", "error", "What to do when a shard exceeds --max-ids-per-shard:\n"+
+		"  error      — fail the run\n"+
+		"  spill      — move the excess into the next shard\n"+
+		"  new-shard  — move the excess into additional shards appended at the end")
+	cmd.Flags().Int("min-shard-size", 0, "Minimum number of IDs in any non-empty shard; smaller shards are topped up from the largest (0 = no minimum)")
+}
+
+// addConnectionFlags registers the authentication and HTTP client tuning
+// flags shared by every command that talks to Jamf Pro.
+func addConnectionFlags(cmd *cobra.Command) {
 	// ── Authentication ────────────────────────────────────────────────────────
-	shardCmd.Flags().String("instance-domain", "", "Jamf Pro instance domain (e.g. company.jamfcloud.com)")
-	shardCmd.Flags().String("auth-method", "oauth2", "Authentication method: oauth2 or basic")
-	shardCmd.Flags().String("client-id", "", "OAuth2 client ID")
-	shardCmd.Flags().String("client-secret", "", "OAuth2 client secret")
-	shardCmd.Flags().String("username", "", "Basic auth username")
-	shardCmd.Flags().String("password", "", "Basic auth password")
+	cmd.Flags().String("instance-domain", "", "Jamf Pro instance domain (e.g. company.jamfcloud.com)")
+	cmd.Flags().String("auth-method", "oauth2", "Authentication method: oauth2 or basic")
+	cmd.Flags().String("client-id", "", "OAuth2 client ID")
+	cmd.Flags().String("client-secret", "", "OAuth2 client secret")
+	cmd.Flags().String("username", "", "Basic auth username")
+	cmd.Flags().String("password", "", "Basic auth password")
+	cmd.Flags().Bool("check-auth", true, "Verify the credentials with one lightweight API call before fetching")
+	// For end-to-end tests: serves source IDs from a JSON file, so no
+	// instance or credentials are needed.
+	cmd.Flags().String("fixture", "", "JSON file mapping source types to ID lists, served in place of Jamf Pro")
+	cmd.Flags().MarkHidden("fixture") //nolint:errcheck
 
 	// ── HTTP client tuning ────────────────────────────────────────────────────
-	shardCmd.Flags().String("log-level", "warn", "Log level: debug, info, warn, error, fatal")
-	shardCmd.Flags().String("log-export-path", "", "Additional log file path (appended to stderr output)")
-	shardCmd.Flags().Bool("hide-sensitive-data", true, "Mask sensitive data in logs")
-	shardCmd.Flags().Bool("jamf-load-balancer-lock", false, "Lock all requests to one Jamf Pro load balancer node")
-	shardCmd.Flags().Int("max-retry-attempts", 3, "Maximum number of retry attempts per request")
-	shardCmd.Flags().Int("max-concurrent-requests", 1, "Maximum number of concurrent API requests")
-	shardCmd.Flags().Bool("enable-dynamic-rate-limiting", false, "Enable dynamic rate limiting")
-	shardCmd.Flags().Int("custom-timeout", 60, "Per-request timeout in seconds")
-	shardCmd.Flags().Int("token-refresh-buffer", 300, "Token refresh buffer period in seconds")
-	shardCmd.Flags().Int("total-retry-duration", 60, "Total retry window duration in seconds")
-	shardCmd.Flags().Bool("follow-redirects", true, "Follow HTTP redirects")
-	shardCmd.Flags().Int("max-redirects", 5, "Maximum number of redirects to follow")
-	shardCmd.Flags().Bool("enable-concurrency-management", true, "Enable concurrency management")
-	shardCmd.Flags().Int("mandatory-request-delay", 0, "Mandatory delay between requests in milliseconds")
-	shardCmd.Flags().Bool("retry-eligible-requests", true, "Retry eligible failed requests")
+	cmd.Flags().String("log-level", "warn", "Log level: debug, info, warn, error, fatal")
+	cmd.Flags().String("log-export-path", "", "Additional log file path (appended to stderr output)")
+	cmd.Flags().Bool("hide-sensitive-data", true, "Mask sensitive data in logs")
+	cmd.Flags().Bool("jamf-load-balancer-lock", false, "Lock all requests to one Jamf Pro load balancer node")
+	cmd.Flags().Int("max-retry-attempts", 3, "Maximum number of retry attempts per request")
+	cmd.Flags().Int("max-concurrent-requests", 1, "Maximum number of concurrent API requests")
+	cmd.Flags().Bool("enable-dynamic-rate-limiting", false, "Enable dynamic rate limiting")
+	cmd.Flags().Int("custom-timeout", 60, "Per-request timeout in seconds")
+	cmd.Flags().Int("custom-timeout-ms", 0, "Per-request timeout in milliseconds; overrides --custom-timeout when set")
+	cmd.Flags().Int("token-refresh-buffer", 300, "Token refresh buffer period in seconds")
+	cmd.Flags().Int("total-retry-duration", 60, "Total retry window duration in seconds")
+	cmd.Flags().Int("fetch-page-retries", 0, "Retries for a single failed page of a paginated fetch before the fetch fails (0 = none)")
+	cmd.Flags().Bool("follow-redirects", true, "Follow HTTP redirects")
+	cmd.Flags().Int("max-redirects", 5, "Maximum number of redirects to follow")
+	cmd.Flags().Bool("enable-concurrency-management", true, "Enable concurrency management")
+	cmd.Flags().Int("mandatory-request-delay", 0, "Mandatory delay between requests in milliseconds")
+	cmd.Flags().Bool("retry-eligible-requests", true, "Retry eligible failed requests")
+
+	// ── Proxy ─────────────────────────────────────────────────────────────────
+	cmd.Flags().String("http-proxy", "", "Proxy URL for http:// requests (default: HTTP_PROXY from the environment)")
+	cmd.Flags().String("https-proxy", "", "Proxy URL for https:// requests (default: HTTPS_PROXY from the environment)")
+	cmd.Flags().String("no-proxy", "", "Comma-separated hosts to reach directly, bypassing the proxy (default: NO_PROXY from the environment)")
+
+	// ── Run limits ────────────────────────────────────────────────────────────
+	cmd.Flags().Duration("run-timeout", 0, "Abort the whole run if it takes longer than this, e.g. 10m (0 = no limit)")
+	cmd.Flags().Duration("source-timeout", 0, "Abort the source fetch, across all its pages and retries, if it takes longer than this, e.g. 5m (0 = no limit)")
+}
 
-	// ── Sharding ──────────────────────────────────────────────────────────────
-	shardCmd.Flags().String("source-type", "", "Source to query IDs from:\n"+
+// addSourceFlags registers the flags that select and filter the source IDs.
+func addSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("source-type", "", "Source to query IDs from; several may be combined, comma-separated:\n"+
 		"  computer_inventory              — all managed computers\n"+
 		"  mobile_device_inventory         — all managed mobile devices\n"+
 		"  computer_group_membership       — members of a computer group (requires --group-id)\n"+
 		"  mobile_device_group_membership  — members of a mobile device group (requires --group-id)\n"+
-		"  user_accounts                   — all Jamf Pro user accounts")
-	shardCmd.Flags().String("group-id", "", "Jamf Pro group ID (required for *_group_membership source types)")
-	shardCmd.Flags().String("strategy", "", "Sharding strategy: round-robin | percentage | size | rendezvous")
-	shardCmd.Flags().Int("shard-count", 0, "Number of shards (required for round-robin and rendezvous)")
-	shardCmd.Flags().StringSlice("shard-percentages", []string{}, "Percentages summing to 100, e.g. 10,30,60 (percentage strategy)")
-	shardCmd.Flags().StringSlice("shard-sizes", []string{}, "Absolute shard sizes; use -1 as last element for remainder, e.g. 50,200,-1 (size strategy)")
-	shardCmd.Flags().String("seed", "", "Seed for deterministic distribution (supported by all strategies)")
-	shardCmd.Flags().StringSlice("exclude-ids", []string{}, "IDs to completely exclude from all shards (comma-separated)")
-	shardCmd.Flags().String("reserved-ids", "",
-		`JSON map of shard names to ID lists to pin to specific shards,
-e.g. '{"shard_0":["101","102"],"shard_2":["201"]}'`)
-
-	// ── Output ────────────────────────────────────────────────────────────────
-	shardCmd.Flags().StringP("output", "o", "json", "Output format: json or yaml")
-	shardCmd.Flags().String("output-file", "", "Write output to this file path instead of stdout")
+		"  computer_prestage_scope         — computers scoped to a prestage enrollment (requires --prestage-id)\n"+
+		"  user_accounts                   — all Jamf Pro user accounts\n"+
+		"  user_group_membership           — members of a user group (requires --group-id)\n"+
+		"  raw_endpoint                    — IDs from any API path (requires --raw-path and --raw-id-jsonpath)")
+	cmd.Flags().String("group-id", "", "Jamf Pro group ID (required for *_group_membership source types)")
+	cmd.Flags().String("prestage-id", "", "Jamf Pro computer prestage enrollment ID (required for computer_prestage_scope)")
+	cmd.Flags().String("raw-path", "", "Jamf Pro API path to GET for raw_endpoint, e.g. /api/v1/departments")
+	cmd.Flags().String("raw-id-jsonpath", "", "JSONPath to the IDs in the raw_endpoint response, e.g. $.results[*].id")
+	cmd.Flags().Bool("namespace-ids", false, "Prefix each ID with its type, e.g. computer:101 (required to combine different device types)")
+	cmd.Flags().String("id-field", "jamf-id", "Which ID to shard: jamf-id (numeric Jamf Pro ID) or management-id (the MDM management ID GUID; computer_inventory only)")
+	cmd.Flags().String("site-id", "", "Keep only devices in this Jamf Pro site (numeric ID; device source types)")
+	cmd.Flags().Bool("include-unmanaged", false, "Include unmanaged computers and mobile devices (*_inventory source types)")
+	cmd.Flags().String("filter-department", "", "Keep only computers in this department (name or numeric ID; computer source types)")
+	cmd.Flags().String("filter-building", "", "Keep only computers in this building (name or numeric ID; computer source types)")
+	cmd.Flags().String("cache-ids", "", "Save fetched source IDs to this file, and reuse them instead of querying Jamf Pro while fresh")
+	cmd.Flags().Duration("cache-ttl", time.Hour, "How long a --cache-ids file stays fresh, e.g. 30m")
+	cmd.Flags().Bool("refresh-cache", false, "Fetch from Jamf Pro even when the --cache-ids file is fresh, and rewrite it")
+}
 
-	bindShardFlags(shardCmd)
+// shardFlagKeys maps each shard flag name to the viper/config key it binds
+// to. It is also the alias table used by `config normalize`.
+var shardFlagKeys = map[string]string{
+	"instance-domain":               "instance_domain",
+	"auth-method":                   "auth_method",
+	"client-id":                     "client_id",
+	"client-secret":                 "client_secret",
+	"username":                      "basic_auth_username",
+	"password":                      "basic_auth_password",
+	"check-auth":                    "check_auth",
+	"fixture":                       "fixture",
+	"log-level":                     "log_level",
+	"log-export-path":               "log_export_path",
+	"hide-sensitive-data":           "hide_sensitive_data",
+	"jamf-load-balancer-lock":       "jamf_load_balancer_lock",
+	"max-retry-attempts":            "max_retry_attempts",
+	"max-concurrent-requests":       "max_concurrent_requests",
+	"enable-dynamic-rate-limiting":  "enable_dynamic_rate_limiting",
+	"custom-timeout":                "custom_timeout_seconds",
+	"custom-timeout-ms":             "custom_timeout_milliseconds",
+	"token-refresh-buffer":          "token_refresh_buffer_period_seconds",
+	"total-retry-duration":          "total_retry_duration_seconds",
+	"fetch-page-retries":            "fetch_page_retries",
+	"follow-redirects":              "follow_redirects",
+	"max-redirects":                 "max_redirects",
+	"enable-concurrency-management": "enable_concurrency_management",
+	"mandatory-request-delay":       "mandatory_request_delay_milliseconds",
+	"retry-eligible-requests":       "retry_eligiable_requests",
+	"http-proxy":                    "http_proxy",
+	"https-proxy":                   "https_proxy",
+	"no-proxy":                      "no_proxy",
+	"run-timeout":                   "run_timeout",
+	"source-timeout":                "source_timeout",
+	"source-type":                   "source_type",
+	"group-id":                      "group_id",
+	"prestage-id":                   "prestage_id",
+	"raw-path":                      "raw_path",
+	"raw-id-jsonpath":               "raw_id_jsonpath",
+	"namespace-ids":                 "namespace_ids",
+	"id-field":                      "id_field",
+	"site-id":                       "site_id",
+	"include-unmanaged":             "include_unmanaged",
+	"filter-department":             "filter_department",
+	"filter-building":               "filter_building",
+	"cache-ids":                     "cache_ids",
+	"cache-ttl":                     "cache_ttl",
+	"refresh-cache":                 "refresh_cache",
+	"strategy":                      "strategy",
+	"shard-count":                   "shard_count",
+	"shard-percentages":             "shard_percentages",
+	"allow-partial":                 "allow_partial",
+	"balance-after-reservations":    "balance_after_reservations",
+	"shard-sizes":                   "shard_sizes",
+	"auto-shards":                   "auto_shards",
+	"shard-weights":                 "shard_weights",
+	"round-robin-offset":            "round_robin_offset",
+	"virtual-nodes":                 "virtual_nodes",
+	"parallel":                      "parallel",
+	"seed":                          "seed",
+	"seed-file":                     "seed_file",
+	"seed-salt":                     "seed_salt",
+	"seeds":                         "seeds",
+	"stable":                        "stable",
+	"per-shard-seeds":               "per_shard_seeds",
+	"exclude-ids":                   "exclude_ids",
+	"exclude-ids-file":              "exclude_ids_file",
+	"exclude-from-result":           "exclude_from_result",
+	"exclude-id-pattern":            "exclude_id_pattern",
+	"sample-size":                   "sample_size",
+	"sample-seed":                   "sample_seed",
+	"holdback-percentage":           "holdback_percentage",
+	"holdback-seed":                 "holdback_seed",
+	"shard-prefix":                  "shard_prefix",
+	"reserved-ids-file":             "reserved_ids_file",
+	"max-ids-per-shard":             "max_ids_per_shard",
+	"overflow":                      "overflow_policy",
+	"min-shard-size":                "min_shard_size",
+	"fail-on-duplicates":            "fail_on_duplicates",
+	"strict-source-match":           "strict_source_match",
+	"fail-on-empty-shards":          "fail_on_empty_shards",
+	"fail-on-empty-source":          "fail_on_empty_source",
+	"fail-on-missing-reserved":      "fail_on_missing_reserved",
+	"fail-on-unused-excludes":       "fail_on_unused_excludes",
+	"fail-on-warnings":              "fail_on_warnings",
+	"fail-on-oversized":             "fail_on_oversized",
+	"fail-on-undersized":            "fail_on_undersized",
+	"output":                        "output_format",
+	"output-file":                   "output_file",
+	"output-dir":                    "output_dir",
+	"output-file-mode":              "output_file_mode",
+	"atomic-write":                  "atomic_write",
+	"sort-order":                    "sort_order",
+	"shard-order":                   "shard_order",
+	"print-hash-only":               "print_hash_only",
+	"select-shard":                  "select_shard",
+	"only-shards":                   "only_shards",
+	"preview-count":                 "preview_count",
+	"histogram":                     "histogram",
+	"explain":                       "explain",
+	"explain-ids":                   "explain_ids",
+	"include-names":                 "include_names",
+	"yaml-header":                   "yaml_header",
+	"canonical":                     "canonical",
+	"expires-in":                    "expires_in",
+	"run-log":                       "run_log",
+	"audit-file":                    "audit_file",
 }
 
 // bindShardFlags wires cobra flags to viper keys so that flags, env vars,
 // and config file values are all resolved through a single viper lookup.
-func bindShardFlags(cmd *cobra.Command) {
-	pairs := map[string]string{
-		"instance-domain":               "instance_domain",
-		"auth-method":                   "auth_method",
-		"client-id":                     "client_id",
-		"client-secret":                 "client_secret",
-		"username":                      "basic_auth_username",
-		"password":                      "basic_auth_password",
-		"log-level":                     "log_level",
-		"log-export-path":               "log_export_path",
-		"hide-sensitive-data":           "hide_sensitive_data",
-		"jamf-load-balancer-lock":       "jamf_load_balancer_lock",
-		"max-retry-attempts":            "max_retry_attempts",
-		"max-concurrent-requests":       "max_concurrent_requests",
-		"enable-dynamic-rate-limiting":  "enable_dynamic_rate_limiting",
-		"custom-timeout":                "custom_timeout_seconds",
-		"token-refresh-buffer":          "token_refresh_buffer_period_seconds",
-		"total-retry-duration":          "total_retry_duration_seconds",
-		"follow-redirects":              "follow_redirects",
-		"max-redirects":                 "max_redirects",
-		"enable-concurrency-management": "enable_concurrency_management",
-		"mandatory-request-delay":       "mandatory_request_delay_milliseconds",
-		"retry-eligible-requests":       "retry_eligiable_requests",
-		"source-type":                   "source_type",
-		"group-id":                      "group_id",
-		"strategy":                      "strategy",
-		"shard-count":                   "shard_count",
-		"shard-percentages":             "shard_percentages",
-		"shard-sizes":                   "shard_sizes",
-		"seed":                          "seed",
-		"exclude-ids":                   "exclude_ids",
-		"output":                        "output_format",
-		"output-file":                   "output_file",
-	}
-	for flag, key := range pairs {
+// Several commands share config keys, and viper holds one flag per key, so
+// each command binds its own flags in PreRun rather than at init time.
+// Flags named in except are left unbound, for commands that reuse a flag
+// name for something else, such as validate's --output report format.
+func bindShardFlags(cmd *cobra.Command, except ...string) {
+	for flag, key := range shardFlagKeys {
+		if slices.Contains(except, flag) {
+			continue
+		}
 		if f := cmd.Flags().Lookup(flag); f != nil {
 			viper.BindPFlag(key, f) //nolint:errcheck
 		}
 	}
 }
 
-func runShard(cmd *cobra.Command, _ []string) error {
+func runShard(cmd *cobra.Command, _ []string) (err error) {
+	cfg, err := loadShardConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := resolveSeed(cfg); err != nil {
+		return err
+	}
+	logResolvedConfig(cfg)
+
+	if err := validateShardConfig(cfg); err != nil {
+		return err
+	}
+
+	runLog, err := openRunLog(cfg.RunLog)
+	if err != nil {
+		return err
+	}
+	// Deferred first so it runs last and records err as finally returned.
+	runStart, shardedCount := time.Now(), 0
+	defer func() { runLog.finish(runStart, shardedCount, err) }()
+
+	ctx, cancel := newRunContext(cfg)
+	defer cancel()
+	phase := "building the Jamf Pro client"
+	defer func() { err = runTimeoutError(ctx, cfg, phase, err) }()
+	enterPhase := func(name string) error {
+		phase = name
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	fetched, err := loadSourceIDs(ctx, cfg, enterPhase)
+	if err != nil {
+		return err
+	}
+	logPhase(fmt.Sprintf("Fetching %d ID(s) from %s", len(fetched.IDs), cfg.SourceType), start)
+	runLog.phase("fetch", start, len(fetched.IDs))
+
+	if len(cfg.Seeds) > 0 {
+		shardedCount, err = writeSeedResults(ctx, cfg, fetched, runLog, enterPhase)
+		return err
+	}
+
+	result, err := shardFetched(cfg, fetched, runLog, enterPhase)
+	if err != nil {
+		return err
+	}
+	if err := checkWarnings(cfg, result.Warnings); err != nil {
+		return err
+	}
+	shardedCount = len(resultIDs(result))
+	applyShardOrder(result, cfg.ShardOrder)
+
+	if cfg.Histogram && !quiet {
+		writeHistogram(os.Stderr, result.Shards)
+	}
+
+	if cfg.PrintHashOnly {
+		if _, err := fmt.Fprintln(os.Stdout, result.Metadata.ResultHash); err != nil {
+			return err
+		}
+		return appendAuditRecord(cfg, result)
+	}
+
+	if err := enterPhase("writing output"); err != nil {
+		return err
+	}
+	start = time.Now()
+	applyOnlyShards(result, cfg.OnlyShards)
+	applyPreviewCount(result, cfg.PreviewCount)
+	if err := writeOutput(ctx, cfg, result); err != nil {
+		return err
+	}
+	logPhase("Writing output", start)
+	runLog.phase("write", start, shardedCount)
+	return appendAuditRecord(cfg, result)
+}
+
+// writeSeedResults shards fetched once per entry in cfg.Seeds and writes
+// each full result to <seed>.<format> in cfg.OutputDir, so candidate seeds
+// can be compared without fetching the source again. It returns the number
+// of IDs sharded by the last seed, which is the same for every seed.
+func writeSeedResults(ctx context.Context, cfg *shardConfig, fetched *sourceFetchResult, runLog *runLogger, enterPhase func(string) error) (int, error) {
+	if err := os.MkdirAll(cfg.OutputDir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create output directory %s: %w", cfg.OutputDir, err)
+	}
+	format := cfg.OutputFormat
+	if format == "" {
+		format = "json"
+	}
+
+	shardedCount := 0
+	for _, seed := range cfg.Seeds {
+		run := selftestRunConfig(cfg)
+		run.Seed = seed
+		run.OutputDir = ""
+		run.OutputFile = filepath.Join(cfg.OutputDir, seed+"."+format)
+
+		result, err := shardFetched(run, selftestRunIDs(fetched), runLog, enterPhase)
+		if err == nil {
+			err = checkWarnings(run, result.Warnings)
+		}
+		if err != nil {
+			return shardedCount, fmt.Errorf("seed %q: %w", seed, err)
+		}
+		shardedCount = len(resultIDs(result))
+		applyShardOrder(result, run.ShardOrder)
+
+		if err := enterPhase("writing output"); err != nil {
+			return shardedCount, err
+		}
+		start := time.Now()
+		applyOnlyShards(result, run.OnlyShards)
+		if err := writeOutput(ctx, run, result); err != nil {
+			return shardedCount, err
+		}
+		runLog.phase("write", start, shardedCount)
+		if err := appendAuditRecord(run, result); err != nil {
+			return shardedCount, err
+		}
+		infof("seed %s: result_hash %s written to %s", seed, result.Metadata.ResultHash, run.OutputFile)
+	}
+	return shardedCount, nil
+}
+
+// shardFetched runs every step of a shard run that follows the fetch —
+// sampling, exclusions, holdback, reservations, the strategy, overflow, and
+// sort order — and assembles the result, with its hash, from fetched. It
+// does not modify fetched, so the same fetch can be sharded more than once;
+// auto_shards does rewrite cfg.ShardSizes.
+func shardFetched(cfg *shardConfig, fetched *sourceFetchResult, runLog *runLogger, enterPhase func(string) error) (*ShardResult, error) {
+	// warnings collects the non-fatal conditions reported on stderr so they
+	// are also kept in the result document, starting with any from the fetch.
+	warnings := slices.Clone(fetched.Warnings)
+	if err := checkEmptySource(cfg, fetched, &warnings); err != nil {
+		return nil, err
+	}
+	totalFetched := len(fetched.IDs)
+	sourceIDs := applySample(cfg, fetched.IDs, &warnings)
+	sampledCount, sampleSeed := 0, ""
+	if cfg.SampleSize > 0 {
+		sampledCount, sampleSeed = len(sourceIDs), cfg.SampleSeed
+	}
+
+	if err := enterPhase("applying exclusions and reservations"); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	excludeIDs, err := resolveExcludeIDs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	excludePattern, err := compileExcludePattern(cfg)
+	if err != nil {
+		return nil, err
+	}
+	filteredIDs, patternMatched := applyExclusions(sourceIDs, excludeIDs, excludePattern)
+	if err := checkUnusedExcludeIDs(unusedExcludeIDs(cfg.ExcludeIDs, fetched.IDs), cfg.FailOnUnusedExcludes, &warnings); err != nil {
+		return nil, err
+	}
+	excludedCount := len(sourceIDs) - len(filteredIDs)
+	if excludePattern != nil {
+		infof("exclude_id_pattern matched %d ID(s)", patternMatched)
+	}
+	filteredIDs, holdback := applyHoldback(cfg, filteredIDs)
+	filteredIDs = distributionOrder(cfg, filteredIDs)
+	runLog.phase("exclude", start, len(filteredIDs))
+
+	reserveStart := time.Now()
+	if cfg.AutoShards {
+		cfg.ShardSizes = sharding.AutoSizes(cfg.ShardSizes[0], len(filteredIDs))
+	}
+	shardCount := resolveShardCount(cfg)
+	reservations, err := applyReservations(filteredIDs, cfg.ReservedIDs, shardCount, cfg.ShardPrefix)
+	if err != nil {
+		return nil, err
+	}
+	reservedCount := len(filteredIDs) - len(reservations.UnreservedIDs)
+
+	if err := checkDistributableIDs(shardCount, len(reservations.UnreservedIDs), cfg.FailOnEmptyShards, &warnings); err != nil {
+		return nil, err
+	}
+	if err := checkMissingReservedIDs(reservations.MissingIDs, cfg.FailOnMissingReserved, &warnings); err != nil {
+		return nil, err
+	}
+	if err := checkShardSizesTotal(cfg.ShardSizes, len(filteredIDs), cfg.FailOnOversized, &warnings); err != nil {
+		return nil, err
+	}
+	var rebalanced []string
+	if cfg.Strategy == "percentage" {
+		checkZeroPercentages(cfg.ShardPercentages, cfg.ShardPrefix, &warnings)
+		rebalanced = rebalancedShards(cfg, len(filteredIDs), reservations)
+	}
+	logPhase("Exclusions and reservations", start)
+	runLog.phase("reserve", reserveStart, reservedCount)
+
+	if err := enterPhase("sharding"); err != nil {
+		return nil, err
+	}
+	start = time.Now()
+	shards, err := applyStrategy(cfg, filteredIDs, reservations)
+	if err != nil {
+		return nil, err
+	}
+	distributed := countShardIDs(shards) - reservedCount
+	checkUndistributedIDs(len(reservations.UnreservedIDs)-distributed, &warnings)
+
+	var placements map[string]PlacementExplanation
+	if cfg.Explain {
+		placements = explainPlacements(cfg, filteredIDs, reservations, shards, cfg.ExplainIDs)
+	}
+
+	shards, overflow, err := enforceShardCap(shards, cfg.MaxIDsPerShard, cfg.OverflowPolicy, cfg.ShardPrefix, reservations)
+	if err != nil {
+		return nil, err
+	}
+	minShardSize, err := enforceMinShardSize(shards, cfg.MinShardSize, cfg.FailOnUndersized, cfg.ShardPrefix, reservations)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Explain {
+		markOverflowMoves(placements, shards, cfg.ShardPrefix)
+		checkExplainIDs(cfg.ExplainIDs, placements, &warnings)
+	}
+
+	applySortOrder(shards, cfg.SortOrder, sourceIDs)
+	applyPerShardSeeds(shards, cfg.PerShardSeeds, cfg.ShardPrefix)
+	logPhase(fmt.Sprintf("Sharding with %s", cfg.Strategy), start)
+	runLog.phase("shard", start, countShardIDs(shards))
+
+	result := ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:              time.Now().UTC(),
+			SourceType:               cfg.SourceType,
+			GroupID:                  cfg.GroupID,
+			PrestageID:               cfg.PrestageID,
+			RawPath:                  cfg.RawPath,
+			SiteID:                   cfg.SiteID,
+			Strategy:                 cfg.Strategy,
+			Seed:                     cfg.Seed,
+			SeedSalt:                 cfg.SeedSalt,
+			Stable:                   cfg.Stable && cfg.Seed == "",
+			PerShardSeeds:            cfg.PerShardSeeds,
+			TotalIDsFetched:          totalFetched,
+			SourceBreakdown:          fetched.SourceBreakdown,
+			DuplicatesRemoved:        fetched.DuplicatesRemoved,
+			ExcludedIDCount:          excludedCount,
+			ExcludedByPatternCount:   patternMatched,
+			ReservedIDCount:          reservedCount,
+			UnreservedIDsDistributed: distributed,
+			UndistributedIDCount:     len(reservations.UnreservedIDs) - distributed,
+			ShardCount:               len(shards),
+			Overflow:                 overflow,
+			MinShardSize:             minShardSize,
+			Holdback:                 holdback,
+			SampleSize:               sampledCount,
+			SampleSeed:               sampleSeed,
+			MissingReservedIDs:       reservations.MissingIDs,
+			RebalancedShards:         rebalanced,
+			LocationFilter:           fetched.LocationFilter,
+			RateLimitWaitsMs:         fetched.RateLimitWaitsMs,
+		},
+		Shards:         make(map[string][]string, len(shards)),
+		ShardBreakdown: make(map[string]ShardCounts, len(shards)),
+		Labels:         cfg.ShardLabels,
+		Placements:     placements,
+		Warnings:       warnings,
+		Unmanaged:      fetched.Unmanaged,
+	}
+	if cfg.IncludeNames {
+		result.Names = fetched.Names
+	}
+	if cfg.ExpiresIn > 0 {
+		expiresAt := result.Metadata.GeneratedAt.Add(cfg.ExpiresIn)
+		result.Metadata.ExpiresAt = &expiresAt
+	}
+	// The default, Jamf Pro IDs, is left out so existing results are unchanged.
+	if cfg.IDField == "management-id" {
+		result.Metadata.IDField = cfg.IDField
+	}
+	if cfg.ShardPrefix != defaultShardPrefix {
+		result.Metadata.ShardPrefix = cfg.ShardPrefix
+	}
+	for i, shard := range shards {
+		// Empty shards are emitted as [] rather than null so consumers always
+		// see one array per shard.
+		if shard == nil {
+			shard = []string{}
+		}
+		name := shardName(cfg.ShardPrefix, i)
+		result.Shards[name] = shard
+		// Reserved IDs never move during overflow handling, so the counts
+		// recorded at reservation time still hold for the final shards.
+		reserved := len(reservations.IDsByShard[i])
+		result.ShardBreakdown[name] = ShardCounts{
+			Reserved:    reserved,
+			Distributed: len(shard) - reserved,
+		}
+	}
+	result.Metadata.ResultHash = computeResultHash(result.Shards)
+	return &result, nil
+}
+
+// newRunContext returns the context a run's API calls are made under. It
+// expires after run_timeout, or never when run_timeout is 0.
+func newRunContext(cfg *shardConfig) (context.Context, context.CancelFunc) {
+	if cfg.RunTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), cfg.RunTimeout)
+}
+
+// runTimeoutError names the phase that was in progress when err was caused by
+// the run_timeout deadline passing. Any other err is returned unchanged.
+func runTimeoutError(ctx context.Context, cfg *shardConfig, phase string, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("run timed out after %s (run_timeout) while %s: %w", cfg.RunTimeout, phase, err)
+}
+
+// sourceTimeoutError reports how far the fetch got when err was caused by
+// the source_timeout deadline of fetchCtx passing, rather than by the run's
+// own ctx ending. Any other err is returned unchanged.
+func sourceTimeoutError(ctx, fetchCtx context.Context, cfg *shardConfig, progress *fetchProgress, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	pages, records := progress.counts()
+	return fmt.Errorf("source fetch timed out after %s (source_timeout) with %d page(s) and %d record(s) collected: %w",
+		cfg.SourceTimeout, pages, records, err)
+}
+
+// loadShardConfig resolves the configuration from viper, working around the
+// flag types viper.Unmarshal cannot decode on its own.
+func loadShardConfig(cmd *cobra.Command) (*shardConfig, error) {
 	var cfg shardConfig
 	if err := viper.Unmarshal(&cfg); err != nil {
-		return fmt.Errorf("failed to parse configuration: %w", err)
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
 	}
 
 	// viper.Unmarshal can struggle with StringSlice flags bound from cobra; use
 	// GetStringSlice + parseTrimmedIntSlice as a reliable fallback. This also
 	// handles user input like "25, 25, 50" where spaces follow commas.
+	// Percentages may be fractional, e.g. 12.5.
 	if len(cfg.ShardPercentages) == 0 {
 		raw := viper.GetStringSlice("shard_percentages")
-		parsed, err := parseTrimmedIntSlice(raw)
+		parsed, err := parseTrimmedFloatSlice(raw)
 		if err != nil {
-			return fmt.Errorf("invalid --shard-percentages value: %w", err)
+			return nil, fmt.Errorf("invalid --shard-percentages value: %w", err)
 		}
 		cfg.ShardPercentages = parsed
 	}
@@ -158,78 +717,296 @@ func runShard(cmd *cobra.Command, _ []string) error {
 		raw := viper.GetStringSlice("shard_sizes")
 		parsed, err := parseTrimmedIntSlice(raw)
 		if err != nil {
-			return fmt.Errorf("invalid --shard-sizes value: %w", err)
+			return nil, fmt.Errorf("invalid --shard-sizes value: %w", err)
 		}
 		cfg.ShardSizes = parsed
 	}
+	if len(cfg.ShardWeights) == 0 {
+		raw := viper.GetStringSlice("shard_weights")
+		parsed, err := parseTrimmedFloatSlice(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --shard-weights value: %w", err)
+		}
+		cfg.ShardWeights = parsed
+	}
 	if len(cfg.ExcludeIDs) == 0 {
 		cfg.ExcludeIDs = viper.GetStringSlice("exclude_ids")
 	}
+	if len(cfg.ExplainIDs) == 0 {
+		cfg.ExplainIDs = viper.GetStringSlice("explain_ids")
+	}
 
 	// reserved-ids flag accepts a JSON string on the command line; a config file
 	// may supply it as a native YAML/JSON map which viper.Unmarshal handles.
 	if rawFlag, _ := cmd.Flags().GetString("reserved-ids"); rawFlag != "" {
 		parsed := make(map[string][]string)
 		if err := json.Unmarshal([]byte(rawFlag), &parsed); err != nil {
-			return fmt.Errorf("invalid --reserved-ids JSON: %w", err)
+			return nil, fmt.Errorf("invalid --reserved-ids JSON: %w", err)
 		}
 		cfg.ReservedIDs = parsed
 	}
-	// If the flag was not set but the config file has reserved_ids, use viper.
+	// If the flag was not set, fall back to viper: a config file supplies a
+	// native map, while JAMF_RESERVED_IDS arrives as a JSON string. Parse the
+	// string explicitly so malformed JSON is an error rather than an empty map.
 	if cfg.ReservedIDs == nil && viper.IsSet("reserved_ids") {
-		cfg.ReservedIDs = viper.GetStringMapStringSlice("reserved_ids")
+		if rawEnv, ok := viper.Get("reserved_ids").(string); ok {
+			parsed := make(map[string][]string)
+			if err := json.Unmarshal([]byte(rawEnv), &parsed); err != nil {
+				return nil, fmt.Errorf("invalid JAMF_RESERVED_IDS JSON: %w", err)
+			}
+			cfg.ReservedIDs = parsed
+		} else {
+			cfg.ReservedIDs = viper.GetStringMapStringSlice("reserved_ids")
+		}
+	}
+	// per_shard_seeds takes the same flag / environment / config file forms
+	// as reserved_ids. It is skipped by viper.Unmarshal, which cannot decode
+	// the JSON string form into a map[string]string.
+	if rawFlag, _ := cmd.Flags().GetString("per-shard-seeds"); rawFlag != "" {
+		parsed := make(map[string]string)
+		if err := json.Unmarshal([]byte(rawFlag), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid --per-shard-seeds JSON: %w", err)
+		}
+		cfg.PerShardSeeds = parsed
+	}
+	if cfg.PerShardSeeds == nil && viper.IsSet("per_shard_seeds") {
+		if rawEnv, ok := viper.Get("per_shard_seeds").(string); ok {
+			parsed := make(map[string]string)
+			if err := json.Unmarshal([]byte(rawEnv), &parsed); err != nil {
+				return nil, fmt.Errorf("invalid JAMF_PER_SHARD_SEEDS JSON: %w", err)
+			}
+			cfg.PerShardSeeds = parsed
+		} else {
+			cfg.PerShardSeeds = viper.GetStringMapString("per_shard_seeds")
+		}
+	}
+	if cfg.ExcludeIDsFile != "" {
+		fromFile, err := loadExcludeIDsFile(cfg.ExcludeIDsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExcludeIDs = append(cfg.ExcludeIDs, fromFile...)
+	}
+	if cfg.ReservedIDsFile != "" {
+		fromFile, err := loadReservedIDsFile(cfg.ReservedIDsFile)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := mergeReservedIDs(cfg.ReservedIDs, fromFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ReservedIDs = merged
 	}
 
-	if err := validateShardConfig(&cfg); err != nil {
-		return err
+	// An instance_domain that does not normalize is left for validateAuth
+	// to report.
+	if domain, err := normalizeInstanceDomain(cfg.InstanceDomain); err == nil {
+		cfg.InstanceDomain = domain
 	}
 
-	client, err := buildJamfClient(&cfg)
-	if err != nil {
-		return fmt.Errorf("failed to build Jamf Pro client: %w", err)
+	// custom_timeout_seconds always has a flag default, so only warn when it
+	// was set explicitly alongside the millisecond form.
+	if cfg.CustomTimeoutMs > 0 && viper.IsSet("custom_timeout_seconds") {
+		warnf("custom_timeout_milliseconds (%d) and custom_timeout_seconds (%d) are both set; "+
+			"using milliseconds and ignoring seconds", cfg.CustomTimeoutMs, cfg.CustomTimeout)
 	}
+	return &cfg, nil
+}
 
-	sourceIDs, err := fetchSourceIDs(client, &cfg)
+// loadReservedIDsFile reads a shard name → ID list map from a JSON or YAML
+// file. YAML is a superset of JSON, so one decoder handles both. A .jsonl or
+// .ndjson file instead holds one {"id": ..., "shard": ...} object per line,
+// the same records ndjson output uses.
+func loadReservedIDsFile(path string) (map[string][]string, error) {
+	reserved := make(map[string][]string)
+	if isJSONLines(path) {
+		records, err := loadIDRecords(path, "--reserved-ids-file")
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			if rec.Shard == "" {
+				return nil, fmt.Errorf("failed to parse --reserved-ids-file %s line %d: missing \"shard\"", path, rec.line)
+			}
+			reserved[rec.Shard] = append(reserved[rec.Shard], rec.ID)
+		}
+		return reserved, nil
+	}
+	data, err := readIDFile(path, "--reserved-ids-file")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	totalFetched := len(sourceIDs)
+	if err := yaml.Unmarshal(data, &reserved); err != nil {
+		return nil, fmt.Errorf("failed to parse --reserved-ids-file %s: %w", path, err)
+	}
+	return reserved, nil
+}
 
-	filteredIDs := applyExclusions(sourceIDs, cfg.ExcludeIDs)
-	excludedCount := totalFetched - len(filteredIDs)
+// loadExcludeIDsFile reads a list of IDs to exclude from a JSON or YAML
+// file, or from a .jsonl or .ndjson file holding one {"id": ...} object per
+// line.
+func loadExcludeIDsFile(path string) ([]string, error) {
+	if isJSONLines(path) {
+		records, err := loadIDRecords(path, "--exclude-ids-file")
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(records))
+		for _, rec := range records {
+			// A shard suggests a reservation or result file, which excluding
+			// wholesale is rarely what was meant.
+			if rec.Shard != "" {
+				return nil, fmt.Errorf("failed to parse --exclude-ids-file %s line %d: unexpected \"shard\" — "+
+					"use --exclude-from-result to exclude a previous result's IDs", path, rec.line)
+			}
+			ids = append(ids, rec.ID)
+		}
+		return ids, nil
+	}
+	data, err := readIDFile(path, "--exclude-ids-file")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := yaml.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("failed to parse --exclude-ids-file %s: %w", path, err)
+	}
+	return ids, nil
+}
 
-	shardCount := resolveShardCount(&cfg)
-	reservations, err := applyReservations(filteredIDs, cfg.ReservedIDs, shardCount)
+// readIDFile reads an ID list file for flag. When a companion <path>.sha256
+// file exists — sha256sum output, or the bare hex digest — the file's hash
+// must match it, so a file truncated by a partial write upstream fails the
+// run instead of silently dropping IDs.
+func readIDFile(path, flag string) ([]byte, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read %s: %w", flag, err)
 	}
-	reservedCount := len(filteredIDs) - len(reservations.UnreservedIDs)
+	sumPath := path + ".sha256"
+	sumData, err := os.ReadFile(sumPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s checksum: %w", flag, err)
+	}
+	fields := strings.Fields(string(sumData))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s checksum %s is empty", flag, sumPath)
+	}
+	sum := sha256.Sum256(data)
+	if got, want := hex.EncodeToString(sum[:]), strings.ToLower(fields[0]); got != want {
+		return nil, fmt.Errorf("%s %s does not match %s (sha256 %s, expected %s) — "+
+			"the file may be truncated or was changed after its checksum was written", flag, path, sumPath, got, want)
+	}
+	verbosef("Verified %s against %s", path, sumPath)
+	return data, nil
+}
+
+// isJSONLines reports whether path names a JSON Lines file by its extension.
+func isJSONLines(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jsonl" || ext == ".ndjson"
+}
+
+// idRecord is one line of a JSON Lines ID list, with its line number for
+// error messages.
+type idRecord struct {
+	ShardRecord
+	line int
+}
 
-	shards, err := applyStrategy(&cfg, filteredIDs, reservations)
+// loadIDRecords reads the {"id": ..., "shard": ...} objects of a JSON Lines
+// file, one per non-blank line. Every record must have an ID; flag names the
+// setting in errors.
+func loadIDRecords(path, flag string) ([]idRecord, error) {
+	data, err := readIDFile(path, flag)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var records []idRecord
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		rec := idRecord{line: i + 1}
+		if err := json.Unmarshal([]byte(line), &rec.ShardRecord); err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s line %d: %w", flag, path, rec.line, err)
+		}
+		if rec.ID == "" {
+			return nil, fmt.Errorf("failed to parse %s %s line %d: missing \"id\"", flag, path, rec.line)
+		}
+		records = append(records, rec)
 	}
+	return records, nil
+}
 
-	result := ShardResult{
-		Metadata: ShardMetadata{
-			GeneratedAt:              time.Now().UTC(),
-			SourceType:               cfg.SourceType,
-			GroupID:                  cfg.GroupID,
-			Strategy:                 cfg.Strategy,
-			Seed:                     cfg.Seed,
-			TotalIDsFetched:          totalFetched,
-			ExcludedIDCount:          excludedCount,
-			ReservedIDCount:          reservedCount,
-			UnreservedIDsDistributed: len(reservations.UnreservedIDs),
-			ShardCount:               len(shards),
-		},
-		Shards: make(map[string][]string, len(shards)),
+// mergeReservedIDs combines inline reservations with those loaded from a
+// file. A shard may be reserved in one place or the other, not both, so a
+// shard name present in both maps is an error rather than a silent merge.
+func mergeReservedIDs(inline, fromFile map[string][]string) (map[string][]string, error) {
+	merged := make(map[string][]string, len(inline)+len(fromFile))
+	for shard, ids := range inline {
+		merged[shard] = ids
 	}
-	for i, shard := range shards {
-		result.Shards[fmt.Sprintf("shard_%d", i)] = shard
+	var conflicts []string
+	for shard, ids := range fromFile {
+		if _, exists := merged[shard]; exists {
+			conflicts = append(conflicts, shard)
+			continue
+		}
+		merged[shard] = ids
+	}
+	if len(conflicts) > 0 {
+		slices.Sort(conflicts)
+		return nil, fmt.Errorf("shard(s) %s reserved both inline and in --reserved-ids-file — "+
+			"move each shard's reservations to one place", quotedList(conflicts))
+	}
+	return merged, nil
+}
+
+// resolveSeed fills cfg.Seed from seed_file when no seed was given directly,
+// keeping the seed itself out of shell history and process listings.
+func resolveSeed(cfg *shardConfig) error {
+	if cfg.Seed != "" || cfg.SeedFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.SeedFile)
+	if err != nil {
+		return fmt.Errorf("failed to read --seed-file: %w", err)
+	}
+	seed := strings.TrimSpace(string(data))
+	if seed == "" {
+		return fmt.Errorf("seed file %s is empty", cfg.SeedFile)
+	}
+	cfg.Seed = seed
+	return nil
+}
+
+// strategySeed is the seed the strategies hash with: seed on its own, or seed
+// and seed_salt joined by "|" when a salt is set. Joining with a separator
+// keeps ("ab", "c") and ("a", "bc") distinct.
+func strategySeed(cfg *shardConfig) string {
+	if cfg.SeedSalt == "" {
+		return cfg.Seed
 	}
+	return cfg.Seed + "|" + cfg.SeedSalt
+}
 
-	return writeOutput(&cfg, &result)
+// distributionOrder returns ids in the order the strategies receive them.
+// With stable set and no seed, they are sorted numerically so an unseeded run
+// is reproducible without being shuffled; otherwise API order is kept, since
+// a seed sorts and shuffles them anyway.
+func distributionOrder(cfg *shardConfig, ids []string) []string {
+	if !cfg.Stable || cfg.Seed != "" {
+		return ids
+	}
+	sorted := slices.Clone(ids)
+	sharding.SortIDsNumerically(sorted)
+	return sorted
 }
 
 // ── Client construction ───────────────────────────────────────────────────────
@@ -249,8 +1026,8 @@ func buildJamfClient(cfg *shardConfig) (*jamfpro.Client, error) {
 	}
 
 	var options []jamfpro.ClientOption
-	if cfg.CustomTimeout > 0 {
-		options = append(options, jamfpro.WithTimeout(time.Duration(cfg.CustomTimeout)*time.Second))
+	if timeout := requestTimeout(cfg); timeout > 0 {
+		options = append(options, jamfpro.WithTimeout(timeout))
 	}
 	if cfg.MaxRetryAttempts > 0 {
 		options = append(options, jamfpro.WithRetryCount(cfg.MaxRetryAttempts))
@@ -264,84 +1041,606 @@ func buildJamfClient(cfg *shardConfig) (*jamfpro.Client, error) {
 	if cfg.TotalRetryDuration > 0 {
 		options = append(options, jamfpro.WithTotalRetryDuration(time.Duration(cfg.TotalRetryDuration)*time.Second))
 	}
+	if cfg.HTTPProxy != "" || cfg.HTTPSProxy != "" || cfg.NoProxy != "" {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = proxyFunc(cfg)
+		options = append(options, jamfpro.WithTransport(transport))
+	}
 
-	return jamfpro.NewClient(authConfig, options...)
+	client, err := jamfpro.NewClient(authConfig, options...)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := client.GetTransport().GetHTTPClient()
+	httpClient.AddResponseMiddleware(recordRetryAfter)
+	httpClient.AddRetryHooks(countRetryAfterWait)
+	return client, nil
 }
 
-// ── ID fetching ───────────────────────────────────────────────────────────────
-
-// fetchSourceIDs dispatches to the appropriate Jamf Pro endpoint based on
-// the configured source_type.
-func fetchSourceIDs(client *jamfpro.Client, cfg *shardConfig) ([]string, error) {
-	switch cfg.SourceType {
-	case "computer_inventory":
-		return fetchComputerInventory(client)
-	case "mobile_device_inventory":
-		return fetchMobileDeviceInventory(client)
-	case "computer_group_membership":
-		return fetchComputerGroupMembers(client, cfg.GroupID)
-	case "mobile_device_group_membership":
-		return fetchMobileDeviceGroupMembers(client, cfg.GroupID)
-	case "user_accounts":
-		return fetchUsers(client)
-	default:
-		return nil, fmt.Errorf("unknown source_type: %s", cfg.SourceType)
+// proxyFunc returns the proxy selection for the Jamf Pro client's transport.
+// http_proxy, https_proxy, and no_proxy each fall back to the standard
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables when unset.
+func proxyFunc(cfg *shardConfig) func(*http.Request) (*url.URL, error) {
+	proxy := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy != "" {
+		proxy.HTTPProxy = cfg.HTTPProxy
+	}
+	if cfg.HTTPSProxy != "" {
+		proxy.HTTPSProxy = cfg.HTTPSProxy
+	}
+	if cfg.NoProxy != "" {
+		proxy.NoProxy = cfg.NoProxy
+	}
+	forURL := proxy.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return forURL(req.URL)
 	}
 }
 
-// fetchComputerInventory returns IDs for all managed computers.
-// Unmanaged computers are excluded because they cannot be members of a
-// Jamf Pro static group.
-func fetchComputerInventory(client *jamfpro.Client) ([]string, error) {
-	ctx := context.Background()
-	rsqlQuery := map[string]string{
-		"section": "GENERAL",
+// requestTimeout returns the per-request timeout. custom_timeout_milliseconds
+// takes precedence over custom_timeout_seconds when set.
+func requestTimeout(cfg *shardConfig) time.Duration {
+	if cfg.CustomTimeoutMs > 0 {
+		return time.Duration(cfg.CustomTimeoutMs) * time.Millisecond
 	}
+	return time.Duration(cfg.CustomTimeout) * time.Second
+}
 
-	computers, _, err := client.
-		JamfProAPI.
-		ComputerInventory.
-		ListV3(ctx, rsqlQuery)
+// ── ID fetching ───────────────────────────────────────────────────────────────
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve computer inventory: %w", err)
-	}
+// idNamespaces maps each source type to the prefix namespace_ids adds to its
+// IDs. Computer, mobile device, and user IDs are numbered independently in
+// Jamf Pro, so the same number can name one of each.
+var idNamespaces = map[string]string{
+	"computer_inventory":             "computer",
+	"computer_group_membership":      "computer",
+	"mobile_device_inventory":        "mobile_device",
+	"mobile_device_group_membership": "mobile_device",
+	"computer_prestage_scope":        "computer",
+	"user_accounts":                  "user",
+	"user_group_membership":          "user",
+}
 
-	var ids []string
-	for _, c := range computers.Results {
-		if c.General.RemoteManagement.Managed {
-			ids = append(ids, c.ID)
+// sourceTypes splits a comma-separated source_type into its entries.
+func sourceTypes(value string) []string {
+	var types []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
 		}
 	}
-	return ids, nil
+	return types
 }
 
-// fetchMobileDeviceInventory returns IDs for all managed mobile devices.
-// Unmanaged devices are excluded for the same reason as unmanaged computers.
-func fetchMobileDeviceInventory(client *jamfpro.Client) ([]string, error) {
-	ctx := context.Background()
+// fetchSourceIDs retrieves every source listed in source_type and unions the
+// results in the order the sources are listed. With namespace_ids set, each
+// ID is prefixed with its type (e.g. "computer:101") so IDs from different
+// object types stay distinct. An ID returned by more than one source of the
+// same type is kept once.
+func fetchSourceIDs(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	combined := &sourceFetchResult{Unmanaged: make(map[string]bool), Names: make(map[string]string)}
+	sources := sourceTypes(cfg.SourceType)
+	if len(sources) > 1 {
+		combined.SourceBreakdown = make(map[string]int, len(sources))
+	}
+	for _, sourceType := range sources {
+		single := *cfg
+		single.SourceType = sourceType
+		fetched, err := fetchSingleSource(ctx, client, &single)
+		if err != nil {
+			return nil, err
+		}
+		// Management IDs are GUIDs, so only Jamf Pro IDs are expected to be
+		// numeric.
+		if cfg.IDField != "management-id" {
+			if err := checkSourceIDFormats(cfg, sourceType, fetched.IDs, &fetched.Warnings); err != nil {
+				return nil, err
+			}
+		}
 
-	devices, _, err := client.
-		ClassicAPI.
-		MobileDevices.
-		List(ctx)
+		prefix := ""
+		if cfg.NamespaceIDs {
+			prefix = idNamespaces[sourceType] + ":"
+		}
+		for _, id := range fetched.IDs {
+			combined.IDs = append(combined.IDs, prefix+id)
+		}
+		for id := range fetched.Unmanaged {
+			combined.Unmanaged[prefix+id] = true
+		}
+		for id, name := range fetched.Names {
+			combined.Names[prefix+id] = name
+		}
+		if combined.SourceBreakdown != nil {
+			combined.SourceBreakdown[sourceType] = len(fetched.IDs)
+		}
+		combined.DuplicatesRemoved += fetched.DuplicatesRemoved
+		combined.Warnings = append(combined.Warnings, fetched.Warnings...)
+		if fetched.LocationFilter != nil {
+			if combined.LocationFilter == nil {
+				combined.LocationFilter = &LocationFilterSummary{
+					Department: cfg.FilterDepartment,
+					Building:   cfg.FilterBuilding,
+				}
+			}
+			combined.LocationFilter.IDsRemoved += fetched.LocationFilter.IDsRemoved
+		}
+	}
+
+	combined.IDs, _ = dedupeIDs(combined.IDs)
+	return combined, nil
+}
+
+// checkSourceIDFormats reports IDs that sourceType returned which are not
+// numeric. The Jamf Pro API only returns numeric IDs today, but anything else,
+// such as a UUID from a new object type, would sort as though it were 0. With
+// strict_source_match set they fail the run; otherwise they are kept with a
+// warning.
+func checkSourceIDFormats(cfg *shardConfig, sourceType string, ids []string, warnings *[]string) error {
+	var invalid []string
+	for _, id := range ids {
+		if !numericIDRe.MatchString(id) {
+			invalid = append(invalid, fmt.Sprintf("%q", id))
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	if cfg.StrictSourceMatch {
+		return fmt.Errorf("source_type %s returned %d ID(s) that are not numeric: %s — "+
+			"rerun without --strict-source-match to keep them with a warning",
+			sourceType, len(invalid), strings.Join(invalid, ", "))
+	}
+	addWarning(warnings, "source_type %s returned %d ID(s) that are not numeric, which sort after the numeric IDs: %s",
+		sourceType, len(invalid), strings.Join(invalid, ", "))
+	return nil
+}
+
+// fetchSingleSource retrieves one source and removes any duplicate IDs from
+// the response. The Jamf Pro API occasionally returns the same record on
+// more than one page; left in place, a duplicate inflates counts and can be
+// placed in two shards. With fail_on_duplicates set, duplicates are reported
+// as an error instead of being dropped.
+func fetchSingleSource(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	fetched, err := withFetchRetry(ctx, cfg, func() (*sourceFetchResult, error) {
+		return dispatchSourceFetch(ctx, client, cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unique, duplicates := dedupeIDs(fetched.IDs)
+	if len(duplicates) > 0 && cfg.FailOnDuplicates {
+		return nil, fmt.Errorf(
+			"source_type %s returned %d duplicate ID(s): %s — rerun without --fail-on-duplicates to remove them automatically",
+			cfg.SourceType, len(duplicates), strings.Join(duplicates, ", "),
+		)
+	}
+
+	// Inventory sources filter by site as they fetch; group members and
+	// prestage scopes carry no site, so they are checked against the site's
+	// inventory afterwards.
+	if cfg.SiteID != "" && (strings.HasSuffix(cfg.SourceType, "_group_membership") || cfg.SourceType == "computer_prestage_scope") {
+		unique, err = withFetchRetry(ctx, cfg, func() ([]string, error) {
+			return applySiteFilter(ctx, client, cfg, unique)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &sourceFetchResult{
+		IDs:               unique,
+		DuplicatesRemoved: len(duplicates),
+		Unmanaged:         fetched.Unmanaged,
+		Names:             fetched.Names,
+		Warnings:          fetched.Warnings,
+	}
+	if cfg.FilterDepartment != "" || cfg.FilterBuilding != "" {
+		kept, err := withFetchRetry(ctx, cfg, func() ([]string, error) {
+			return applyLocationFilter(ctx, client, cfg, unique)
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.IDs = kept
+		result.LocationFilter = &LocationFilterSummary{
+			Department: cfg.FilterDepartment,
+			Building:   cfg.FilterBuilding,
+			IDsRemoved: len(unique) - len(kept),
+		}
+	}
+	return result, nil
+}
+
+// dedupeIDs returns ids with repeated entries removed, preserving the order
+// in which each ID was first seen, plus one entry per extra occurrence.
+func dedupeIDs(ids []string) (unique []string, duplicates []string) {
+	seen := make(map[string]bool, len(ids))
+	unique = make([]string, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			duplicates = append(duplicates, id)
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique, duplicates
+}
+
+// dispatchSourceFetch routes to the appropriate Jamf Pro endpoint based on
+// the configured source_type. Only the inventory sources report which IDs are
+// unmanaged and the device names.
+func dispatchSourceFetch(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	var (
+		ids []string
+		err error
+	)
+	if cfg.Fixture != "" {
+		return fetchFixtureSource(cfg)
+	}
+	switch cfg.SourceType {
+	case "computer_inventory":
+		return fetchComputerInventory(ctx, client, cfg)
+	case "mobile_device_inventory":
+		return fetchMobileDeviceInventory(ctx, client, cfg)
+	case "computer_group_membership":
+		ids, err = fetchComputerGroupMembers(ctx, client, cfg.GroupID)
+	case "mobile_device_group_membership":
+		ids, err = fetchMobileDeviceGroupMembers(ctx, client, cfg.GroupID)
+	case "computer_prestage_scope":
+		return fetchComputerPrestageScope(ctx, client, cfg)
+	case "user_accounts":
+		ids, err = fetchUsers(ctx, client)
+	case "user_group_membership":
+		ids, err = fetchUserGroupMembers(ctx, client, cfg.GroupID)
+	case "raw_endpoint":
+		ids, err = fetchRawEndpoint(ctx, client, cfg)
+	default:
+		err = fmt.Errorf("unknown source_type: %s", cfg.SourceType)
+	}
+	return &sourceFetchResult{IDs: ids}, err
+}
+
+// fetchComputerInventory returns IDs for all managed computers.
+// Unmanaged computers are excluded because they cannot be members of a
+// Jamf Pro static group, unless include_unmanaged is set; the IDs of any
+// unmanaged computers kept are returned as a set. A non-empty site_id keeps
+// only computers assigned to that site. Each kept computer's name is
+// returned alongside its ID for display.
+//
+// With id_field 'management-id', each computer's general.managementId is
+// returned in place of its Jamf Pro ID. Computers without one are skipped
+// with a warning.
+func fetchComputerInventory(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	fetched := &sourceFetchResult{Unmanaged: make(map[string]bool), Names: make(map[string]string)}
+	var noManagementID []string
+	mergePage := func(page []byte) error {
+		var computers []computer_inventory.ResourceComputerInventory
+		if err := json.Unmarshal(page, &computers); err != nil {
+			return err
+		}
+		for _, c := range computers {
+			if cfg.SiteID != "" && c.General.Site.ID != cfg.SiteID {
+				continue
+			}
+			id := c.ID
+			if cfg.IDField == "management-id" {
+				if c.General.ManagementId == "" {
+					noManagementID = append(noManagementID, c.ID)
+					continue
+				}
+				id = c.General.ManagementId
+			}
+			if !c.General.RemoteManagement.Managed {
+				if !cfg.IncludeUnmanaged {
+					continue
+				}
+				fetched.Unmanaged[id] = true
+			}
+			fetched.IDs = append(fetched.IDs, id)
+			fetched.Names[id] = c.General.Name
+		}
+		return nil
+	}
+
+	err := fetchPaginated(ctx, client, cfg, computerInventoryPath, map[string]string{"section": "GENERAL"}, mergePage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve computer inventory: %w", err)
+	}
+	if len(noManagementID) > 0 {
+		sharding.SortIDsNumerically(noManagementID)
+		addWarning(&fetched.Warnings, "%d computer(s) have no management ID and were skipped: %s",
+			len(noManagementID), strings.Join(noManagementID, ", "))
+	}
+	return fetched, nil
+}
+
+// fetchMobileDeviceInventory returns IDs for all managed mobile devices.
+// Unmanaged devices are excluded for the same reason as unmanaged computers,
+// unless include_unmanaged is set, in which case they are also returned as a
+// set. A non-empty site_id keeps only devices assigned to that site. Each kept
+// device's display name is returned alongside its ID.
+//
+// The SDK has no Jamf Pro API mobile device inventory service, and the Classic
+// API list does not paginate or reliably report managed state, so the
+// paginated /api/v2/mobile-devices/detail endpoint is called directly.
+func fetchMobileDeviceInventory(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	fetched := &sourceFetchResult{Unmanaged: make(map[string]bool), Names: make(map[string]string)}
+	mergePage := func(page []byte) error {
+		var devices []mobileDeviceDetail
+		if err := json.Unmarshal(page, &devices); err != nil {
+			return err
+		}
+		for _, d := range devices {
+			if cfg.SiteID != "" && d.General.SiteID != cfg.SiteID {
+				continue
+			}
+			if !d.General.Managed {
+				if !cfg.IncludeUnmanaged {
+					continue
+				}
+				fetched.Unmanaged[d.MobileDeviceID] = true
+			}
+			fetched.IDs = append(fetched.IDs, d.MobileDeviceID)
+			fetched.Names[d.MobileDeviceID] = d.General.DisplayName
+		}
+		return nil
+	}
 
+	err := fetchPaginated(ctx, client, cfg, mobileDeviceDetailPath, map[string]string{"section": "GENERAL"}, mergePage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve mobile devices: %w", err)
 	}
+	return fetched, nil
+}
 
-	var ids []string
-	for _, d := range devices.Results {
-		if d.Managed {
-			ids = append(ids, strconv.Itoa(d.ID))
+// ── Paginated fetches ─────────────────────────────────────────────────────────
+
+const (
+	computerInventoryPath  = "/api/v3/computers-inventory"
+	mobileDeviceDetailPath = "/api/v2/mobile-devices/detail"
+
+	// fetchPageSize is the page-size fetchPaginated requests, matching the
+	// SDK's own default.
+	fetchPageSize = jamfclient.DefaultPageSize
+)
+
+// paginatedPage is the envelope every paginated Jamf Pro API endpoint returns.
+type paginatedPage struct {
+	TotalCount int             `json:"totalCount"`
+	Results    json.RawMessage `json:"results"`
+}
+
+// fetchPaginated walks a paginated Jamf Pro API endpoint one page at a time,
+// passing each page's results array to mergePage. It replaces the SDK's
+// GetPaginated so that each page can be retried on its own: a page that fails
+// is retried up to fetch_page_retries times with backoff, and the pages
+// already merged are kept. When a page's retries run out, the error names the
+// page number and the offset of its first record.
+func fetchPaginated(ctx context.Context, client *jamfpro.Client, cfg *shardConfig, path string, params map[string]string, mergePage func([]byte) error) error {
+	for page := 0; ; page++ {
+		result, err := retryFetch(ctx, cfg, cfg.FetchPageRetries, func() (*paginatedPage, error) {
+			var result paginatedPage
+			_, err := client.
+				GetTransport().
+				NewRequest(ctx).
+				SetHeader("Accept", "application/json").
+				SetQueryParams(params).
+				SetQueryParam("page", strconv.Itoa(page)).
+				SetQueryParam("page-size", strconv.Itoa(fetchPageSize)).
+				SetResult(&result).
+				Get(path)
+			return &result, err
+		})
+		if err != nil {
+			return fmt.Errorf("page %d (offset %d): %w", page, page*fetchPageSize, err)
+		}
+		if err := mergePage(result.Results); err != nil {
+			return fmt.Errorf("page %d (offset %d): failed to decode results: %w", page, page*fetchPageSize, err)
+		}
+		fetchProgressFrom(ctx).addPage(min(fetchPageSize, max(result.TotalCount-page*fetchPageSize, 0)))
+		// An empty page also ends the walk, in case totalCount overstates.
+		results := bytes.TrimSpace(result.Results)
+		if len(results) == 0 || string(results) == "[]" || string(results) == "null" ||
+			(page+1)*fetchPageSize >= result.TotalCount {
+			return nil
 		}
 	}
-	return ids, nil
+}
+
+// fetchProgress counts the pages, and the records on them, that
+// fetchPaginated has merged, so a fetch cut short by source_timeout can say
+// how far it got. It travels in the fetch's context; its methods are safe on
+// a nil progress.
+type fetchProgress struct {
+	mu      sync.Mutex
+	pages   int
+	records int
+}
+
+type fetchProgressKey struct{}
+
+// withFetchProgress returns ctx carrying a new fetchProgress.
+func withFetchProgress(ctx context.Context) (context.Context, *fetchProgress) {
+	progress := &fetchProgress{}
+	return context.WithValue(ctx, fetchProgressKey{}, progress), progress
+}
+
+// fetchProgressFrom returns the progress in ctx, or nil when there is none.
+func fetchProgressFrom(ctx context.Context) *fetchProgress {
+	progress, _ := ctx.Value(fetchProgressKey{}).(*fetchProgress)
+	return progress
+}
+
+func (p *fetchProgress) addPage(records int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages++
+	p.records += records
+}
+
+// counts returns the pages and records merged so far.
+func (p *fetchProgress) counts() (pages, records int) {
+	if p == nil {
+		return 0, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pages, p.records
+}
+
+// ── Site and location filters ─────────────────────────────────────────────────
+
+// applySiteFilter keeps only the group members assigned to cfg.SiteID. Group
+// membership records carry no site, so the matching inventory is fetched for
+// the site, managed or not, and the members are intersected with it.
+func applySiteFilter(ctx context.Context, client *jamfpro.Client, cfg *shardConfig, ids []string) ([]string, error) {
+	fetchInventory := fetchComputerInventory
+	if cfg.SourceType == "mobile_device_group_membership" {
+		fetchInventory = fetchMobileDeviceInventory
+	}
+	inventory := *cfg
+	inventory.IncludeUnmanaged = true
+	site, err := fetchInventory(ctx, client, &inventory)
+	if err != nil {
+		return nil, err
+	}
+
+	inSite := make(map[string]bool, len(site.IDs))
+	for _, id := range site.IDs {
+		inSite[id] = true
+	}
+	kept := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if inSite[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept, nil
+}
+
+// applyLocationFilter keeps only the computers whose department and building
+// match the configured filters. When both are set a computer must match both.
+// Filter values may be a numeric Jamf Pro ID or a name; names are resolved
+// case-insensitively.
+func applyLocationFilter(ctx context.Context, client *jamfpro.Client, cfg *shardConfig, ids []string) ([]string, error) {
+	var departmentID, buildingID string
+	if cfg.FilterDepartment != "" {
+		resolved, err := resolveDepartmentID(ctx, client, cfg.FilterDepartment)
+		if err != nil {
+			return nil, err
+		}
+		departmentID = resolved
+	}
+	if cfg.FilterBuilding != "" {
+		resolved, err := resolveBuildingID(ctx, client, cfg.FilterBuilding)
+		if err != nil {
+			return nil, err
+		}
+		buildingID = resolved
+	}
+
+	locations, err := fetchComputerLocations(ctx, client, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]string, 0, len(ids))
+	for _, id := range ids {
+		loc, ok := locations[id]
+		if !ok {
+			continue
+		}
+		if departmentID != "" && loc.DepartmentId != departmentID {
+			continue
+		}
+		if buildingID != "" && loc.BuildingId != buildingID {
+			continue
+		}
+		kept = append(kept, id)
+	}
+	return kept, nil
+}
+
+// fetchComputerLocations returns the USER_AND_LOCATION section of every
+// computer, keyed by computer ID.
+func fetchComputerLocations(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (map[string]computer_inventory.ComputerInventorySubsetUserAndLocation, error) {
+	locations := make(map[string]computer_inventory.ComputerInventorySubsetUserAndLocation)
+	mergePage := func(page []byte) error {
+		var computers []computer_inventory.ResourceComputerInventory
+		if err := json.Unmarshal(page, &computers); err != nil {
+			return err
+		}
+		for _, c := range computers {
+			locations[c.ID] = c.UserAndLocation
+		}
+		return nil
+	}
+
+	err := fetchPaginated(ctx, client, cfg, computerInventoryPath, map[string]string{"section": "USER_AND_LOCATION"}, mergePage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve computer locations: %w", err)
+	}
+	return locations, nil
+}
+
+// resolveDepartmentID returns value unchanged when it is a numeric ID,
+// otherwise looks up the department with that name.
+func resolveDepartmentID(ctx context.Context, client *jamfpro.Client, value string) (string, error) {
+	if numericIDRe.MatchString(value) {
+		return value, nil
+	}
+
+	departments, _, err := client.
+		JamfProAPI.
+		Departments.
+		ListV1(ctx, nil)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve departments: %w", err)
+	}
+
+	for _, d := range departments.Results {
+		if strings.EqualFold(d.Name, value) {
+			return d.ID, nil
+		}
+	}
+	return "", fmt.Errorf("filter_department %q does not match any department in Jamf Pro", value)
+}
+
+// resolveBuildingID returns value unchanged when it is a numeric ID,
+// otherwise looks up the building with that name.
+func resolveBuildingID(ctx context.Context, client *jamfpro.Client, value string) (string, error) {
+	if numericIDRe.MatchString(value) {
+		return value, nil
+	}
+
+	buildings, _, err := client.
+		JamfProAPI.
+		Buildings.
+		ListV1(ctx, nil)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve buildings: %w", err)
+	}
+
+	for _, b := range buildings.Results {
+		if strings.EqualFold(b.Name, value) {
+			return b.ID, nil
+		}
+	}
+	return "", fmt.Errorf("filter_building %q does not match any building in Jamf Pro", value)
 }
 
 // fetchComputerGroupMembers returns the IDs of all computers in the given group.
-func fetchComputerGroupMembers(client *jamfpro.Client, groupID string) ([]string, error) {
-	ctx := context.Background()
+// A group Jamf Pro does not know is reported as such rather than as a failed
+// request, since retrying will not help.
+func fetchComputerGroupMembers(ctx context.Context, client *jamfpro.Client, groupID string) ([]string, error) {
 	id, err := strconv.Atoi(groupID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid group ID %q: must be numeric", groupID)
@@ -353,6 +1652,9 @@ func fetchComputerGroupMembers(client *jamfpro.Client, groupID string) ([]string
 		GetByID(ctx, id)
 
 	if err != nil {
+		if status, _ := classifyFetchError(err); status == http.StatusNotFound {
+			return nil, fmt.Errorf("computer group %s does not exist — check --group-id", groupID)
+		}
 		return nil, fmt.Errorf("failed to retrieve computer group %s: %w", groupID, err)
 	}
 
@@ -363,9 +1665,62 @@ func fetchComputerGroupMembers(client *jamfpro.Client, groupID string) ([]string
 	return ids, nil
 }
 
+// fetchComputerPrestageScope returns the IDs of the computers scoped to the
+// prestage enrollment named by prestage_id, in scope order. A prestage scope
+// lists serial numbers, so they are matched against the HARDWARE section of
+// computer inventory; serial numbers with no inventory record, such as
+// computers that have not enrolled yet, are skipped with a warning.
+func fetchComputerPrestageScope(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) (*sourceFetchResult, error) {
+	scope, _, err := client.
+		JamfProAPI.
+		ComputerPrestages.
+		GetDeviceScopeByIDV2(ctx, cfg.PrestageID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve computer prestage %s scope: %w", cfg.PrestageID, err)
+	}
+
+	idBySerial := make(map[string]string, len(scope.Assignments))
+	for _, a := range scope.Assignments {
+		idBySerial[a.SerialNumber] = ""
+	}
+	mergePage := func(page []byte) error {
+		var computers []computer_inventory.ResourceComputerInventory
+		if err := json.Unmarshal(page, &computers); err != nil {
+			return err
+		}
+		for _, c := range computers {
+			if _, scoped := idBySerial[c.Hardware.SerialNumber]; scoped {
+				idBySerial[c.Hardware.SerialNumber] = c.ID
+			}
+		}
+		return nil
+	}
+
+	err = fetchPaginated(ctx, client, cfg, computerInventoryPath, map[string]string{"section": "HARDWARE"}, mergePage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match computer prestage %s scope to inventory: %w", cfg.PrestageID, err)
+	}
+
+	fetched := &sourceFetchResult{}
+	var unmatched []string
+	for _, a := range scope.Assignments {
+		if id := idBySerial[a.SerialNumber]; id != "" {
+			fetched.IDs = append(fetched.IDs, id)
+		} else {
+			unmatched = append(unmatched, a.SerialNumber)
+		}
+	}
+	if len(unmatched) > 0 {
+		addWarning(&fetched.Warnings, "%d serial number(s) scoped to computer prestage %s have no computer inventory record and were skipped: %s",
+			len(unmatched), cfg.PrestageID, strings.Join(unmatched, ", "))
+	}
+	return fetched, nil
+}
+
 // fetchMobileDeviceGroupMembers returns the IDs of all mobile devices in the given group.
-func fetchMobileDeviceGroupMembers(client *jamfpro.Client, groupID string) ([]string, error) {
-	ctx := context.Background()
+// As with computer groups, a missing group gets its own error.
+func fetchMobileDeviceGroupMembers(ctx context.Context, client *jamfpro.Client, groupID string) ([]string, error) {
 	id, err := strconv.Atoi(groupID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid group ID %q: must be numeric", groupID)
@@ -377,6 +1732,9 @@ func fetchMobileDeviceGroupMembers(client *jamfpro.Client, groupID string) ([]st
 		GetByID(ctx, id)
 
 	if err != nil {
+		if status, _ := classifyFetchError(err); status == http.StatusNotFound {
+			return nil, fmt.Errorf("mobile device group %s does not exist — check --group-id", groupID)
+		}
 		return nil, fmt.Errorf("failed to retrieve mobile device group %s: %w", groupID, err)
 	}
 
@@ -387,10 +1745,36 @@ func fetchMobileDeviceGroupMembers(client *jamfpro.Client, groupID string) ([]st
 	return ids, nil
 }
 
-// fetchUsers returns the IDs of all Jamf Pro user accounts.
-func fetchUsers(client *jamfpro.Client) ([]string, error) {
-	ctx := context.Background()
+// fetchUserGroupMembers returns the IDs of all users in the given user group,
+// smart or static. An empty group returns no IDs rather than an error.
+func fetchUserGroupMembers(ctx context.Context, client *jamfpro.Client, groupID string) ([]string, error) {
+	id, err := strconv.Atoi(groupID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group ID %q: must be numeric", groupID)
+	}
+
+	// Smart and static user groups share one Classic API endpoint.
+	group, _, err := client.
+		ClassicAPI.
+		StaticUserGroups.
+		GetByID(ctx, id)
+
+	if err != nil {
+		if status, _ := classifyFetchError(err); status == http.StatusNotFound {
+			return nil, fmt.Errorf("user group %s does not exist — check --group-id", groupID)
+		}
+		return nil, fmt.Errorf("failed to retrieve user group %s: %w", groupID, err)
+	}
+
+	var ids []string
+	for _, u := range group.Users {
+		ids = append(ids, strconv.Itoa(u.ID))
+	}
+	return ids, nil
+}
 
+// fetchUsers returns the IDs of all Jamf Pro user accounts.
+func fetchUsers(ctx context.Context, client *jamfpro.Client) ([]string, error) {
 	users, _, err := client.
 		ClassicAPI.
 		Users.
@@ -407,82 +1791,586 @@ func fetchUsers(client *jamfpro.Client) ([]string, error) {
 	return ids, nil
 }
 
-// ── Exclusions & reservations ─────────────────────────────────────────────────
-
-// applyExclusions removes any ID present in excludeIDs from the pool.
-func applyExclusions(ids []string, excludeIDs []string) []string {
-	if len(excludeIDs) == 0 {
-		return ids
-	}
-	excludeSet := make(map[string]bool, len(excludeIDs))
-	for _, id := range excludeIDs {
-		excludeSet[id] = true
-	}
-	filtered := make([]string, 0, len(ids))
-	for _, id := range ids {
-		if !excludeSet[id] {
-			filtered = append(filtered, id)
-		}
-	}
-	return filtered
+// ── Fetch retry ───────────────────────────────────────────────────────────────
+
+// fetchRetryBaseDelay is the wait before the first application-level retry.
+// Each later wait doubles. A variable so tests can shorten it.
+var fetchRetryBaseDelay = time.Second
+
+// withFetchRetry runs fetch, retrying transient failures with exponential
+// backoff. This sits above the SDK's own retries, which do not cover every
+// endpoint the sharder uses (Classic API group lookups in particular).
+//
+// Up to max_retry_attempts retries are made, and no retry is started whose
+// wait would run past total_retry_duration_seconds (0 means no time limit).
+// Once retries have been made, the final error reports the attempt count and
+// the last HTTP status seen.
+func withFetchRetry[T any](ctx context.Context, cfg *shardConfig, fetch func() (T, error)) (T, error) {
+	return retryFetch(ctx, cfg, cfg.MaxRetryAttempts, fetch)
 }
 
-// applyReservations partitions the ID pool into reserved (pinned to a specific
-// shard) and unreserved (available for the sharding algorithm). Validates that
-// shard names are in range and that no ID appears in more than one shard.
-func applyReservations(ids []string, reservedMap map[string][]string, shardCount int) (*shardReservations, error) {
-	info := &shardReservations{
-		IDsByShard:    make(map[string][]string),
-		CountsByShard: make(map[int]int),
-		UnreservedIDs: ids,
-	}
-	if len(reservedMap) == 0 {
-		return info, nil
+// retryFetch is withFetchRetry with the retry count given explicitly, so
+// paginated fetches can retry single pages under fetch_page_retries.
+func retryFetch[T any](ctx context.Context, cfg *shardConfig, maxRetries int, fetch func() (T, error)) (T, error) {
+	var deadline time.Time
+	if cfg.TotalRetryDuration > 0 {
+		deadline = time.Now().Add(time.Duration(cfg.TotalRetryDuration) * time.Second)
 	}
 
-	seenIDs := make(map[string]string)
+	rateLimits := rateLimitTrackerFrom(ctx)
+	delay := fetchRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		result, err := fetch()
+		if err == nil {
+			return result, nil
+		}
+		// A cancelled or expired run is never retried.
+		if ctx.Err() != nil {
+			return result, err
+		}
 
-	for shardName, idList := range reservedMap {
-		var shardIndex int
-		if _, err := fmt.Sscanf(shardName, "shard_%d", &shardIndex); err != nil {
-			return nil, fmt.Errorf("invalid shard name %q in reserved_ids: must be 'shard_0', 'shard_1', etc.", shardName)
+		status, retryable := classifyFetchError(err)
+		// A 429 waits as long as its Retry-After header asks, when it has one.
+		wait := delay
+		rateLimited := status == http.StatusTooManyRequests
+		retryAfter, hasRetryAfter := rateLimits.take()
+		if rateLimited && hasRetryAfter {
+			wait = retryAfter
 		}
-		if shardIndex < 0 || shardIndex >= shardCount {
-			return nil, fmt.Errorf(
-				"shard name %q in reserved_ids is out of range: with shard_count=%d, valid names are shard_0 to shard_%d",
-				shardName, shardCount, shardCount-1,
-			)
+		exhausted := attempt > maxRetries ||
+			(!deadline.IsZero() && time.Now().Add(wait).After(deadline))
+		if !retryable || (attempt == 1 && exhausted) {
+			return result, err
 		}
-		for _, id := range idList {
-			if prev, exists := seenIDs[id]; exists {
-				return nil, fmt.Errorf(
-					"ID %q appears in multiple reserved_ids shards: %q and %q — each ID may only be reserved for one shard",
-					id, prev, shardName,
-				)
+		if exhausted {
+			if status != 0 {
+				return result, fmt.Errorf("giving up after %d attempt(s), last HTTP status %d: %w", attempt, status, err)
 			}
-			seenIDs[id] = shardName
+			return result, fmt.Errorf("giving up after %d attempt(s): %w", attempt, err)
 		}
-		info.IDsByShard[shardName] = idList
-		info.CountsByShard[shardIndex] = len(idList)
-	}
 
-	if len(seenIDs) > 0 {
-		reservedSet := make(map[string]bool, len(seenIDs))
-		for id := range seenIDs {
-			reservedSet[id] = true
+		if rateLimited && hasRetryAfter {
+			warnf("fetch attempt %d was rate limited, retrying in %s as Retry-After asks: %v", attempt, wait, err)
+		} else {
+			warnf("fetch attempt %d failed, retrying in %s: %v", attempt, wait, err)
 		}
-		filtered := make([]string, 0, len(ids))
-		for _, id := range ids {
-			if !reservedSet[id] {
-				filtered = append(filtered, id)
-			}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(wait):
 		}
-		info.UnreservedIDs = filtered
+		if rateLimited {
+			rateLimits.addWait(wait)
+		}
+		delay *= 2
+	}
+}
+
+// rateLimitTracker carries the Retry-After of the latest 429 response, seen
+// by the Jamf Pro client's response middleware, to retryFetch, which has only
+// the SDK's error, and totals the time spent waiting on rate limits. It
+// travels in the fetch's context; its methods are safe on a nil tracker.
+type rateLimitTracker struct {
+	mu            sync.Mutex
+	retryAfter    time.Duration
+	hasRetryAfter bool
+	waited        time.Duration
+}
+
+type rateLimitTrackerKey struct{}
+
+// withRateLimitTracker returns ctx carrying a new rateLimitTracker.
+func withRateLimitTracker(ctx context.Context) (context.Context, *rateLimitTracker) {
+	tracker := &rateLimitTracker{}
+	return context.WithValue(ctx, rateLimitTrackerKey{}, tracker), tracker
+}
+
+// rateLimitTrackerFrom returns the tracker in ctx, or nil when there is none.
+func rateLimitTrackerFrom(ctx context.Context) *rateLimitTracker {
+	tracker, _ := ctx.Value(rateLimitTrackerKey{}).(*rateLimitTracker)
+	return tracker
+}
+
+// take returns and clears the Retry-After of the latest 429 response.
+func (t *rateLimitTracker) take() (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	retryAfter, ok := t.retryAfter, t.hasRetryAfter
+	t.retryAfter, t.hasRetryAfter = 0, false
+	return retryAfter, ok
+}
+
+// setRetryAfter records the Retry-After of the latest response; ok is false
+// when it had none, so an older value is never applied to a later failure.
+func (t *rateLimitTracker) setRetryAfter(wait time.Duration, ok bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retryAfter, t.hasRetryAfter = wait, ok
+}
+
+func (t *rateLimitTracker) addWait(wait time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.waited += wait
+}
+
+// waitedMs returns the total time spent waiting on rate limits.
+func (t *rateLimitTracker) waitedMs() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waited.Milliseconds()
+}
+
+// recordRetryAfter is response middleware for the Jamf Pro client. The HTTP
+// client under the SDK already waits out a 429's Retry-After within
+// max_retry_attempts, but the error the SDK returns once those retries run
+// out carries no headers, so the Retry-After is handed to retryFetch through
+// the tracker in the request's context.
+func recordRetryAfter(_ *resty.Client, resp *resty.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+	wait, ok := retryAfterOf(resp)
+	rateLimitTrackerFrom(resp.Request.Context()).setRetryAfter(wait, ok)
+	return nil
+}
+
+// countRetryAfterWait is a retry hook for the Jamf Pro client, run before the
+// HTTP client retries a request. It adds the Retry-After wait of a 429 to
+// the tracker's rate-limit total.
+func countRetryAfterWait(resp *resty.Response, _ error) {
+	if resp == nil || resp.Request == nil {
+		return
+	}
+	if wait, ok := retryAfterOf(resp); ok {
+		rateLimitTrackerFrom(resp.Request.Context()).addWait(wait)
+	}
+}
+
+// retryAfterOf returns the Retry-After of resp when it is a 429 response.
+func retryAfterOf(resp *resty.Response) (time.Duration, bool) {
+	if resp.StatusCode() != http.StatusTooManyRequests {
+		return 0, false
+	}
+	return parseRetryAfter(resp.Header().Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter reads a Retry-After header value, either delay seconds or
+// an HTTP date, as the time to wait from now. It reports false for an absent
+// or malformed value.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// tokenRejectedRe matches the SDK's error when Jamf Pro answers the token
+// request with a client error, i.e. rejects the credentials themselves.
+var tokenRejectedRe = regexp.MustCompile(`token request failed: 4\d\d`)
+
+// checkAuth makes one lightweight authenticated request, reading the Jamf Pro
+// version, so credentials the API does not accept fail the run with a clear
+// error before a fetch of potentially thousands of records.
+func checkAuth(ctx context.Context, client *jamfpro.Client, cfg *shardConfig) error {
+	version, _, err := client.JamfProAPI.JamfProVersion.GetV1(ctx)
+	if err != nil {
+		if status, _ := classifyFetchError(err); status == http.StatusUnauthorized || status == http.StatusForbidden {
+			return authFailedError(cfg, err)
+		}
+		return fmt.Errorf("authentication check against %s failed: %w — set --check-auth=false to skip it",
+			cfg.InstanceDomain, err)
+	}
+	if version != nil && version.Version != nil {
+		verbosef("Authenticated to Jamf Pro %s", *version.Version)
+	}
+	return nil
+}
+
+// authFailedError reports that Jamf Pro rejected the credentials, naming the
+// settings to check for the configured auth_method.
+func authFailedError(cfg *shardConfig, err error) error {
+	keys := "client_id and client_secret"
+	if cfg.AuthMethod == "basic" {
+		keys = "basic_auth_username and basic_auth_password"
+	}
+	return fmt.Errorf("authentication failed: %s rejected the %s credentials — check %s: %w",
+		cfg.InstanceDomain, cfg.AuthMethod, keys, err)
+}
+
+// classifyFetchError reports the HTTP status carried by err (0 when there is
+// none) and whether the failure is worth retrying: server errors, 408 and
+// 429 responses, and network-level errors.
+func classifyFetchError(err error) (status int, retryable bool) {
+	var apiErr *jamfclient.APIError
+	if errors.As(err, &apiErr) {
+		status = apiErr.StatusCode
+		return status, status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return 0, errors.As(err, &netErr)
+}
+
+// ── Exclusions & reservations ─────────────────────────────────────────────────
+
+// applyExclusions removes any ID present in excludeIDs, or matched by
+// pattern when it is not nil, from the pool. It also returns how many IDs
+// pattern matched that excludeIDs did not already remove.
+func applyExclusions(ids []string, excludeIDs []string, pattern *regexp.Regexp) ([]string, int) {
+	if len(excludeIDs) == 0 && pattern == nil {
+		return ids, 0
+	}
+	excludeSet := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excludeSet[id] = true
+	}
+	filtered := make([]string, 0, len(ids))
+	matched := 0
+	for _, id := range ids {
+		switch {
+		case excludeSet[id]:
+		case pattern != nil && pattern.MatchString(id):
+			matched++
+		default:
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered, matched
+}
+
+// compileExcludePattern compiles exclude_id_pattern, returning nil when it is
+// not set.
+func compileExcludePattern(cfg *shardConfig) (*regexp.Regexp, error) {
+	if cfg.ExcludeIDPattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(cfg.ExcludeIDPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_id_pattern %q: %w", cfg.ExcludeIDPattern, err)
+	}
+	return pattern, nil
+}
+
+// applyHoldback removes holdback_percentage of ids, rounded to the nearest
+// whole ID, as a control cohort: the lowest-ranked by seedRankedIDs under
+// holdback_seed. Reserved IDs are never held back. Returns ids unchanged and
+// a nil summary when holdback_percentage is not set.
+func applyHoldback(cfg *shardConfig, ids []string) ([]string, *HoldbackSummary) {
+	if cfg.HoldbackPercent <= 0 {
+		return ids, nil
+	}
+
+	reserved := make(map[string]bool)
+	for _, shardIDs := range cfg.ReservedIDs {
+		for _, id := range shardIDs {
+			reserved[id] = true
+		}
+	}
+	candidates := slices.DeleteFunc(slices.Clone(ids), func(id string) bool { return reserved[id] })
+
+	count := min(int(math.Round(float64(len(ids))*cfg.HoldbackPercent/100)), len(candidates))
+	heldBack := seedRankedIDs(candidates, "holdback", cfg.HoldbackSeed)[:count]
+	sharding.SortIDsNumerically(heldBack)
+	return removeIDs(ids, heldBack), &HoldbackSummary{
+		Percentage: cfg.HoldbackPercent,
+		Seed:       cfg.HoldbackSeed,
+		IDCount:    count,
+		IDs:        heldBack,
+	}
+}
+
+// applySample keeps a deterministic sample of sample_size ids, the
+// highest-ranked by seedRankedIDs under sample_seed, in their original order.
+// When sample_size is not below the number of ids, every ID is kept with a
+// warning. Returns ids unchanged when sample_size is not set.
+func applySample(cfg *shardConfig, ids []string, warnings *[]string) []string {
+	if cfg.SampleSize <= 0 {
+		return ids
+	}
+	if cfg.SampleSize >= len(ids) {
+		addWarning(warnings, "sample_size is %d but only %d ID(s) were fetched; sharding all of them",
+			cfg.SampleSize, len(ids))
+		return ids
+	}
+	dropped := seedRankedIDs(ids, "sample", cfg.SampleSeed)[cfg.SampleSize:]
+	return removeIDs(ids, dropped)
+}
+
+// seedRankedIDs returns a copy of ids ordered by the SHA-256 digest of
+// purpose, seed, and each ID. The same seed always ranks the same IDs the
+// same way, and an ID's rank does not depend on the rest of the pool, so a
+// selection taken from the front changes only by the IDs added or removed
+// between runs. purpose keeps selections made for different reasons
+// independent when they share a seed.
+func seedRankedIDs(ids []string, purpose, seed string) []string {
+	digests := make(map[string][32]byte, len(ids))
+	for _, id := range ids {
+		digests[id] = sha256.Sum256([]byte(purpose + ":" + seed + ":" + id))
+	}
+	ranked := slices.Clone(ids)
+	slices.SortFunc(ranked, func(a, b string) int {
+		da, db := digests[a], digests[b]
+		return bytes.Compare(da[:], db[:])
+	})
+	return ranked
+}
+
+// removeIDs returns ids without any ID in remove, keeping their order.
+func removeIDs(ids, remove []string) []string {
+	removeSet := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		removeSet[id] = true
+	}
+	kept := make([]string, 0, len(ids)-len(remove))
+	for _, id := range ids {
+		if !removeSet[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// resolveExcludeIDs returns exclude_ids plus every ID assigned in the
+// exclude_from_result file, when one is set.
+func resolveExcludeIDs(cfg *shardConfig) ([]string, error) {
+	if cfg.ExcludeFromResult == "" {
+		return cfg.ExcludeIDs, nil
+	}
+	prior, err := loadShardResult(cfg.ExcludeFromResult)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --exclude-from-result: %w", err)
+	}
+	return append(slices.Clone(cfg.ExcludeIDs), resultIDs(prior)...), nil
+}
+
+// unusedExcludeIDs returns the exclude_ids entries that are not in the
+// fetched pool, in exclude_ids order. The full fetch is compared, before
+// sampling, so an ID the sample happened to leave out is not reported.
+func unusedExcludeIDs(excludeIDs, fetchedIDs []string) []string {
+	if len(excludeIDs) == 0 {
+		return nil
+	}
+	pool := make(map[string]bool, len(fetchedIDs))
+	for _, id := range fetchedIDs {
+		pool[id] = true
+	}
+	var unused []string
+	for _, id := range excludeIDs {
+		if !pool[id] && !slices.Contains(unused, id) {
+			unused = append(unused, id)
+		}
+	}
+	return unused
+}
+
+// checkUnusedExcludeIDs warns on stderr when exclude_ids entries matched
+// nothing in the source pool, which is usually a typo. With failOnUnused set
+// the condition is an error.
+func checkUnusedExcludeIDs(unused []string, failOnUnused bool, warnings *[]string) error {
+	if len(unused) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%d excluded ID(s) not found in the source pool: %s",
+		len(unused), strings.Join(unused, ", "))
+	if failOnUnused {
+		return fmt.Errorf("%s (--fail-on-unused-excludes is set)", msg)
+	}
+	addWarning(warnings, "%s", msg)
+	return nil
+}
+
+// applyReservations partitions the ID pool into reserved (pinned to a specific
+// shard) and unreserved (available for the sharding algorithm). Validates that
+// shard names are in range and that no ID appears in more than one shard.
+// Reserved IDs absent from the pool are still pinned, and are listed in
+// MissingIDs so the caller can report them.
+//
+// Shard names in reservedMap use prefix; IDsByShard is keyed by shard index.
+func applyReservations(ids []string, reservedMap map[string][]string, shardCount int, prefix string) (*shardReservations, error) {
+	info := &shardReservations{Reservations: sharding.Reservations{
+		IDsByShard:    make(map[int][]string),
+		UnreservedIDs: ids,
+	}}
+	if len(reservedMap) == 0 {
+		return info, nil
+	}
+
+	seenIDs := make(map[string]string)
+	if prefix == "" {
+		prefix = defaultShardPrefix
+	}
+
+	for name, idList := range reservedMap {
+		// Atoi rather than parseShardName, so "shard_-1" is reported as out
+		// of range rather than malformed.
+		rest, hasPrefix := strings.CutPrefix(name, prefix)
+		shardIndex, err := strconv.Atoi(rest)
+		if !hasPrefix || err != nil {
+			return nil, fmt.Errorf("invalid shard name %q in reserved_ids: must be '%s', '%s', etc.",
+				name, shardName(prefix, 0), shardName(prefix, 1))
+		}
+		if shardIndex < 0 || shardIndex >= shardCount {
+			return nil, fmt.Errorf(
+				"shard name %q in reserved_ids is out of range: with shard_count=%d, valid names are %s to %s",
+				name, shardCount, shardName(prefix, 0), shardName(prefix, shardCount-1),
+			)
+		}
+		for _, id := range idList {
+			if prev, exists := seenIDs[id]; exists {
+				return nil, fmt.Errorf(
+					"ID %q appears in multiple reserved_ids shards: %q and %q — each ID may only be reserved for one shard",
+					id, prev, name,
+				)
+			}
+			seenIDs[id] = name
+		}
+		info.IDsByShard[shardIndex] = idList
+	}
+
+	if len(seenIDs) > 0 {
+		reservedSet := make(map[string]bool, len(seenIDs))
+		for id := range seenIDs {
+			reservedSet[id] = true
+		}
+		poolSet := make(map[string]bool, len(ids))
+		filtered := make([]string, 0, len(ids))
+		for _, id := range ids {
+			poolSet[id] = true
+			if !reservedSet[id] {
+				filtered = append(filtered, id)
+			}
+		}
+		info.UnreservedIDs = filtered
+
+		for id := range seenIDs {
+			if !poolSet[id] {
+				info.MissingIDs = append(info.MissingIDs, id)
+			}
+		}
+		sharding.SortIDsNumerically(info.MissingIDs)
 	}
 
 	return info, nil
 }
 
+// loadShardResult reads a ShardResult previously written by this tool. The
+// format is chosen from the file extension: .ndjson/.jsonl are read line by
+// line, .yaml/.yml as YAML, and anything else as JSON.
+func loadShardResult(path string) (*ShardResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result file %s: %w", path, err)
+	}
+
+	result := &ShardResult{Shards: make(map[string][]string)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			var rec struct {
+				ShardRecord
+				Metadata       *ShardMetadata               `json:"metadata"`
+				ShardBreakdown map[string]ShardCounts       `json:"shard_breakdown"`
+				Labels         map[string]map[string]string `json:"labels"`
+				Warnings       []string                     `json:"warnings"`
+				Truncated      bool                         `json:"truncated"`
+			}
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				return nil, fmt.Errorf("failed to parse result file %s line %d: %w", path, i+1, err)
+			}
+			if rec.Metadata != nil {
+				result.Metadata = *rec.Metadata
+				result.ShardBreakdown = rec.ShardBreakdown
+				result.Labels = rec.Labels
+				result.Warnings = rec.Warnings
+				result.Truncated = rec.Truncated
+				continue
+			}
+			result.Shards[rec.Shard] = append(result.Shards[rec.Shard], rec.ID)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("failed to parse result file %s: %w", path, err)
+		}
+	default:
+		if err := json.Unmarshal(data, result); err != nil {
+			// json-detailed output holds {id, managed} objects in place of
+			// plain IDs.
+			var detailed DetailedShardResult
+			if json.Unmarshal(data, &detailed) != nil {
+				return nil, fmt.Errorf("failed to parse result file %s: %w", path, err)
+			}
+			result.Metadata = detailed.Metadata
+			result.ShardBreakdown = detailed.ShardBreakdown
+			result.Labels = detailed.Labels
+			result.Warnings = detailed.Warnings
+			result.Truncated = detailed.Truncated
+			result.Shards = make(map[string][]string, len(detailed.Shards))
+			for name, entries := range detailed.Shards {
+				for _, e := range entries {
+					result.Shards[name] = append(result.Shards[name], e.ID)
+				}
+			}
+		}
+	}
+	if result.Truncated {
+		return nil, fmt.Errorf("result file %s was written with --preview-count, so its shards are incomplete — "+
+			"rerun shard without it to get a result that can be read back", path)
+	}
+	if len(result.Metadata.OnlyShards) > 0 {
+		return nil, fmt.Errorf("result file %s was written with --only-shards %s, so it is missing the other shards — "+
+			"rerun shard without it to get a result that can be read back", path, strings.Join(result.Metadata.OnlyShards, ","))
+	}
+	checkResultExpiry(path, result, time.Now())
+	return result, nil
+}
+
+// checkResultExpiry warns when result, read from path, is past the
+// expires_at its run recorded with expires_in, since the fleet may have
+// changed since it was sharded.
+func checkResultExpiry(path string, result *ShardResult, now time.Time) {
+	expiresAt := result.Metadata.ExpiresAt
+	if expiresAt == nil || now.Before(*expiresAt) {
+		return
+	}
+	warnf("result file %s expired at %s (%s ago); its shards may be stale — rerun shard for a fresh result",
+		path, expiresAt.Format(time.RFC3339), now.Sub(*expiresAt).Round(time.Second))
+}
+
+// resultIDs returns every ID across all shards of result, in shard order.
+func resultIDs(result *ShardResult) []string {
+	var ids []string
+	for _, name := range sortedShardNames(result.Shards) {
+		ids = append(ids, result.Shards[name]...)
+	}
+	return ids
+}
+
 // ── Strategy dispatch ─────────────────────────────────────────────────────────
 
 // resolveShardCount infers the shard count from whichever configuration
@@ -497,36 +2385,450 @@ func resolveShardCount(cfg *shardConfig) int {
 	return cfg.ShardCount
 }
 
+// checkWarnings fails the run when fail_on_warnings is set and it produced
+// any warning, listing them all. Each was already printed by addWarning.
+func checkWarnings(cfg *shardConfig, warnings []string) error {
+	if !cfg.FailOnWarnings || len(warnings) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d warning(s) with --fail-on-warnings set:\n  - %s",
+		len(warnings), strings.Join(warnings, "\n  - "))
+}
+
+// addWarning prints a warning to stderr like warnf and appends it to
+// warnings, which end up in the result's warnings list. A nil warnings only
+// prints.
+func addWarning(warnings *[]string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	warnf("%s", msg)
+	if warnings != nil {
+		*warnings = append(*warnings, msg)
+	}
+}
+
+// checkUndistributedIDs warns when the strategy left IDs out of every shard,
+// which happens with allow_partial percentages or shard_sizes without a
+// trailing -1.
+func checkUndistributedIDs(undistributed int, warnings *[]string) {
+	if undistributed > 0 {
+		addWarning(warnings, "%d ID(s) were left out of every shard (see undistributed_id_count)", undistributed)
+	}
+}
+
+// checkShardSizesTotal warns when the fixed entries of shard_sizes (every
+// size except -1) add up to more than the available IDs, since the size
+// strategy then silently leaves the trailing shards short or empty. Reserved
+// IDs count towards their shard's size, so available includes them. With
+// failOnOversized set the condition is an error.
+func checkShardSizesTotal(sizes []int, available int, failOnOversized bool, warnings *[]string) error {
+	total := 0
+	for _, size := range sizes {
+		if size > 0 {
+			total += size
+		}
+	}
+	if total <= available {
+		return nil
+	}
+	msg := fmt.Sprintf(
+		"shard_sizes request %d ID(s) but only %d are available after exclusions; the last shards will be short or empty",
+		total, available,
+	)
+	if failOnOversized {
+		return fmt.Errorf("%s (--fail-on-oversized is set)", msg)
+	}
+	addWarning(warnings, "%s", msg)
+	return nil
+}
+
+// checkZeroPercentages warns about shard_percentages entries of 0. They are
+// valid, for a shard meant to hold only reserved IDs, but are more often a
+// typo, since the strategy never places an ID in such a shard.
+func checkZeroPercentages(percentages []float64, prefix string, warnings *[]string) {
+	var zero []string
+	for i, pct := range percentages {
+		if pct == 0 {
+			zero = append(zero, shardName(prefix, i))
+		}
+	}
+	if len(zero) > 0 {
+		addWarning(warnings, "shard_percentages gives %s 0%%; the strategy places no IDs there, only reserved_ids",
+			strings.Join(zero, ", "))
+	}
+}
+
+// rebalancedShards returns the shards whose reservations exceed their
+// percentage target when balance_after_reservations is set, so the other
+// shards absorb the excess. It logs when rebalancing applies.
+func rebalancedShards(cfg *shardConfig, totalIDs int, reservations *shardReservations) []string {
+	if !cfg.BalanceReserved {
+		return nil
+	}
+	_, over := sharding.PercentageTargets(totalIDs, cfg.ShardPercentages, reservations.Counts(), true)
+	var names []string
+	for _, i := range over {
+		names = append(names, shardName(cfg.ShardPrefix, i))
+	}
+	if len(names) > 0 {
+		infof("Rebalancing after reservations: %s keep their reserved IDs above their percentage; the other shards absorb the excess",
+			strings.Join(names, ", "))
+	}
+	return names
+}
+
+// checkExplainIDs warns about explain_ids that ended up in no shard, because
+// the source did not return them, they were excluded, or allow_partial left
+// them undistributed.
+func checkExplainIDs(explainIDs []string, placements map[string]PlacementExplanation, warnings *[]string) {
+	var missing []string
+	for _, id := range explainIDs {
+		if _, ok := placements[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		addWarning(warnings, "explain_ids %s are not in any shard and have no explanation", strings.Join(missing, ", "))
+	}
+}
+
+// checkEmptySource warns when the source returned no IDs at all, which
+// usually means a wrong group_id rather than an empty fleet. With
+// fail_on_empty_source set the warning becomes an error.
+func checkEmptySource(cfg *shardConfig, fetched *sourceFetchResult, warnings *[]string) error {
+	if len(fetched.IDs) > 0 {
+		return nil
+	}
+	source := "source_type " + cfg.SourceType
+	if cfg.GroupID != "" {
+		source += fmt.Sprintf(" (group_id %s)", cfg.GroupID)
+	}
+	if cfg.PrestageID != "" {
+		source += fmt.Sprintf(" (prestage_id %s)", cfg.PrestageID)
+	}
+	if cfg.RawPath != "" {
+		source += fmt.Sprintf(" (raw_path %s)", cfg.RawPath)
+	}
+	msg := source + " returned no IDs"
+	if fetched.LocationFilter != nil {
+		msg += " after location filters"
+	}
+	if cfg.FailOnEmptySource {
+		return fmt.Errorf("%s (--fail-on-empty-source is set)", msg)
+	}
+	addWarning(warnings, "%s — every shard will be empty", msg)
+	return nil
+}
+
+// checkDistributableIDs warns on stderr when more shards are requested than
+// there are unreserved IDs to distribute, since the surplus shards can only be
+// filled by reservations. With failOnEmpty set the condition is an error.
+func checkDistributableIDs(shardCount, distributable int, failOnEmpty bool, warnings *[]string) error {
+	if shardCount <= distributable {
+		return nil
+	}
+	msg := fmt.Sprintf(
+		"shard count %d exceeds the %d distributable (unreserved) ID(s); some shards will be empty",
+		shardCount, distributable,
+	)
+	if failOnEmpty {
+		return fmt.Errorf("%s (--fail-on-empty-shards is set)", msg)
+	}
+	addWarning(warnings, "%s", msg)
+	return nil
+}
+
+// checkMissingReservedIDs warns on stderr when reserved IDs were not found in
+// the source pool (for example a wiped device). With failOnMissing set the
+// condition is an error.
+func checkMissingReservedIDs(missing []string, failOnMissing bool, warnings *[]string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%d reserved ID(s) not found in the source pool: %s",
+		len(missing), strings.Join(missing, ", "))
+	if failOnMissing {
+		return fmt.Errorf("%s (--fail-on-missing-reserved is set)", msg)
+	}
+	addWarning(warnings, "%s", msg)
+	return nil
+}
+
 // applyStrategy routes to the appropriate sharding algorithm and returns the
 // resulting per-shard ID slices.
 func applyStrategy(cfg *shardConfig, ids []string, reservations *shardReservations) ([][]string, error) {
+	seed := strategySeed(cfg)
+	var reserved *sharding.Reservations
+	if reservations != nil {
+		reserved = &reservations.Reservations
+	}
 	switch cfg.Strategy {
 	case "round-robin":
-		return shardByRoundRobin(ids, cfg.ShardCount, cfg.Seed, reservations), nil
+		return sharding.RoundRobin(ids, cfg.ShardCount, cfg.RoundRobinOffset, seed, reserved), nil
 	case "rendezvous":
-		return shardByRendezvous(ids, cfg.ShardCount, cfg.Seed, reservations), nil
+		if cfg.Parallel {
+			return sharding.RendezvousParallel(ids, cfg.ShardCount, cfg.ShardWeights, seed, reserved), nil
+		}
+		return sharding.Rendezvous(ids, cfg.ShardCount, cfg.ShardWeights, seed, reserved), nil
 	case "percentage":
-		return shardByPercentage(ids, cfg.ShardPercentages, cfg.Seed, reservations), nil
+		return sharding.Percentage(ids, cfg.ShardPercentages, seed, reserved, cfg.BalanceReserved), nil
 	case "size":
-		return shardBySize(ids, cfg.ShardSizes, cfg.Seed, reservations), nil
+		return sharding.Size(ids, cfg.ShardSizes, seed, reserved), nil
+	case "balanced":
+		return sharding.Balanced(ids, cfg.ShardCount, seed, reserved), nil
+	case "hash-ring":
+		return sharding.HashRing(ids, cfg.ShardCount, cfg.VirtualNodes, seed, reserved), nil
 	default:
 		return nil, fmt.Errorf("unknown strategy: %q", cfg.Strategy)
 	}
 }
 
+// ── Shard size limits ─────────────────────────────────────────────────────────
+
+// enforceShardCap applies max_ids_per_shard to the strategy output. Reserved
+// IDs are never moved; only algorithmically placed IDs count as excess.
+//
+//   - "error" (or empty) fails if any shard is over the cap.
+//   - "spill" cascades each shard's excess into the following shard.
+//   - "new-shard" collects all excess and packs it into additional shards.
+//
+// A summary is returned only when IDs were actually moved.
+func enforceShardCap(shards [][]string, maxPerShard int, policy, prefix string, reservations *shardReservations) ([][]string, *OverflowSummary, error) {
+	if maxPerShard <= 0 {
+		return shards, nil, nil
+	}
+
+	var oversized []string
+	for i, shard := range shards {
+		if len(shard) > maxPerShard {
+			oversized = append(oversized, fmt.Sprintf("%s (%d IDs)", shardName(prefix, i), len(shard)))
+		}
+	}
+	if len(oversized) == 0 {
+		return shards, nil, nil
+	}
+
+	reservedSet := make(map[string]bool)
+	if reservations != nil {
+		for _, ids := range reservations.IDsByShard {
+			for _, id := range ids {
+				reservedSet[id] = true
+			}
+		}
+	}
+
+	summary := &OverflowSummary{
+		MaxIDsPerShard:      maxPerShard,
+		Policy:              policy,
+		RequestedShardCount: len(shards),
+	}
+
+	switch policy {
+	case "", "error":
+		return nil, nil, fmt.Errorf(
+			"%d shard(s) exceed max_ids_per_shard=%d: %s — raise the limit, add shards, or set --overflow to 'spill' or 'new-shard'",
+			len(oversized), maxPerShard, strings.Join(oversized, ", "),
+		)
+
+	case "spill":
+		for i := range shards {
+			if len(shards[i]) <= maxPerShard {
+				continue
+			}
+			keep, excess, err := splitShardExcess(shards[i], maxPerShard, reservedSet)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", shardName(prefix, i), err)
+			}
+			if i == len(shards)-1 {
+				return nil, nil, fmt.Errorf(
+					"%s exceeds max_ids_per_shard=%d by %d ID(s) and is the last shard, so there is nowhere to spill — use --overflow new-shard or add shards",
+					shardName(prefix, i), maxPerShard, len(excess),
+				)
+			}
+			shards[i] = keep
+			shards[i+1] = append(shards[i+1], excess...)
+			sharding.SortIDsNumerically(shards[i+1])
+			summary.IDsMoved += len(excess)
+		}
+
+	case "new-shard":
+		var pool []string
+		for i := range shards {
+			if len(shards[i]) <= maxPerShard {
+				continue
+			}
+			keep, excess, err := splitShardExcess(shards[i], maxPerShard, reservedSet)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", shardName(prefix, i), err)
+			}
+			shards[i] = keep
+			pool = append(pool, excess...)
+		}
+		sharding.SortIDsNumerically(pool)
+		summary.IDsMoved = len(pool)
+		for start := 0; start < len(pool); start += maxPerShard {
+			end := min(start+maxPerShard, len(pool))
+			shards = append(shards, pool[start:end])
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unknown overflow policy: %q", policy)
+	}
+
+	return shards, summary, nil
+}
+
+// enforceMinShardSize applies min_shard_size to the sharded output. Every
+// non-empty shard below the minimum is topped up, one ID at a time, from the
+// largest shard that has more than the minimum, taking its highest unreserved
+// ID. Empty shards are left empty. With failOnUndersized the run fails
+// instead.
+//
+// A summary is returned only when IDs were actually moved.
+func enforceMinShardSize(shards [][]string, minSize int, failOnUndersized bool, prefix string, reservations *shardReservations) (*MinShardSizeSummary, error) {
+	if minSize <= 0 {
+		return nil, nil
+	}
+
+	var undersized []string
+	for i, shard := range shards {
+		if len(shard) > 0 && len(shard) < minSize {
+			undersized = append(undersized, fmt.Sprintf("%s (%d IDs)", shardName(prefix, i), len(shard)))
+		}
+	}
+	if len(undersized) == 0 {
+		return nil, nil
+	}
+	if failOnUndersized {
+		return nil, fmt.Errorf("%d shard(s) are below min_shard_size=%d: %s (--fail-on-undersized is set)",
+			len(undersized), minSize, strings.Join(undersized, ", "))
+	}
+
+	reservedSet := make(map[string]bool)
+	if reservations != nil {
+		for _, ids := range reservations.IDsByShard {
+			for _, id := range ids {
+				reservedSet[id] = true
+			}
+		}
+	}
+
+	summary := &MinShardSizeSummary{MinShardSize: minSize}
+	for i := range shards {
+		if len(shards[i]) == 0 || len(shards[i]) >= minSize {
+			continue
+		}
+		for len(shards[i]) < minSize {
+			donor, pos := minShardSizeDonor(shards, minSize, reservedSet)
+			if donor < 0 {
+				return nil, fmt.Errorf(
+					"%s has %d ID(s), below min_shard_size=%d, and no shard has unreserved IDs to spare — "+
+						"lower the minimum or use fewer shards", shardName(prefix, i), len(shards[i]), minSize)
+			}
+			shards[i] = append(shards[i], shards[donor][pos])
+			shards[donor] = slices.Delete(shards[donor], pos, pos+1)
+			summary.IDsMoved++
+		}
+		sharding.SortIDsNumerically(shards[i])
+		summary.ToppedUpShards = append(summary.ToppedUpShards, shardName(prefix, i))
+	}
+	infof("Topped up %s to min_shard_size=%d, moving %d ID(s) from the largest shards",
+		strings.Join(summary.ToppedUpShards, ", "), minSize, summary.IDsMoved)
+	return summary, nil
+}
+
+// minShardSizeDonor returns the largest shard above minSize, the first such
+// shard on a tie, and the position of its last unreserved ID. It returns -1
+// when no shard can give an ID without falling to the minimum.
+func minShardSizeDonor(shards [][]string, minSize int, reservedSet map[string]bool) (donor, pos int) {
+	donor, pos = -1, -1
+	for i, shard := range shards {
+		if len(shard) <= minSize || (donor >= 0 && len(shard) <= len(shards[donor])) {
+			continue
+		}
+		for j := len(shard) - 1; j >= 0; j-- {
+			if !reservedSet[shard[j]] {
+				donor, pos = i, j
+				break
+			}
+		}
+	}
+	return donor, pos
+}
+
+// splitShardExcess trims shard down to maxPerShard IDs by removing
+// unreserved IDs from the end of the slice. Returns an error when the
+// reserved IDs alone exceed the cap.
+func splitShardExcess(shard []string, maxPerShard int, reservedSet map[string]bool) (keep, excess []string, err error) {
+	excessCount := len(shard) - maxPerShard
+	for i := len(shard) - 1; i >= 0 && len(excess) < excessCount; i-- {
+		if !reservedSet[shard[i]] {
+			excess = append(excess, shard[i])
+		}
+	}
+	if len(excess) < excessCount {
+		return nil, nil, fmt.Errorf(
+			"reserved IDs alone exceed max_ids_per_shard=%d — reduce reserved_ids for this shard or raise the limit",
+			maxPerShard)
+	}
+
+	moving := make(map[string]bool, len(excess))
+	for _, id := range excess {
+		moving[id] = true
+	}
+	keep = make([]string, 0, maxPerShard)
+	for _, id := range shard {
+		if !moving[id] {
+			keep = append(keep, id)
+		}
+	}
+	sharding.SortIDsNumerically(excess)
+	return keep, excess, nil
+}
+
 // ── Output ────────────────────────────────────────────────────────────────────
 
 // writeOutput serialises the ShardResult to the configured format and writes
-// it to stdout or the specified output file.
-func writeOutput(cfg *shardConfig, result *ShardResult) error {
+// it to stdout or the specified output file. The null format discards it
+// unserialised, so benchmarks measure the pipeline alone.
+func writeOutput(ctx context.Context, cfg *shardConfig, result *ShardResult) error {
+	if cfg.OutputFormat == "null" {
+		verbosef("Discarding output (output_format null)")
+		return nil
+	}
+	if cfg.OutputFile != "" {
+		path, err := expandOutputFile(cfg.OutputFile, &result.Metadata)
+		if err != nil {
+			return err
+		}
+		expanded := *cfg
+		expanded.OutputFile = path
+		cfg = &expanded
+	}
+	if cfg.Canonical {
+		result = canonicalResult(result)
+	}
+	if cfg.OutputDir != "" {
+		return writeOutputDir(ctx, cfg, result)
+	}
+	if cfg.OutputFormat == "ndjson" {
+		return writeNDJSONOutput(ctx, cfg, result)
+	}
+
 	var (
 		data []byte
 		err  error
 	)
 
-	switch cfg.OutputFormat {
-	case "yaml":
+	switch {
+	case cfg.SelectShard != "":
+		data, err = marshalSelectedShard(cfg, result)
+	case cfg.OutputFormat == "yaml":
 		data, err = yaml.Marshal(result)
+	case cfg.OutputFormat == "json-detailed":
+		data, err = json.MarshalIndent(detailedResult(result), "", "  ")
+		if err == nil {
+			data = append(data, '\n')
+		}
 	default: // json
 		data, err = json.MarshalIndent(result, "", "  ")
 		if err == nil {
@@ -536,15 +2838,675 @@ func writeOutput(cfg *shardConfig, result *ShardResult) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal output as %s: %w", cfg.OutputFormat, err)
 	}
+	if cfg.YAMLHeader && cfg.OutputFormat == "yaml" {
+		data = append(yamlHeader(result.Metadata.GeneratedAt), data...)
+	}
 
 	if cfg.OutputFile != "" {
-		if err := os.WriteFile(cfg.OutputFile, data, 0o644); err != nil {
+		if err := writeOutputFile(ctx, cfg, cfg.OutputFile, data); err != nil {
 			return fmt.Errorf("failed to write output to %s: %w", cfg.OutputFile, err)
 		}
-		fmt.Fprintf(os.Stderr, "Output written to %s\n", cfg.OutputFile)
+		infof("Output written to %s", cfg.OutputFile)
 		return nil
 	}
 
 	_, err = os.Stdout.Write(data)
 	return err
 }
+
+// canonicalResult returns a copy of result without the fields that differ
+// between runs over the same assignment: generated_at and
+// rate_limit_waits_ms. Map keys are already sorted by both encoders, so the
+// output is then byte-for-byte identical whenever the result is.
+func canonicalResult(result *ShardResult) *ShardResult {
+	canonical := *result
+	canonical.Metadata.GeneratedAt = time.Time{}
+	canonical.Metadata.RateLimitWaitsMs = 0
+	return &canonical
+}
+
+// marshalSelectedShard encodes only the IDs of the select_shard shard, as a
+// plain JSON array on one line, or a YAML list. The shard must be in result:
+// validation can only check the name, since overflow and auto_shards settle
+// the final shard count at run time.
+func marshalSelectedShard(cfg *shardConfig, result *ShardResult) ([]byte, error) {
+	ids, ok := result.Shards[cfg.SelectShard]
+	if !ok {
+		return nil, fmt.Errorf("select_shard %q is not in the result, which has %s to %s",
+			cfg.SelectShard, shardName(cfg.ShardPrefix, 0), shardName(cfg.ShardPrefix, len(result.Shards)-1))
+	}
+	if cfg.OutputFormat == "yaml" {
+		return yaml.Marshal(ids)
+	}
+	data, err := json.Marshal(ids)
+	return append(data, '\n'), err
+}
+
+// outputFileFields returns the run metadata an output_file template may
+// reference, e.g. "shards-{{.Date}}-{{.SourceType}}.json". Hash is the first
+// 12 characters of result_hash.
+func outputFileFields(meta *ShardMetadata) map[string]string {
+	hash := meta.ResultHash
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return map[string]string{
+		"Date":       meta.GeneratedAt.Format(time.DateOnly),
+		"SourceType": meta.SourceType,
+		"Strategy":   meta.Strategy,
+		"Hash":       hash,
+	}
+}
+
+// expandOutputFile expands the Go template tokens in path from meta. A path
+// without "{{" is returned unchanged.
+func expandOutputFile(path string, meta *ShardMetadata) (string, error) {
+	if !strings.Contains(path, "{{") {
+		return path, nil
+	}
+	fields := outputFileFields(meta)
+	tmpl, err := template.New("output_file").Option("missingkey=error").Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("output_file %q is not a valid template: %w", path, err)
+	}
+	var expanded strings.Builder
+	if err := tmpl.Execute(&expanded, fields); err != nil {
+		names := slices.Sorted(maps.Keys(fields))
+		for i, name := range names {
+			names[i] = "{{." + name + "}}"
+		}
+		return "", fmt.Errorf("output_file %q references an unknown field (%v) — available fields: %s",
+			path, err, strings.Join(names, ", "))
+	}
+	return expanded.String(), nil
+}
+
+// histogramWidth is the bar length, in characters, of the largest shard in
+// the --histogram chart.
+const histogramWidth = 40
+
+// writeHistogram prints one bar per shard, scaled so the largest shard spans
+// histogramWidth characters, e.g. "shard_0 |######## 812". A non-empty shard
+// always gets at least one character.
+func writeHistogram(w io.Writer, shards map[string][]string) {
+	names := sortedShardNames(shards)
+
+	largest, nameWidth := 0, 0
+	for _, name := range names {
+		largest = max(largest, len(shards[name]))
+		nameWidth = max(nameWidth, len(name))
+	}
+
+	for _, name := range names {
+		size := len(shards[name])
+		bar := 0
+		if largest > 0 {
+			bar = max((size*histogramWidth+largest/2)/largest, min(size, 1))
+		}
+		fmt.Fprintf(w, "%-*s |%s %d\n", nameWidth, name, strings.Repeat("#", bar), size)
+	}
+}
+
+// detailedResult expands result into the json-detailed form, marking each ID
+// as managed unless it appears in result.Unmanaged and attaching its name and
+// placement explanation, if any.
+func detailedResult(result *ShardResult) *DetailedShardResult {
+	detailed := &DetailedShardResult{
+		Metadata:       result.Metadata,
+		Shards:         make(map[string][]ShardEntry, len(result.Shards)),
+		ShardBreakdown: result.ShardBreakdown,
+		Labels:         result.Labels,
+		Warnings:       result.Warnings,
+		Truncated:      result.Truncated,
+	}
+	for name, ids := range result.Shards {
+		entries := make([]ShardEntry, len(ids))
+		for i, id := range ids {
+			entries[i] = ShardEntry{ID: id, Name: result.Names[id], Managed: !result.Unmanaged[id]}
+			if p, ok := result.Placements[id]; ok {
+				entries[i].Placement = &p
+			}
+		}
+		detailed.Shards[name] = entries
+	}
+	return detailed
+}
+
+// defaultOutputFileMode is the permission output files get when
+// output_file_mode is not set.
+const defaultOutputFileMode fs.FileMode = 0o644
+
+// parseOutputFileMode parses an output_file_mode such as "0600". An empty
+// mode is the default, 0644.
+func parseOutputFileMode(mode string) (fs.FileMode, error) {
+	if mode == "" {
+		return defaultOutputFileMode, nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > uint64(fs.ModePerm) {
+		return 0, fmt.Errorf("output_file_mode %q is not a valid octal file mode — use e.g. '0600' or '0644'", mode)
+	}
+	return fs.FileMode(perm), nil
+}
+
+// createOutputFile creates or truncates path for output with the permissions
+// set by output_file_mode. The umask still applies to a new file, and an
+// existing file with wider permissions is narrowed to the mode, so a rerun
+// with 0600 never leaves an older 0644 file readable.
+//
+// With atomic_write, the file returned is instead a new temporary file in
+// path's directory, with exactly the mode, that closeOutputFile renames over
+// path. Callers must always finish with closeOutputFile.
+func createOutputFile(cfg *shardConfig, path string) (*os.File, error) {
+	mode, err := parseOutputFileMode(cfg.OutputFileMode)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AtomicWrite {
+		f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+		return f, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.Mode().Perm()&^mode != 0 {
+		err = f.Chmod(info.Mode().Perm() & mode)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// closeOutputFile closes f, opened by createOutputFile for path. With
+// atomic_write, f is synced and renamed over path, or removed when failed is
+// true or any step fails, so path only ever holds a complete file.
+func closeOutputFile(cfg *shardConfig, f *os.File, path string, failed bool) error {
+	if !cfg.AtomicWrite {
+		return f.Close()
+	}
+	var err error
+	if !failed {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !failed {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil || failed {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// writeOutputFile writes data to path through createOutputFile, or uploads
+// it when path is an object storage URL.
+func writeOutputFile(ctx context.Context, cfg *shardConfig, path string, data []byte) error {
+	if u := objectURL(path); u != nil {
+		return uploadObject(ctx, u, data)
+	}
+	f, err := createOutputFile(cfg, path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := closeOutputFile(cfg, f, path, err != nil); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeNDJSONOutput streams one ShardRecord per line, shard by shard, then a
+// final ShardMetadataRecord line. Records are encoded straight to a buffered
+// writer so the full document is never materialised in memory, except when
+// output_file is an object storage URL and the document is uploaded whole.
+func writeNDJSONOutput(ctx context.Context, cfg *shardConfig, result *ShardResult) (err error) {
+	var out io.Writer = os.Stdout
+	var upload *bytes.Buffer
+	if objectURL(cfg.OutputFile) != nil {
+		upload = &bytes.Buffer{}
+		out = upload
+	} else if cfg.OutputFile != "" {
+		f, openErr := createOutputFile(cfg, cfg.OutputFile)
+		if openErr != nil {
+			return fmt.Errorf("failed to write output to %s: %w", cfg.OutputFile, openErr)
+		}
+		defer func() {
+			if cerr := closeOutputFile(cfg, f, cfg.OutputFile, err != nil); cerr != nil && err == nil {
+				err = fmt.Errorf("failed to write output to %s: %w", cfg.OutputFile, cerr)
+			}
+		}()
+		out = f
+	}
+
+	bw := bufio.NewWriter(out)
+	enc := json.NewEncoder(bw)
+	for _, name := range sortedShardNames(result.Shards) {
+		for _, id := range result.Shards[name] {
+			if err := enc.Encode(ShardRecord{Shard: name, ID: id}); err != nil {
+				return fmt.Errorf("failed to encode ndjson record: %w", err)
+			}
+		}
+	}
+	trailer := ShardMetadataRecord{
+		Metadata:       result.Metadata,
+		ShardBreakdown: result.ShardBreakdown,
+		Labels:         result.Labels,
+		Warnings:       result.Warnings,
+		Truncated:      result.Truncated,
+	}
+	if err := enc.Encode(trailer); err != nil {
+		return fmt.Errorf("failed to encode ndjson metadata: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if upload != nil {
+		if err := writeOutputFile(ctx, cfg, cfg.OutputFile, upload.Bytes()); err != nil {
+			return fmt.Errorf("failed to write output to %s: %w", cfg.OutputFile, err)
+		}
+	}
+
+	if cfg.OutputFile != "" {
+		infof("Output written to %s", cfg.OutputFile)
+	}
+	return nil
+}
+
+// applyShardOrder renumbers the shards of result by size for shard_order
+// 'size-desc' or 'size-asc', so shard_0 is the largest or smallest. Shards of
+// equal size keep their relative order. The shards, breakdown, labels, the
+// shard names in the metadata and warnings all move to the new names, each
+// breakdown entry records the shard's original index, and the result hash is
+// recomputed over the renamed shards. 'index' and the empty default leave
+// result as is.
+func applyShardOrder(result *ShardResult, order string) {
+	if order != "size-desc" && order != "size-asc" {
+		return
+	}
+	names := sortedShardNames(result.Shards)
+	slices.SortStableFunc(names, func(a, b string) int {
+		if order == "size-desc" {
+			return cmp.Compare(len(result.Shards[b]), len(result.Shards[a]))
+		}
+		return cmp.Compare(len(result.Shards[a]), len(result.Shards[b]))
+	})
+
+	prefix := result.Metadata.ShardPrefix
+	renames := make(map[string]string, len(names))
+	for i, name := range names {
+		renames[name] = shardName(prefix, i)
+	}
+	renameShards(result, renames)
+	for name, renamed := range renames {
+		if counts, ok := result.ShardBreakdown[renamed]; ok {
+			index, _ := parseShardName(name, prefix)
+			counts.OriginalIndex = &index
+			result.ShardBreakdown[renamed] = counts
+		}
+	}
+	result.Metadata.ShardOrder = order
+}
+
+// renameShards renames the shards of result through renames, which maps old
+// names to new ones: the shards, breakdown, labels, the shard names in the
+// metadata and warnings all move, and the result hash is recomputed. Names
+// not in renames are kept. result's previous maps and slices are replaced,
+// not modified, so a shallow copy of a result can be renamed on its own.
+func renameShards(result *ShardResult, renames map[string]string) {
+	rename := func(name string) string { return cmp.Or(renames[name], name) }
+	shards := make(map[string][]string, len(result.Shards))
+	for name, ids := range result.Shards {
+		shards[rename(name)] = ids
+	}
+	breakdown := make(map[string]ShardCounts, len(result.ShardBreakdown))
+	for name, counts := range result.ShardBreakdown {
+		breakdown[rename(name)] = counts
+	}
+	var labels map[string]map[string]string
+	if result.Labels != nil {
+		labels = make(map[string]map[string]string, len(result.Labels))
+		for name, l := range result.Labels {
+			labels[rename(name)] = l
+		}
+	}
+	result.Shards, result.ShardBreakdown, result.Labels = shards, breakdown, labels
+
+	meta := &result.Metadata
+	prefix := meta.ShardPrefix
+	if meta.PerShardSeeds != nil {
+		seeds := make(map[string]string, len(meta.PerShardSeeds))
+		for name, seed := range meta.PerShardSeeds {
+			seeds[rename(name)] = seed
+		}
+		meta.PerShardSeeds = seeds
+	}
+	meta.RebalancedShards = renameShardList(meta.RebalancedShards, renames, prefix)
+	if meta.MinShardSize != nil {
+		summary := *meta.MinShardSize
+		summary.ToppedUpShards = renameShardList(summary.ToppedUpShards, renames, prefix)
+		meta.MinShardSize = &summary
+	}
+	// Warnings name shards in running text, so every whole shard name in
+	// them is rewritten in one pass; a name is never renamed twice.
+	if result.Warnings != nil {
+		nameRe := regexp.MustCompile(`(^|[^A-Za-z0-9_.-])(` + regexp.QuoteMeta(cmp.Or(prefix, defaultShardPrefix)) + `\d+)\b`)
+		warnings := make([]string, len(result.Warnings))
+		for i, warning := range result.Warnings {
+			warnings[i] = nameRe.ReplaceAllStringFunc(warning, func(match string) string {
+				sub := nameRe.FindStringSubmatch(match)
+				if renamed, ok := renames[sub[2]]; ok {
+					return sub[1] + renamed
+				}
+				return match
+			})
+		}
+		result.Warnings = warnings
+	}
+	meta.ResultHash = computeResultHash(result.Shards)
+}
+
+// renameShardList maps each shard name in names through renames, for
+// renameShards, and returns them in order of their new index. Names not
+// in renames are kept.
+func renameShardList(names []string, renames map[string]string, prefix string) []string {
+	if names == nil {
+		return nil
+	}
+	renamed := make([]string, len(names))
+	for i, name := range names {
+		renamed[i] = cmp.Or(renames[name], name)
+	}
+	slices.SortStableFunc(renamed, func(a, b string) int {
+		ai, _ := parseShardName(a, prefix)
+		bi, _ := parseShardName(b, prefix)
+		return cmp.Compare(ai, bi)
+	})
+	return renamed
+}
+
+// applyOnlyShards removes every shard not named in names from result's
+// shards, breakdown, labels, and placements, and records names in the
+// metadata so the partial result is not read back as a whole one. The rest
+// of the metadata and the hash are left describing the full result. An empty
+// names keeps every shard.
+func applyOnlyShards(result *ShardResult, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	omitted := func(name string) bool { return !slices.Contains(names, name) }
+	maps.DeleteFunc(result.Shards, func(name string, _ []string) bool { return omitted(name) })
+	maps.DeleteFunc(result.ShardBreakdown, func(name string, _ ShardCounts) bool { return omitted(name) })
+	// Labels is shard_labels itself, so it is copied before trimming.
+	result.Labels = maps.Clone(result.Labels)
+	maps.DeleteFunc(result.Labels, func(name string, _ map[string]string) bool { return omitted(name) })
+	maps.DeleteFunc(result.Placements, func(_ string, p PlacementExplanation) bool { return omitted(p.Shard) })
+	result.Metadata.OnlyShards = slices.Clone(names)
+	infof("Output shows %d of %d shard(s) (only_shards)", len(result.Shards), result.Metadata.ShardCount)
+}
+
+// applyPreviewCount cuts each shard of result to its first count IDs and marks
+// the result truncated when any shard lost IDs. The metadata, breakdown, and
+// hash are left describing the full result. A count of 0 keeps every ID.
+func applyPreviewCount(result *ShardResult, count int) {
+	if count <= 0 {
+		return
+	}
+	for name, ids := range result.Shards {
+		if len(ids) > count {
+			result.Shards[name] = ids[:count]
+			result.Truncated = true
+		}
+	}
+	if result.Truncated {
+		infof("Output shows the first %d ID(s) of each shard (preview_count)", count)
+	}
+}
+
+// applySortOrder reorders the IDs within each shard in place. Strategies
+// always emit ascending numeric order, so "numeric-asc" (and the empty
+// default) is a no-op. "api" restores the order of apiOrder, the IDs as
+// fetched; any ID not found there keeps its relative position at the end.
+func applySortOrder(shards [][]string, order string, apiOrder []string) {
+	switch order {
+	case "numeric-desc":
+		for _, shard := range shards {
+			slices.Reverse(shard)
+		}
+	case "api":
+		position := make(map[string]int, len(apiOrder))
+		for i, id := range apiOrder {
+			if _, seen := position[id]; !seen {
+				position[id] = i
+			}
+		}
+		rank := func(id string) int {
+			if p, ok := position[id]; ok {
+				return p
+			}
+			return len(apiOrder)
+		}
+		for _, shard := range shards {
+			slices.SortStableFunc(shard, func(a, b string) int {
+				return rank(a) - rank(b)
+			})
+		}
+	}
+}
+
+// computeResultHash returns the hex SHA-256 of the canonical shard→ID
+// mapping: shard names in key order, each shard's IDs sorted. Only the
+// assignment is hashed, so identical distributions hash identically across
+// runs regardless of timestamp or metadata.
+func computeResultHash(shards map[string][]string) string {
+	canonical := make(map[string][]string, len(shards))
+	for name, ids := range shards {
+		sorted := slices.Clone(ids)
+		if sorted == nil {
+			sorted = []string{}
+		}
+		slices.Sort(sorted)
+		canonical[name] = sorted
+	}
+	// encoding/json writes map keys in sorted order, which makes this
+	// serialisation canonical.
+	data, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeOutputDir writes each shard to its own file (shard_0.json, ...) plus a
+// metadata file in cfg.OutputDir, creating the directory if needed. Each file
+// uses the configured output format: a plain ID list for json and yaml, and
+// one ShardRecord per line for ndjson.
+func writeOutputDir(ctx context.Context, cfg *shardConfig, result *ShardResult) error {
+	if err := os.MkdirAll(cfg.OutputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory %s: %w", cfg.OutputDir, err)
+	}
+
+	format := cfg.OutputFormat
+	if format == "" {
+		format = "json"
+	}
+
+	write := func(name string, data []byte, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s as %s: %w", name, format, err)
+		}
+		if cfg.YAMLHeader && format == "yaml" {
+			data = append(yamlHeader(result.Metadata.GeneratedAt), data...)
+		}
+		path := filepath.Join(cfg.OutputDir, name+"."+format)
+		if err := writeOutputFile(ctx, cfg, path, data); err != nil {
+			return fmt.Errorf("failed to write output to %s: %w", path, err)
+		}
+		return nil
+	}
+
+	for _, name := range sortedShardNames(result.Shards) {
+		ids := result.Shards[name]
+		var (
+			data []byte
+			err  error
+		)
+		if format == "ndjson" {
+			records := make([]ShardRecord, len(ids))
+			for i, id := range ids {
+				records[i] = ShardRecord{Shard: name, ID: id}
+			}
+			data, err = encodeNDJSON(records)
+		} else {
+			data, err = marshalDocument(format, ids)
+		}
+		if err := write(name, data, err); err != nil {
+			return err
+		}
+	}
+
+	// The metadata file carries what the single-file output holds beside the
+	// shards: the breakdown, the shard labels, and the warnings, which would
+	// otherwise only reach stderr.
+	record := ShardMetadataRecord{
+		Metadata:       result.Metadata,
+		ShardBreakdown: result.ShardBreakdown,
+		Labels:         result.Labels,
+		Warnings:       result.Warnings,
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if format == "ndjson" {
+		data, err = encodeNDJSON([]ShardMetadataRecord{record})
+	} else {
+		data, err = marshalDocument(format, record)
+	}
+	if err := write("metadata", data, err); err != nil {
+		return err
+	}
+
+	infof("Output written to %s (%d shard file(s) + metadata)", cfg.OutputDir, len(result.Shards))
+	return nil
+}
+
+// marshalDocument encodes v as a single json (indented) or yaml document.
+func marshalDocument(format string, v any) ([]byte, error) {
+	if format == "yaml" {
+		return yaml.Marshal(v)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// yamlHeader returns the start of a yaml_header document: a comment naming
+// the tool, its version, and when the result was generated (left out when
+// canonical zeroed generated_at), then a "---" document marker. Both are
+// ignored by YAML parsers.
+func yamlHeader(generatedAt time.Time) []byte {
+	if generatedAt.IsZero() {
+		return fmt.Appendf(nil, "# generated by go-jamf-guid-sharder %s\n---\n", Version)
+	}
+	return fmt.Appendf(nil, "# generated by go-jamf-guid-sharder %s at %s\n---\n",
+		Version, generatedAt.UTC().Format(time.RFC3339))
+}
+
+// encodeNDJSON encodes each record as one JSON line.
+func encodeNDJSON[T any](records []T) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// countShardIDs returns the total number of IDs across shards.
+func countShardIDs(shards [][]string) int {
+	total := 0
+	for _, shard := range shards {
+		total += len(shard)
+	}
+	return total
+}
+
+// defaultShardPrefix is the shard_prefix used when none is set.
+const defaultShardPrefix = "shard_"
+
+// shardName returns the name of shard index i under prefix, e.g. "wave_2".
+// An empty prefix is the default, "shard_".
+func shardName(prefix string, i int) string {
+	if prefix == "" {
+		prefix = defaultShardPrefix
+	}
+	return prefix + strconv.Itoa(i)
+}
+
+// parseShardName returns the index of a shard name under prefix, e.g. 2 for
+// "wave_2" with prefix "wave_". ok is false when name is not prefix followed
+// by an index. An empty prefix is the default, "shard_".
+func parseShardName(name, prefix string) (index int, ok bool) {
+	if prefix == "" {
+		prefix = defaultShardPrefix
+	}
+	namePrefix, index, ok := splitShardName(name)
+	return index, ok && namePrefix == prefix
+}
+
+// splitShardName splits a shard name into its prefix and trailing index,
+// e.g. "wave_" and 2 for "wave_2", whatever the prefix is. ok is false when
+// name does not end in an index. shard_prefix cannot end in a digit, so the
+// split is unambiguous.
+func splitShardName(name string) (prefix string, index int, ok bool) {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	index, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return "", 0, false
+	}
+	return name[:i], index, true
+}
+
+// sortedShardNames returns the keys of shards ordered by shard index, so
+// shard_2 precedes shard_10. Keys without a numeric suffix sort lexically
+// after the indexed ones.
+func sortedShardNames(shards map[string][]string) []string {
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		aPrefix, ai, aOK := splitShardName(a)
+		bPrefix, bi, bOK := splitShardName(b)
+		switch {
+		case aOK && bOK:
+			return cmp.Or(strings.Compare(aPrefix, bPrefix), ai-bi)
+		case aOK:
+			return -1
+		case bOK:
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+	return names
+}
@@ -1,13 +1,29 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
+	jamfclient "github.com/deploymenttheory/go-sdk-jamfpro-v2/jamfpro/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -17,7 +33,7 @@ import (
 
 func TestApplyExclusions_NoExclusions(t *testing.T) {
 	ids := []string{"1", "2", "3", "4", "5"}
-	result := applyExclusions(ids, []string{})
+	result, _ := applyExclusions(ids, []string{}, nil)
 
 	assert.Equal(t, ids, result)
 }
@@ -26,7 +42,7 @@ func TestApplyExclusions_SomeExcluded(t *testing.T) {
 	ids := []string{"1", "2", "3", "4", "5"}
 	excludeIDs := []string{"2", "4"}
 
-	result := applyExclusions(ids, excludeIDs)
+	result, _ := applyExclusions(ids, excludeIDs, nil)
 
 	expected := []string{"1", "3", "5"}
 	assert.Equal(t, expected, result)
@@ -36,7 +52,7 @@ func TestApplyExclusions_AllExcluded(t *testing.T) {
 	ids := []string{"1", "2", "3"}
 	excludeIDs := []string{"1", "2", "3"}
 
-	result := applyExclusions(ids, excludeIDs)
+	result, _ := applyExclusions(ids, excludeIDs, nil)
 
 	assert.Empty(t, result)
 }
@@ -45,39 +61,136 @@ func TestApplyExclusions_NonExistentIDs(t *testing.T) {
 	ids := []string{"1", "2", "3"}
 	excludeIDs := []string{"10", "20"}
 
-	result := applyExclusions(ids, excludeIDs)
+	result, _ := applyExclusions(ids, excludeIDs, nil)
 
 	assert.Equal(t, ids, result)
 }
 
 func TestApplyExclusions_EmptyInput(t *testing.T) {
-	result := applyExclusions([]string{}, []string{"1", "2"})
+	result, _ := applyExclusions([]string{}, []string{"1", "2"}, nil)
 
 	assert.Empty(t, result)
 }
 
+func TestApplyExclusions_Pattern(t *testing.T) {
+	ids := []string{"1", "9001", "2", "9002", "90", "9003"}
+
+	result, matched := applyExclusions(ids, []string{"9003"}, regexp.MustCompile(`^9\d{3}$`))
+
+	assert.Equal(t, []string{"1", "2", "90"}, result)
+	assert.Equal(t, 2, matched, "IDs already in excludeIDs are not counted as pattern matches")
+}
+
+// ── Holdback Tests ────────────────────────────────────────────────────────────
+
+func TestApplyHoldback_Unset(t *testing.T) {
+	ids := createTestIDs(10, 1)
+
+	kept, summary := applyHoldback(&shardConfig{}, ids)
+
+	assert.Equal(t, ids, kept)
+	assert.Nil(t, summary)
+}
+
+func TestApplyHoldback_Deterministic(t *testing.T) {
+	ids := createTestIDs(200, 1)
+	cfg := &shardConfig{HoldbackPercent: 5, HoldbackSeed: "canary-2024"}
+
+	kept, summary := applyHoldback(cfg, ids)
+
+	require.NotNil(t, summary)
+	assert.Equal(t, 10, summary.IDCount)
+	assert.Len(t, summary.IDs, 10)
+	assert.Len(t, kept, 190)
+	for _, id := range summary.IDs {
+		assert.NotContains(t, kept, id)
+	}
+
+	reversed := slices.Clone(ids)
+	slices.Reverse(reversed)
+	_, again := applyHoldback(cfg, reversed)
+	assert.Equal(t, summary.IDs, again.IDs, "The cohort does not depend on input order")
+
+	_, other := applyHoldback(&shardConfig{HoldbackPercent: 5, HoldbackSeed: "canary-2025"}, ids)
+	assert.NotEqual(t, summary.IDs, other.IDs, "A different seed selects a different cohort")
+}
+
+func TestApplyHoldback_SkipsReservedIDs(t *testing.T) {
+	ids := createTestIDs(4, 1)
+	cfg := &shardConfig{
+		HoldbackPercent: 50,
+		HoldbackSeed:    "canary",
+		ReservedIDs:     map[string][]string{"shard_0": {"1", "2", "3"}},
+	}
+
+	kept, summary := applyHoldback(cfg, ids)
+
+	assert.Equal(t, []string{"4"}, summary.IDs, "Only unreserved IDs are held back, even below the requested share")
+	assert.Equal(t, []string{"1", "2", "3"}, kept)
+}
+
+// ── Sample Tests ──────────────────────────────────────────────────────────────
+
+func TestApplySample_Deterministic(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	cfg := &shardConfig{SampleSize: 10, SampleSeed: "dry-run"}
+
+	var warnings []string
+	sample := applySample(cfg, ids, &warnings)
+
+	assert.Len(t, sample, 10)
+	assert.Empty(t, warnings)
+	sorted := slices.Clone(sample)
+	sharding.SortIDsNumerically(sorted)
+	assert.Equal(t, sorted, sample, "The sample keeps the input order")
+
+	reversed := slices.Clone(ids)
+	slices.Reverse(reversed)
+	again := applySample(cfg, reversed, nil)
+	sharding.SortIDsNumerically(again)
+	assert.Equal(t, sample, again, "The sample does not depend on input order")
+
+	other := applySample(&shardConfig{SampleSize: 10, SampleSeed: "another"}, ids, nil)
+	assert.NotEqual(t, sample, other, "A different seed selects a different sample")
+}
+
+func TestApplySample_LargerThanPool(t *testing.T) {
+	ids := createTestIDs(5, 1)
+
+	var warnings []string
+	sample := applySample(&shardConfig{SampleSize: 10}, ids, &warnings)
+
+	assert.Equal(t, ids, sample)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "sample_size is 10 but only 5 ID(s) were fetched")
+}
+
+func TestApplySample_Unset(t *testing.T) {
+	ids := createTestIDs(5, 1)
+
+	assert.Equal(t, ids, applySample(&shardConfig{}, ids, nil))
+}
+
 // ── Reservations Tests ────────────────────────────────────────────────────────
 
 func TestApplyReservations_NoReservations(t *testing.T) {
 	ids := []string{"1", "2", "3", "4", "5"}
 
-	result, err := applyReservations(ids, nil, 3)
+	result, err := applyReservations(ids, nil, 3, "")
 
 	require.NoError(t, err)
 	assert.Equal(t, ids, result.UnreservedIDs)
 	assert.Empty(t, result.IDsByShard)
-	assert.Empty(t, result.CountsByShard)
 }
 
 func TestApplyReservations_EmptyMap(t *testing.T) {
 	ids := []string{"1", "2", "3", "4", "5"}
 
-	result, err := applyReservations(ids, map[string][]string{}, 3)
+	result, err := applyReservations(ids, map[string][]string{}, 3, "")
 
 	require.NoError(t, err)
 	assert.Equal(t, ids, result.UnreservedIDs)
 	assert.Empty(t, result.IDsByShard)
-	assert.Empty(t, result.CountsByShard)
 }
 
 func TestApplyReservations_ValidReservations(t *testing.T) {
@@ -87,14 +200,13 @@ func TestApplyReservations_ValidReservations(t *testing.T) {
 		"shard_2": {"5"},
 	}
 
-	result, err := applyReservations(ids, reservedMap, 3)
+	result, err := applyReservations(ids, reservedMap, 3, "")
 
 	require.NoError(t, err)
 	assert.Len(t, result.UnreservedIDs, 5)
-	assert.Equal(t, []string{"1", "2"}, result.IDsByShard["shard_0"])
-	assert.Equal(t, []string{"5"}, result.IDsByShard["shard_2"])
-	assert.Equal(t, 2, result.CountsByShard[0])
-	assert.Equal(t, 1, result.CountsByShard[2])
+	assert.Equal(t, []string{"1", "2"}, result.IDsByShard[0])
+	assert.Equal(t, []string{"5"}, result.IDsByShard[2])
+	assert.Equal(t, map[int]int{0: 2, 2: 1}, result.Counts())
 
 	for _, id := range []string{"1", "2", "5"} {
 		assert.NotContains(t, result.UnreservedIDs, id)
@@ -110,7 +222,7 @@ func TestApplyReservations_InvalidShardName(t *testing.T) {
 		"invalid_name": {"1"},
 	}
 
-	_, err := applyReservations(ids, reservedMap, 3)
+	_, err := applyReservations(ids, reservedMap, 3, "")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid shard name")
@@ -122,7 +234,7 @@ func TestApplyReservations_ShardIndexOutOfRange(t *testing.T) {
 		"shard_5": {"1"},
 	}
 
-	_, err := applyReservations(ids, reservedMap, 3)
+	_, err := applyReservations(ids, reservedMap, 3, "")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "out of range")
@@ -135,7 +247,7 @@ func TestApplyReservations_DuplicateIDInMultipleShards(t *testing.T) {
 		"shard_1": {"2", "3"},
 	}
 
-	_, err := applyReservations(ids, reservedMap, 3)
+	_, err := applyReservations(ids, reservedMap, 3, "")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "appears in multiple reserved_ids shards")
@@ -148,259 +260,1660 @@ func TestApplyReservations_NegativeShardIndex(t *testing.T) {
 		"shard_-1": {"1"},
 	}
 
-	_, err := applyReservations(ids, reservedMap, 3)
+	_, err := applyReservations(ids, reservedMap, 3, "")
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "out of range")
 }
 
-// ── Resolve Shard Count Tests ─────────────────────────────────────────────────
+func TestApplyReservations_ShardPrefix(t *testing.T) {
+	ids := []string{"1", "2", "3", "4"}
 
-func TestResolveShardCount_FromShardCount(t *testing.T) {
-	cfg := &shardConfig{
-		ShardCount: 5,
-	}
+	result, err := applyReservations(ids, map[string][]string{"wave_1": {"2"}}, 3, "wave_")
 
-	count := resolveShardCount(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]string{1: {"2"}}, result.IDsByShard, "Keyed by shard index, not the prefixed name")
 
-	assert.Equal(t, 5, count)
+	_, err = applyReservations(ids, map[string][]string{"shard_1": {"2"}}, 3, "wave_")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be 'wave_0', 'wave_1', etc.")
 }
 
-func TestResolveShardCount_FromPercentages(t *testing.T) {
-	cfg := &shardConfig{
-		ShardPercentages: []int{10, 30, 60},
-		ShardCount:       5,
+func TestShardName(t *testing.T) {
+	assert.Equal(t, "shard_3", shardName("", 3))
+	assert.Equal(t, "wave-12", shardName("wave-", 12))
+
+	tests := []struct {
+		name, prefix string
+		index        int
+		ok           bool
+	}{
+		{name: "shard_0", prefix: "", index: 0, ok: true},
+		{name: "shard_10", prefix: "shard_", index: 10, ok: true},
+		{name: "wave_2", prefix: "wave_", index: 2, ok: true},
+		{name: "wave_2", prefix: "", ok: false},
+		{name: "shard_2", prefix: "wave_", ok: false},
+		{name: "wave_", prefix: "wave_", ok: false},
+		{name: "wave_2x", prefix: "wave_", ok: false},
+		{name: "prewave_2", prefix: "wave_", ok: false},
 	}
+	for _, tt := range tests {
+		index, ok := parseShardName(tt.name, tt.prefix)
 
-	count := resolveShardCount(cfg)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		if tt.ok {
+			assert.Equal(t, tt.index, index, tt.name)
+		}
+	}
+}
 
-	assert.Equal(t, 3, count, "Should use percentages length over shard_count")
+func TestSortedShardNames_Prefix(t *testing.T) {
+	shards := map[string][]string{"wave_10": nil, "wave_2": nil, "wave_0": nil, "extra": nil}
+
+	assert.Equal(t, []string{"wave_0", "wave_2", "wave_10", "extra"}, sortedShardNames(shards))
 }
 
-func TestResolveShardCount_FromSizes(t *testing.T) {
-	cfg := &shardConfig{
-		ShardSizes: []int{10, 20, 30},
-		ShardCount: 5,
+func TestApplyReservations_MissingIDs(t *testing.T) {
+	ids := []string{"1", "2", "3", "4"}
+	reservedMap := map[string][]string{
+		"shard_0": {"1", "100"},
+		"shard_1": {"9", "3"},
 	}
 
-	count := resolveShardCount(cfg)
+	result, err := applyReservations(ids, reservedMap, 2, "")
 
-	assert.Equal(t, 3, count, "Should use sizes length over shard_count")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9", "100"}, result.MissingIDs)
+	assert.Equal(t, []string{"2", "4"}, result.UnreservedIDs)
+	assert.Equal(t, []string{"1", "100"}, result.IDsByShard[0], "missing IDs stay pinned")
 }
 
-func TestResolveShardCount_PercentagesPriority(t *testing.T) {
-	cfg := &shardConfig{
-		ShardPercentages: []int{10, 30, 60},
-		ShardSizes:       []int{10, 20},
-		ShardCount:       5,
+func TestApplyReservations_NoMissingIDs(t *testing.T) {
+	ids := []string{"1", "2", "3"}
+	reservedMap := map[string][]string{
+		"shard_0": {"1"},
 	}
 
-	count := resolveShardCount(cfg)
+	result, err := applyReservations(ids, reservedMap, 2, "")
 
-	assert.Equal(t, 3, count, "Percentages should take priority")
+	require.NoError(t, err)
+	assert.Empty(t, result.MissingIDs)
 }
 
-// ── Apply Strategy Tests ──────────────────────────────────────────────────────
+func TestCheckMissingReservedIDs(t *testing.T) {
+	assert.NoError(t, checkMissingReservedIDs(nil, true, nil))
+	assert.NoError(t, checkMissingReservedIDs([]string{"9"}, false, nil))
 
-func TestApplyStrategy_RoundRobin(t *testing.T) {
-	cfg := &shardConfig{
-		Strategy:   "round-robin",
-		ShardCount: 3,
-		Seed:       "test",
+	err := checkMissingReservedIDs([]string{"9", "100"}, true, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 reserved ID(s) not found in the source pool: 9, 100")
+}
+
+func TestUnusedExcludeIDs(t *testing.T) {
+	assert.Nil(t, unusedExcludeIDs(nil, []string{"1", "2"}))
+	assert.Nil(t, unusedExcludeIDs([]string{"2"}, []string{"1", "2"}))
+	assert.Equal(t, []string{"9", "100"}, unusedExcludeIDs([]string{"9", "2", "100", "9"}, []string{"1", "2"}))
+}
+
+func TestCheckUnusedExcludeIDs(t *testing.T) {
+	var warnings []string
+	require.NoError(t, checkUnusedExcludeIDs(nil, true, &warnings))
+	require.NoError(t, checkUnusedExcludeIDs([]string{"9"}, false, &warnings))
+	assert.Equal(t, []string{"1 excluded ID(s) not found in the source pool: 9"}, warnings)
+
+	err := checkUnusedExcludeIDs([]string{"9", "100"}, true, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 excluded ID(s) not found in the source pool: 9, 100 (--fail-on-unused-excludes is set)")
+}
+
+func TestCheckUndistributedIDs(t *testing.T) {
+	var warnings []string
+	checkUndistributedIDs(0, &warnings)
+	assert.Empty(t, warnings)
+
+	checkUndistributedIDs(7, &warnings)
+	assert.Equal(t, []string{"7 ID(s) were left out of every shard (see undistributed_id_count)"}, warnings)
+}
+
+func TestCheckZeroPercentages(t *testing.T) {
+	var warnings []string
+	checkZeroPercentages([]float64{10, 40, 50}, "", &warnings)
+	assert.Empty(t, warnings)
+
+	checkZeroPercentages([]float64{50, 0, 50, 0}, "", &warnings)
+	assert.Equal(t, []string{"shard_percentages gives shard_1, shard_3 0%; the strategy places no IDs there, only reserved_ids"}, warnings)
+}
+
+func TestRebalancedShards(t *testing.T) {
+	reservations := &shardReservations{Reservations: sharding.Reservations{
+		IDsByShard: map[int][]string{0: createTestIDs(30, 1), 2: createTestIDs(5, 31)},
+	}}
+	cfg := &shardConfig{ShardPercentages: []float64{20, 40, 40}}
+	assert.Nil(t, rebalancedShards(cfg, 100, reservations), "Only with balance_after_reservations")
+
+	cfg.BalanceReserved = true
+	assert.Equal(t, []string{"shard_0"}, rebalancedShards(cfg, 100, reservations))
+}
+
+func TestLoadReservedIDsFile_JSONAndYAML(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "reserved.json")
+	yamlPath := filepath.Join(dir, "reserved.yaml")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"shard_0":["101","102"]}`), 0o644))
+	require.NoError(t, os.WriteFile(yamlPath, []byte("shard_0:\n  - \"101\"\n  - \"102\"\n"), 0o644))
+
+	for _, path := range []string{jsonPath, yamlPath} {
+		reserved, err := loadReservedIDsFile(path)
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"shard_0": {"101", "102"}}, reserved)
 	}
-	ids := createTestIDs(9, 1)
+}
+
+func TestLoadReservedIDsFile_Errors(t *testing.T) {
+	_, err := loadReservedIDsFile(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read --reserved-ids-file")
+
+	path := filepath.Join(t.TempDir(), "bad.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("shard_0: {not: a list}"), 0o644))
+	_, err = loadReservedIDsFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse --reserved-ids-file")
+}
 
-	shards, err := applyStrategy(cfg, ids, &shardReservations{UnreservedIDs: ids})
+func TestLoadReservedIDsFile_JSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reserved.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"id":"101","shard":"shard_2"}`+"\n\n"+
+			`{"id":"102","shard":"shard_0"}`+"\n"+
+			`{"id":"103","shard":"shard_2"}`+"\n"), 0o644))
+
+	reserved, err := loadReservedIDsFile(path)
 
 	require.NoError(t, err)
-	assert.Len(t, shards, 3)
+	assert.Equal(t, map[string][]string{"shard_0": {"102"}, "shard_2": {"101", "103"}}, reserved)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"id":"101","shard":"shard_2"}`+"\n"+`{"id":"102"}`+"\n"), 0o644))
+	_, err = loadReservedIDsFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `line 2: missing "shard"`)
 }
 
-func TestApplyStrategy_Rendezvous(t *testing.T) {
-	cfg := &shardConfig{
-		Strategy:   "rendezvous",
-		ShardCount: 3,
-		Seed:       "test",
+func TestLoadExcludeIDsFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"exclude.json":  `["101","102"]`,
+		"exclude.yaml":  "- \"101\"\n- \"102\"\n",
+		"exclude.jsonl": `{"id":"101"}` + "\n" + `{"id":"102"}` + "\n",
 	}
-	ids := createTestIDs(9, 1)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
 
-	shards, err := applyStrategy(cfg, ids, &shardReservations{UnreservedIDs: ids})
+		ids, err := loadExcludeIDsFile(path)
 
-	require.NoError(t, err)
-	assert.Len(t, shards, 3)
+		require.NoError(t, err, name)
+		assert.Equal(t, []string{"101", "102"}, ids, name)
+	}
 }
 
-func TestApplyStrategy_Percentage(t *testing.T) {
-	cfg := &shardConfig{
-		Strategy:         "percentage",
-		ShardPercentages: []int{10, 30, 60},
-		Seed:             "test",
+func TestLoadExcludeIDsFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content, wantErr string
+	}{
+		{name: "shard.jsonl", content: `{"id":"101","shard":"shard_0"}`, wantErr: `line 1: unexpected "shard"`},
+		{name: "noid.ndjson", content: `{"id":"101"}` + "\n" + `{"name":"Mac-2"}`, wantErr: `line 2: missing "id"`},
+		{name: "bad.jsonl", content: `{"id":101}`, wantErr: "failed to parse --exclude-ids-file"},
+		{name: "map.yaml", content: "shard_0: [\"101\"]", wantErr: "failed to parse --exclude-ids-file"},
 	}
-	ids := createTestIDs(100, 1)
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
 
-	shards, err := applyStrategy(cfg, ids, &shardReservations{UnreservedIDs: ids})
+		_, err := loadExcludeIDsFile(path)
 
-	require.NoError(t, err)
-	assert.Len(t, shards, 3)
+		require.Error(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.wantErr, tt.name)
+	}
+
+	_, err := loadExcludeIDsFile(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read --exclude-ids-file")
 }
 
-func TestApplyStrategy_Size(t *testing.T) {
-	cfg := &shardConfig{
-		Strategy:   "size",
-		ShardSizes: []int{10, 20, -1},
-		Seed:       "test",
+func TestReadIDFile_Checksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "exclude.jsonl")
+	content := []byte(`{"id":"101"}` + "\n" + `{"id":"102"}` + "\n")
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	data, err := readIDFile(path, "--exclude-ids-file")
+	require.NoError(t, err, "No companion checksum")
+	assert.Equal(t, content, data)
+
+	// sha256sum output, and a bare upper-case digest, are both accepted.
+	for _, sumFile := range []string{digest + "  exclude.jsonl\n", strings.ToUpper(digest)} {
+		require.NoError(t, os.WriteFile(path+".sha256", []byte(sumFile), 0o644))
+		ids, err := loadExcludeIDsFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"101", "102"}, ids)
 	}
-	ids := createTestIDs(50, 1)
 
-	shards, err := applyStrategy(cfg, ids, &shardReservations{UnreservedIDs: ids})
+	// A truncated file no longer matches.
+	require.NoError(t, os.WriteFile(path, content[:len(content)-14], 0o644))
+	_, err = loadExcludeIDsFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--exclude-ids-file "+path+" does not match "+path+".sha256")
+
+	require.NoError(t, os.WriteFile(path+".sha256", []byte("\n"), 0o644))
+	_, err = readIDFile(path, "--reserved-ids-file")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--reserved-ids-file checksum "+path+".sha256 is empty")
+}
+
+func TestMergeReservedIDs(t *testing.T) {
+	merged, err := mergeReservedIDs(
+		map[string][]string{"shard_0": {"1"}},
+		map[string][]string{"shard_1": {"2"}, "shard_2": {"3"}},
+	)
 
 	require.NoError(t, err)
-	assert.Len(t, shards, 3)
+	assert.Equal(t, map[string][]string{
+		"shard_0": {"1"},
+		"shard_1": {"2"},
+		"shard_2": {"3"},
+	}, merged)
 }
 
-func TestApplyStrategy_UnknownStrategy(t *testing.T) {
-	cfg := &shardConfig{
-		Strategy:   "unknown-strategy",
-		ShardCount: 3,
-	}
-	ids := createTestIDs(9, 1)
+func TestMergeReservedIDs_NilInline(t *testing.T) {
+	merged, err := mergeReservedIDs(nil, map[string][]string{"shard_1": {"2"}})
 
-	_, err := applyStrategy(cfg, ids, &shardReservations{UnreservedIDs: ids})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"shard_1": {"2"}}, merged)
+}
+
+func TestMergeReservedIDs_ConflictingShardKeys(t *testing.T) {
+	_, err := mergeReservedIDs(
+		map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}},
+		map[string][]string{"shard_1": {"3"}, "shard_0": {"4"}},
+	)
 
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "unknown strategy")
+	assert.Contains(t, err.Error(), `shard(s) ["shard_0", "shard_1"] reserved both inline and in --reserved-ids-file`)
 }
 
-// ── Output Tests ──────────────────────────────────────────────────────────────
+// ── Prior Result Tests ────────────────────────────────────────────────────────
+
+func TestLoadShardResult_RoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "prior."+format)
+			cfg := &shardConfig{OutputFormat: format, OutputFile: path}
+			written := &ShardResult{
+				Metadata: ShardMetadata{
+					GeneratedAt: time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+					Strategy:    "round-robin",
+					ShardCount:  2,
+				},
+				Shards: map[string][]string{
+					"shard_0": {"1", "3"},
+					"shard_1": {"2"},
+				},
+				Labels: map[string]map[string]string{"shard_0": {"owner": "it-ops"}},
+			}
+			require.NoError(t, writeOutput(context.Background(), cfg, written))
 
-func TestWriteOutput_JSON_Stdout(t *testing.T) {
-	cfg := &shardConfig{
-		OutputFormat: "json",
-		OutputFile:   "",
+			loaded, err := loadShardResult(path)
+
+			require.NoError(t, err)
+			assert.Equal(t, written.Shards, loaded.Shards)
+			assert.Equal(t, written.Labels, loaded.Labels)
+			assert.Equal(t, "round-robin", loaded.Metadata.Strategy)
+			assert.True(t, written.Metadata.GeneratedAt.Equal(loaded.Metadata.GeneratedAt))
+			assert.Equal(t, []string{"1", "3", "2"}, resultIDs(loaded))
+		})
 	}
-	result := &ShardResult{
-		Metadata: ShardMetadata{
-			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
-			SourceType:      "computer_inventory",
-			Strategy:        "round-robin",
-			Seed:            "test",
-			TotalIDsFetched: 10,
-			ShardCount:      2,
-		},
-		Shards: map[string][]string{
-			"shard_0": {"1", "3", "5"},
-			"shard_1": {"2", "4"},
-		},
+}
+
+func TestLoadShardResult_JSONDetailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prior.json")
+	cfg := &shardConfig{OutputFormat: "json-detailed", OutputFile: path}
+	written := &ShardResult{
+		Shards:    map[string][]string{"shard_0": {"1", "2"}, "shard_1": {"3"}},
+		Unmanaged: map[string]bool{"2": true},
 	}
+	require.NoError(t, writeOutput(context.Background(), cfg, written))
 
-	oldStdout := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+	loaded, err := loadShardResult(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, written.Shards, loaded.Shards)
+}
 
-	err := writeOutput(cfg, result)
+func TestLoadShardResult_RejectsPreview(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "ndjson", "json-detailed"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "preview."+strings.TrimSuffix(format, "-detailed"))
+			result := &ShardResult{Shards: map[string][]string{"shard_0": {"1", "2", "3"}, "shard_1": {"4"}}}
+			applyPreviewCount(result, 2)
+			require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: format, OutputFile: path}, result))
 
-	w.Close()
-	os.Stdout = oldStdout
-	r.Close()
+			_, err := loadShardResult(path)
 
-	require.NoError(t, err)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "was written with --preview-count")
+		})
+	}
 }
 
-func TestWriteOutput_JSON_File(t *testing.T) {
-	tmpDir := t.TempDir()
-	outputFile := filepath.Join(tmpDir, "test_output.json")
+func TestLoadShardResult_RejectsOnlyShards(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "ndjson", "json-detailed"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "partial."+strings.TrimSuffix(format, "-detailed"))
+			result := &ShardResult{
+				Metadata: ShardMetadata{ShardCount: 3},
+				Shards:   map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}, "shard_2": {"3"}},
+			}
+			applyOnlyShards(result, []string{"shard_1", "shard_2"})
+			require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: format, OutputFile: path}, result))
 
-	cfg := &shardConfig{
-		OutputFormat: "json",
-		OutputFile:   outputFile,
+			_, err := loadShardResult(path)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "was written with --only-shards shard_1,shard_2")
+		})
 	}
-	result := &ShardResult{
-		Metadata: ShardMetadata{
-			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
-			SourceType:      "computer_inventory",
-			Strategy:        "round-robin",
-			Seed:            "test",
-			TotalIDsFetched: 10,
-			ShardCount:      2,
-		},
-		Shards: map[string][]string{
-			"shard_0": {"1", "3", "5"},
-			"shard_1": {"2", "4"},
-		},
+}
+
+func TestLoadShardResult_Expired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prior.json")
+	expiresAt := time.Now().Add(-2 * time.Hour).UTC()
+	written := &ShardResult{
+		Metadata: ShardMetadata{ExpiresAt: &expiresAt},
+		Shards:   map[string][]string{"shard_0": {"1"}},
 	}
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: path}, written))
 
-	err := writeOutput(cfg, result)
+	var loaded *ShardResult
+	stderr := captureStderr(t, func() {
+		var err error
+		loaded, err = loadShardResult(path)
+		require.NoError(t, err)
+	})
 
-	require.NoError(t, err)
-	assert.FileExists(t, outputFile)
+	assert.True(t, expiresAt.Equal(*loaded.Metadata.ExpiresAt))
+	assert.Contains(t, stderr, "Warning: result file "+path+" expired at "+expiresAt.Format(time.RFC3339)+" (2h0m0s ago)")
+}
 
-	data, err := os.ReadFile(outputFile)
-	require.NoError(t, err)
+func TestCheckResultExpiry_NotExpired(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Minute)
 
-	var parsed ShardResult
-	err = json.Unmarshal(data, &parsed)
-	require.NoError(t, err)
-	assert.Equal(t, "computer_inventory", parsed.Metadata.SourceType)
-	assert.Equal(t, 2, parsed.Metadata.ShardCount)
-	assert.Len(t, parsed.Shards, 2)
+	stderr := captureStderr(t, func() {
+		checkResultExpiry("prior.json", &ShardResult{Metadata: ShardMetadata{ExpiresAt: &expiresAt}}, now)
+		checkResultExpiry("prior.json", &ShardResult{}, now)
+	})
+
+	assert.Empty(t, stderr)
 }
 
-func TestWriteOutput_YAML_File(t *testing.T) {
-	tmpDir := t.TempDir()
-	outputFile := filepath.Join(tmpDir, "test_output.yaml")
+func TestLoadShardResult_MissingFile(t *testing.T) {
+	_, err := loadShardResult(filepath.Join(t.TempDir(), "missing.json"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read result file")
+}
+
+func TestLoadShardResult_InvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o644))
+
+	_, err := loadShardResult(path)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse result file")
+}
+
+// ── Resolve Seed Tests ────────────────────────────────────────────────────────
+
+func TestResolveSeed_ReadsAndTrimsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed")
+	require.NoError(t, os.WriteFile(path, []byte("  canonical-seed\n"), 0o600))
+	cfg := &shardConfig{SeedFile: path}
+
+	require.NoError(t, resolveSeed(cfg))
+
+	assert.Equal(t, "canonical-seed", cfg.Seed)
+}
+
+func TestResolveSeed_ExplicitSeedWins(t *testing.T) {
+	cfg := &shardConfig{Seed: "flag-seed", SeedFile: filepath.Join(t.TempDir(), "missing")}
+
+	require.NoError(t, resolveSeed(cfg), "The seed file is not read when --seed is set")
+
+	assert.Equal(t, "flag-seed", cfg.Seed)
+}
+
+func TestResolveSeed_MissingFile(t *testing.T) {
+	cfg := &shardConfig{SeedFile: filepath.Join(t.TempDir(), "missing")}
+
+	err := resolveSeed(cfg)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read --seed-file")
+}
+
+func TestResolveSeed_EmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed")
+	require.NoError(t, os.WriteFile(path, []byte(" \n\t"), 0o600))
+
+	err := resolveSeed(&shardConfig{SeedFile: path})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is empty")
+}
+
+// ── Request Timeout Tests ─────────────────────────────────────────────────────
+
+func TestRequestTimeout(t *testing.T) {
+	assert.Equal(t, 60*time.Second, requestTimeout(&shardConfig{CustomTimeout: 60}))
+	assert.Equal(t, 250*time.Millisecond, requestTimeout(&shardConfig{CustomTimeout: 60, CustomTimeoutMs: 250}),
+		"Milliseconds take precedence over seconds")
+	assert.Equal(t, time.Duration(0), requestTimeout(&shardConfig{}))
+}
+
+// ── Proxy Tests ───────────────────────────────────────────────────────────────
+
+func TestProxyFunc(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://env-proxy.corp:3128")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy.corp:3128")
+	t.Setenv("NO_PROXY", "")
+	proxy := proxyFunc(&shardConfig{
+		HTTPSProxy: "http://proxy.corp:8080",
+		NoProxy:    "internal.corp",
+	})
+
+	proxyFor := func(rawURL string) string {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		require.NoError(t, err)
+		u, err := proxy(req)
+		require.NoError(t, err)
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+
+	assert.Equal(t, "http://proxy.corp:8080", proxyFor("https://company.jamfcloud.com/api"), "Config overrides HTTPS_PROXY")
+	assert.Equal(t, "http://env-proxy.corp:3128", proxyFor("http://company.jamfcloud.com/api"), "HTTP_PROXY is the fallback")
+	assert.Empty(t, proxyFor("https://jamf.internal.corp/api"), "no_proxy hosts are reached directly")
+}
+
+func TestLoadShardConfig_WarnsWhenBothTimeoutsSet(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("custom_timeout_seconds", 30)
+	viper.Set("custom_timeout_milliseconds", 250)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	var cfg *shardConfig
+	stderr := captureStderr(t, func() {
+		var err error
+		cfg, err = loadShardConfig(cmd)
+		require.NoError(t, err)
+	})
+
+	assert.Equal(t, 250*time.Millisecond, requestTimeout(cfg))
+	assert.Contains(t, stderr, "Warning: custom_timeout_milliseconds (250) and custom_timeout_seconds (30) are both set")
+}
+
+func TestLoadShardConfig_NoWarningForMillisecondsAlone(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("custom_timeout_milliseconds", 250)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	stderr := captureStderr(t, func() {
+		_, err := loadShardConfig(cmd)
+		require.NoError(t, err)
+	})
+
+	assert.Empty(t, stderr)
+}
+
+func TestLoadShardConfig_FractionalPercentages(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("shard_percentages", []string{"12.5", "37.5", "50"})
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("reserved-ids", "", "")
+	cfg, err := loadShardConfig(cmd)
+
+	require.NoError(t, err)
+	assert.Equal(t, []float64{12.5, 37.5, 50}, cfg.ShardPercentages)
+}
+
+// ── Resolve Shard Count Tests ─────────────────────────────────────────────────
+
+func TestResolveShardCount_FromShardCount(t *testing.T) {
+	cfg := &shardConfig{
+		ShardCount: 5,
+	}
+
+	count := resolveShardCount(cfg)
+
+	assert.Equal(t, 5, count)
+}
+
+func TestResolveShardCount_FromPercentages(t *testing.T) {
+	cfg := &shardConfig{
+		ShardPercentages: []float64{10, 30, 60},
+		ShardCount:       5,
+	}
+
+	count := resolveShardCount(cfg)
+
+	assert.Equal(t, 3, count, "Should use percentages length over shard_count")
+}
+
+func TestResolveShardCount_FromSizes(t *testing.T) {
+	cfg := &shardConfig{
+		ShardSizes: []int{10, 20, 30},
+		ShardCount: 5,
+	}
+
+	count := resolveShardCount(cfg)
+
+	assert.Equal(t, 3, count, "Should use sizes length over shard_count")
+}
+
+func TestResolveShardCount_PercentagesPriority(t *testing.T) {
+	cfg := &shardConfig{
+		ShardPercentages: []float64{10, 30, 60},
+		ShardSizes:       []int{10, 20},
+		ShardCount:       5,
+	}
+
+	count := resolveShardCount(cfg)
+
+	assert.Equal(t, 3, count, "Percentages should take priority")
+}
+
+func TestCheckDistributableIDs_Enough(t *testing.T) {
+	assert.NoError(t, checkDistributableIDs(3, 3, true, nil))
+	assert.NoError(t, checkDistributableIDs(3, 10, true, nil))
+}
+
+func TestCheckDistributableIDs_WarnOnly(t *testing.T) {
+	var warnings []string
+	assert.NoError(t, checkDistributableIDs(10, 4, false, &warnings))
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "shard count 10 exceeds the 4 distributable")
+}
+
+func TestCheckDistributableIDs_Fail(t *testing.T) {
+	err := checkDistributableIDs(10, 4, true, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shard count 10 exceeds the 4 distributable")
+}
+
+func TestCheckShardSizesTotal_Fits(t *testing.T) {
+	assert.NoError(t, checkShardSizesTotal([]int{5, 5}, 10, true, nil))
+	assert.NoError(t, checkShardSizesTotal([]int{5, 100, -1}, 10, false, nil))
+}
+
+func TestCheckShardSizesTotal_IgnoresRemainder(t *testing.T) {
+	assert.NoError(t, checkShardSizesTotal([]int{4, 6, -1}, 10, true, nil))
+}
+
+func TestCheckShardSizesTotal_Fail(t *testing.T) {
+	err := checkShardSizesTotal([]int{50, 200, -1}, 100, true, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shard_sizes request 250 ID(s) but only 100 are available")
+	assert.Contains(t, err.Error(), "--fail-on-oversized is set")
+}
+
+func TestCheckEmptySource_NonEmpty(t *testing.T) {
+	cfg := &shardConfig{SourceType: "computer_inventory", FailOnEmptySource: true}
+
+	assert.NoError(t, checkEmptySource(cfg, &sourceFetchResult{IDs: []string{"1"}}, nil))
+}
+
+func TestCheckEmptySource_WarnOnly(t *testing.T) {
+	cfg := &shardConfig{SourceType: "computer_inventory"}
+
+	var warnings []string
+	assert.NoError(t, checkEmptySource(cfg, &sourceFetchResult{}, &warnings))
+	assert.Equal(t, []string{"source_type computer_inventory returned no IDs — every shard will be empty"}, warnings)
+}
+
+func TestCheckEmptySource_FailNamesGroup(t *testing.T) {
+	cfg := &shardConfig{
+		SourceType:        "computer_group_membership",
+		GroupID:           "42",
+		FailOnEmptySource: true,
+	}
+
+	err := checkEmptySource(cfg, &sourceFetchResult{}, nil)
+
+	require.Error(t, err)
+	assert.Equal(t, "source_type computer_group_membership (group_id 42) returned no IDs (--fail-on-empty-source is set)", err.Error())
+}
+
+func TestCheckEmptySource_FailMentionsLocationFilter(t *testing.T) {
+	cfg := &shardConfig{SourceType: "computer_inventory", FailOnEmptySource: true}
+	fetched := &sourceFetchResult{LocationFilter: &LocationFilterSummary{Department: "Sales", IDsRemoved: 12}}
+
+	err := checkEmptySource(cfg, fetched, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "returned no IDs after location filters")
+}
+
+// ── Apply Strategy Tests ──────────────────────────────────────────────────────
+
+func TestApplyStrategy_RoundRobin(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:   "round-robin",
+		ShardCount: 3,
+		Seed:       "test",
+	}
+	ids := createTestIDs(9, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 3)
+}
+
+func TestApplyStrategy_Rendezvous(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:   "rendezvous",
+		ShardCount: 3,
+		Seed:       "test",
+	}
+	ids := createTestIDs(9, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 3)
+}
+
+func TestApplyStrategy_Balanced(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:   "balanced",
+		ShardCount: 4,
+		Seed:       "test",
+	}
+	ids := createTestIDs(10, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 4)
+}
+
+func TestApplyStrategy_HashRing(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:     "hash-ring",
+		ShardCount:   3,
+		VirtualNodes: 20,
+	}
+	ids := createTestIDs(30, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 3)
+}
+
+func TestApplyStrategy_Percentage(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:         "percentage",
+		ShardPercentages: []float64{10, 30, 60},
+		Seed:             "test",
+	}
+	ids := createTestIDs(100, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 3)
+}
+
+func TestApplyStrategy_Size(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:   "size",
+		ShardSizes: []int{10, 20, -1},
+		Seed:       "test",
+	}
+	ids := createTestIDs(50, 1)
+
+	shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.NoError(t, err)
+	assert.Len(t, shards, 3)
+}
+
+func TestApplyStrategy_UnknownStrategy(t *testing.T) {
+	cfg := &shardConfig{
+		Strategy:   "unknown-strategy",
+		ShardCount: 3,
+	}
+	ids := createTestIDs(9, 1)
+
+	_, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown strategy")
+}
+
+func TestApplyStrategy_SeedSalt(t *testing.T) {
+	ids := createTestIDs(200, 1)
+	run := func(strategy, salt string) [][]string {
+		cfg := &shardConfig{Strategy: strategy, ShardCount: 4, Seed: "shared", SeedSalt: salt}
+		shards, err := applyStrategy(cfg, ids, &shardReservations{Reservations: sharding.Reservations{UnreservedIDs: ids}})
+		require.NoError(t, err)
+		return shards
+	}
+
+	for _, strategy := range []string{"round-robin", "rendezvous"} {
+		assert.Equal(t, run(strategy, "team-a"), run(strategy, "team-a"), "%s: same salt is reproducible", strategy)
+		assert.NotEqual(t, run(strategy, "team-a"), run(strategy, "team-b"), "%s: salts are independent", strategy)
+		assert.NotEqual(t, run(strategy, ""), run(strategy, "team-a"), "%s: salt changes the unsalted result", strategy)
+	}
+}
+
+func TestStrategySeed(t *testing.T) {
+	assert.Equal(t, "wave-1", strategySeed(&shardConfig{Seed: "wave-1"}))
+	assert.Equal(t, "wave-1|team-a", strategySeed(&shardConfig{Seed: "wave-1", SeedSalt: "team-a"}))
+	assert.NotEqual(t,
+		strategySeed(&shardConfig{Seed: "ab", SeedSalt: "c"}),
+		strategySeed(&shardConfig{Seed: "a", SeedSalt: "bc"}))
+}
+
+func TestDistributionOrder(t *testing.T) {
+	apiOrder := []string{"30", "4", "200", "1"}
+
+	t.Run("stable without a seed sorts numerically", func(t *testing.T) {
+		got := distributionOrder(&shardConfig{Stable: true}, apiOrder)
+		assert.Equal(t, []string{"1", "4", "30", "200"}, got)
+		assert.Equal(t, []string{"30", "4", "200", "1"}, apiOrder, "Input must not be mutated")
+	})
+
+	t.Run("unstable keeps API order", func(t *testing.T) {
+		assert.Equal(t, apiOrder, distributionOrder(&shardConfig{}, apiOrder))
+	})
+
+	t.Run("a seed takes precedence", func(t *testing.T) {
+		assert.Equal(t, apiOrder, distributionOrder(&shardConfig{Stable: true, Seed: "wave-1"}, apiOrder))
+	})
+}
+
+func TestApplyStrategy_StableIgnoresAPIOrder(t *testing.T) {
+	cfg := &shardConfig{Strategy: "round-robin", ShardCount: 2, Stable: true}
+	first, err := applyStrategy(cfg, distributionOrder(cfg, []string{"3", "1", "4", "2"}), nil)
+	require.NoError(t, err)
+	second, err := applyStrategy(cfg, distributionOrder(cfg, []string{"2", "4", "1", "3"}), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{{"1", "3"}, {"2", "4"}}, first)
+	assert.Equal(t, first, second)
+}
+
+// ── Shard Cap Tests ───────────────────────────────────────────────────────────
+
+func TestEnforceShardCap_NoLimit(t *testing.T) {
+	shards := [][]string{createTestIDs(10, 1), createTestIDs(2, 20)}
+
+	out, summary, err := enforceShardCap(shards, 0, "error", "", nil)
+
+	require.NoError(t, err)
+	assert.Nil(t, summary)
+	assert.Equal(t, shards, out)
+}
+
+func TestEnforceShardCap_WithinLimit(t *testing.T) {
+	shards := [][]string{createTestIDs(5, 1), createTestIDs(5, 20)}
+
+	out, summary, err := enforceShardCap(shards, 5, "error", "", nil)
+
+	require.NoError(t, err)
+	assert.Nil(t, summary, "No summary when nothing had to move")
+	assert.Equal(t, shards, out)
+}
+
+func TestEnforceShardCap_ErrorPolicy(t *testing.T) {
+	shards := [][]string{createTestIDs(7, 1), createTestIDs(3, 20)}
+
+	_, _, err := enforceShardCap(shards, 5, "error", "", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shard_0 (7 IDs)")
+	assert.Contains(t, err.Error(), "max_ids_per_shard=5")
+}
+
+func TestEnforceShardCap_Spill(t *testing.T) {
+	shards := [][]string{createTestIDs(7, 1), createTestIDs(4, 20), {}}
+
+	out, summary, err := enforceShardCap(shards, 5, "spill", "", nil)
+
+	require.NoError(t, err)
+	require.Len(t, out, 3)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, out[0])
+	assert.Len(t, out[1], 5, "Receives 2 spilled IDs, then spills 1 onward")
+	assert.Len(t, out[2], 1)
+	require.NotNil(t, summary)
+	assert.Equal(t, 3, summary.IDsMoved)
+	assert.Equal(t, 3, summary.RequestedShardCount)
+}
+
+func TestEnforceShardCap_SpillFromLastShard(t *testing.T) {
+	shards := [][]string{createTestIDs(2, 1), createTestIDs(7, 20)}
+
+	_, _, err := enforceShardCap(shards, 5, "spill", "", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nowhere to spill")
+}
+
+func TestEnforceShardCap_NewShard(t *testing.T) {
+	shards := [][]string{createTestIDs(9, 1), createTestIDs(6, 20)}
+
+	out, summary, err := enforceShardCap(shards, 4, "new-shard", "", nil)
+
+	require.NoError(t, err)
+	require.Len(t, out, 4, "7 excess IDs at cap 4 need two new shards")
+	assert.Len(t, out[0], 4)
+	assert.Len(t, out[1], 4)
+	assert.Len(t, out[2], 4)
+	assert.Len(t, out[3], 3)
+	require.NotNil(t, summary)
+	assert.Equal(t, 7, summary.IDsMoved)
+	assert.Equal(t, 2, summary.RequestedShardCount)
+}
+
+func TestEnforceShardCap_ReservedIDsStayPut(t *testing.T) {
+	shards := [][]string{{"1", "2", "3", "900", "901"}, {}}
+	reservations := &shardReservations{Reservations: sharding.Reservations{
+		IDsByShard: map[int][]string{0: {"900", "901"}},
+	}}
+
+	out, _, err := enforceShardCap(shards, 3, "spill", "", reservations)
+
+	require.NoError(t, err)
+	assert.Contains(t, out[0], "900")
+	assert.Contains(t, out[0], "901")
+	assert.Len(t, out[0], 3)
+	assert.Len(t, out[1], 2)
+}
+
+func TestEnforceShardCap_ReservedExceedCap(t *testing.T) {
+	shards := [][]string{{"1", "900", "901", "902"}, {}}
+	reservations := &shardReservations{Reservations: sharding.Reservations{
+		IDsByShard: map[int][]string{0: {"900", "901", "902"}},
+	}}
+
+	_, _, err := enforceShardCap(shards, 2, "spill", "", reservations)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reserved IDs alone exceed")
+}
+
+func TestEnforceMinShardSize_NoMinimum(t *testing.T) {
+	shards := [][]string{{"1"}, {"2", "3", "4"}}
+
+	summary, err := enforceMinShardSize(shards, 0, false, "", nil)
+
+	require.NoError(t, err)
+	assert.Nil(t, summary)
+	assert.Equal(t, [][]string{{"1"}, {"2", "3", "4"}}, shards)
+}
+
+func TestEnforceMinShardSize_TopsUpFromLargest(t *testing.T) {
+	shards := [][]string{{"1"}, {"2", "3", "4"}, {"5", "6", "7", "8", "9", "10"}, {}}
+
+	summary, err := enforceMinShardSize(shards, 3, false, "", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "9", "10"}, shards[0], "The highest IDs of the largest shard move")
+	assert.Equal(t, []string{"2", "3", "4"}, shards[1])
+	assert.Equal(t, []string{"5", "6", "7", "8"}, shards[2])
+	assert.Empty(t, shards[3], "Empty shards are left empty")
+	require.NotNil(t, summary)
+	assert.Equal(t, &MinShardSizeSummary{MinShardSize: 3, IDsMoved: 2, ToppedUpShards: []string{"shard_0"}}, summary)
+}
+
+func TestEnforceMinShardSize_ReservedIDsStayPut(t *testing.T) {
+	shards := [][]string{{"1"}, {"2", "3", "900", "901"}}
+	reservations := &shardReservations{Reservations: sharding.Reservations{
+		IDsByShard: map[int][]string{1: {"900", "901"}},
+	}}
+
+	_, err := enforceMinShardSize(shards, 2, false, "", reservations)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, shards[0])
+	assert.Equal(t, []string{"2", "900", "901"}, shards[1])
+}
+
+func TestEnforceMinShardSize_NotEnoughIDs(t *testing.T) {
+	shards := [][]string{{"1"}, {"2", "3"}}
+
+	_, err := enforceMinShardSize(shards, 3, false, "", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "shard_0 has 1 ID(s), below min_shard_size=3")
+}
+
+func TestEnforceMinShardSize_FailOnUndersized(t *testing.T) {
+	shards := [][]string{{"1"}, {"2", "3", "4", "5"}}
+
+	_, err := enforceMinShardSize(shards, 2, true, "", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 shard(s) are below min_shard_size=2: shard_0 (1 IDs) (--fail-on-undersized is set)")
+	assert.Equal(t, [][]string{{"1"}, {"2", "3", "4", "5"}}, shards, "Nothing moves")
+}
+
+// ── Output Tests ──────────────────────────────────────────────────────────────
+
+func TestWriteOutput_JSON_Stdout(t *testing.T) {
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputFile:   "",
+	}
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+			SourceType:      "computer_inventory",
+			Strategy:        "round-robin",
+			Seed:            "test",
+			TotalIDsFetched: 10,
+			ShardCount:      2,
+		},
+		Shards: map[string][]string{
+			"shard_0": {"1", "3", "5"},
+			"shard_1": {"2", "4"},
+		},
+	}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	w.Close()
+	os.Stdout = oldStdout
+	r.Close()
+
+	require.NoError(t, err)
+}
+
+func TestWriteOutput_Null(t *testing.T) {
+	cfg := &shardConfig{OutputFormat: "null"}
+	result := &ShardResult{Shards: map[string][]string{"shard_0": {"1", "2"}}}
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	w.Close()
+	os.Stdout = oldStdout
+	out, _ := io.ReadAll(r)
+	r.Close()
+
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestWriteOutput_JSON_File(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "test_output.json")
+
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputFile:   outputFile,
+	}
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+			SourceType:      "computer_inventory",
+			Strategy:        "round-robin",
+			Seed:            "test",
+			TotalIDsFetched: 10,
+			ShardCount:      2,
+		},
+		Shards: map[string][]string{
+			"shard_0": {"1", "3", "5"},
+			"shard_1": {"2", "4"},
+		},
+	}
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	require.NoError(t, err)
+	assert.FileExists(t, outputFile)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var parsed ShardResult
+	err = json.Unmarshal(data, &parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "computer_inventory", parsed.Metadata.SourceType)
+	assert.Equal(t, 2, parsed.Metadata.ShardCount)
+	assert.Len(t, parsed.Shards, 2)
+}
+
+func TestWriteOutput_YAML_File(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "test_output.yaml")
+
+	cfg := &shardConfig{
+		OutputFormat: "yaml",
+		OutputFile:   outputFile,
+	}
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+			SourceType:      "mobile_device_inventory",
+			Strategy:        "percentage",
+			Seed:            "test",
+			TotalIDsFetched: 20,
+			ShardCount:      3,
+		},
+		Shards: map[string][]string{
+			"shard_0": {"1", "2"},
+			"shard_1": {"3", "4", "5"},
+			"shard_2": {"6", "7", "8"},
+		},
+	}
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	require.NoError(t, err)
+	assert.FileExists(t, outputFile)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var parsed ShardResult
+	err = yaml.Unmarshal(data, &parsed)
+	require.NoError(t, err)
+	assert.Equal(t, "mobile_device_inventory", parsed.Metadata.SourceType)
+	assert.Equal(t, 3, parsed.Metadata.ShardCount)
+	assert.Len(t, parsed.Shards, 3)
+}
+
+func TestWriteOutput_YAMLHeader(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "shards.yaml")
+	cfg := &shardConfig{OutputFormat: "yaml", OutputFile: outputFile, YAMLHeader: true}
+	result := &ShardResult{
+		Metadata: ShardMetadata{GeneratedAt: time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC), ShardCount: 2},
+		Shards:   map[string][]string{"shard_0": {"1", "3"}, "shard_1": {"2"}},
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data),
+		"# generated by go-jamf-guid-sharder "+Version+" at 2026-03-11T12:00:00Z\n---\nmetadata:\n"))
+
+	loaded, err := loadShardResult(outputFile)
+	require.NoError(t, err, "The header keeps the file readable as a prior result")
+	assert.Equal(t, result.Shards, loaded.Shards)
+}
+
+func TestWriteOutput_Canonical(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "ndjson", "json-detailed"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			var outputs [2][]byte
+			for i, generatedAt := range []time.Time{
+				time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+				time.Date(2026, 3, 12, 9, 30, 0, 0, time.UTC),
+			} {
+				path := filepath.Join(dir, fmt.Sprintf("run%d.out", i))
+				cfg := &shardConfig{OutputFormat: format, OutputFile: path, Canonical: true, YAMLHeader: format == "yaml"}
+				result := &ShardResult{
+					Metadata: ShardMetadata{GeneratedAt: generatedAt, RateLimitWaitsMs: int64(100 * i), ResultHash: "hash"},
+					Shards:   map[string][]string{"shard_1": {"2"}, "shard_0": {"1", "3"}},
+					Labels:   map[string]map[string]string{"shard_0": {"window": "sat", "owner": "it-ops"}},
+				}
+
+				require.NoError(t, writeOutput(context.Background(), cfg, result))
+				assert.Equal(t, generatedAt, result.Metadata.GeneratedAt, "The caller's result is left alone")
+
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				outputs[i] = data
+			}
+
+			assert.Equal(t, string(outputs[0]), string(outputs[1]))
+			assert.NotContains(t, string(outputs[0]), "generated_at")
+			assert.NotContains(t, string(outputs[0]), "rate_limit_waits_ms")
+		})
+	}
+}
+
+func TestYAMLHeader_Canonical(t *testing.T) {
+	assert.Equal(t, "# generated by go-jamf-guid-sharder "+Version+"\n---\n", string(yamlHeader(time.Time{})))
+}
+
+func TestWriteOutput_Dir_YAMLHeader(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &shardConfig{OutputFormat: "yaml", OutputDir: outputDir, YAMLHeader: true}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, outputDirTestResult()))
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "shard_0.yaml"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# generated by go-jamf-guid-sharder "))
+	var shard0 []string
+	require.NoError(t, yaml.Unmarshal(data, &shard0))
+	assert.Equal(t, []string{"1", "3"}, shard0)
+}
+
+func TestWriteOutput_TemplatedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt: time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC),
+			SourceType:  "computer_inventory",
+			Strategy:    "round-robin",
+			ResultHash:  "0123456789abcdef0123",
+		},
+		Shards: map[string][]string{"shard_0": {"1"}},
+	}
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputFile:   filepath.Join(tmpDir, "shards-{{.Date}}-{{.SourceType}}-{{.Strategy}}-{{.Hash}}.json"),
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	assert.FileExists(t, filepath.Join(tmpDir, "shards-2024-06-01-computer_inventory-round-robin-0123456789ab.json"))
+	assert.Contains(t, cfg.OutputFile, "{{.Date}}", "The caller's config is left unexpanded")
+}
+
+func TestWriteOutput_SelectShard(t *testing.T) {
+	tmpDir := t.TempDir()
+	result := &ShardResult{
+		Metadata: ShardMetadata{SourceType: "computer_inventory"},
+		Shards:   map[string][]string{"shard_0": {"1", "3"}, "shard_1": {}, "shard_2": {"201", "203"}},
+	}
+
+	jsonFile := filepath.Join(tmpDir, "wave.json")
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: jsonFile, SelectShard: "shard_2"}, result))
+	data, err := os.ReadFile(jsonFile)
+	require.NoError(t, err)
+	assert.Equal(t, "[\"201\",\"203\"]\n", string(data))
+
+	yamlFile := filepath.Join(tmpDir, "wave.yaml")
+	require.NoError(t, writeOutput(context.Background(), &shardConfig{OutputFormat: "yaml", OutputFile: yamlFile, SelectShard: "shard_1"}, result))
+	data, err = os.ReadFile(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(data), "An empty shard is an empty list")
+
+	err = writeOutput(context.Background(), &shardConfig{OutputFormat: "json", OutputFile: jsonFile, SelectShard: "shard_3"}, result)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `select_shard "shard_3" is not in the result, which has shard_0 to shard_2`)
+}
+
+func TestExpandOutputFile(t *testing.T) {
+	meta := &ShardMetadata{GeneratedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), SourceType: "computer_inventory"}
+
+	path, err := expandOutputFile("out/shards.json", meta)
+	require.NoError(t, err)
+	assert.Equal(t, "out/shards.json", path, "Plain paths are unchanged")
+
+	path, err = expandOutputFile("shards-{{.Date}}-{{.SourceType}}.json", meta)
+	require.NoError(t, err)
+	assert.Equal(t, "shards-2024-06-01-computer_inventory.json", path)
+
+	_, err = expandOutputFile("shards-{{.Day}}.json", meta)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `output_file "shards-{{.Day}}.json" references an unknown field`)
+	assert.Contains(t, err.Error(), "available fields: {{.Date}}, {{.Hash}}, {{.SourceType}}, {{.Strategy}}")
+
+	_, err = expandOutputFile("shards-{{.Date.json", meta)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a valid template")
+}
+
+func TestWriteOutput_InvalidPath(t *testing.T) {
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputFile:   "/nonexistent/path/output.json",
+	}
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt: time.Now(),
+		},
+		Shards: map[string][]string{},
+	}
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write output")
+}
+
+func TestWriteOutput_NDJSON_File(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputFile := filepath.Join(tmpDir, "test_output.ndjson")
+
+	cfg := &shardConfig{
+		OutputFormat: "ndjson",
+		OutputFile:   outputFile,
+	}
+	result := &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+			SourceType:      "computer_inventory",
+			Strategy:        "round-robin",
+			TotalIDsFetched: 4,
+			ShardCount:      11,
+		},
+		Shards: map[string][]string{
+			"shard_10": {"4"},
+			"shard_2":  {"3"},
+			"shard_0":  {"1", "2"},
+		},
+	}
+
+	err := writeOutput(context.Background(), cfg, result)
+
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 5, "One line per ID plus a trailing metadata line")
+
+	var records []ShardRecord
+	for _, line := range lines[:4] {
+		var rec ShardRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records = append(records, rec)
+	}
+	assert.Equal(t, []ShardRecord{
+		{Shard: "shard_0", ID: "1"},
+		{Shard: "shard_0", ID: "2"},
+		{Shard: "shard_2", ID: "3"},
+		{Shard: "shard_10", ID: "4"},
+	}, records, "Records should be grouped by shard in index order")
+
+	var meta ShardMetadataRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &meta))
+	assert.Equal(t, "computer_inventory", meta.Metadata.SourceType)
+	assert.Equal(t, 4, meta.Metadata.TotalIDsFetched)
+}
+
+func TestWriteHistogram(t *testing.T) {
+	shards := map[string][]string{
+		"shard_0":  make([]string, 80),
+		"shard_1":  make([]string, 20),
+		"shard_10": make([]string, 1),
+		"shard_2":  {},
+	}
+
+	var buf bytes.Buffer
+	writeHistogram(&buf, shards)
+
+	expected := "shard_0  |" + strings.Repeat("#", 40) + " 80\n" +
+		"shard_1  |" + strings.Repeat("#", 10) + " 20\n" +
+		"shard_2  | 0\n" +
+		"shard_10 |# 1\n"
+	assert.Equal(t, expected, buf.String(), "Bars scale to the largest shard; a non-empty shard always gets one #")
+}
+
+func TestWriteHistogram_AllEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	writeHistogram(&buf, map[string][]string{"shard_0": {}, "shard_1": {}})
+
+	assert.Equal(t, "shard_0 | 0\nshard_1 | 0\n", buf.String())
+}
+
+func TestWriteOutput_JSONDetailed(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "out.json")
+	cfg := &shardConfig{OutputFormat: "json-detailed", OutputFile: outputFile}
+	result := &ShardResult{
+		Metadata:  ShardMetadata{SourceType: "computer_inventory", ShardCount: 2},
+		Shards:    map[string][]string{"shard_0": {"1", "2"}, "shard_1": {}},
+		Unmanaged: map[string]bool{"2": true},
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var parsed DetailedShardResult
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, "computer_inventory", parsed.Metadata.SourceType)
+	assert.Equal(t, []ShardEntry{{ID: "1", Managed: true}, {ID: "2", Managed: false}}, parsed.Shards["shard_0"])
+	assert.Equal(t, []ShardEntry{}, parsed.Shards["shard_1"], "Empty shards stay [] rather than null")
+	assert.NotContains(t, string(data), "unmanaged")
+}
+
+func TestWriteOutput_JSONDetailed_Names(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "out.json")
+	cfg := &shardConfig{OutputFormat: "json-detailed", OutputFile: outputFile}
+	result := &ShardResult{
+		Shards: map[string][]string{"shard_0": {"1", "2"}},
+		Names:  map[string]string{"1": "Computer1"},
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var parsed DetailedShardResult
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, []ShardEntry{{ID: "1", Name: "Computer1", Managed: true}, {ID: "2", Managed: true}}, parsed.Shards["shard_0"])
+	assert.Equal(t, 1, strings.Count(string(data), `"name"`), "IDs without a name omit the field")
+}
+
+func TestWriteOutput_WarningsRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "ndjson", "json-detailed"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+strings.TrimSuffix(format, "-detailed"))
+			cfg := &shardConfig{OutputFormat: format, OutputFile: path}
+			written := &ShardResult{
+				Shards:   map[string][]string{"shard_0": {"1"}, "shard_1": {}},
+				Warnings: []string{"shard count 2 exceeds the 1 distributable (unreserved) ID(s); some shards will be empty"},
+			}
+			require.NoError(t, writeOutput(context.Background(), cfg, written))
+
+			loaded, err := loadShardResult(path)
+
+			require.NoError(t, err)
+			assert.Equal(t, written.Warnings, loaded.Warnings)
+		})
+	}
+}
+
+func TestWriteOutput_JSONDetailed_Placements(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "out.json")
+	cfg := &shardConfig{OutputFormat: "json-detailed", OutputFile: outputFile}
+	index := 0
+	result := &ShardResult{
+		Shards:     map[string][]string{"shard_0": {"1", "2"}},
+		Placements: map[string]PlacementExplanation{"2": {Shard: "shard_0", DistributionIndex: &index}},
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	data, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	var parsed DetailedShardResult
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	entries := parsed.Shards["shard_0"]
+	require.Len(t, entries, 2)
+	assert.Nil(t, entries[0].Placement)
+	require.NotNil(t, entries[1].Placement)
+	assert.Equal(t, 0, *entries[1].Placement.DistributionIndex)
+	assert.NotContains(t, string(data), `"placements"`, "json-detailed reports placements per entry only")
+}
+
+func TestWriteOutput_NDJSON_BreakdownInTrailer(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "out.ndjson")
+	cfg := &shardConfig{OutputFormat: "ndjson", OutputFile: outputFile}
+	result := &ShardResult{
+		Shards:         map[string][]string{"shard_0": {"1", "2"}},
+		ShardBreakdown: map[string]ShardCounts{"shard_0": {Reserved: 1, Distributed: 1}},
+	}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, result))
+
+	loaded, err := loadShardResult(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, result.ShardBreakdown, loaded.ShardBreakdown)
+}
+
+func TestWriteOutput_NDJSON_InvalidPath(t *testing.T) {
+	cfg := &shardConfig{
+		OutputFormat: "ndjson",
+		OutputFile:   "/nonexistent/path/output.ndjson",
+	}
+
+	err := writeOutput(context.Background(), cfg, &ShardResult{Shards: map[string][]string{}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write output")
+}
+
+// outputDirTestResult is a small two-shard result used by the --output-dir tests.
+func outputDirTestResult() *ShardResult {
+	return &ShardResult{
+		Metadata: ShardMetadata{
+			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
+			SourceType:      "computer_inventory",
+			Strategy:        "round-robin",
+			TotalIDsFetched: 3,
+			ShardCount:      2,
+		},
+		Shards: map[string][]string{
+			"shard_0": {"1", "3"},
+			"shard_1": {"2"},
+		},
+		ShardBreakdown: map[string]ShardCounts{
+			"shard_0": {Distributed: 2},
+			"shard_1": {Distributed: 1},
+		},
+		Labels:   map[string]map[string]string{"shard_0": {"window": "Tue 02:00"}},
+		Warnings: []string{"shard_1 is small"},
+	}
+}
+
+func TestWriteOutput_Dir_JSON(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "shards")
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputDir:    outputDir,
+	}
+
+	err := writeOutput(context.Background(), cfg, outputDirTestResult())
+
+	require.NoError(t, err)
+
+	var shard0 []string
+	data, err := os.ReadFile(filepath.Join(outputDir, "shard_0.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &shard0))
+	assert.Equal(t, []string{"1", "3"}, shard0)
+
+	var meta ShardMetadataRecord
+	data, err = os.ReadFile(filepath.Join(outputDir, "metadata.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, 2, meta.Metadata.ShardCount)
+	assert.Equal(t, ShardCounts{Distributed: 2}, meta.ShardBreakdown["shard_0"])
+	assert.Equal(t, map[string]string{"window": "Tue 02:00"}, meta.Labels["shard_0"])
+	assert.Equal(t, []string{"shard_1 is small"}, meta.Warnings)
+
+	assert.FileExists(t, filepath.Join(outputDir, "shard_1.json"))
+}
+
+func TestWriteOutput_Dir_YAML(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &shardConfig{
+		OutputFormat: "yaml",
+		OutputDir:    outputDir,
+	}
+
+	err := writeOutput(context.Background(), cfg, outputDirTestResult())
+
+	require.NoError(t, err)
+
+	var shard1 []string
+	data, err := os.ReadFile(filepath.Join(outputDir, "shard_1.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(data, &shard1))
+	assert.Equal(t, []string{"2"}, shard1)
+
+	var meta ShardMetadataRecord
+	data, err = os.ReadFile(filepath.Join(outputDir, "metadata.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(data, &meta))
+	assert.Equal(t, "round-robin", meta.Metadata.Strategy)
+	assert.Equal(t, ShardCounts{Distributed: 1}, meta.ShardBreakdown["shard_1"])
+	assert.Equal(t, map[string]string{"window": "Tue 02:00"}, meta.Labels["shard_0"])
+	assert.Equal(t, []string{"shard_1 is small"}, meta.Warnings)
+}
+
+func TestWriteOutput_Dir_NDJSON(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &shardConfig{
+		OutputFormat: "ndjson",
+		OutputDir:    outputDir,
+	}
+
+	err := writeOutput(context.Background(), cfg, outputDirTestResult())
+
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "shard_0.ndjson"))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"shard\":\"shard_0\",\"id\":\"1\"}\n{\"shard\":\"shard_0\",\"id\":\"3\"}\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(outputDir, "metadata.ndjson"))
+	require.NoError(t, err)
+	var meta ShardMetadataRecord
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, "round-robin", meta.Metadata.Strategy)
+	assert.Equal(t, map[string]string{"window": "Tue 02:00"}, meta.Labels["shard_0"])
+	assert.Equal(t, []string{"shard_1 is small"}, meta.Warnings)
+}
+
+func TestWriteOutput_Dir_Unwritable(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(blocker, []byte("x"), 0o644))
+	cfg := &shardConfig{
+		OutputFormat: "json",
+		OutputDir:    filepath.Join(blocker, "shards"),
+	}
+
+	err := writeOutput(context.Background(), cfg, outputDirTestResult())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create output directory")
+}
+
+func TestWriteOutput_FileMode(t *testing.T) {
+	for _, format := range []string{"json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "output."+format)
+			// An existing, wider file is narrowed rather than left as it was.
+			require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+			cfg := &shardConfig{OutputFormat: format, OutputFile: path, OutputFileMode: "0600"}
+
+			require.NoError(t, writeOutput(context.Background(), cfg, outputDirTestResult()))
+
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		})
+	}
+}
+
+func TestWriteOutput_Dir_FileMode(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &shardConfig{OutputFormat: "json", OutputDir: outputDir, OutputFileMode: "0600"}
+
+	require.NoError(t, writeOutput(context.Background(), cfg, outputDirTestResult()))
+
+	for _, name := range []string{"shard_0.json", "shard_1.json", "metadata.json"} {
+		info, err := os.Stat(filepath.Join(outputDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), name)
+	}
+}
+
+func TestWriteOutput_AtomicWrite(t *testing.T) {
+	for _, format := range []string{"json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "output."+format)
+			require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+			cfg := &shardConfig{OutputFormat: format, OutputFile: path, OutputFileMode: "0600", AtomicWrite: true}
+
+			require.NoError(t, writeOutput(context.Background(), cfg, outputDirTestResult()))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "shard_0")
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
 
-	cfg := &shardConfig{
-		OutputFormat: "yaml",
-		OutputFile:   outputFile,
-	}
-	result := &ShardResult{
-		Metadata: ShardMetadata{
-			GeneratedAt:     time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC),
-			SourceType:      "mobile_device_inventory",
-			Strategy:        "percentage",
-			Seed:            "test",
-			TotalIDsFetched: 20,
-			ShardCount:      3,
-		},
-		Shards: map[string][]string{
-			"shard_0": {"1", "2"},
-			"shard_1": {"3", "4", "5"},
-			"shard_2": {"6", "7", "8"},
-		},
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1, "no temporary file is left behind")
+		})
 	}
+}
 
-	err := writeOutput(cfg, result)
+func TestCloseOutputFile_AtomicFailureKeepsTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.json")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+	cfg := &shardConfig{AtomicWrite: true}
 
+	f, err := createOutputFile(cfg, path)
 	require.NoError(t, err)
-	assert.FileExists(t, outputFile)
-
-	data, err := os.ReadFile(outputFile)
+	_, err = f.WriteString("partial")
 	require.NoError(t, err)
+	require.NoError(t, closeOutputFile(cfg, f, path, true))
 
-	var parsed ShardResult
-	err = yaml.Unmarshal(data, &parsed)
+	data, err := os.ReadFile(path)
 	require.NoError(t, err)
-	assert.Equal(t, "mobile_device_inventory", parsed.Metadata.SourceType)
-	assert.Equal(t, 3, parsed.Metadata.ShardCount)
-	assert.Len(t, parsed.Shards, 3)
+	assert.Equal(t, "old", string(data))
+	assert.NoFileExists(t, f.Name())
 }
 
-func TestWriteOutput_InvalidPath(t *testing.T) {
-	cfg := &shardConfig{
-		OutputFormat: "json",
-		OutputFile:   "/nonexistent/path/output.json",
+func TestParseOutputFileMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{mode: "", want: 0o644},
+		{mode: "0600", want: 0o600},
+		{mode: "640", want: 0o640},
+		{mode: "0o600", wantErr: true},
+		{mode: "0800", wantErr: true},
+		{mode: "01777", wantErr: true},
+		{mode: "rw-------", wantErr: true},
 	}
-	result := &ShardResult{
-		Metadata: ShardMetadata{
-			GeneratedAt: time.Now(),
-		},
-		Shards: map[string][]string{},
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := parseOutputFileMode(tt.mode)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "is not a valid octal file mode")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
 	}
-
-	err := writeOutput(cfg, result)
-
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to write output")
 }
 
 func TestWriteOutput_YAMLStdout(t *testing.T) {
@@ -427,7 +1940,7 @@ func TestWriteOutput_YAMLStdout(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	err := writeOutput(cfg, result)
+	err := writeOutput(context.Background(), cfg, result)
 
 	w.Close()
 	os.Stdout = oldStdout
@@ -459,7 +1972,7 @@ func TestWriteOutput_DefaultFormat(t *testing.T) {
 		},
 	}
 
-	err := writeOutput(cfg, result)
+	err := writeOutput(context.Background(), cfg, result)
 
 	require.NoError(t, err)
 	assert.FileExists(t, outputFile)
@@ -501,7 +2014,7 @@ func TestWriteOutput_ComplexMetadata(t *testing.T) {
 		},
 	}
 
-	err := writeOutput(cfg, result)
+	err := writeOutput(context.Background(), cfg, result)
 
 	require.NoError(t, err)
 	assert.FileExists(t, outputFile)
@@ -518,6 +2031,184 @@ func TestWriteOutput_ComplexMetadata(t *testing.T) {
 	assert.Equal(t, 460, parsed.Metadata.UnreservedIDsDistributed)
 }
 
+// ── Preview Count Tests ───────────────────────────────────────────────────────
+
+func TestApplyPreviewCount_TruncatesLongShards(t *testing.T) {
+	result := &ShardResult{
+		Metadata: ShardMetadata{ResultHash: "full-hash"},
+		Shards:   map[string][]string{"shard_0": {"1", "2", "3"}, "shard_1": {"4"}, "shard_2": {}},
+	}
+
+	applyPreviewCount(result, 2)
+
+	assert.Equal(t, map[string][]string{"shard_0": {"1", "2"}, "shard_1": {"4"}, "shard_2": {}}, result.Shards)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "full-hash", result.Metadata.ResultHash, "Metadata still describes the full result")
+}
+
+func TestApplyPreviewCount_NothingCut(t *testing.T) {
+	result := &ShardResult{Shards: map[string][]string{"shard_0": {"1", "2"}}}
+
+	applyPreviewCount(result, 2)
+	assert.False(t, result.Truncated, "No shard was longer than the preview")
+
+	applyPreviewCount(result, 0)
+	assert.Equal(t, []string{"1", "2"}, result.Shards["shard_0"])
+	assert.False(t, result.Truncated)
+}
+
+func TestApplyOnlyShards(t *testing.T) {
+	labels := map[string]map[string]string{"shard_0": {"owner": "it-ops"}, "shard_2": {"owner": "desktop"}}
+	result := &ShardResult{
+		Metadata: ShardMetadata{ResultHash: "full-hash", ShardCount: 3},
+		Shards:   map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}, "shard_2": {"3"}},
+		ShardBreakdown: map[string]ShardCounts{
+			"shard_0": {Distributed: 1}, "shard_1": {Distributed: 1}, "shard_2": {Distributed: 1},
+		},
+		Labels:     labels,
+		Placements: map[string]PlacementExplanation{"1": {Shard: "shard_0"}, "3": {Shard: "shard_2"}},
+	}
+
+	applyOnlyShards(result, []string{"shard_1", "shard_2"})
+
+	assert.Equal(t, map[string][]string{"shard_1": {"2"}, "shard_2": {"3"}}, result.Shards)
+	assert.Equal(t, map[string]ShardCounts{"shard_1": {Distributed: 1}, "shard_2": {Distributed: 1}}, result.ShardBreakdown)
+	assert.Equal(t, map[string]map[string]string{"shard_2": {"owner": "desktop"}}, result.Labels)
+	assert.Equal(t, map[string]PlacementExplanation{"3": {Shard: "shard_2"}}, result.Placements)
+	assert.Equal(t, "full-hash", result.Metadata.ResultHash, "Metadata still describes the full result")
+	assert.Equal(t, []string{"shard_1", "shard_2"}, result.Metadata.OnlyShards, "The omission is recorded")
+	assert.Len(t, labels, 2, "shard_labels itself is left alone")
+}
+
+func TestApplyOnlyShards_NoneNamed(t *testing.T) {
+	result := &ShardResult{Shards: map[string][]string{"shard_0": {"1"}, "shard_1": {"2"}}}
+
+	applyOnlyShards(result, nil)
+
+	assert.Len(t, result.Shards, 2)
+	assert.Nil(t, result.Metadata.OnlyShards)
+}
+
+func TestApplyShardOrder(t *testing.T) {
+	newResult := func() *ShardResult {
+		return &ShardResult{
+			Metadata: ShardMetadata{
+				ResultHash:       "strategy-hash",
+				ShardCount:       4,
+				PerShardSeeds:    map[string]string{"shard_0": "alpha"},
+				RebalancedShards: []string{"shard_0", "shard_1"},
+				MinShardSize:     &MinShardSizeSummary{MinShardSize: 1, IDsMoved: 1, ToppedUpShards: []string{"shard_2"}},
+			},
+			Warnings: []string{"shard_1 holds 3 ID(s); shard_0, shard_3 and wave_2 are small"},
+			Shards: map[string][]string{
+				"shard_0": {"1"}, "shard_1": {"2", "3", "4"}, "shard_2": {"5", "6"}, "shard_3": {"7", "8"},
+			},
+			ShardBreakdown: map[string]ShardCounts{
+				"shard_0": {Distributed: 1}, "shard_1": {Reserved: 1, Distributed: 2},
+				"shard_2": {Distributed: 2}, "shard_3": {Distributed: 2},
+			},
+			Labels: map[string]map[string]string{"shard_1": {"owner": "it-ops"}},
+		}
+	}
+	index := func(i int) *int { return &i }
+
+	result := newResult()
+	applyShardOrder(result, "size-desc")
+
+	assert.Equal(t, map[string][]string{
+		"shard_0": {"2", "3", "4"}, "shard_1": {"5", "6"}, "shard_2": {"7", "8"}, "shard_3": {"1"},
+	}, result.Shards, "Equal sizes keep their relative order")
+	assert.Equal(t, ShardCounts{Reserved: 1, Distributed: 2, OriginalIndex: index(1)}, result.ShardBreakdown["shard_0"])
+	assert.Equal(t, ShardCounts{Distributed: 1, OriginalIndex: index(0)}, result.ShardBreakdown["shard_3"])
+	assert.Equal(t, map[string]map[string]string{"shard_0": {"owner": "it-ops"}}, result.Labels)
+	assert.Equal(t, "size-desc", result.Metadata.ShardOrder)
+	assert.Equal(t, computeResultHash(result.Shards), result.Metadata.ResultHash, "The hash covers the new names")
+	assert.Equal(t, map[string]string{"shard_3": "alpha"}, result.Metadata.PerShardSeeds)
+	assert.Equal(t, []string{"shard_0", "shard_3"}, result.Metadata.RebalancedShards)
+	assert.Equal(t, []string{"shard_1"}, result.Metadata.MinShardSize.ToppedUpShards)
+	assert.Equal(t, []string{"shard_0 holds 3 ID(s); shard_3, shard_2 and wave_2 are small"}, result.Warnings)
+
+	result = newResult()
+	applyShardOrder(result, "size-asc")
+	assert.Equal(t, []string{"1"}, result.Shards["shard_0"])
+	assert.Equal(t, []string{"2", "3", "4"}, result.Shards["shard_3"])
+
+	result = newResult()
+	applyShardOrder(result, "index")
+	assert.Equal(t, newResult(), result)
+}
+
+// ── Sort Order Tests ──────────────────────────────────────────────────────────
+
+func TestApplySortOrder_NumericAscIsNoop(t *testing.T) {
+	shards := [][]string{{"1", "5", "10"}, {"2", "3"}}
+
+	applySortOrder(shards, "numeric-asc", nil)
+
+	assert.Equal(t, [][]string{{"1", "5", "10"}, {"2", "3"}}, shards)
+}
+
+func TestApplySortOrder_NumericDesc(t *testing.T) {
+	shards := [][]string{{"1", "5", "10"}, {}, {"2", "3"}}
+
+	applySortOrder(shards, "numeric-desc", nil)
+
+	assert.Equal(t, [][]string{{"10", "5", "1"}, {}, {"3", "2"}}, shards)
+}
+
+func TestApplySortOrder_API(t *testing.T) {
+	shards := [][]string{{"1", "5", "10"}, {"2", "3"}}
+	apiOrder := []string{"10", "3", "1", "2", "5"}
+
+	applySortOrder(shards, "api", apiOrder)
+
+	assert.Equal(t, [][]string{{"10", "1", "5"}, {"3", "2"}}, shards)
+}
+
+func TestApplySortOrder_APIUnknownIDsLast(t *testing.T) {
+	shards := [][]string{{"1", "7", "9", "10"}}
+
+	applySortOrder(shards, "api", []string{"10", "1"})
+
+	assert.Equal(t, [][]string{{"10", "1", "7", "9"}}, shards)
+}
+
+// ── Result Hash Tests ─────────────────────────────────────────────────────────
+
+func TestComputeResultHash_Deterministic(t *testing.T) {
+	shards := map[string][]string{
+		"shard_0": {"1", "3"},
+		"shard_1": {"2", "4"},
+	}
+
+	hash := computeResultHash(shards)
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, computeResultHash(shards))
+}
+
+func TestComputeResultHash_IgnoresIDOrder(t *testing.T) {
+	a := map[string][]string{"shard_0": {"1", "2", "3"}}
+	b := map[string][]string{"shard_0": {"3", "1", "2"}}
+
+	assert.Equal(t, computeResultHash(a), computeResultHash(b))
+	assert.Equal(t, []string{"3", "1", "2"}, b["shard_0"], "input should not be mutated")
+}
+
+func TestComputeResultHash_DetectsMovedID(t *testing.T) {
+	a := map[string][]string{"shard_0": {"1", "2"}, "shard_1": {"3"}}
+	b := map[string][]string{"shard_0": {"1"}, "shard_1": {"2", "3"}}
+
+	assert.NotEqual(t, computeResultHash(a), computeResultHash(b))
+}
+
+func TestComputeResultHash_EmptyAndNilShardsMatch(t *testing.T) {
+	a := map[string][]string{"shard_0": {"1"}, "shard_1": nil}
+	b := map[string][]string{"shard_0": {"1"}, "shard_1": {}}
+
+	assert.Equal(t, computeResultHash(a), computeResultHash(b))
+}
+
 // ── Fetch Source IDs Tests ────────────────────────────────────────────────────
 
 func TestFetchSourceIDs_UnknownSourceType(t *testing.T) {
@@ -525,12 +2216,277 @@ func TestFetchSourceIDs_UnknownSourceType(t *testing.T) {
 		SourceType: "unknown_source",
 	}
 
-	_, err := fetchSourceIDs(nil, cfg)
+	_, err := fetchSourceIDs(context.Background(), nil, cfg)
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unknown source_type")
 }
 
+func TestDedupeIDs_NoDuplicates(t *testing.T) {
+	unique, duplicates := dedupeIDs([]string{"3", "1", "2"})
+
+	assert.Equal(t, []string{"3", "1", "2"}, unique)
+	assert.Empty(t, duplicates)
+}
+
+func TestDedupeIDs_PreservesFirstSeenOrder(t *testing.T) {
+	unique, duplicates := dedupeIDs([]string{"5", "2", "5", "9", "2", "5"})
+
+	assert.Equal(t, []string{"5", "2", "9"}, unique)
+	assert.Equal(t, []string{"5", "2", "5"}, duplicates, "Each extra occurrence should be reported")
+}
+
+func TestCheckSourceIDFormats_Numeric(t *testing.T) {
+	var warnings []string
+
+	err := checkSourceIDFormats(&shardConfig{StrictSourceMatch: true}, "computer_inventory", []string{"1", "22"}, &warnings)
+
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestCheckSourceIDFormats_WarnsByDefault(t *testing.T) {
+	var warnings []string
+	ids := []string{"1", "550e8400-e29b-41d4-a716-446655440000", "2", ""}
+
+	err := checkSourceIDFormats(&shardConfig{}, "mobile_device_inventory", ids, &warnings)
+
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], `mobile_device_inventory returned 2 ID(s) that are not numeric`)
+	assert.Contains(t, warnings[0], `"550e8400-e29b-41d4-a716-446655440000", ""`)
+}
+
+func TestCheckSourceIDFormats_Strict(t *testing.T) {
+	var warnings []string
+
+	err := checkSourceIDFormats(&shardConfig{StrictSourceMatch: true}, "user_accounts", []string{"7", "abc"}, &warnings)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `user_accounts returned 1 ID(s) that are not numeric: "abc"`)
+	assert.Empty(t, warnings)
+}
+
+// ── Fetch Retry Tests ─────────────────────────────────────────────────────────
+
+// shortenFetchRetryDelay makes withFetchRetry back off in microseconds for
+// the duration of a test.
+func shortenFetchRetryDelay(t *testing.T) {
+	original := fetchRetryBaseDelay
+	fetchRetryBaseDelay = time.Microsecond
+	t.Cleanup(func() { fetchRetryBaseDelay = original })
+}
+
+func TestWithFetchRetry_RecoversFromServerError(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	cfg := &shardConfig{MaxRetryAttempts: 3}
+
+	calls := 0
+	ids, err := withFetchRetry(context.Background(), cfg, func() ([]string, error) {
+		calls++
+		if calls < 3 {
+			return nil, &jamfclient.APIError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return []string{"1", "2"}, nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	assert.Equal(t, 3, calls)
+}
+
+func TestWithFetchRetry_ExhaustedReportsAttemptsAndStatus(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	cfg := &shardConfig{MaxRetryAttempts: 2}
+
+	calls := 0
+	_, err := withFetchRetry(context.Background(), cfg, func() ([]string, error) {
+		calls++
+		return nil, fmt.Errorf("failed to retrieve computer group 7: %w",
+			&jamfclient.APIError{StatusCode: http.StatusBadGateway})
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 3, calls, "One initial attempt plus max_retry_attempts retries")
+	assert.Contains(t, err.Error(), "giving up after 3 attempt(s), last HTTP status 502")
+	assert.Contains(t, err.Error(), "computer group 7")
+}
+
+func TestWithFetchRetry_ClientErrorNotRetried(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	cfg := &shardConfig{MaxRetryAttempts: 3}
+
+	calls := 0
+	_, err := withFetchRetry(context.Background(), cfg, func() ([]string, error) {
+		calls++
+		return nil, &jamfclient.APIError{StatusCode: http.StatusNotFound}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.NotContains(t, err.Error(), "giving up")
+}
+
+func TestWithFetchRetry_ZeroAttemptsDisablesRetry(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	cfg := &shardConfig{MaxRetryAttempts: 0}
+
+	calls := 0
+	_, err := withFetchRetry(context.Background(), cfg, func() ([]string, error) {
+		calls++
+		return nil, &jamfclient.APIError{StatusCode: http.StatusInternalServerError}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWithFetchRetry_StopsAtTotalRetryDuration(t *testing.T) {
+	original := fetchRetryBaseDelay
+	fetchRetryBaseDelay = 2 * time.Second
+	t.Cleanup(func() { fetchRetryBaseDelay = original })
+	cfg := &shardConfig{MaxRetryAttempts: 5, TotalRetryDuration: 1}
+
+	calls := 0
+	_, err := withFetchRetry(context.Background(), cfg, func() ([]string, error) {
+		calls++
+		return nil, &jamfclient.APIError{StatusCode: http.StatusInternalServerError}
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, calls, "A retry whose wait exceeds the window should not start")
+}
+
+func TestWithFetchRetry_StopsWhenRunContextExpires(t *testing.T) {
+	original := fetchRetryBaseDelay
+	fetchRetryBaseDelay = time.Hour
+	t.Cleanup(func() { fetchRetryBaseDelay = original })
+	cfg := &shardConfig{MaxRetryAttempts: 5}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	_, err := withFetchRetry(ctx, cfg, func() ([]string, error) {
+		calls++
+		return nil, &jamfclient.APIError{StatusCode: http.StatusServiceUnavailable}
+	})
+
+	require.ErrorIs(t, err, context.DeadlineExceeded, "The backoff wait should end with the run")
+	assert.Equal(t, 1, calls)
+}
+
+func TestWithFetchRetry_HonoursRetryAfter(t *testing.T) {
+	original := fetchRetryBaseDelay
+	fetchRetryBaseDelay = time.Hour
+	t.Cleanup(func() { fetchRetryBaseDelay = original })
+	cfg := &shardConfig{MaxRetryAttempts: 3}
+	ctx, rateLimits := withRateLimitTracker(context.Background())
+
+	calls := 0
+	ids, err := withFetchRetry(ctx, cfg, func() ([]string, error) {
+		calls++
+		if calls == 1 {
+			// As recordRetryAfter does for a 429 with "Retry-After: 0".
+			rateLimits.setRetryAfter(0, true)
+			return nil, &jamfclient.APIError{StatusCode: http.StatusTooManyRequests}
+		}
+		return []string{"1"}, nil
+	})
+
+	require.NoError(t, err, "The Retry-After wait replaces the hour-long backoff")
+	assert.Equal(t, []string{"1"}, ids)
+	assert.Equal(t, 2, calls)
+}
+
+func TestWithFetchRetry_RateLimitWaitsCounted(t *testing.T) {
+	shortenFetchRetryDelay(t)
+	cfg := &shardConfig{MaxRetryAttempts: 3}
+	ctx, rateLimits := withRateLimitTracker(context.Background())
+
+	calls := 0
+	_, err := withFetchRetry(ctx, cfg, func() ([]string, error) {
+		calls++
+		switch calls {
+		case 1:
+			rateLimits.setRetryAfter(20*time.Millisecond, true)
+			return nil, &jamfclient.APIError{StatusCode: http.StatusTooManyRequests}
+		case 2:
+			return nil, &jamfclient.APIError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil, nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), rateLimits.waitedMs(), "Only the wait after the 429 is a rate-limit wait")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "30", want: 30 * time.Second, ok: true},
+		{value: " 0 ", want: 0, ok: true},
+		{value: "-5", ok: false},
+		{value: "Fri, 01 May 2026 09:00:45 GMT", want: 45 * time.Second, ok: true},
+		{value: "Fri, 01 May 2026 08:59:00 GMT", want: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunTimeoutError(t *testing.T) {
+	cfg := &shardConfig{RunTimeout: time.Millisecond}
+	fetchErr := errors.New("failed to retrieve users: context deadline exceeded")
+
+	assert.NoError(t, runTimeoutError(context.Background(), cfg, "sharding", nil))
+	assert.Equal(t, fetchErr, runTimeoutError(context.Background(), cfg, "sharding", fetchErr),
+		"Errors unrelated to the deadline pass through unchanged")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := runTimeoutError(ctx, cfg, "fetching source IDs", fetchErr)
+	require.ErrorIs(t, err, fetchErr)
+	assert.Contains(t, err.Error(), "run timed out after 1ms (run_timeout) while fetching source IDs")
+}
+
+func TestClassifyFetchError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		retryable bool
+	}{
+		{"server error", &jamfclient.APIError{StatusCode: 500}, 500, true},
+		{"request timeout", &jamfclient.APIError{StatusCode: 408}, 408, true},
+		{"rate limited", &jamfclient.APIError{StatusCode: 429}, 429, true},
+		{"not found", &jamfclient.APIError{StatusCode: 404}, 404, false},
+		{"wrapped server error", fmt.Errorf("ctx: %w", &jamfclient.APIError{StatusCode: 503}), 503, true},
+		{"network error", fmt.Errorf("request failed: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), 0, true},
+		{"plain error", errors.New("invalid group ID"), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, retryable := classifyFetchError(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.retryable, retryable)
+		})
+	}
+}
+
 
 // ── Integration Tests ─────────────────────────────────────────────────────────
 
@@ -543,10 +2499,10 @@ func TestFullShardingWorkflow_RoundRobin(t *testing.T) {
 		ExcludeIDs: []string{"10", "20", "30"},
 	}
 
-	filtered := applyExclusions(ids, cfg.ExcludeIDs)
+	filtered, _ := applyExclusions(ids, cfg.ExcludeIDs, nil)
 	assert.Len(t, filtered, 97)
 
-	reservations, err := applyReservations(filtered, nil, cfg.ShardCount)
+	reservations, err := applyReservations(filtered, nil, cfg.ShardCount, "")
 	require.NoError(t, err)
 
 	shards, err := applyStrategy(cfg, filtered, reservations)
@@ -564,7 +2520,7 @@ func TestFullShardingWorkflow_WithReservations(t *testing.T) {
 	ids := createTestIDs(100, 1)
 	cfg := &shardConfig{
 		Strategy:         "percentage",
-		ShardPercentages: []int{20, 30, 50},
+		ShardPercentages: []float64{20, 30, 50},
 		Seed:             "integration-test",
 		ExcludeIDs:       []string{"10", "20"},
 		ReservedIDs: map[string][]string{
@@ -573,13 +2529,13 @@ func TestFullShardingWorkflow_WithReservations(t *testing.T) {
 		},
 	}
 
-	filtered := applyExclusions(ids, cfg.ExcludeIDs)
+	filtered, _ := applyExclusions(ids, cfg.ExcludeIDs, nil)
 	assert.Len(t, filtered, 98)
 
 	shardCount := resolveShardCount(cfg)
 	assert.Equal(t, 3, shardCount)
 
-	reservations, err := applyReservations(filtered, cfg.ReservedIDs, shardCount)
+	reservations, err := applyReservations(filtered, cfg.ReservedIDs, shardCount, "")
 	require.NoError(t, err)
 	assert.Len(t, reservations.UnreservedIDs, 95)
 
@@ -600,7 +2556,7 @@ func TestFullShardingWorkflow_SizeWithRemainder(t *testing.T) {
 		Seed:       "test",
 	}
 
-	reservations, err := applyReservations(ids, nil, len(cfg.ShardSizes))
+	reservations, err := applyReservations(ids, nil, len(cfg.ShardSizes), "")
 	require.NoError(t, err)
 
 	shards, err := applyStrategy(cfg, ids, reservations)
@@ -620,7 +2576,7 @@ func TestFullShardingWorkflow_Rendezvous(t *testing.T) {
 		Seed:       "stability-test",
 	}
 
-	reservations, err := applyReservations(ids, nil, cfg.ShardCount)
+	reservations, err := applyReservations(ids, nil, cfg.ShardCount, "")
 	require.NoError(t, err)
 
 	shards, err := applyStrategy(cfg, ids, reservations)
@@ -663,7 +2619,7 @@ func TestWriteOutput_JSONFormat(t *testing.T) {
 		},
 	}
 
-	err := writeOutput(cfg, result)
+	err := writeOutput(context.Background(), cfg, result)
 	require.NoError(t, err)
 
 	data, err := os.ReadFile(outputFile)
@@ -706,7 +2662,7 @@ func TestWriteOutput_YAMLFormat(t *testing.T) {
 		},
 	}
 
-	err := writeOutput(cfg, result)
+	err := writeOutput(context.Background(), cfg, result)
 	require.NoError(t, err)
 
 	data, err := os.ReadFile(outputFile)
@@ -730,146 +2686,12 @@ func TestApplyReservations_AllIDsReserved(t *testing.T) {
 		"shard_1": {"3", "4"},
 	}
 
-	result, err := applyReservations(ids, reservedMap, 2)
+	result, err := applyReservations(ids, reservedMap, 2, "")
 
 	require.NoError(t, err)
 	assert.Empty(t, result.UnreservedIDs)
 	assert.Len(t, result.IDsByShard, 2)
-	assert.Equal(t, 2, result.CountsByShard[0])
-	assert.Equal(t, 2, result.CountsByShard[1])
-}
-
-func TestShardByPercentage_SmallIDSet(t *testing.T) {
-	ids := []string{"1", "2", "3"}
-	percentages := []int{33, 33, 34}
-
-	shards := shardByPercentage(ids, percentages, "", nil)
-
-	require.Len(t, shards, 3)
-	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
-	assert.Equal(t, 3, totalIDs, "All IDs should be distributed")
-}
-
-func TestShardBySize_ExactFit(t *testing.T) {
-	ids := createTestIDs(60, 1)
-	sizes := []int{20, 20, 20}
-
-	shards := shardBySize(ids, sizes, "", nil)
-
-	require.Len(t, shards, 3)
-	assert.Equal(t, 20, len(shards[0]))
-	assert.Equal(t, 20, len(shards[1]))
-	assert.Equal(t, 20, len(shards[2]))
-}
-
-func TestShardBySize_MoreSizesThanIDs(t *testing.T) {
-	ids := []string{"1", "2", "3"}
-	sizes := []int{10, 10, 10, 10}
-
-	shards := shardBySize(ids, sizes, "", nil)
-
-	require.Len(t, shards, 4)
-	totalIDs := 0
-	for _, shard := range shards {
-		totalIDs += len(shard)
-	}
-	assert.Equal(t, 3, totalIDs, "Should only distribute available IDs")
-}
-
-func TestSortIDsNumerically_LargeNumbers(t *testing.T) {
-	ids := []string{"1000", "50", "500", "5", "5000"}
-	sortIDsNumerically(ids)
-
-	expected := []string{"5", "50", "500", "1000", "5000"}
-	assert.Equal(t, expected, ids)
-}
-
-func TestShuffleIDs_SingleElement(t *testing.T) {
-	ids := []string{"42"}
-	shuffled := shuffleIDs(ids, "test-seed")
-
-	assert.Equal(t, []string{"42"}, shuffled)
-}
-
-func TestShuffleIDs_TwoElements(t *testing.T) {
-	ids := []string{"1", "2"}
-	shuffled := shuffleIDs(ids, "test-seed")
-
-	assert.Len(t, shuffled, 2)
-	assert.Contains(t, shuffled, "1")
-	assert.Contains(t, shuffled, "2")
-}
-
-func TestCreateSeededRNG_EmptySeed(t *testing.T) {
-	rng := createSeededRNG("")
-
-	val1 := rng.Intn(1000)
-	val2 := rng.Intn(1000)
-
-	assert.True(t, val1 >= 0 && val1 < 1000)
-	assert.True(t, val2 >= 0 && val2 < 1000)
-}
-
-func TestSortAndShuffleIfSeed_PreservesAllIDs(t *testing.T) {
-	ids := createTestIDs(50, 1)
-	result := sortAndShuffleIfSeed(ids, "preserve-test")
-
-	assert.Len(t, result, len(ids))
-	for _, id := range ids {
-		assert.Contains(t, result, id)
-	}
-}
-
-// ── Boundary Tests ────────────────────────────────────────────────────────────
-
-func TestShardByRoundRobin_OneID(t *testing.T) {
-	ids := []string{"1"}
-	shards := shardByRoundRobin(ids, 3, "", nil)
-
-	require.Len(t, shards, 3)
-	assert.Len(t, shards[0], 1)
-	assert.Empty(t, shards[1])
-	assert.Empty(t, shards[2])
-}
-
-func TestShardByPercentage_OneID(t *testing.T) {
-	ids := []string{"1"}
-	percentages := []int{33, 33, 34}
-
-	shards := shardByPercentage(ids, percentages, "", nil)
-
-	require.Len(t, shards, 3)
-	totalIDs := 0
-	for _, shard := range shards {
-		totalIDs += len(shard)
-	}
-	assert.Equal(t, 1, totalIDs)
-}
-
-func TestShardBySize_OneID(t *testing.T) {
-	ids := []string{"1"}
-	sizes := []int{10, 20, 30}
-
-	shards := shardBySize(ids, sizes, "", nil)
-
-	require.Len(t, shards, 3)
-	totalIDs := 0
-	for _, shard := range shards {
-		totalIDs += len(shard)
-	}
-	assert.Equal(t, 1, totalIDs)
-}
-
-func TestShardByRendezvous_OneID(t *testing.T) {
-	ids := []string{"1"}
-	shards := shardByRendezvous(ids, 3, "test", nil)
-
-	require.Len(t, shards, 3)
-	totalIDs := 0
-	for _, shard := range shards {
-		totalIDs += len(shard)
-	}
-	assert.Equal(t, 1, totalIDs)
+	assert.Equal(t, map[int]int{0: 2, 1: 2}, result.Counts())
 }
 
 func TestApplyReservations_EmptyIDList(t *testing.T) {
@@ -877,7 +2699,7 @@ func TestApplyReservations_EmptyIDList(t *testing.T) {
 		"shard_0": {"1", "2"},
 	}
 
-	result, err := applyReservations([]string{}, reservedMap, 2)
+	result, err := applyReservations([]string{}, reservedMap, 2, "")
 
 	require.NoError(t, err)
 	assert.Empty(t, result.UnreservedIDs)
@@ -888,7 +2710,7 @@ func TestApplyReservations_EmptyIDList(t *testing.T) {
 
 func TestSortIDsNumerically_MixedOrder(t *testing.T) {
 	ids := []string{"999", "1", "100", "10", "50"}
-	sortIDsNumerically(ids)
+	sharding.SortIDsNumerically(ids)
 
 	expected := []string{"1", "10", "50", "100", "999"}
 	assert.Equal(t, expected, ids)
@@ -896,7 +2718,7 @@ func TestSortIDsNumerically_MixedOrder(t *testing.T) {
 
 func TestSortIDsNumerically_WithLeadingZeros(t *testing.T) {
 	ids := []string{"001", "100", "010", "002"}
-	sortIDsNumerically(ids)
+	sharding.SortIDsNumerically(ids)
 
 	expected := []string{"001", "002", "010", "100"}
 	assert.Equal(t, expected, ids)
@@ -917,8 +2739,8 @@ func TestShardResultMetadata_Calculation(t *testing.T) {
 		},
 	}
 
-	filtered := applyExclusions(ids, cfg.ExcludeIDs)
-	reservations, err := applyReservations(filtered, cfg.ReservedIDs, cfg.ShardCount)
+	filtered, _ := applyExclusions(ids, cfg.ExcludeIDs, nil)
+	reservations, err := applyReservations(filtered, cfg.ReservedIDs, cfg.ShardCount, "")
 	require.NoError(t, err)
 
 	shards, err := applyStrategy(cfg, filtered, reservations)
@@ -1012,7 +2834,7 @@ func TestFullWorkflow_AllSourceTypes(t *testing.T) {
 				Seed:       tc.seed,
 			}
 
-			reservations, err := applyReservations(ids, nil, tc.shardCount)
+			reservations, err := applyReservations(ids, nil, tc.shardCount, "")
 			require.NoError(t, err)
 
 			shards, err := applyStrategy(cfg, ids, reservations)
@@ -1032,7 +2854,7 @@ func TestFullWorkflow_ComplexReservationsAndExclusions(t *testing.T) {
 	ids := createTestIDs(200, 1)
 	cfg := &shardConfig{
 		Strategy:         "percentage",
-		ShardPercentages: []int{25, 35, 40},
+		ShardPercentages: []float64{25, 35, 40},
 		Seed:             "complex",
 		ExcludeIDs:       []string{"5", "10", "15", "20", "25", "30"},
 		ReservedIDs: map[string][]string{
@@ -1042,11 +2864,11 @@ func TestFullWorkflow_ComplexReservationsAndExclusions(t *testing.T) {
 		},
 	}
 
-	filtered := applyExclusions(ids, cfg.ExcludeIDs)
+	filtered, _ := applyExclusions(ids, cfg.ExcludeIDs, nil)
 	assert.Len(t, filtered, 194)
 
 	shardCount := resolveShardCount(cfg)
-	reservations, err := applyReservations(filtered, cfg.ReservedIDs, shardCount)
+	reservations, err := applyReservations(filtered, cfg.ReservedIDs, shardCount, "")
 	require.NoError(t, err)
 	assert.Len(t, reservations.UnreservedIDs, 188)
 
@@ -1078,7 +2900,7 @@ func TestResolveShardCount_AllCombinations(t *testing.T) {
 		},
 		{
 			name:     "only_percentages",
-			cfg:      &shardConfig{ShardPercentages: []int{20, 30, 50}},
+			cfg:      &shardConfig{ShardPercentages: []float64{20, 30, 50}},
 			expected: 3,
 		},
 		{
@@ -1089,7 +2911,7 @@ func TestResolveShardCount_AllCombinations(t *testing.T) {
 		{
 			name: "percentages_override_count",
 			cfg: &shardConfig{
-				ShardPercentages: []int{25, 75},
+				ShardPercentages: []float64{25, 75},
 				ShardCount:       10,
 			},
 			expected: 2,
@@ -1,271 +1,119 @@
 package cmd
 
-// strategies.go contains the four sharding algorithms, adapted from the
-// terraform-provider-jamfpro guid_list_sharder data source. All Terraform and
-// tflog dependencies have been removed; the logic is otherwise identical.
+// strategies.go connects the sharding strategies in pkg/sharding to a run's
+// configuration: per-shard seeds, and explanations of where each ID was
+// placed and why.
 
-import (
-	"crypto/sha256"
-	"encoding/binary"
-	"fmt"
-	"math/rand"
-	"slices"
-	"strconv"
-)
+import "github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
 
-// shardByRoundRobin distributes IDs in circular order, guaranteeing equal
-// shard sizes ±1. If a seed is provided, IDs are sorted numerically then
-// shuffled deterministically before distribution.
-//
-// Algorithm: Round-robin scheduling
-// Reference: https://en.wikipedia.org/wiki/Round-robin_scheduling
-func shardByRoundRobin(ids []string, shardCount int, seed string, reservations *shardReservations) [][]string {
-	if shardCount <= 0 {
-		shardCount = 1
-	}
-
-	unreservedIDs := ids
-	if reservations != nil {
-		unreservedIDs = reservations.UnreservedIDs
-	}
-
-	shards := make([][]string, shardCount)
-	distributionIDs := sortAndShuffleIfSeed(unreservedIDs, seed)
-
-	for i, id := range distributionIDs {
-		shards[i%shardCount] = append(shards[i%shardCount], id)
-	}
-
-	if reservations != nil {
-		for shardName, reservedIDs := range reservations.IDsByShard {
-			var idx int
-			fmt.Sscanf(shardName, "shard_%d", &idx)
-			shards[idx] = append(reservedIDs, shards[idx]...)
+// applyPerShardSeeds reorders each shard named in seeds, under prefix, in
+// place: sorted numerically, then shuffled with that shard's own seed, so its
+// order depends only on its contents and seed. Other shards are left as they
+// are.
+func applyPerShardSeeds(shards [][]string, seeds map[string]string, prefix string) {
+	for i := range shards {
+		if seed, ok := seeds[shardName(prefix, i)]; ok {
+			shards[i] = sharding.DistributionOrder(shards[i], seed)
 		}
 	}
+}
 
-	for i := range shards {
-		sortIDsNumerically(shards[i])
-	}
+// ── Placement explanations ────────────────────────────────────────────────────
 
-	return shards
-}
+// explainPlacements records why the strategy placed each ID in shards, the
+// strategy's output before any overflow handling. Only IDs in explainIDs are
+// recorded unless it is empty. Reserved IDs are marked as reserved. Otherwise
+// rendezvous records every shard's weight for the ID, hash-ring records the
+// ID's ring hash and the point that claimed it, and the remaining strategies
+// record the ID's index in the distribution order.
+func explainPlacements(cfg *shardConfig, ids []string, reservations *shardReservations, shards [][]string, explainIDs []string) map[string]PlacementExplanation {
+	wanted := make(map[string]bool, len(explainIDs))
+	for _, id := range explainIDs {
+		wanted[id] = true
+	}
 
-// shardByPercentage distributes IDs according to specified percentages.
-// Target shard sizes are calculated against total ID count (after exclusions).
-// Reserved counts are subtracted from targets to maintain percentage accuracy.
-// The last shard receives any remainder from rounding.
-func shardByPercentage(ids []string, percentages []int, seed string, reservations *shardReservations) [][]string {
 	unreservedIDs := ids
-	totalIDs := len(ids)
-
+	reserved := make(map[string]bool)
 	if reservations != nil {
 		unreservedIDs = reservations.UnreservedIDs
-	}
-
-	shardCount := len(percentages)
-	shards := make([][]string, shardCount)
-
-	if len(unreservedIDs) == 0 {
-		return shards
-	}
-
-	distributionIDs := sortAndShuffleIfSeed(unreservedIDs, seed)
-
-	currentIndex := 0
-	for i, percentage := range percentages {
-		var shardSize int
-		if i == shardCount-1 {
-			shardSize = len(unreservedIDs) - currentIndex
-		} else {
-			shardSize = int(float64(totalIDs) * float64(percentage) / 100.0)
-			if reservations != nil {
-				shardSize -= reservations.CountsByShard[i]
+		for _, reservedIDs := range reservations.IDsByShard {
+			for _, id := range reservedIDs {
+				reserved[id] = true
 			}
 		}
-
-		if currentIndex+shardSize > len(unreservedIDs) {
-			shardSize = len(unreservedIDs) - currentIndex
-		}
-
-		if shardSize > 0 {
-			shards[i] = distributionIDs[currentIndex : currentIndex+shardSize]
-			currentIndex += shardSize
-		}
 	}
 
-	if reservations != nil {
-		for shardName, reservedIDs := range reservations.IDsByShard {
-			var idx int
-			fmt.Sscanf(shardName, "shard_%d", &idx)
-			shards[idx] = append(reservedIDs, shards[idx]...)
+	seed := strategySeed(cfg)
+	var distributionIndex map[string]int
+	switch cfg.Strategy {
+	case "round-robin", "percentage", "size", "balanced":
+		distributionIndex = make(map[string]int, len(unreservedIDs))
+		for i, id := range sharding.DistributionOrder(unreservedIDs, seed) {
+			distributionIndex[id] = i
 		}
 	}
-
-	for i := range shards {
-		sortIDsNumerically(shards[i])
+	var ring *sharding.Ring
+	if cfg.Strategy == "hash-ring" {
+		ring = sharding.NewRing(len(shards), cfg.VirtualNodes, seed)
 	}
 
-	return shards
-}
-
-// shardBySize distributes IDs according to specified absolute sizes.
-// A value of -1 in the last position means "all remaining IDs".
-// Reserved counts are subtracted from targets so the final shard size
-// (distributed + reserved) matches the requested size.
-func shardBySize(ids []string, sizes []int, seed string, reservations *shardReservations) [][]string {
-	unreservedIDs := ids
-	if reservations != nil {
-		unreservedIDs = reservations.UnreservedIDs
-	}
-
-	shardCount := len(sizes)
-	shards := make([][]string, shardCount)
-
-	if len(unreservedIDs) == 0 {
-		return shards
-	}
-
-	distributionIDs := sortAndShuffleIfSeed(unreservedIDs, seed)
-
-	currentIndex := 0
-	for i, size := range sizes {
-		var shardSize int
-
-		if size == -1 {
-			shardSize = len(unreservedIDs) - currentIndex
-		} else {
-			shardSize = size
-			if reservations != nil {
-				shardSize -= reservations.CountsByShard[i]
+	placements := make(map[string]PlacementExplanation)
+	for shardIdx, shard := range shards {
+		for _, id := range shard {
+			if len(wanted) > 0 && !wanted[id] {
+				continue
 			}
-			if currentIndex+shardSize > len(unreservedIDs) {
-				shardSize = len(unreservedIDs) - currentIndex
+			p := PlacementExplanation{Shard: shardName(cfg.ShardPrefix, shardIdx)}
+			switch {
+			case reserved[id]:
+				p.Reserved = true
+			case distributionIndex != nil:
+				index := distributionIndex[id]
+				p.DistributionIndex = &index
+			case cfg.Strategy == "rendezvous":
+				p.RendezvousWeights, p.RendezvousScores = rendezvousScores(id, len(shards), cfg.ShardWeights, seed, cfg.ShardPrefix)
+			case cfg.Strategy == "hash-ring":
+				h, point, _ := ring.Locate(id)
+				p.RingHash, p.RingPoint = &h, &point
 			}
-		}
-
-		if shardSize > 0 && currentIndex < len(unreservedIDs) {
-			shards[i] = distributionIDs[currentIndex : currentIndex+shardSize]
-			currentIndex += shardSize
-		} else {
-			shards[i] = []string{}
+			placements[id] = p
 		}
 	}
+	return placements
+}
 
-	if reservations != nil {
-		for shardName, reservedIDs := range reservations.IDsByShard {
-			var idx int
-			fmt.Sscanf(shardName, "shard_%d", &idx)
-			shards[idx] = append(reservedIDs, shards[idx]...)
+// rendezvousScores returns the 64-bit weight every shard scores for id and,
+// when weights applies, the weighted score compared in its place, keyed by
+// shard name under prefix.
+func rendezvousScores(id string, shardCount int, weights []float64, seed, prefix string) (map[string]uint64, map[string]float64) {
+	weights64, scores := sharding.RendezvousScores(id, shardCount, weights, seed)
+	raw := make(map[string]uint64, shardCount)
+	var scaled map[string]float64
+	if scores != nil {
+		scaled = make(map[string]float64, shardCount)
+	}
+	for shardIdx, weight := range weights64 {
+		name := shardName(prefix, shardIdx)
+		raw[name] = weight
+		if scaled != nil {
+			scaled[name] = scores[shardIdx]
 		}
 	}
-
-	for i := range shards {
-		sortIDsNumerically(shards[i])
-	}
-
-	return shards
+	return raw, scaled
 }
 
-// shardByRendezvous distributes IDs using Highest Random Weight (HRW) algorithm.
-// Always deterministic. Provides superior stability when shard count changes —
-// only ~1/n IDs move when a new shard is added.
-//
-// Algorithm: Rendezvous Hashing (Highest Random Weight Hashing)
-// Reference: https://en.wikipedia.org/wiki/Rendezvous_hashing
-// Original Paper: Thaler & Ravishankar (1998)
-func shardByRendezvous(ids []string, shardCount int, seed string, reservations *shardReservations) [][]string {
-	if shardCount <= 0 {
-		shardCount = 1
-	}
-
-	unreservedIDs := ids
-	if reservations != nil {
-		unreservedIDs = reservations.UnreservedIDs
-	}
-
-	shards := make([][]string, shardCount)
-	for i := range shardCount {
-		shards[i] = []string{}
-	}
-
-	for _, id := range unreservedIDs {
-		highestWeight := uint64(0)
-		selectedShard := 0
-
-		for shardIdx := range shardCount {
-			input := fmt.Sprintf("%s:shard_%d:%s", id, shardIdx, seed)
-			hash := sha256.Sum256([]byte(input))
-			weight := binary.BigEndian.Uint64(hash[:8])
-
-			if weight > highestWeight {
-				highestWeight = weight
-				selectedShard = shardIdx
+// markOverflowMoves updates placements for IDs that max_ids_per_shard moved
+// out of the shard the strategy chose, recording the original shard.
+func markOverflowMoves(placements map[string]PlacementExplanation, shards [][]string, prefix string) {
+	for shardIdx, shard := range shards {
+		name := shardName(prefix, shardIdx)
+		for _, id := range shard {
+			p, ok := placements[id]
+			if !ok || p.Shard == name {
+				continue
 			}
+			p.MovedFromShard, p.Shard = p.Shard, name
+			placements[id] = p
 		}
-
-		shards[selectedShard] = append(shards[selectedShard], id)
-	}
-
-	if reservations != nil {
-		for shardName, reservedIDs := range reservations.IDsByShard {
-			var idx int
-			fmt.Sscanf(shardName, "shard_%d", &idx)
-			shards[idx] = append(reservedIDs, shards[idx]...)
-		}
-	}
-
-	for i := range shards {
-		sortIDsNumerically(shards[i])
-	}
-
-	return shards
-}
-
-// sortAndShuffleIfSeed sorts IDs numerically, then shuffles deterministically
-// using the seed. Returns IDs unchanged (in API order) when seed is empty.
-func sortAndShuffleIfSeed(ids []string, seed string) []string {
-	if seed == "" {
-		return ids
 	}
-
-	sorted := make([]string, len(ids))
-	copy(sorted, ids)
-	sortIDsNumerically(sorted)
-	return shuffleIDs(sorted, seed)
-}
-
-// shuffleIDs performs a deterministic Fisher-Yates shuffle seeded from the
-// given string. Returns a new slice; the original is not mutated.
-//
-// Algorithm: Fisher-Yates shuffle (Knuth shuffle)
-// Reference: https://en.wikipedia.org/wiki/Fisher%E2%80%93Yates_shuffle
-func shuffleIDs(ids []string, seed string) []string {
-	rng := createSeededRNG(seed)
-	shuffled := make([]string, len(ids))
-	copy(shuffled, ids)
-
-	for i := len(shuffled) - 1; i > 0; i-- {
-		j := rng.Intn(i + 1)
-		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-	}
-
-	return shuffled
-}
-
-// createSeededRNG derives a deterministic *rand.Rand from a seed string by
-// hashing it with SHA-256 and reading the first 8 bytes as a uint64.
-func createSeededRNG(seed string) *rand.Rand {
-	hash := sha256.Sum256([]byte(seed))
-	seedValue := int64(binary.BigEndian.Uint64(hash[:8]))
-	return rand.New(rand.NewSource(seedValue))
-}
-
-// sortIDsNumerically sorts a string-ID slice by numeric value in-place.
-func sortIDsNumerically(ids []string) {
-	slices.SortFunc(ids, func(a, b string) int {
-		aInt, _ := strconv.Atoi(a)
-		bInt, _ := strconv.Atoi(b)
-		return aInt - bInt
-	})
 }
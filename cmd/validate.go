@@ -12,8 +12,14 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/deploymenttheory/go-jamf-guid-sharder/pkg/sharding"
 )
 
 var (
@@ -23,24 +29,88 @@ var (
 	// to group_id, exclude_ids elements, and reserved_ids value elements.
 	numericIDRe = regexp.MustCompile(`^\d+$`)
 
-	// shardNameRe matches the shard_N key format expected by reserved_ids.
-	// Equivalent to the mapvalidator.KeysAre(RegexMatches(^shard_\d+$)) rule.
-	shardNameRe = regexp.MustCompile(`^shard_\d+$`)
+	// namespacedIDRe matches the "<type>:<id>" IDs produced by namespace_ids.
+	namespacedIDRe = regexp.MustCompile(`^(computer|mobile_device|user):\d+$`)
+
+	// managementIDRe matches any non-empty ID. Management IDs are GUIDs, but
+	// their format is Jamf Pro's to define, so id_field 'management-id' only
+	// requires a value.
+	managementIDRe = regexp.MustCompile(`^\S+$`)
+
+	// shardPrefixRe matches the shard_prefix values that make safe shard
+	// names: they are used as map keys, file names, and YAML keys, and must
+	// not end in a digit so the index that follows can be read back.
+	shardPrefixRe = regexp.MustCompile(`^[A-Za-z0-9._-]*[A-Za-z._-]$`)
+
+	// seedNameRe matches the seeds that can name a file in output_dir.
+	seedNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// The accepted values of the enumerated settings. The validators check
+// against these, and the options command lists them.
+var (
+	validSourceTypes = []string{
+		"computer_inventory",
+		"mobile_device_inventory",
+		"computer_group_membership",
+		"mobile_device_group_membership",
+		"computer_prestage_scope",
+		"user_accounts",
+		"user_group_membership",
+		"raw_endpoint",
+	}
+	validStrategies    = []string{"round-robin", "percentage", "size", "rendezvous", "balanced", "hash-ring"}
+	validAuthMethods   = []string{"oauth2", "basic"}
+	validOutputFormats = []string{"json", "yaml", "ndjson", "json-detailed", "null"}
 )
 
 // validateShardConfig runs all validation rules and returns a combined error
 // listing every problem found. Callers receive the full picture in one pass
 // rather than having to fix-and-retry one issue at a time.
 func validateShardConfig(cfg *shardConfig) error {
+	return issuesError(shardConfigIssues(cfg))
+}
+
+// shardConfigIssues runs all validation rules and returns every issue found,
+// in rule order.
+func shardConfigIssues(cfg *shardConfig) []string {
 	var issues []string
 
 	validateAuth(cfg, &issues)
+	validateConnection(cfg, &issues)
 	validateSource(cfg, &issues)
+	validateRawEndpoint(cfg, &issues)
+	validateIDField(cfg, &issues)
+	validateSourceCache(cfg, &issues)
 	validateShardingParameters(cfg, &issues)
+	validateShardPrefix(cfg, &issues)
+	validateShardLimits(cfg, &issues)
 	validateIDFormats(cfg, &issues)
 	validateIDConflicts(cfg, &issues)
 	validateOutput(cfg, &issues)
 
+	return issues
+}
+
+// validateFetchConfig runs the subset of rules that apply to commands that
+// fetch a source but never shard it (analyze and count).
+func validateFetchConfig(cfg *shardConfig) error {
+	var issues []string
+
+	validateAuth(cfg, &issues)
+	validateConnection(cfg, &issues)
+	validateSource(cfg, &issues)
+	validateRawEndpoint(cfg, &issues)
+	validateIDField(cfg, &issues)
+	validateSourceCache(cfg, &issues)
+	validateIDFormats(cfg, &issues)
+
+	return issuesError(issues)
+}
+
+// issuesError combines collected validation issues into a single error, or
+// returns nil when there are none.
+func issuesError(issues []string) error {
 	if len(issues) == 0 {
 		return nil
 	}
@@ -56,8 +126,14 @@ func validateShardConfig(cfg *shardConfig) error {
 
 // validateAuth checks that a complete and consistent credential set is present.
 func validateAuth(cfg *shardConfig, issues *[]string) {
+	// A fixture stands in for Jamf Pro, so there is nothing to authenticate to.
+	if cfg.Fixture != "" {
+		return
+	}
 	if cfg.InstanceDomain == "" {
 		*issues = append(*issues, "instance_domain is required")
+	} else if _, err := normalizeInstanceDomain(cfg.InstanceDomain); err != nil {
+		*issues = append(*issues, err.Error())
 	}
 
 	switch cfg.AuthMethod {
@@ -86,49 +162,115 @@ func validateAuth(cfg *shardConfig, issues *[]string) {
 				"client_id / client_secret are set but auth_method is 'basic' — these fields are ignored; remove them or switch auth_method to 'oauth2'")
 		}
 	case "":
-		*issues = append(*issues, "auth_method is required: must be 'oauth2' or 'basic'")
+		*issues = append(*issues,
+			fmt.Sprintf("auth_method is required: must be one of %s", quotedList(validAuthMethods)))
 	default:
 		*issues = append(*issues,
-			fmt.Sprintf("auth_method %q is not valid: must be 'oauth2' or 'basic'", cfg.AuthMethod))
+			fmt.Sprintf("auth_method %q is not valid: must be one of %s", cfg.AuthMethod, quotedList(validAuthMethods)))
+	}
+}
+
+// ── Connection ────────────────────────────────────────────────────────────────
+
+// validateConnection checks the limits placed on talking to Jamf Pro.
+func validateConnection(cfg *shardConfig, issues *[]string) {
+	if cfg.CustomTimeoutMs < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("custom_timeout_milliseconds must not be negative, got %d", cfg.CustomTimeoutMs))
+	} else if requestTimeout(cfg) <= 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("the per-request timeout must be positive — set custom_timeout_seconds (got %d) "+
+				"or custom_timeout_milliseconds", cfg.CustomTimeout))
+	}
+
+	if cfg.RunTimeout < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("run_timeout must not be negative, got %s (0 means no limit)", cfg.RunTimeout))
+	}
+	if cfg.SourceTimeout < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("source_timeout must not be negative, got %s (0 means no limit)", cfg.SourceTimeout))
+	}
+
+	if cfg.FetchPageRetries < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("fetch_page_retries must not be negative, got %d", cfg.FetchPageRetries))
+	}
+
+	validateProxyURL("http_proxy", cfg.HTTPProxy, issues)
+	validateProxyURL("https_proxy", cfg.HTTPSProxy, issues)
+}
+
+// validateProxyURL checks that a proxy setting, when set, is an absolute
+// http, https, or socks5 URL, so a typo fails here rather than on the first
+// request.
+func validateProxyURL(key, value string, issues *[]string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		*issues = append(*issues, fmt.Sprintf("%s %q is not a valid URL: %v", key, value, err))
+		return
+	}
+	if !slices.Contains([]string{"http", "https", "socks5"}, u.Scheme) || u.Host == "" {
+		*issues = append(*issues,
+			fmt.Sprintf("%s must be an http://, https://, or socks5:// URL with a host, got %q", key, value))
 	}
 }
 
 // ── Source type ───────────────────────────────────────────────────────────────
 
-// validateSource checks source_type membership and group_id requirements.
+// validateSource checks source_type membership and the group_id and
+// prestage_id requirements.
+// source_type may list several sources; object types can only be mixed with
+// namespace_ids set, and at most one group source may be listed.
 //
 // Terraform equivalents:
 //   - stringvalidator.OneOf on source_type
 //   - validate.RequiredWhenOneOf("source_type", "computer_group_membership", …) on group_id
 //   - stringvalidator.RegexMatches(^\d+$) on group_id
+//   - validate.RequiredWhenOneOf("source_type", "computer_prestage_scope") on prestage_id
+//   - stringvalidator.RegexMatches(^\d+$) on prestage_id
 func validateSource(cfg *shardConfig, issues *[]string) {
-	validSources := []string{
-		"computer_inventory",
-		"mobile_device_inventory",
-		"computer_group_membership",
-		"mobile_device_group_membership",
-		"user_accounts",
-	}
-
-	sourceValid := false
-	for _, s := range validSources {
-		if cfg.SourceType == s {
-			sourceValid = true
-			break
-		}
+	// source_type may list several sources, comma-separated.
+	sources := sourceTypes(cfg.SourceType)
+	sourceValid := len(sources) > 0
+	if len(sources) == 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("source_type is required: must be one of %s", quotedList(validSourceTypes)))
 	}
-	if !sourceValid {
-		if cfg.SourceType == "" {
-			*issues = append(*issues,
-				fmt.Sprintf("source_type is required: must be one of %s", quotedList(validSources)))
-		} else {
+	groupSources := 0
+	namespaces := make(map[string]bool)
+	for i, source := range sources {
+		if !slices.Contains(validSourceTypes, source) {
 			*issues = append(*issues,
-				fmt.Sprintf("source_type %q is not valid: must be one of %s", cfg.SourceType, quotedList(validSources)))
+				fmt.Sprintf("source_type %q is not valid: must be one of %s", source, quotedList(validSourceTypes)))
+			sourceValid = false
+			continue
+		}
+		if slices.Contains(sources[:i], source) {
+			*issues = append(*issues, fmt.Sprintf("source_type lists %q more than once", source))
+		}
+		if strings.HasSuffix(source, "_group_membership") {
+			groupSources++
+		}
+		if ns, ok := idNamespaces[source]; ok {
+			namespaces[ns] = true
 		}
 	}
+	if groupSources > 1 {
+		*issues = append(*issues,
+			"source_type lists more than one *_group_membership source, but group_id names a single group")
+	}
+	// Computer, mobile device, and user IDs are numbered independently.
+	if len(namespaces) > 1 && !cfg.NamespaceIDs {
+		*issues = append(*issues,
+			fmt.Sprintf("source_type %q combines different object types whose IDs can collide — "+
+				"set namespace_ids to prefix each ID with its type (e.g. \"computer:101\")", cfg.SourceType))
+	}
 
-	groupRequired := cfg.SourceType == "computer_group_membership" ||
-		cfg.SourceType == "mobile_device_group_membership"
+	groupRequired := groupSources > 0
 
 	if groupRequired && cfg.GroupID == "" {
 		*issues = append(*issues,
@@ -145,12 +287,162 @@ func validateSource(cfg *shardConfig, issues *[]string) {
 		if !groupRequired && sourceValid {
 			*issues = append(*issues,
 				fmt.Sprintf("group_id is set (%q) but source_type %q does not use a group — "+
-					"set source_type to 'computer_group_membership' or 'mobile_device_group_membership', "+
-					"or remove group_id", cfg.GroupID, cfg.SourceType))
+					"set source_type to 'computer_group_membership', 'mobile_device_group_membership', "+
+					"or 'user_group_membership', or remove group_id", cfg.GroupID, cfg.SourceType))
+		}
+	}
+
+	prestageRequired := slices.Contains(sources, "computer_prestage_scope")
+
+	if prestageRequired && cfg.PrestageID == "" {
+		*issues = append(*issues,
+			fmt.Sprintf("prestage_id is required when source_type is %q", cfg.SourceType))
+	}
+
+	if cfg.PrestageID != "" {
+		if !numericIDRe.MatchString(cfg.PrestageID) {
+			*issues = append(*issues,
+				fmt.Sprintf("prestage_id %q must be a numeric ID (e.g. \"3\")", cfg.PrestageID))
+		}
+		if !prestageRequired && sourceValid {
+			*issues = append(*issues,
+				fmt.Sprintf("prestage_id is set (%q) but source_type %q does not use a prestage — "+
+					"set source_type to 'computer_prestage_scope', or remove prestage_id", cfg.PrestageID, cfg.SourceType))
+		}
+	}
+
+	if cfg.SiteID != "" {
+		if !numericIDRe.MatchString(cfg.SiteID) {
+			*issues = append(*issues,
+				fmt.Sprintf("site_id %q must be a numeric ID (e.g. \"1\")", cfg.SiteID))
+		}
+		// Users, and whatever a raw endpoint returns, are not assigned to
+		// sites.
+		for _, source := range sources {
+			if ns := idNamespaces[source]; ns != "computer" && ns != "mobile_device" && slices.Contains(validSourceTypes, source) {
+				*issues = append(*issues,
+					fmt.Sprintf("site_id is set but source_type %q is not a device source — "+
+						"site filtering applies to computer and mobile device sources only", source))
+			}
+		}
+	}
+
+	// Department and building only exist in computer inventory records.
+	computerSource := !slices.ContainsFunc(sources, func(s string) bool {
+		return idNamespaces[s] != "computer"
+	})
+	if sourceValid && !computerSource {
+		if cfg.FilterDepartment != "" {
+			*issues = append(*issues,
+				fmt.Sprintf("filter_department is set but source_type %q is not a computer source — "+
+					"filters apply to 'computer_inventory' and 'computer_group_membership' only", cfg.SourceType))
+		}
+		if cfg.FilterBuilding != "" {
+			*issues = append(*issues,
+				fmt.Sprintf("filter_building is set but source_type %q is not a computer source — "+
+					"filters apply to 'computer_inventory' and 'computer_group_membership' only", cfg.SourceType))
+		}
+	}
+
+	// Site and location filters read inventory records, which a fixture
+	// does not have.
+	if cfg.Fixture != "" {
+		for _, key := range []struct{ name, value string }{
+			{"site_id", cfg.SiteID},
+			{"filter_department", cfg.FilterDepartment},
+			{"filter_building", cfg.FilterBuilding},
+		} {
+			if key.value != "" {
+				*issues = append(*issues,
+					fmt.Sprintf("%s cannot be combined with fixture — a fixture holds IDs only, not inventory records", key.name))
+			}
 		}
 	}
 }
 
+// validateRawEndpoint checks raw_path and raw_id_jsonpath, which
+// source_type raw_endpoint requires and no other source uses. raw_path must
+// be a path on the Jamf Pro instance, so the client's credentials are never
+// sent to another host. A raw endpoint's IDs have no known object type, so
+// it cannot be combined with other sources or namespace_ids.
+func validateRawEndpoint(cfg *shardConfig, issues *[]string) {
+	sources := sourceTypes(cfg.SourceType)
+	if !slices.Contains(sources, "raw_endpoint") {
+		for _, key := range []struct{ name, value string }{
+			{"raw_path", cfg.RawPath},
+			{"raw_id_jsonpath", cfg.RawIDJSONPath},
+		} {
+			if key.value != "" {
+				*issues = append(*issues,
+					fmt.Sprintf("%s is set but source_type %q does not use it — "+
+						"set source_type to 'raw_endpoint', or remove %s", key.name, cfg.SourceType, key.name))
+			}
+		}
+		return
+	}
+
+	if len(sources) > 1 {
+		*issues = append(*issues,
+			fmt.Sprintf("source_type %q combines raw_endpoint with other sources — "+
+				"a raw endpoint's IDs have no known object type, so it must be the only source", cfg.SourceType))
+	}
+	if cfg.NamespaceIDs {
+		*issues = append(*issues,
+			"namespace_ids cannot be combined with source_type 'raw_endpoint' — a raw endpoint's IDs have no known object type")
+	}
+
+	if cfg.RawPath == "" {
+		*issues = append(*issues, "raw_path is required when source_type is \"raw_endpoint\"")
+	} else if u, err := url.Parse(cfg.RawPath); err != nil || u.Scheme != "" || u.Host != "" ||
+		!strings.HasPrefix(cfg.RawPath, "/") || strings.HasPrefix(cfg.RawPath, "//") {
+		*issues = append(*issues,
+			fmt.Sprintf("raw_path %q must be an API path on the Jamf Pro instance, e.g. \"/api/v1/departments\"", cfg.RawPath))
+	}
+
+	if cfg.RawIDJSONPath == "" {
+		*issues = append(*issues, "raw_id_jsonpath is required when source_type is \"raw_endpoint\"")
+	} else if _, err := parseJSONPath(cfg.RawIDJSONPath); err != nil {
+		*issues = append(*issues,
+			fmt.Sprintf("raw_id_jsonpath %q is not valid: %v", cfg.RawIDJSONPath, err))
+	}
+}
+
+// validateIDField checks id_field. Management IDs are only read from computer
+// inventory records, and are GUIDs, so they cannot take a namespace prefix.
+func validateIDField(cfg *shardConfig, issues *[]string) {
+	validIDFields := []string{"jamf-id", "management-id"}
+	if cfg.IDField != "" && !slices.Contains(validIDFields, cfg.IDField) {
+		*issues = append(*issues,
+			fmt.Sprintf("id_field %q is not valid: must be one of %s", cfg.IDField, quotedList(validIDFields)))
+		return
+	}
+	if cfg.IDField != "management-id" {
+		return
+	}
+	if cfg.SourceType != "computer_inventory" {
+		*issues = append(*issues,
+			fmt.Sprintf("id_field 'management-id' requires source_type 'computer_inventory', got %q", cfg.SourceType))
+	}
+	if cfg.NamespaceIDs {
+		*issues = append(*issues,
+			"id_field 'management-id' cannot be combined with namespace_ids — management IDs are GUIDs and need no type prefix")
+	}
+}
+
+// validateSourceCache checks the cache_ids settings.
+func validateSourceCache(cfg *shardConfig, issues *[]string) {
+	if cfg.CacheIDs == "" {
+		if cfg.RefreshCache {
+			*issues = append(*issues, "refresh_cache is set but cache_ids is not — set cache_ids to the cache file to refresh")
+		}
+		return
+	}
+	if cfg.CacheTTL <= 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("cache_ttl must be positive when cache_ids is set, got %s", cfg.CacheTTL))
+	}
+}
+
 // ── Sharding parameters ───────────────────────────────────────────────────────
 
 // validateShardingParameters enforces the ExactlyOneOf constraint between
@@ -189,7 +481,6 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 	}
 
 	// ── Strategy validation ───────────────────────────────────────────────────
-	validStrategies := []string{"round-robin", "percentage", "size", "rendezvous"}
 	strategyValid := false
 	for _, s := range validStrategies {
 		if cfg.Strategy == s {
@@ -212,7 +503,7 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 	// ── Strategy ↔ parameter compatibility ───────────────────────────────────
 	// validate.Int64RequiredWhenOneOf / validate.ListRequiredWhenEquals
 	switch cfg.Strategy {
-	case "round-robin", "rendezvous":
+	case "round-robin", "rendezvous", "balanced", "hash-ring":
 		if !hasCount {
 			*issues = append(*issues,
 				fmt.Sprintf("strategy %q requires shard_count — use shard_count, not shard_percentages or shard_sizes",
@@ -236,7 +527,7 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 		}
 		if hasCount {
 			*issues = append(*issues,
-				"shard_count is set but strategy is 'percentage' — shard_count is only valid with strategies 'round-robin' or 'rendezvous'")
+				"shard_count is set but strategy is 'percentage' — shard_count is only valid with strategies 'round-robin', 'rendezvous', 'balanced', or 'hash-ring'")
 		}
 		if hasSizes {
 			*issues = append(*issues,
@@ -250,12 +541,20 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 		}
 		if hasCount {
 			*issues = append(*issues,
-				"shard_count is set but strategy is 'size' — shard_count is only valid with strategies 'round-robin' or 'rendezvous'")
+				"shard_count is set but strategy is 'size' — shard_count is only valid with strategies 'round-robin', 'rendezvous', 'balanced', or 'hash-ring'")
 		}
 		if hasPct {
 			*issues = append(*issues,
 				"shard_percentages is set but strategy is 'size' — shard_percentages is only valid with strategy 'percentage'")
 		}
+		if cfg.AutoShards && (len(cfg.ShardSizes) != 1 || cfg.ShardSizes[0] < 1) {
+			*issues = append(*issues,
+				fmt.Sprintf("auto_shards requires exactly one positive shard_sizes value, e.g. [500], got %v", cfg.ShardSizes))
+		}
+	}
+	if cfg.AutoShards && cfg.Strategy != "size" {
+		*issues = append(*issues,
+			fmt.Sprintf("auto_shards is set but strategy is %q — auto_shards is only valid with strategy 'size'", cfg.Strategy))
 	}
 
 	// ── shard_count internal constraints ─────────────────────────────────────
@@ -271,19 +570,165 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 		for i, p := range cfg.ShardPercentages {
 			if p < 0 {
 				*issues = append(*issues,
-					fmt.Sprintf("shard_percentages[%d] is %d — each percentage must be >= 0", i, p))
+					fmt.Sprintf("shard_percentages[%d] is %g — each percentage must be >= 0", i, p))
 			}
 		}
-		// validate.ListInt64SumEquals(100)
-		sum := 0
+		// validate.ListInt64SumEquals(100), relaxed to <= 100 by allow_partial.
+		// Percentages may be fractional, so the sum is compared within
+		// sharding.PercentageSumTolerance.
+		sum := 0.0
 		for _, p := range cfg.ShardPercentages {
 			sum += p
 		}
-		if sum != 100 {
+		switch {
+		case cfg.AllowPartial && sum > 100+sharding.PercentageSumTolerance:
 			*issues = append(*issues,
-				fmt.Sprintf("shard_percentages must sum to exactly 100, got %d (%v)", sum, cfg.ShardPercentages))
+				fmt.Sprintf("shard_percentages must sum to at most 100 with allow_partial, got %g (%v)", sum, cfg.ShardPercentages))
+		case !cfg.AllowPartial && math.Abs(sum-100) > sharding.PercentageSumTolerance:
+			*issues = append(*issues,
+				fmt.Sprintf("shard_percentages must sum to exactly 100, got %g (%v) — "+
+					"set allow_partial to leave the remainder undistributed", sum, cfg.ShardPercentages))
 		}
 	}
+	if cfg.AllowPartial && cfg.Strategy != "percentage" {
+		*issues = append(*issues,
+			fmt.Sprintf("allow_partial is set but strategy is %q — allow_partial is only valid with strategy 'percentage'",
+				cfg.Strategy))
+	}
+	if cfg.BalanceReserved && cfg.Strategy != "percentage" {
+		*issues = append(*issues,
+			fmt.Sprintf("balance_after_reservations is set but strategy is %q — balance_after_reservations is only valid with strategy 'percentage'",
+				cfg.Strategy))
+	}
+
+	// ── shard_weights constraints ────────────────────────────────────────────
+	if len(cfg.ShardWeights) > 0 {
+		if cfg.Strategy != "rendezvous" {
+			*issues = append(*issues,
+				fmt.Sprintf("shard_weights is set but strategy is %q — shard_weights is only valid with strategy 'rendezvous'",
+					cfg.Strategy))
+		} else if hasCount && len(cfg.ShardWeights) != cfg.ShardCount {
+			*issues = append(*issues,
+				fmt.Sprintf("shard_weights has %d element(s) but shard_count is %d — provide exactly one weight per shard",
+					len(cfg.ShardWeights), cfg.ShardCount))
+		}
+		for i, w := range cfg.ShardWeights {
+			if w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+				*issues = append(*issues,
+					fmt.Sprintf("shard_weights[%d] is %v — each weight must be a finite number > 0", i, w))
+			}
+		}
+	}
+
+	// ── round_robin_offset constraints ───────────────────────────────────────
+	if cfg.RoundRobinOffset < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("round_robin_offset must be >= 0, got %d", cfg.RoundRobinOffset))
+	}
+	if cfg.Strategy != "round-robin" && cfg.RoundRobinOffset != 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("round_robin_offset is set but strategy is %q — round_robin_offset is only valid with strategy 'round-robin'",
+				cfg.Strategy))
+	}
+
+	// ── virtual_nodes constraints ────────────────────────────────────────────
+	if cfg.Strategy == "hash-ring" && cfg.VirtualNodes < 1 {
+		*issues = append(*issues,
+			fmt.Sprintf("strategy 'hash-ring' requires virtual_nodes of at least 1, got %d", cfg.VirtualNodes))
+	}
+	if cfg.Strategy != "hash-ring" && cfg.VirtualNodes != 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("virtual_nodes is set but strategy is %q — virtual_nodes is only valid with strategy 'hash-ring'",
+				cfg.Strategy))
+	}
+
+	// ── parallel constraints ─────────────────────────────────────────────────
+	if cfg.Parallel && cfg.Strategy != "rendezvous" {
+		*issues = append(*issues,
+			fmt.Sprintf("parallel is set but strategy is %q — parallel is only valid with strategy 'rendezvous'",
+				cfg.Strategy))
+	}
+
+	// ── seed_salt constraints ────────────────────────────────────────────────
+	if cfg.SeedSalt != "" && cfg.Seed == "" && len(cfg.Seeds) == 0 {
+		*issues = append(*issues,
+			"seed_salt is set but seed is empty — set seed, seed_file, or seeds for the salt to apply to")
+	}
+
+	// ── seeds constraints ────────────────────────────────────────────────────
+	// Each seed names its own output file in output_dir.
+	if len(cfg.Seeds) > 0 {
+		if cfg.Seed != "" || cfg.SeedFile != "" {
+			*issues = append(*issues,
+				"seeds cannot be combined with seed or seed_file — list every seed to run in seeds")
+		}
+		if cfg.OutputDir == "" {
+			*issues = append(*issues, "seeds requires output_dir — each seed's result is written to <seed>.<format> there")
+		}
+		if cfg.PrintHashOnly {
+			*issues = append(*issues, "seeds cannot be combined with print_hash_only — each seed's result_hash is logged to stderr")
+		}
+		seen := make(map[string]bool, len(cfg.Seeds))
+		for i, seed := range cfg.Seeds {
+			switch {
+			case !seedNameRe.MatchString(seed) || seed == "." || seed == "..":
+				*issues = append(*issues,
+					fmt.Sprintf("seeds[%d] %q is not valid — seeds may only contain letters, digits, '.', '_', and '-'", i, seed))
+			case seen[seed]:
+				*issues = append(*issues, fmt.Sprintf("seeds[%d] %q is listed more than once", i, seed))
+			}
+			seen[seed] = true
+		}
+	}
+
+	// ── per_shard_seeds constraints ──────────────────────────────────────────
+	// With auto_shards the shard count is only known once the IDs are fetched.
+	shardCount := resolveShardCount(cfg)
+	if cfg.AutoShards {
+		shardCount = 0
+	}
+	for _, key := range slices.Sorted(maps.Keys(cfg.PerShardSeeds)) {
+		if index, ok := parseShardName(key, cfg.ShardPrefix); !ok {
+			*issues = append(*issues,
+				fmt.Sprintf("per_shard_seeds key %q is not valid — keys must be in the format %s", key, shardNameFormat(cfg)))
+		} else if shardCount > 0 && index >= shardCount {
+			*issues = append(*issues,
+				fmt.Sprintf("per_shard_seeds key %q is out of range: with %d shard(s), valid names are %s to %s",
+					key, shardCount, shardName(cfg.ShardPrefix, 0), shardName(cfg.ShardPrefix, shardCount-1)))
+		}
+		if cfg.PerShardSeeds[key] == "" {
+			*issues = append(*issues, fmt.Sprintf("per_shard_seeds[%q] must not be empty", key))
+		}
+	}
+	if len(cfg.PerShardSeeds) > 0 && cfg.SortOrder != "" && cfg.SortOrder != "numeric-asc" {
+		*issues = append(*issues,
+			fmt.Sprintf("per_shard_seeds cannot be combined with sort_order %q — the seeded shards are shuffled, not sorted",
+				cfg.SortOrder))
+	}
+
+	// ── sample constraints ───────────────────────────────────────────────────
+	if cfg.SampleSize < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("sample_size must be >= 0 (0 = no sampling), got %d", cfg.SampleSize))
+	}
+	if cfg.SampleSeed != "" && cfg.SampleSize == 0 {
+		*issues = append(*issues,
+			"sample_seed is set but sample_size is 0 — set sample_size for the seed to apply to")
+	}
+
+	// ── holdback constraints ─────────────────────────────────────────────────
+	if cfg.HoldbackPercent < 0 || cfg.HoldbackPercent >= 100 {
+		*issues = append(*issues,
+			fmt.Sprintf("holdback_percentage must be >= 0 and < 100, got %g", cfg.HoldbackPercent))
+	}
+	if cfg.HoldbackPercent > 0 && cfg.HoldbackSeed == "" {
+		*issues = append(*issues,
+			"holdback_seed is required when holdback_percentage is set — the seed selects which IDs are held back")
+	}
+	if cfg.HoldbackSeed != "" && cfg.HoldbackPercent == 0 {
+		*issues = append(*issues,
+			"holdback_seed is set but holdback_percentage is 0 — set holdback_percentage for the seed to apply to")
+	}
 
 	// ── shard_sizes internal constraints ─────────────────────────────────────
 	if hasSizes {
@@ -303,30 +748,96 @@ func validateShardingParameters(cfg *shardConfig, issues *[]string) {
 	}
 }
 
+// validateShardPrefix checks shard_prefix. Shard names become map keys in
+// JSON and YAML, file names in output_dir, and settings keys such as
+// reserved_ids, so the prefix is limited to characters safe in all of them.
+func validateShardPrefix(cfg *shardConfig, issues *[]string) {
+	if cfg.ShardPrefix != "" && !shardPrefixRe.MatchString(cfg.ShardPrefix) {
+		*issues = append(*issues,
+			fmt.Sprintf("shard_prefix %q is not valid — use letters, digits, '_', '-', or '.', "+
+				"not ending in a digit (e.g. \"wave_\")", cfg.ShardPrefix))
+	}
+}
+
+// ── Shard size limits ─────────────────────────────────────────────────────────
+
+// validateShardLimits checks max_ids_per_shard and the overflow policy that
+// governs what happens when a shard exceeds it, and min_shard_size.
+func validateShardLimits(cfg *shardConfig, issues *[]string) {
+	if cfg.MaxIDsPerShard < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("max_ids_per_shard must be >= 0 (0 = unlimited), got %d", cfg.MaxIDsPerShard))
+	}
+
+	if cfg.MinShardSize < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("min_shard_size must be >= 0 (0 = no minimum), got %d", cfg.MinShardSize))
+	}
+	if cfg.MaxIDsPerShard > 0 && cfg.MinShardSize > cfg.MaxIDsPerShard {
+		*issues = append(*issues,
+			fmt.Sprintf("min_shard_size (%d) is greater than max_ids_per_shard (%d) — no shard could satisfy both",
+				cfg.MinShardSize, cfg.MaxIDsPerShard))
+	}
+	if cfg.FailOnUndersized && cfg.MinShardSize == 0 {
+		*issues = append(*issues, "fail_on_undersized is set but min_shard_size is not — set min_shard_size")
+	}
+
+	validPolicies := []string{"error", "spill", "new-shard"}
+	if cfg.OverflowPolicy != "" && !slices.Contains(validPolicies, cfg.OverflowPolicy) {
+		*issues = append(*issues,
+			fmt.Sprintf("overflow_policy %q is not valid: must be one of %s", cfg.OverflowPolicy, quotedList(validPolicies)))
+	}
+}
+
 // ── ID format validation ──────────────────────────────────────────────────────
 
 // validateIDFormats checks that every ID-like field contains only numeric
 // values, matching the RegexMatches(^\d+$) validators in the Terraform schema.
 func validateIDFormats(cfg *shardConfig, issues *[]string) {
+	// With namespace_ids, every ID carries its type prefix.
+	idRe, example := numericIDRe, `a numeric ID (e.g. "42")`
+	switch {
+	case cfg.IDField == "management-id":
+		idRe, example = managementIDRe, `a non-empty management ID`
+	case cfg.NamespaceIDs:
+		idRe, example = namespacedIDRe, `a namespaced ID (e.g. "computer:42")`
+	}
+
 	// exclude_ids — each element must be a numeric string.
 	for i, id := range cfg.ExcludeIDs {
-		if !numericIDRe.MatchString(id) {
+		if !idRe.MatchString(id) {
+			*issues = append(*issues,
+				fmt.Sprintf("exclude_ids[%d] %q must be %s", i, id, example))
+		}
+	}
+
+	// exclude_id_pattern — must be a valid regular expression.
+	if cfg.ExcludeIDPattern != "" {
+		if _, err := regexp.Compile(cfg.ExcludeIDPattern); err != nil {
+			*issues = append(*issues,
+				fmt.Sprintf("exclude_id_pattern %q is not a valid regular expression: %v", cfg.ExcludeIDPattern, err))
+		}
+	}
+
+	// explain_ids — same format as exclude_ids.
+	for i, id := range cfg.ExplainIDs {
+		if !idRe.MatchString(id) {
 			*issues = append(*issues,
-				fmt.Sprintf("exclude_ids[%d] %q must be a numeric ID (e.g. \"42\")", i, id))
+				fmt.Sprintf("explain_ids[%d] %q must be %s", i, id, example))
 		}
 	}
 
-	// reserved_ids keys — must match shard_N format.
+	// reserved_ids keys — must match the shard_prefix + N format.
 	// reserved_ids values — each ID in each list must be numeric.
 	for key, ids := range cfg.ReservedIDs {
-		if !shardNameRe.MatchString(key) {
+		if _, ok := parseShardName(key, cfg.ShardPrefix); !ok {
 			*issues = append(*issues,
-				fmt.Sprintf("reserved_ids key %q is not valid — keys must be in the format 'shard_0', 'shard_1', etc.", key))
+				fmt.Sprintf("reserved_ids key %q is not valid — keys must be in the format %s", key, shardNameFormat(cfg)))
 		}
 		for i, id := range ids {
-			if !numericIDRe.MatchString(id) {
+			if !idRe.MatchString(id) {
 				*issues = append(*issues,
-					fmt.Sprintf("reserved_ids[%q][%d] %q must be a numeric ID (e.g. \"42\")", key, i, id))
+					fmt.Sprintf("reserved_ids[%q][%d] %q must be %s", key, i, id, example))
 			}
 		}
 	}
@@ -380,18 +891,188 @@ func validateIDConflicts(cfg *shardConfig, issues *[]string) {
 
 // validateOutput checks that the output configuration is consistent.
 func validateOutput(cfg *shardConfig, issues *[]string) {
-	if cfg.OutputFormat != "json" && cfg.OutputFormat != "yaml" {
+	formatValid := false
+	for _, f := range validOutputFormats {
+		if cfg.OutputFormat == f {
+			formatValid = true
+			break
+		}
+	}
+	if !formatValid {
 		if cfg.OutputFormat == "" {
-			*issues = append(*issues, "output_format is required: must be 'json' or 'yaml'")
+			*issues = append(*issues,
+				fmt.Sprintf("output_format is required: must be one of %s", quotedList(validOutputFormats)))
 		} else {
 			*issues = append(*issues,
-				fmt.Sprintf("output_format %q is not valid: must be 'json' or 'yaml'", cfg.OutputFormat))
+				fmt.Sprintf("output_format %q is not valid: must be one of %s", cfg.OutputFormat, quotedList(validOutputFormats)))
+		}
+	}
+
+	if cfg.SelectShard != "" {
+		validateOutputShardName(cfg, "select_shard", cfg.SelectShard, issues)
+		if cfg.OutputFormat != "json" && cfg.OutputFormat != "yaml" {
+			*issues = append(*issues,
+				fmt.Sprintf("select_shard requires output_format 'json' or 'yaml', got %q", cfg.OutputFormat))
+		}
+		if cfg.OutputDir != "" {
+			*issues = append(*issues, "select_shard cannot be combined with output_dir — use output_file or stdout")
+		}
+		if cfg.PrintHashOnly {
+			*issues = append(*issues, "select_shard cannot be combined with print_hash_only")
+		}
+	}
+
+	for _, name := range cfg.OnlyShards {
+		validateOutputShardName(cfg, "only_shards", name, issues)
+	}
+	if len(cfg.OnlyShards) > 0 && cfg.SelectShard != "" {
+		*issues = append(*issues, "only_shards cannot be combined with select_shard — list the one shard in only_shards, or drop it")
+	}
+
+	// Labels may name shards that overflow or auto_shards add at run time.
+	for _, name := range slices.Sorted(maps.Keys(cfg.ShardLabels)) {
+		if _, ok := parseShardName(name, cfg.ShardPrefix); !ok {
+			*issues = append(*issues,
+				fmt.Sprintf("shard_labels key %q is not valid — keys must be in the format %s", name, shardNameFormat(cfg)))
+		}
+	}
+
+	if cfg.PreviewCount < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("preview_count must not be negative, got %d (0 outputs every ID)", cfg.PreviewCount))
+	}
+	if cfg.PreviewCount > 0 && cfg.OutputDir != "" {
+		*issues = append(*issues, "preview_count cannot be combined with output_dir — per-shard files must be complete")
+	}
+
+	// Only the inventory sources report whether a device is managed.
+	if cfg.OutputFormat == "json-detailed" {
+		inventoryOnly := !slices.ContainsFunc(sourceTypes(cfg.SourceType), func(s string) bool {
+			return s != "computer_inventory" && s != "mobile_device_inventory"
+		})
+		if !inventoryOnly {
+			*issues = append(*issues,
+				fmt.Sprintf("output_format 'json-detailed' requires source_type 'computer_inventory' or "+
+					"'mobile_device_inventory', got %q", cfg.SourceType))
+		}
+		if cfg.OutputDir != "" {
+			*issues = append(*issues,
+				"output_format 'json-detailed' cannot be combined with output_dir — use output_file or stdout")
 		}
 	}
+
+	if _, err := parseOutputFileMode(cfg.OutputFileMode); err != nil {
+		*issues = append(*issues, err.Error())
+	}
+	if cfg.AtomicWrite && cfg.OutputFile == "" && cfg.OutputDir == "" {
+		*issues = append(*issues, "atomic_write requires output_file or output_dir — stdout is not written atomically")
+	}
+	if u := objectURL(cfg.OutputFile); u != nil {
+		if err := validateObjectURL("output_file", u); err != nil {
+			*issues = append(*issues, err.Error())
+		}
+		if cfg.AtomicWrite {
+			*issues = append(*issues,
+				fmt.Sprintf("atomic_write cannot be combined with output_file %q — uploads are already all-or-nothing", cfg.OutputFile))
+		}
+	}
+	if objectURL(cfg.OutputDir) != nil {
+		*issues = append(*issues,
+			fmt.Sprintf("output_dir %q is not a local directory — object storage URLs are only supported for output_file", cfg.OutputDir))
+	}
+
+	if cfg.OutputFile != "" && cfg.OutputDir != "" {
+		*issues = append(*issues,
+			"output_file and output_dir are mutually exclusive — set one or the other")
+	}
+	if cfg.OutputFormat == "null" && (cfg.OutputFile != "" || cfg.OutputDir != "") {
+		*issues = append(*issues,
+			"output_format 'null' discards the result — it cannot be combined with output_file or output_dir")
+	}
+	// Template errors depend only on the tokens used, not on their values.
+	if _, err := expandOutputFile(cfg.OutputFile, &ShardMetadata{}); err != nil {
+		*issues = append(*issues, err.Error())
+	}
+
+	// Explanations are carried in the result document, which ndjson and
+	// output_dir split apart.
+	if cfg.Explain {
+		if cfg.OutputFormat == "ndjson" {
+			*issues = append(*issues,
+				"explain cannot be combined with output_format 'ndjson' — use 'json', 'yaml', or 'json-detailed'")
+		}
+		if cfg.OutputDir != "" {
+			*issues = append(*issues,
+				"explain cannot be combined with output_dir — use output_file or stdout")
+		}
+	}
+	if len(cfg.ExplainIDs) > 0 && !cfg.Explain {
+		*issues = append(*issues, "explain_ids is set but explain is not — set explain to record placements")
+	}
+
+	// Names are only carried by the per-ID entries of json-detailed output.
+	if cfg.IncludeNames && cfg.OutputFormat != "json-detailed" {
+		*issues = append(*issues,
+			fmt.Sprintf("include_names requires output_format 'json-detailed', got %q", cfg.OutputFormat))
+	}
+
+	if cfg.YAMLHeader && cfg.OutputFormat != "yaml" {
+		*issues = append(*issues,
+			fmt.Sprintf("yaml_header requires output_format 'yaml', got %q", cfg.OutputFormat))
+	}
+
+	if cfg.ExpiresIn < 0 {
+		*issues = append(*issues,
+			fmt.Sprintf("expires_in must be >= 0 (0 = never), got %s", cfg.ExpiresIn))
+	}
+	if cfg.Canonical && cfg.ExpiresIn > 0 {
+		*issues = append(*issues,
+			"canonical cannot be combined with expires_in — expires_at changes on every run")
+	}
+
+	validShardOrders := []string{"index", "size-desc", "size-asc"}
+	if cfg.ShardOrder != "" && !slices.Contains(validShardOrders, cfg.ShardOrder) {
+		*issues = append(*issues,
+			fmt.Sprintf("shard_order %q is not valid: must be one of %s", cfg.ShardOrder, quotedList(validShardOrders)))
+	}
+	// Placements name shards in the strategy's numbering, in more places
+	// than the output can rename.
+	if cfg.Explain && cfg.ShardOrder != "" && cfg.ShardOrder != "index" {
+		*issues = append(*issues,
+			fmt.Sprintf("shard_order %q cannot be combined with explain — placements use the strategy's shard numbering", cfg.ShardOrder))
+	}
+
+	validSortOrders := []string{"numeric-asc", "numeric-desc", "api"}
+	if cfg.SortOrder != "" && !slices.Contains(validSortOrders, cfg.SortOrder) {
+		*issues = append(*issues,
+			fmt.Sprintf("sort_order %q is not valid: must be one of %s", cfg.SortOrder, quotedList(validSortOrders)))
+	}
 }
 
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
+// validateOutputShardName checks that name, from setting, is a shard name
+// the run will produce. auto_shards and the new-shard overflow policy settle
+// the shard count at run time, so only a fixed count can be checked here.
+func validateOutputShardName(cfg *shardConfig, setting, name string, issues *[]string) {
+	shardCount := resolveShardCount(cfg)
+	fixedCount := !cfg.AutoShards && cfg.OverflowPolicy != "new-shard" && shardCount > 0
+	if index, ok := parseShardName(name, cfg.ShardPrefix); !ok {
+		*issues = append(*issues,
+			fmt.Sprintf("%s %q is not valid — use a shard name like '%s'", setting, name, shardName(cfg.ShardPrefix, 0)))
+	} else if fixedCount && index >= shardCount {
+		*issues = append(*issues,
+			fmt.Sprintf("%s %q is out of range: with %d shard(s), valid names are %s to %s",
+				setting, name, shardCount, shardName(cfg.ShardPrefix, 0), shardName(cfg.ShardPrefix, shardCount-1)))
+	}
+}
+
+// shardNameFormat describes the shard names cfg's shard_prefix produces,
+// e.g. "'shard_0', 'shard_1', etc.".
+func shardNameFormat(cfg *shardConfig) string {
+	return fmt.Sprintf("'%s', '%s', etc.", shardName(cfg.ShardPrefix, 0), shardName(cfg.ShardPrefix, 1))
+}
+
 // quotedList formats a string slice as a human-readable quoted list,
 // e.g. ["round-robin", "percentage", "size", "rendezvous"].
 func quotedList(items []string) string {
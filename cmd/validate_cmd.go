@@ -0,0 +1,125 @@
+package cmd
+
+// validate_cmd.go implements the `validate` command: load a configuration
+// and run the shard validation rules without contacting Jamf Pro.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a shard configuration without running it",
+	Long: `Loads the configuration from the config file, environment, and flags, and
+runs the same validation rules as shard, without contacting Jamf Pro. Exits
+non-zero when any rule fails.
+
+Use --output json for a machine-readable report: {"valid":true} on success,
+or {"valid":false,"issues":[...]} listing each problem with the config key it
+concerns.
+
+Examples:
+  go-jamf-guid-sharder validate --config ./config.yaml
+
+  go-jamf-guid-sharder validate --config ./config.yaml --output json`,
+	PreRun: func(cmd *cobra.Command, _ []string) { bindShardFlags(cmd, "output") },
+	RunE:   runValidate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	addConnectionFlags(validateCmd)
+	addSourceFlags(validateCmd)
+	addShardingFlags(validateCmd)
+	validateCmd.Flags().String("output", "text", "Report format: text or json")
+}
+
+// errInvalidConfig is returned after a JSON report of a failed validation,
+// so the command exits non-zero without repeating the issues.
+var errInvalidConfig = errors.New("configuration is invalid")
+
+// validationReport is the JSON form of the validate command's output.
+type validationReport struct {
+	Valid  bool              `json:"valid"`
+	Issues []validationIssue `json:"issues,omitempty"`
+}
+
+// validationIssue is one failed rule. Field is the config key the issue
+// concerns, when it names one.
+type validationIssue struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func runValidate(cmd *cobra.Command, _ []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("invalid --output %q: must be one of: text, json", output)
+	}
+
+	var issues []string
+	cfg, err := loadShardConfig(cmd)
+	if err == nil {
+		err = resolveSeed(cfg)
+	}
+	if err != nil {
+		// Config that cannot be loaded is reported like any other issue.
+		issues = []string{err.Error()}
+	} else {
+		// --output here is the report format, so no flag supplies the
+		// output_format default that shard gets from its own --output.
+		if cfg.OutputFormat == "" {
+			cfg.OutputFormat = "json"
+		}
+		issues = shardConfigIssues(cfg)
+	}
+
+	if output == "json" {
+		if err := writeValidationReport(cmd.OutOrStdout(), issues); err != nil {
+			return err
+		}
+		if len(issues) > 0 {
+			return errInvalidConfig
+		}
+		return nil
+	}
+	if len(issues) > 0 {
+		return issuesError(issues)
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid.")
+	return err
+}
+
+// writeValidationReport prints issues to w as a validationReport.
+func writeValidationReport(w io.Writer, issues []string) error {
+	keys := make(map[string]bool)
+	for _, key := range canonicalConfigKeys() {
+		keys[key] = true
+	}
+
+	report := validationReport{Valid: len(issues) == 0}
+	for _, issue := range issues {
+		report.Issues = append(report.Issues, validationIssue{
+			Field:   issueField(issue, keys),
+			Message: issue,
+		})
+	}
+	return json.NewEncoder(w).Encode(report)
+}
+
+// issueField returns the config key an issue concerns: its first word, when
+// that is one of keys. Every rule that concerns a single key names it first.
+func issueField(issue string, keys map[string]bool) string {
+	first, _, _ := strings.Cut(issue, " ")
+	if keys[first] {
+		return first
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package cmd
+
+// validate_cmd_test.go contains tests for the `validate` command in
+// validate_cmd.go.
+//
+//   TestRunValidate_*  — text and JSON reports for valid and invalid config
+//   TestIssueField     — mapping an issue to the config key it concerns
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newValidateCmd returns a bare command carrying validate's --output flag,
+// writing stdout to buf.
+func newValidateCmd(buf *bytes.Buffer, output string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", output, "")
+	cmd.SetOut(buf)
+	return cmd
+}
+
+// setValidShardConfig sets a complete round-robin configuration in viper.
+func setValidShardConfig(t *testing.T) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("instance_domain", "https://example.jamfcloud.com")
+	viper.Set("auth_method", "oauth2")
+	viper.Set("client_id", "id")
+	viper.Set("client_secret", "secret")
+	viper.Set("custom_timeout_seconds", 60)
+	viper.Set("source_type", "computer_inventory")
+	viper.Set("strategy", "round-robin")
+	viper.Set("shard_count", 3)
+}
+
+func TestRunValidate_ValidText(t *testing.T) {
+	setValidShardConfig(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, runValidate(newValidateCmd(&buf, "text"), []string{}))
+
+	assert.Equal(t, "Configuration is valid.\n", buf.String())
+}
+
+func TestRunValidate_ValidJSON(t *testing.T) {
+	setValidShardConfig(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, runValidate(newValidateCmd(&buf, "json"), []string{}))
+
+	assert.JSONEq(t, `{"valid": true}`, buf.String())
+}
+
+func TestRunValidate_InvalidText(t *testing.T) {
+	setValidShardConfig(t)
+	viper.Set("source_type", "computer_group_membership")
+
+	var buf bytes.Buffer
+	err := runValidate(newValidateCmd(&buf, "text"), []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "group_id is required")
+	assert.Empty(t, buf.String())
+}
+
+func TestRunValidate_InvalidJSON(t *testing.T) {
+	setValidShardConfig(t)
+	viper.Set("source_type", "computer_group_membership")
+	viper.Set("shard_count", 0)
+
+	var buf bytes.Buffer
+	err := runValidate(newValidateCmd(&buf, "json"), []string{})
+
+	require.ErrorIs(t, err, errInvalidConfig)
+	var report validationReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.False(t, report.Valid)
+	require.NotEmpty(t, report.Issues)
+	fields := make([]string, len(report.Issues))
+	for i, issue := range report.Issues {
+		fields[i] = issue.Field
+		assert.NotEmpty(t, issue.Message)
+	}
+	assert.Contains(t, fields, "group_id")
+}
+
+func TestRunValidate_LoadErrorReportedAsIssue(t *testing.T) {
+	setValidShardConfig(t)
+	viper.Set("seed_file", "/nonexistent/seed.txt")
+
+	var buf bytes.Buffer
+	err := runValidate(newValidateCmd(&buf, "json"), []string{})
+
+	require.ErrorIs(t, err, errInvalidConfig)
+	var report validationReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	require.Len(t, report.Issues, 1)
+	assert.Contains(t, report.Issues[0].Message, "seed")
+}
+
+func TestRunValidate_InvalidOutput(t *testing.T) {
+	setValidShardConfig(t)
+
+	var buf bytes.Buffer
+	err := runValidate(newValidateCmd(&buf, "xml"), []string{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --output "xml"`)
+}
+
+func TestIssueField(t *testing.T) {
+	keys := map[string]bool{"group_id": true, "basic_auth_username": true}
+
+	assert.Equal(t, "group_id", issueField(`group_id is required when source_type is "computer_group_membership"`, keys))
+	assert.Equal(t, "basic_auth_username", issueField("basic_auth_username / basic_auth_password are set", keys))
+	assert.Empty(t, issueField("per-request timeout must be positive", keys))
+}
@@ -4,18 +4,27 @@ package cmd
 // validate.go. Tests mirror the structure of the validators themselves:
 //
 //   TestValidateAuth                — credential completeness and cross-method noise
-//   TestValidateSource              — source_type membership, group_id requirements
+//   TestValidateConnection          — request and run timeouts
+//   TestValidateSource              — source_type membership, group_id and site_id rules
+//   TestValidateSourceCache         — cache_ids, cache_ttl, and refresh_cache
 //   TestValidateShardingParameters  — ExactlyOneOf, strategy ↔ param compatibility,
 //                                     per-param internal constraints
+//   TestValidateShardLimits         — max_ids_per_shard and overflow policy
 //   TestValidateIDFormats           — numeric ID and shard-name regex checks
 //   TestValidateIDConflicts         — exclude/reserved overlap, cross-shard duplicates
 //   TestValidateOutput              — output_format membership
+//   TestValidateOutput_FileAndDirExclusive — output_file vs output_dir
+//   TestValidateOutput_SortOrder    — sort_order membership
+//   TestValidateOutput_PreviewCount — preview_count range and output_dir
+//   TestValidateOutput_JSONDetailed — json-detailed source, output_dir, and include_names rules
+//   TestValidateOutput_Explain      — explain output format and explain_ids rules
 //   TestValidateShardConfig         — integration: all validators run together,
 //                                     all errors collected before returning
 
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -31,6 +40,7 @@ func baseOAuth2Config() shardConfig {
 		AuthMethod:     "oauth2",
 		ClientID:       "client-id-123",
 		ClientSecret:   "client-secret-456",
+		CustomTimeout:  60,
 		SourceType:     "computer_inventory",
 		Strategy:       "round-robin",
 		ShardCount:     3,
@@ -45,6 +55,7 @@ func baseBasicConfig() shardConfig {
 		AuthMethod:     "basic",
 		Username:       "admin",
 		Password:       "s3cr3t",
+		CustomTimeout:  60,
 		SourceType:     "computer_inventory",
 		Strategy:       "round-robin",
 		ShardCount:     3,
@@ -103,6 +114,16 @@ func TestValidateAuth(t *testing.T) {
 			wantCount:  1,
 			wantSubstr: []string{"instance_domain is required"},
 		},
+		{
+			name: "instance_domain with a path",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.InstanceDomain = "https://company.jamfcloud.com/api"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{`instance_domain "https://company.jamfcloud.com/api" must be just the host`},
+		},
 
 		// ── auth_method ────────────────────────────────────────────────────────
 		{
@@ -426,407 +447,1182 @@ func TestValidateSource(t *testing.T) {
 			wantCount:  2,
 			wantSubstr: []string{"numeric", "does not use a group"},
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			var issues []string
-			validateSource(&tt.cfg, &issues)
-
-			assert.Len(t, issues, tt.wantCount)
-			for _, sub := range tt.wantSubstr {
-				assertIssueContains(t, issues, sub)
-			}
-		})
-	}
-}
-
-// ── validateShardingParameters ────────────────────────────────────────────────
 
-func TestValidateShardingParameters(t *testing.T) {
-	t.Parallel()
-
-	tests := []struct {
-		name       string
-		cfg        shardConfig
-		wantCount  int
-		wantSubstr []string
-	}{
-		// ── ExactlyOneOf: happy paths ──────────────────────────────────────────
+		// ── prestage_id requirements ───────────────────────────────────────────
 		{
-			name: "round-robin with shard_count",
+			name: "computer_prestage_scope with numeric prestage_id",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "round-robin"
-				c.ShardCount = 3
+				c.SourceType = "computer_prestage_scope"
+				c.PrestageID = "3"
 				return c
 			}(),
 			wantCount: 0,
 		},
 		{
-			name: "rendezvous with shard_count",
+			name: "computer_prestage_scope without prestage_id",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "rendezvous"
-				c.ShardCount = 5
+				c.SourceType = "computer_prestage_scope"
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  1,
+			wantSubstr: []string{"prestage_id is required", "computer_prestage_scope"},
 		},
 		{
-			name: "percentage with valid percentages summing to 100",
+			name: "non-numeric prestage_id",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{10, 30, 60}
+				c.SourceType = "computer_prestage_scope"
+				c.PrestageID = "wave-1"
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  1,
+			wantSubstr: []string{"prestage_id", "wave-1", "numeric"},
 		},
 		{
-			name: "percentage with two equal halves",
+			name: "prestage_id set but source_type is computer_inventory",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{50, 50}
+				c.SourceType = "computer_inventory"
+				c.PrestageID = "3"
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  1,
+			wantSubstr: []string{"prestage_id", "does not use a prestage"},
 		},
+
+		// ── Location filters ───────────────────────────────────────────────────
 		{
-			name: "size with explicit sizes",
+			name: "location filters on computer_inventory",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{50, 100}
+				c.SourceType = "computer_inventory"
+				c.FilterDepartment = "Engineering"
+				c.FilterBuilding = "3"
 				return c
 			}(),
 			wantCount: 0,
 		},
 		{
-			name: "size with remainder in last position",
+			name: "location filters on mobile_device_inventory",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{50, 200, -1}
+				c.SourceType = "mobile_device_inventory"
+				c.FilterDepartment = "Engineering"
+				c.FilterBuilding = "HQ"
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  2,
+			wantSubstr: []string{"filter_department is set", "filter_building is set"},
 		},
 		{
-			name: "size with single remainder-only shard",
+			name: "combined sources of one object type",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{-1}
+				c.SourceType = "computer_inventory, computer_group_membership"
+				c.GroupID = "42"
 				return c
 			}(),
 			wantCount: 0,
 		},
-
-		// ── ExactlyOneOf: none set ─────────────────────────────────────────────
 		{
-			// When no shard param is provided, the "none provided" error is
-			// emitted but the function does NOT return early — so the strategy
-			// compatibility check also fires ("round-robin requires shard_count"),
-			// giving the user the full picture in one pass.
-			name: "none of shard_count/percentages/sizes set, strategy is round-robin",
+			name: "mixed object types with namespace_ids",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.ShardCount = 0
-				c.ShardPercentages = nil
-				c.ShardSizes = nil
+				c.SourceType = "computer_inventory,mobile_device_inventory,user_accounts"
+				c.NamespaceIDs = true
 				return c
 			}(),
-			wantCount:  2,
-			wantSubstr: []string{"exactly one", "none were provided", "requires shard_count"},
+			wantCount: 0,
 		},
-
-		// ── ExactlyOneOf: multiple set — early return, no strategy checks ──────
 		{
-			name: "shard_count and shard_percentages both set",
+			name: "mixed object types without namespace_ids",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "round-robin"
-				c.ShardCount = 3
-				c.ShardPercentages = []int{50, 50}
+				c.SourceType = "computer_inventory,mobile_device_inventory"
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"exactly one", "multiple were provided", "shard_count", "shard_percentages"},
+			wantSubstr: []string{"combines different object types", "set namespace_ids"},
 		},
 		{
-			name: "shard_count and shard_sizes both set",
+			name: "combined sources with an invalid and a repeated entry",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "round-robin"
-				c.ShardCount = 3
-				c.ShardSizes = []int{50, 50}
+				c.SourceType = "computer_inventory,printers,computer_inventory"
 				return c
 			}(),
-			wantCount:  1,
-			wantSubstr: []string{"exactly one", "multiple were provided", "shard_count", "shard_sizes"},
+			wantCount:  2,
+			wantSubstr: []string{`source_type "printers" is not valid`, `lists "computer_inventory" more than once`},
 		},
 		{
-			name: "shard_percentages and shard_sizes both set",
+			name: "two group sources",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{50, 50}
-				c.ShardSizes = []int{50, 50}
+				c.SourceType = "computer_group_membership,mobile_device_group_membership"
+				c.GroupID = "42"
+				c.NamespaceIDs = true
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"exactly one", "multiple were provided", "shard_percentages", "shard_sizes"},
+			wantSubstr: []string{"more than one *_group_membership source"},
 		},
 		{
-			name: "all three set",
+			name: "location filter with a combined non-computer source",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.ShardCount = 3
-				c.ShardPercentages = []int{50, 50}
-				c.ShardSizes = []int{50, 50}
+				c.SourceType = "computer_inventory,user_accounts"
+				c.NamespaceIDs = true
+				c.FilterDepartment = "Engineering"
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"exactly one", "multiple were provided"},
+			wantSubstr: []string{"filter_department is set"},
 		},
-
-		// ── Strategy: missing/invalid ──────────────────────────────────────────
 		{
-			name: "missing strategy",
+			name: "numeric site_id on a group source",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = ""
-				c.ShardCount = 3
+				c.SourceType = "mobile_device_group_membership"
+				c.GroupID = "7"
+				c.SiteID = "3"
 				return c
 			}(),
-			wantCount:  1,
-			wantSubstr: []string{"strategy is required"},
+			wantCount: 0,
 		},
 		{
-			name: "invalid strategy name",
+			name: "non-numeric site_id",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "random"
-				c.ShardCount = 3
+				c.SiteID = "London"
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"strategy", "random", "not valid"},
+			wantSubstr: []string{`site_id "London" must be a numeric ID`},
 		},
-
-		// ── Strategy ↔ param: round-robin ──────────────────────────────────────
 		{
-			name: "round-robin with percentages instead of count",
+			name: "site_id on user_accounts",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "round-robin"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{50, 50}
+				c.SourceType = "user_accounts"
+				c.SiteID = "3"
 				return c
 			}(),
-			wantCount:  2,
-			wantSubstr: []string{"round-robin", "requires shard_count", "shard_percentages is set"},
+			wantCount:  1,
+			wantSubstr: []string{"site_id is set but source_type \"user_accounts\""},
 		},
 		{
-			name: "round-robin with sizes instead of count",
+			name: "site_id on user_group_membership",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "round-robin"
-				c.ShardCount = 0
-				c.ShardSizes = []int{50, 50}
+				c.SourceType = "user_group_membership"
+				c.GroupID = "7"
+				c.SiteID = "3"
 				return c
 			}(),
-			wantCount:  2,
-			wantSubstr: []string{"round-robin", "requires shard_count", "shard_sizes is set"},
+			wantCount:  1,
+			wantSubstr: []string{"site_id is set but source_type \"user_group_membership\""},
 		},
-
-		// ── Strategy ↔ param: rendezvous ───────────────────────────────────────
 		{
-			name: "rendezvous with percentages instead of count",
+			name: "site_id on raw_endpoint",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "rendezvous"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{50, 50}
+				c.SourceType = "raw_endpoint"
+				c.SiteID = "3"
 				return c
 			}(),
-			wantCount:  2,
-			wantSubstr: []string{"rendezvous", "requires shard_count", "shard_percentages is set"},
+			wantCount:  1,
+			wantSubstr: []string{"site_id is set but source_type \"raw_endpoint\""},
 		},
+	}
 
-		// ── Strategy ↔ param: percentage ──────────────────────────────────────
-		{
-			name: "percentage with count instead of percentages",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 3
-				c.ShardPercentages = nil
-				return c
-			}(),
-			wantCount:  2,
-			wantSubstr: []string{"percentage", "requires shard_percentages", "shard_count is set"},
-		},
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var issues []string
+			validateSource(&tt.cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+func TestValidateRawEndpoint(t *testing.T) {
+	t.Parallel()
+
+	raw := func(path, jsonPath string) shardConfig {
+		c := baseOAuth2Config()
+		c.SourceType = "raw_endpoint"
+		c.RawPath = path
+		c.RawIDJSONPath = jsonPath
+		return c
+	}
+	tests := []struct {
+		name       string
+		cfg        shardConfig
+		wantCount  int
+		wantSubstr []string
+	}{
+		{name: "valid", cfg: raw("/api/v1/departments?page-size=200", "$.results[*].id"), wantCount: 0},
+		{name: "unset on other sources", cfg: baseOAuth2Config(), wantCount: 0},
 		{
-			name: "percentage with sizes instead of percentages",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardSizes = []int{50, 50}
-				return c
-			}(),
+			name:       "both missing",
+			cfg:        raw("", ""),
 			wantCount:  2,
-			wantSubstr: []string{"percentage", "requires shard_percentages", "shard_sizes is set"},
+			wantSubstr: []string{"raw_path is required", "raw_id_jsonpath is required"},
 		},
-
-		// ── Strategy ↔ param: size ─────────────────────────────────────────────
 		{
-			name: "size with count instead of sizes",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 3
-				c.ShardSizes = nil
-				return c
-			}(),
-			wantCount:  2,
-			wantSubstr: []string{"size", "requires shard_sizes", "shard_count is set"},
+			name:       "absolute URL",
+			cfg:        raw("https://attacker.example.com/api/v1/departments", "$.results[*].id"),
+			wantCount:  1,
+			wantSubstr: []string{"must be an API path on the Jamf Pro instance"},
 		},
 		{
-			name: "size with percentages instead of sizes",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{50, 50}
-				return c
-			}(),
-			wantCount:  2,
-			wantSubstr: []string{"size", "requires shard_sizes", "shard_percentages is set"},
+			name:       "protocol-relative URL",
+			cfg:        raw("//attacker.example.com/api", "$.results[*].id"),
+			wantCount:  1,
+			wantSubstr: []string{"must be an API path on the Jamf Pro instance"},
 		},
-
-		// ── shard_percentages internal ─────────────────────────────────────────
 		{
-			// -10 + 60 = 50 ≠ 100, so both the negative-value and wrong-sum checks fire.
-			name: "percentages with one negative value and wrong sum",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{-10, 60}
-				return c
-			}(),
-			wantCount:  2,
-			wantSubstr: []string{"shard_percentages[0]", "-10", ">= 0", "must sum to exactly 100"},
+			name:       "relative path",
+			cfg:        raw("api/v1/departments", "$.results[*].id"),
+			wantCount:  1,
+			wantSubstr: []string{"must be an API path on the Jamf Pro instance"},
 		},
 		{
-			name: "percentages summing to less than 100",
-			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{10, 20}
-				return c
-			}(),
+			name:       "unsupported JSONPath",
+			cfg:        raw("/api/v1/departments", "$..id"),
 			wantCount:  1,
-			wantSubstr: []string{"must sum to exactly 100", "got 30"},
+			wantSubstr: []string{`raw_id_jsonpath "$..id" is not valid: recursive descent`},
 		},
 		{
-			name: "percentages summing to more than 100",
+			name: "combined with another source",
 			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{60, 60}
+				c := raw("/api/v1/departments", "$.results[*].id")
+				c.SourceType = "computer_inventory,raw_endpoint"
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"must sum to exactly 100", "got 120"},
+			wantSubstr: []string{"must be the only source"},
 		},
 		{
-			// -5 + -5 + 90 = 80 ≠ 100, so all three checks fire: index 0 negative,
-			// index 1 negative, sum wrong.
-			name: "multiple negative percentages with wrong sum",
+			name: "namespace_ids",
 			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{-5, -5, 90}
+				c := raw("/api/v1/departments", "$.results[*].id")
+				c.NamespaceIDs = true
 				return c
 			}(),
-			wantCount:  3,
-			wantSubstr: []string{"shard_percentages[0]", "shard_percentages[1]", "must sum to exactly 100"},
+			wantCount:  1,
+			wantSubstr: []string{"namespace_ids cannot be combined with source_type 'raw_endpoint'"},
 		},
 		{
-			name: "zero percentage is allowed (>= 0)",
+			name: "raw settings without raw_endpoint",
 			cfg: func() shardConfig {
-				c := baseOAuth2Config()
-				c.Strategy = "percentage"
-				c.ShardCount = 0
-				c.ShardPercentages = []int{0, 100}
+				c := raw("/api/v1/departments", "$.results[*].id")
+				c.SourceType = "computer_inventory"
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  2,
+			wantSubstr: []string{"raw_path is set but source_type", "raw_id_jsonpath is set but source_type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var issues []string
+			validateRawEndpoint(&tt.cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+// ── validateConnection ────────────────────────────────────────────────────────
+
+func TestValidateSourceCache(t *testing.T) {
+	t.Parallel()
+
+	cfg := baseOAuth2Config()
+	cfg.RefreshCache = true
+
+	var issues []string
+	validateSourceCache(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "refresh_cache is set but cache_ids is not")
+
+	issues = nil
+	cfg.CacheIDs = "ids-cache.json"
+	validateSourceCache(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "cache_ttl must be positive")
+
+	issues = nil
+	cfg.CacheTTL = time.Hour
+	validateSourceCache(&cfg, &issues)
+	assert.Empty(t, issues)
+}
+
+func TestValidateConnection(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        shardConfig
+		wantCount  int
+		wantSubstr []string
+	}{
+		{name: "seconds only", cfg: shardConfig{CustomTimeout: 60}, wantCount: 0},
+		{name: "milliseconds only", cfg: shardConfig{CustomTimeoutMs: 500}, wantCount: 0},
+		{name: "milliseconds rescue a zero seconds value", cfg: shardConfig{CustomTimeout: 0, CustomTimeoutMs: 1}, wantCount: 0},
+		{
+			name:       "neither timeout positive",
+			cfg:        shardConfig{CustomTimeout: -1},
+			wantCount:  1,
+			wantSubstr: []string{"per-request timeout must be positive", "got -1"},
+		},
+		{
+			name:       "negative milliseconds",
+			cfg:        shardConfig{CustomTimeout: 60, CustomTimeoutMs: -5},
+			wantCount:  1,
+			wantSubstr: []string{"custom_timeout_milliseconds must not be negative"},
+		},
+		{
+			name:       "negative run_timeout",
+			cfg:        shardConfig{CustomTimeout: 60, RunTimeout: -time.Second},
+			wantCount:  1,
+			wantSubstr: []string{"run_timeout must not be negative"},
+		},
+		{
+			name:       "negative source_timeout",
+			cfg:        shardConfig{CustomTimeout: 60, SourceTimeout: -time.Second},
+			wantCount:  1,
+			wantSubstr: []string{"source_timeout must not be negative"},
+		},
+		{name: "fetch_page_retries set", cfg: shardConfig{CustomTimeout: 60, FetchPageRetries: 3}, wantCount: 0},
+		{
+			name:       "negative fetch_page_retries",
+			cfg:        shardConfig{CustomTimeout: 60, FetchPageRetries: -1},
+			wantCount:  1,
+			wantSubstr: []string{"fetch_page_retries must not be negative"},
+		},
+		{
+			name:      "proxies set",
+			cfg:       shardConfig{CustomTimeout: 60, HTTPProxy: "http://proxy.corp:3128", HTTPSProxy: "socks5://proxy.corp:1080"},
+			wantCount: 0,
+		},
+		{
+			name:       "proxy without scheme",
+			cfg:        shardConfig{CustomTimeout: 60, HTTPSProxy: "proxy.corp:3128"},
+			wantCount:  1,
+			wantSubstr: []string{"https_proxy must be an http://, https://, or socks5:// URL"},
+		},
+		{
+			name:       "unparseable proxy",
+			cfg:        shardConfig{CustomTimeout: 60, HTTPProxy: "http://proxy corp:3128"},
+			wantCount:  1,
+			wantSubstr: []string{`http_proxy "http://proxy corp:3128" is not a valid URL`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var issues []string
+			validateConnection(&tt.cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+// ── validateShardingParameters ────────────────────────────────────────────────
+
+func TestValidateShardingParameters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        shardConfig
+		wantCount  int
+		wantSubstr []string
+	}{
+		// ── ExactlyOneOf: happy paths ──────────────────────────────────────────
+		{
+			name: "round-robin with shard_count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 3
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "rendezvous with shard_count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "rendezvous"
+				c.ShardCount = 5
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "balanced with shard_count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "balanced"
+				c.ShardCount = 4
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "hash-ring with shard_count and virtual_nodes",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "hash-ring"
+				c.ShardCount = 4
+				c.VirtualNodes = 100
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "percentage with valid percentages summing to 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{10, 30, 60}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "percentage with two equal halves",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{50, 50}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "size with explicit sizes",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{50, 100}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "size with remainder in last position",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{50, 200, -1}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "size with single remainder-only shard",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{-1}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "size with auto_shards",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{500}
+				c.AutoShards = true
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "auto_shards with several sizes",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{500, -1}
+				c.AutoShards = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"auto_shards requires exactly one positive shard_sizes value, e.g. [500], got [500 -1]"},
+		},
+		{
+			name: "auto_shards with a remainder-only size",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{-1}
+				c.AutoShards = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"auto_shards requires exactly one positive shard_sizes value"},
+		},
+		{
+			name: "auto_shards without size strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.AutoShards = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"auto_shards is set but strategy is \"round-robin\""},
+		},
+
+		// ── ExactlyOneOf: none set ─────────────────────────────────────────────
+		{
+			// When no shard param is provided, the "none provided" error is
+			// emitted but the function does NOT return early — so the strategy
+			// compatibility check also fires ("round-robin requires shard_count"),
+			// giving the user the full picture in one pass.
+			name: "none of shard_count/percentages/sizes set, strategy is round-robin",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ShardCount = 0
+				c.ShardPercentages = nil
+				c.ShardSizes = nil
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"exactly one", "none were provided", "requires shard_count"},
+		},
+
+		// ── ExactlyOneOf: multiple set — early return, no strategy checks ──────
+		{
+			name: "shard_count and shard_percentages both set",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 3
+				c.ShardPercentages = []float64{50, 50}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"exactly one", "multiple were provided", "shard_count", "shard_percentages"},
+		},
+		{
+			name: "shard_count and shard_sizes both set",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 3
+				c.ShardSizes = []int{50, 50}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"exactly one", "multiple were provided", "shard_count", "shard_sizes"},
+		},
+		{
+			name: "shard_percentages and shard_sizes both set",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{50, 50}
+				c.ShardSizes = []int{50, 50}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"exactly one", "multiple were provided", "shard_percentages", "shard_sizes"},
+		},
+		{
+			name: "all three set",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ShardCount = 3
+				c.ShardPercentages = []float64{50, 50}
+				c.ShardSizes = []int{50, 50}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"exactly one", "multiple were provided"},
+		},
+
+		// ── Strategy: missing/invalid ──────────────────────────────────────────
+		{
+			name: "missing strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = ""
+				c.ShardCount = 3
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"strategy is required"},
+		},
+		{
+			name: "invalid strategy name",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "random"
+				c.ShardCount = 3
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"strategy", "random", "not valid"},
+		},
+
+		// ── Strategy ↔ param: round-robin ──────────────────────────────────────
+		{
+			name: "round-robin with percentages instead of count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{50, 50}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"round-robin", "requires shard_count", "shard_percentages is set"},
+		},
+		{
+			name: "round-robin with sizes instead of count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 0
+				c.ShardSizes = []int{50, 50}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"round-robin", "requires shard_count", "shard_sizes is set"},
+		},
+
+		// ── Strategy ↔ param: rendezvous ───────────────────────────────────────
+		{
+			name: "rendezvous with percentages instead of count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "rendezvous"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{50, 50}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"rendezvous", "requires shard_count", "shard_percentages is set"},
+		},
+
+		// ── Strategy ↔ param: percentage ──────────────────────────────────────
+		{
+			name: "percentage with count instead of percentages",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 3
+				c.ShardPercentages = nil
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"percentage", "requires shard_percentages", "shard_count is set"},
+		},
+		{
+			name: "percentage with sizes instead of percentages",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardSizes = []int{50, 50}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"percentage", "requires shard_percentages", "shard_sizes is set"},
+		},
+
+		// ── Strategy ↔ param: size ─────────────────────────────────────────────
+		{
+			name: "size with count instead of sizes",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 3
+				c.ShardSizes = nil
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"size", "requires shard_sizes", "shard_count is set"},
+		},
+		{
+			name: "size with percentages instead of sizes",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{50, 50}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"size", "requires shard_sizes", "shard_percentages is set"},
+		},
+
+		// ── shard_percentages internal ─────────────────────────────────────────
+		{
+			// -10 + 60 = 50 ≠ 100, so both the negative-value and wrong-sum checks fire.
+			name: "percentages with one negative value and wrong sum",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{-10, 60}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"shard_percentages[0]", "-10", ">= 0", "must sum to exactly 100"},
+		},
+		{
+			name: "percentages summing to less than 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{10, 20}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"must sum to exactly 100", "got 30"},
+		},
+		{
+			name: "percentages summing to more than 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{60, 60}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"must sum to exactly 100", "got 120"},
+		},
+		{
+			name: "allow_partial accepts percentages summing to less than 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{10, 50}
+				c.AllowPartial = true
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "allow_partial still rejects a sum above 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{60, 60}
+				c.AllowPartial = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"must sum to at most 100 with allow_partial", "got 120"},
+		},
+		{
+			name: "allow_partial with a non-percentage strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.AllowPartial = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"allow_partial is set but strategy is \"round-robin\""},
+		},
+		{
+			name: "balance_after_reservations with a non-percentage strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.BalanceReserved = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"balance_after_reservations is set but strategy is \"round-robin\""},
+		},
+		{
+			// -5 + -5 + 90 = 80 ≠ 100, so all three checks fire: index 0 negative,
+			// index 1 negative, sum wrong.
+			name: "multiple negative percentages with wrong sum",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{-5, -5, 90}
+				return c
+			}(),
+			wantCount:  3,
+			wantSubstr: []string{"shard_percentages[0]", "shard_percentages[1]", "must sum to exactly 100"},
+		},
+		{
+			name: "zero percentage is allowed (>= 0)",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{0, 100}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "fractional percentages summing to 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{12.5, 12.5, 25, 50}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "fractional percentages not summing to 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "percentage"
+				c.ShardCount = 0
+				c.ShardPercentages = []float64{12.5, 37.4, 50}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"must sum to exactly 100, got 99.9 ([12.5 37.4 50])"},
 		},
 
 		// ── shard_sizes internal ───────────────────────────────────────────────
 		{
-			name: "sizes with zero value",
+			name: "sizes with zero value",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{0, 100}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"shard_sizes[0]", "0", ">= 1"},
+		},
+		{
+			name: "sizes with negative non-minus-one value",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{-2, 100}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"shard_sizes[0]", "-2", ">= 1"},
+		},
+		{
+			name: "minus-one in non-last position",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{-1, 50, 100}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"shard_sizes[0]", "-1", "not the last element"},
+		},
+		{
+			name: "minus-one in middle of three elements",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "size"
+				c.ShardCount = 0
+				c.ShardSizes = []int{50, -1, 100}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"shard_sizes[1]", "-1", "not the last element"},
+		},
+		{
+			name: "rendezvous with one weight per shard",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "rendezvous"
+				c.ShardCount = 3
+				c.ShardWeights = []float64{1, 2, 0.5}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "shard_weights length does not match shard_count",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{0, 100}
+				c.Strategy = "rendezvous"
+				c.ShardCount = 3
+				c.ShardWeights = []float64{1, 2}
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"shard_sizes[0]", "0", ">= 1"},
+			wantSubstr: []string{"shard_weights has 2 element(s) but shard_count is 3"},
 		},
 		{
-			name: "sizes with negative non-minus-one value",
+			name: "shard_weights must be positive",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{-2, 100}
+				c.Strategy = "rendezvous"
+				c.ShardCount = 2
+				c.ShardWeights = []float64{0, 1}
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"shard_sizes[0]", "-2", ">= 1"},
+			wantSubstr: []string{"shard_weights[0]"},
 		},
 		{
-			name: "minus-one in non-last position",
+			name: "shard_weights with non-rendezvous strategy",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
-				c.ShardCount = 0
-				c.ShardSizes = []int{-1, 50, 100}
+				c.Strategy = "round-robin"
+				c.ShardCount = 2
+				c.ShardWeights = []float64{1, 1}
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"shard_sizes[0]", "-1", "not the last element"},
+			wantSubstr: []string{"shard_weights is only valid with strategy 'rendezvous'"},
 		},
 		{
-			name: "minus-one in middle of three elements",
+			name: "hash-ring without virtual_nodes",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.Strategy = "size"
+				c.Strategy = "hash-ring"
+				c.ShardCount = 3
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"strategy 'hash-ring' requires virtual_nodes of at least 1, got 0"},
+		},
+		{
+			name: "hash-ring without shard_count",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "hash-ring"
 				c.ShardCount = 0
-				c.ShardSizes = []int{50, -1, 100}
+				c.VirtualNodes = 50
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{"strategy \"hash-ring\" requires shard_count"},
+		},
+		{
+			name: "seed_salt without seed",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.SeedSalt = "team-a"
 				return c
 			}(),
 			wantCount:  1,
-			wantSubstr: []string{"shard_sizes[1]", "-1", "not the last element"},
+			wantSubstr: []string{"seed_salt is set but seed is empty"},
+		},
+		{
+			name: "seeds with output_dir",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Seeds = []string{"alpha", "beta-2", "gamma_3.0"}
+				c.SeedSalt = "team-a"
+				c.OutputDir = "out"
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "seeds with seed, without output_dir, bad and repeated names",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Seeds = []string{"alpha", "../beta", "alpha", ".."}
+				c.Seed = "fixed"
+				return c
+			}(),
+			wantCount: 5,
+			wantSubstr: []string{
+				"seeds cannot be combined with seed or seed_file",
+				"seeds requires output_dir",
+				`seeds[1] "../beta" is not valid`,
+				`seeds[2] "alpha" is listed more than once`,
+				`seeds[3] ".." is not valid`,
+			},
+		},
+		{
+			name: "per_shard_seeds in range",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.PerShardSeeds = map[string]string{"shard_0": "alpha", "shard_2": "beta"}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "per_shard_seeds out of range",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.PerShardSeeds = map[string]string{"shard_3": "alpha"}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{`per_shard_seeds key "shard_3" is out of range: with 3 shard(s)`},
+		},
+		{
+			name: "per_shard_seeds bad key and empty seed",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.PerShardSeeds = map[string]string{"first": ""}
+				return c
+			}(),
+			wantCount:  2,
+			wantSubstr: []string{`per_shard_seeds key "first" is not valid`, `per_shard_seeds["first"] must not be empty`},
+		},
+		{
+			name: "per_shard_seeds with sort_order",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.PerShardSeeds = map[string]string{"shard_0": "alpha"}
+				c.SortOrder = "api"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{`per_shard_seeds cannot be combined with sort_order "api"`},
+		},
+		{
+			name: "negative sample_size",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.SampleSize = -1
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"sample_size must be >= 0"},
+		},
+		{
+			name: "sample_seed without sample_size",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.SampleSeed = "dry-run"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"sample_seed is set but sample_size is 0"},
+		},
+		{
+			name: "holdback with seed",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.HoldbackPercent = 5
+				c.HoldbackSeed = "canary-2024"
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "holdback without seed",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.HoldbackPercent = 5
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"holdback_seed is required when holdback_percentage is set"},
+		},
+		{
+			name: "holdback_percentage of 100",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.HoldbackPercent = 100
+				c.HoldbackSeed = "canary-2024"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"holdback_percentage must be >= 0 and < 100, got 100"},
+		},
+		{
+			name: "holdback_seed without percentage",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.HoldbackSeed = "canary-2024"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"holdback_seed is set but holdback_percentage is 0"},
+		},
+		{
+			name: "negative round_robin_offset",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.RoundRobinOffset = -1
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"round_robin_offset must be >= 0, got -1"},
+		},
+		{
+			name: "round_robin_offset with non-round-robin strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "rendezvous"
+				c.ShardCount = 3
+				c.RoundRobinOffset = 2
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"round_robin_offset is only valid with strategy 'round-robin'"},
+		},
+		{
+			name: "virtual_nodes with non-hash-ring strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "rendezvous"
+				c.ShardCount = 3
+				c.VirtualNodes = 50
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"virtual_nodes is only valid with strategy 'hash-ring'"},
+		},
+		{
+			name: "parallel with non-rendezvous strategy",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Strategy = "round-robin"
+				c.ShardCount = 3
+				c.Parallel = true
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"parallel is only valid with strategy 'rendezvous'"},
 		},
 		{
 			name: "multiple invalid sizes accumulate",
@@ -856,6 +1652,142 @@ func TestValidateShardingParameters(t *testing.T) {
 	}
 }
 
+// ── validateShardLimits ───────────────────────────────────────────────────────
+
+func TestValidateShardLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		max        int
+		policy     string
+		wantCount  int
+		wantSubstr []string
+	}{
+		{name: "unset", wantCount: 0},
+		{name: "cap with default policy", max: 100, policy: "error", wantCount: 0},
+		{name: "spill", max: 100, policy: "spill", wantCount: 0},
+		{name: "new-shard", max: 100, policy: "new-shard", wantCount: 0},
+		{
+			name:       "negative cap",
+			max:        -5,
+			wantCount:  1,
+			wantSubstr: []string{"max_ids_per_shard must be >= 0"},
+		},
+		{
+			name:       "unknown policy",
+			max:        100,
+			policy:     "truncate",
+			wantCount:  1,
+			wantSubstr: []string{"overflow_policy", "truncate", "not valid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			cfg.MaxIDsPerShard = tt.max
+			cfg.OverflowPolicy = tt.policy
+			var issues []string
+			validateShardLimits(&cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+func TestValidateShardLimits_MinShardSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        func(*shardConfig)
+		wantSubstr string
+	}{
+		{name: "negative minimum", cfg: func(c *shardConfig) { c.MinShardSize = -1 }, wantSubstr: "min_shard_size must be >= 0"},
+		{
+			name:       "minimum above the cap",
+			cfg:        func(c *shardConfig) { c.MinShardSize, c.MaxIDsPerShard = 50, 40 },
+			wantSubstr: "min_shard_size (50) is greater than max_ids_per_shard (40)",
+		},
+		{
+			name:       "fail_on_undersized without a minimum",
+			cfg:        func(c *shardConfig) { c.FailOnUndersized = true },
+			wantSubstr: "fail_on_undersized is set but min_shard_size is not",
+		},
+		{name: "minimum within the cap", cfg: func(c *shardConfig) { c.MinShardSize, c.MaxIDsPerShard = 40, 40 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			tt.cfg(&cfg)
+			var issues []string
+			validateShardLimits(&cfg, &issues)
+
+			if tt.wantSubstr == "" {
+				assert.Empty(t, issues)
+				return
+			}
+			require.Len(t, issues, 1)
+			assertIssueContains(t, issues, tt.wantSubstr)
+		})
+	}
+}
+
+// ── validateIDField ───────────────────────────────────────────────────────────
+
+func TestValidateIDField(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		cfg        func(*shardConfig)
+		wantSubstr []string
+	}{
+		{name: "unset", cfg: func(c *shardConfig) {}},
+		{name: "jamf-id", cfg: func(c *shardConfig) { c.IDField = "jamf-id" }},
+		{name: "management-id", cfg: func(c *shardConfig) { c.IDField = "management-id" }},
+		{
+			name:       "unknown field",
+			cfg:        func(c *shardConfig) { c.IDField = "serial" },
+			wantSubstr: []string{`id_field "serial" is not valid`},
+		},
+		{
+			name: "management-id with another source and namespace_ids",
+			cfg: func(c *shardConfig) {
+				c.IDField = "management-id"
+				c.SourceType = "mobile_device_inventory"
+				c.NamespaceIDs = true
+			},
+			wantSubstr: []string{
+				`id_field 'management-id' requires source_type 'computer_inventory', got "mobile_device_inventory"`,
+				"id_field 'management-id' cannot be combined with namespace_ids",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			tt.cfg(&cfg)
+			var issues []string
+			validateIDField(&cfg, &issues)
+
+			assert.Len(t, issues, len(tt.wantSubstr))
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
 // ── validateIDFormats ─────────────────────────────────────────────────────────
 
 func TestValidateIDFormats(t *testing.T) {
@@ -883,16 +1815,38 @@ func TestValidateIDFormats(t *testing.T) {
 			wantCount: 0,
 		},
 		{
-			name: "valid reserved_ids: shard_N keys with numeric values",
+			name: "valid reserved_ids: shard_N keys with numeric values",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ReservedIDs = map[string][]string{
+					"shard_0": {"101", "102"},
+					"shard_2": {"201"},
+				}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "management IDs with id_field 'management-id'",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.IDField = "management-id"
+				c.ExcludeIDs = []string{"9B2C1E4F-0D3A-4C5B-8E7F-1A2B3C4D5E6F"}
+				c.ReservedIDs = map[string][]string{"shard_0": {"0A1B2C3D-4E5F-6A7B-8C9D-0E1F2A3B4C5D"}}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "empty management ID",
 			cfg: func() shardConfig {
 				c := baseOAuth2Config()
-				c.ReservedIDs = map[string][]string{
-					"shard_0": {"101", "102"},
-					"shard_2": {"201"},
-				}
+				c.IDField = "management-id"
+				c.ExcludeIDs = []string{""}
 				return c
 			}(),
-			wantCount: 0,
+			wantCount:  1,
+			wantSubstr: []string{`exclude_ids[0] "" must be a non-empty management ID`},
 		},
 		{
 			name: "shard_10 is a valid key",
@@ -935,6 +1889,60 @@ func TestValidateIDFormats(t *testing.T) {
 			wantCount:  2, // index 0 and 2 are bad; index 1 is fine
 			wantSubstr: []string{"exclude_ids[0]", "exclude_ids[2]"},
 		},
+		{
+			name: "non-numeric explain_ids",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.Explain = true
+				c.ExplainIDs = []string{"101", "abc"}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"explain_ids[1]", "abc", "numeric"},
+		},
+		{
+			name: "valid exclude_id_pattern",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ExcludeIDPattern = `^9\d{3}$`
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "exclude_id_pattern that does not compile",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ExcludeIDPattern = "^(9"
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{"exclude_id_pattern", "^(9", "not a valid regular expression"},
+		},
+
+		{
+			name: "namespaced exclude_ids with namespace_ids",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.NamespaceIDs = true
+				c.ExcludeIDs = []string{"computer:1", "mobile_device:2", "user:3"}
+				c.ReservedIDs = map[string][]string{"shard_0": {"computer:4"}}
+				return c
+			}(),
+			wantCount: 0,
+		},
+		{
+			name: "plain IDs with namespace_ids",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.NamespaceIDs = true
+				c.ExcludeIDs = []string{"1", "printer:2"}
+				c.ReservedIDs = map[string][]string{"shard_0": {"4"}}
+				return c
+			}(),
+			wantCount:  3,
+			wantSubstr: []string{"exclude_ids[0]", "exclude_ids[1]", `reserved_ids["shard_0"][0]`, "namespaced ID"},
+		},
 
 		// ── reserved_ids key format ────────────────────────────────────────────
 		{
@@ -947,6 +1955,17 @@ func TestValidateIDFormats(t *testing.T) {
 			wantCount:  1,
 			wantSubstr: []string{"reserved_ids key", "0", "shard_0"},
 		},
+		{
+			name: "reserved_ids key with shard_prefix",
+			cfg: func() shardConfig {
+				c := baseOAuth2Config()
+				c.ShardPrefix = "wave_"
+				c.ReservedIDs = map[string][]string{"wave_0": {"1"}, "shard_1": {"2"}}
+				return c
+			}(),
+			wantCount:  1,
+			wantSubstr: []string{`reserved_ids key "shard_1" is not valid — keys must be in the format 'wave_0', 'wave_1', etc.`},
+		},
 		{
 			name: "reserved_ids with 'group_0' key (wrong prefix)",
 			cfg: func() shardConfig {
@@ -1185,6 +2204,8 @@ func TestValidateOutput(t *testing.T) {
 	}{
 		{name: "json", format: "json", wantCount: 0},
 		{name: "yaml", format: "yaml", wantCount: 0},
+		{name: "ndjson", format: "ndjson", wantCount: 0},
+		{name: "json-detailed", format: "json-detailed", wantCount: 0},
 		{
 			name: "empty format",
 			format: "",
@@ -1228,6 +2249,434 @@ func TestValidateOutput(t *testing.T) {
 	}
 }
 
+func TestValidateOutput_FileAndDirExclusive(t *testing.T) {
+	t.Parallel()
+
+	cfg := baseOAuth2Config()
+	cfg.OutputFile = "out.json"
+	cfg.OutputDir = "shards"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "output_file and output_dir are mutually exclusive")
+}
+
+func TestValidateOutput_NullFormat(t *testing.T) {
+	t.Parallel()
+
+	cfg := baseOAuth2Config()
+	cfg.OutputFormat = "null"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+
+	cfg.OutputDir = "shards"
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "output_format 'null' discards the result")
+}
+
+func TestValidateOutput_FileTemplate(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.OutputFile = "shards-{{.Date}}-{{.Source}}.json"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `output_file "shards-{{.Date}}-{{.Source}}.json" references an unknown field`)
+
+	issues = nil
+	cfg.OutputFile = "shards-{{.Date}}-{{.SourceType}}.json"
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+}
+
+func TestValidateOutput_SelectShard(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		mutate     func(*shardConfig)
+		wantSubstr []string
+	}{
+		{name: "in range", mutate: func(c *shardConfig) { c.SelectShard = "shard_2" }},
+		{
+			name:       "out of range",
+			mutate:     func(c *shardConfig) { c.SelectShard = "shard_3" },
+			wantSubstr: []string{`select_shard "shard_3" is out of range: with 3 shard(s)`},
+		},
+		{
+			name: "new-shard overflow may add shards",
+			mutate: func(c *shardConfig) {
+				c.SelectShard = "shard_5"
+				c.OverflowPolicy = "new-shard"
+			},
+		},
+		{
+			name:       "bad name",
+			mutate:     func(c *shardConfig) { c.SelectShard = "2" },
+			wantSubstr: []string{`select_shard "2" is not valid`},
+		},
+		{
+			name: "ndjson and print_hash_only",
+			mutate: func(c *shardConfig) {
+				c.SelectShard = "shard_0"
+				c.OutputFormat = "ndjson"
+				c.PrintHashOnly = true
+			},
+			wantSubstr: []string{"select_shard requires output_format 'json' or 'yaml', got \"ndjson\"",
+				"select_shard cannot be combined with print_hash_only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			tt.mutate(&cfg)
+
+			var issues []string
+			validateOutput(&cfg, &issues)
+
+			assert.Len(t, issues, len(tt.wantSubstr))
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+func TestValidateOutput_OnlyShards(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		mutate     func(*shardConfig)
+		wantSubstr []string
+	}{
+		{name: "in range", mutate: func(c *shardConfig) { c.OnlyShards = []string{"shard_1", "shard_2"} }},
+		{
+			name:       "out of range and bad name",
+			mutate:     func(c *shardConfig) { c.OnlyShards = []string{"shard_1", "shard_3", "two"} },
+			wantSubstr: []string{`only_shards "shard_3" is out of range: with 3 shard(s)`, `only_shards "two" is not valid`},
+		},
+		{
+			name: "with select_shard",
+			mutate: func(c *shardConfig) {
+				c.OnlyShards = []string{"shard_1"}
+				c.SelectShard = "shard_1"
+			},
+			wantSubstr: []string{"only_shards cannot be combined with select_shard"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			tt.mutate(&cfg)
+
+			var issues []string
+			validateOutput(&cfg, &issues)
+
+			assert.Len(t, issues, len(tt.wantSubstr))
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+func TestValidateOutput_PreviewCount(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.PreviewCount = -1
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "preview_count must not be negative")
+
+	issues = nil
+	cfg.PreviewCount = 5
+	cfg.OutputDir = "shards"
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "preview_count cannot be combined with output_dir")
+}
+
+func TestValidateOutput_ShardOrder(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.ShardOrder = "largest"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `shard_order "largest" is not valid`)
+
+	issues = nil
+	cfg.ShardOrder = "size-desc"
+	cfg.Explain = true
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `shard_order "size-desc" cannot be combined with explain`)
+}
+
+func TestValidateOutput_AtomicWrite(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.AtomicWrite = true
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "atomic_write requires output_file or output_dir")
+
+	issues = nil
+	cfg.OutputFile = "shards.json"
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+}
+
+func TestValidateOutput_ObjectStorage(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.OutputFile = "s3://shard-artifacts/rollout/shards.json"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+
+	cfg.OutputFile = "gs://shard-artifacts/shards.json"
+	cfg.AtomicWrite = true
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "atomic_write cannot be combined with output_file")
+
+	issues = nil
+	cfg = baseOAuth2Config()
+	cfg.OutputDir = "s3://shard-artifacts/rollout"
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "object storage URLs are only supported for output_file")
+}
+
+func TestValidateOutput_FileMode(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.OutputFileMode = "0600"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+
+	cfg.OutputFileMode = "u=rw"
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `output_file_mode "u=rw" is not a valid octal file mode`)
+}
+
+func TestValidateOutput_YAMLHeader(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.YAMLHeader = true
+	cfg.OutputFormat = "yaml"
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+
+	cfg.OutputFormat = "json"
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `yaml_header requires output_format 'yaml', got "json"`)
+}
+
+func TestValidateOutput_ExpiresIn(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.ExpiresIn = 72 * time.Hour
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Empty(t, issues)
+
+	cfg.ExpiresIn = -time.Hour
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "expires_in must be >= 0 (0 = never), got -1h0m0s")
+
+	issues = nil
+	cfg.ExpiresIn = time.Hour
+	cfg.Canonical = true
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, "canonical cannot be combined with expires_in")
+}
+
+func TestValidateOutput_ShardLabels(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.ShardLabels = map[string]map[string]string{
+		"shard_0": {"owner": "it-ops"},
+		"shard_9": {"owner": "desktop"}, // may be added by overflow or auto_shards
+		"wave-1":  {"owner": "desktop"},
+	}
+
+	var issues []string
+	validateOutput(&cfg, &issues)
+	assert.Len(t, issues, 1)
+	assertIssueContains(t, issues, `shard_labels key "wave-1" is not valid`)
+}
+
+func TestValidateOutput_JSONDetailed(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requires an inventory source", func(t *testing.T) {
+		t.Parallel()
+		cfg := baseOAuth2Config()
+		cfg.OutputFormat = "json-detailed"
+		cfg.SourceType = "computer_group_membership"
+
+		var issues []string
+		validateOutput(&cfg, &issues)
+
+		assert.Len(t, issues, 1)
+		assertIssueContains(t, issues, "output_format 'json-detailed' requires source_type")
+	})
+
+	t.Run("cannot be combined with output_dir", func(t *testing.T) {
+		t.Parallel()
+		cfg := baseOAuth2Config()
+		cfg.OutputFormat = "json-detailed"
+		cfg.OutputDir = "shards"
+
+		var issues []string
+		validateOutput(&cfg, &issues)
+
+		assert.Len(t, issues, 1)
+		assertIssueContains(t, issues, "cannot be combined with output_dir")
+	})
+
+	t.Run("accepts include_names", func(t *testing.T) {
+		t.Parallel()
+		cfg := baseOAuth2Config()
+		cfg.OutputFormat = "json-detailed"
+		cfg.IncludeNames = true
+
+		var issues []string
+		validateOutput(&cfg, &issues)
+
+		assert.Empty(t, issues)
+	})
+
+	t.Run("include_names requires json-detailed", func(t *testing.T) {
+		t.Parallel()
+		cfg := baseOAuth2Config()
+		cfg.OutputFormat = "yaml"
+		cfg.IncludeNames = true
+
+		var issues []string
+		validateOutput(&cfg, &issues)
+
+		assert.Len(t, issues, 1)
+		assertIssueContains(t, issues, "include_names requires output_format 'json-detailed', got \"yaml\"")
+	})
+}
+
+func TestValidateOutput_SortOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		sortOrder  string
+		wantCount  int
+		wantSubstr []string
+	}{
+		{name: "empty uses default", sortOrder: "", wantCount: 0},
+		{name: "numeric-asc", sortOrder: "numeric-asc", wantCount: 0},
+		{name: "numeric-desc", sortOrder: "numeric-desc", wantCount: 0},
+		{name: "api", sortOrder: "api", wantCount: 0},
+		{
+			name:       "random is not valid",
+			sortOrder:  "random",
+			wantCount:  1,
+			wantSubstr: []string{"sort_order", "random", "not valid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			cfg.SortOrder = tt.sortOrder
+
+			var issues []string
+			validateOutput(&cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
+func TestValidateOutput_Explain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mutate     func(c *shardConfig)
+		wantCount  int
+		wantSubstr []string
+	}{
+		{
+			name:      "explain with json",
+			mutate:    func(c *shardConfig) { c.Explain = true; c.ExplainIDs = []string{"1"} },
+			wantCount: 0,
+		},
+		{
+			name:       "explain with ndjson",
+			mutate:     func(c *shardConfig) { c.Explain = true; c.OutputFormat = "ndjson" },
+			wantCount:  1,
+			wantSubstr: []string{"explain cannot be combined with output_format 'ndjson'"},
+		},
+		{
+			name:       "explain with output_dir",
+			mutate:     func(c *shardConfig) { c.Explain = true; c.OutputDir = "shards" },
+			wantCount:  1,
+			wantSubstr: []string{"explain cannot be combined with output_dir"},
+		},
+		{
+			name:       "explain_ids without explain",
+			mutate:     func(c *shardConfig) { c.ExplainIDs = []string{"1"} },
+			wantCount:  1,
+			wantSubstr: []string{"explain_ids is set but explain is not"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := baseOAuth2Config()
+			tt.mutate(&cfg)
+
+			var issues []string
+			validateOutput(&cfg, &issues)
+
+			assert.Len(t, issues, tt.wantCount)
+			for _, sub := range tt.wantSubstr {
+				assertIssueContains(t, issues, sub)
+			}
+		})
+	}
+}
+
 // ── validateShardConfig (integration) ────────────────────────────────────────
 
 func TestValidateShardConfig(t *testing.T) {
@@ -1244,7 +2693,7 @@ func TestValidateShardConfig(t *testing.T) {
 		cfg := baseBasicConfig()
 		cfg.Strategy = "percentage"
 		cfg.ShardCount = 0
-		cfg.ShardPercentages = []int{10, 30, 60}
+		cfg.ShardPercentages = []float64{10, 30, 60}
 		require.NoError(t, validateShardConfig(&cfg))
 	})
 
@@ -1324,7 +2773,7 @@ func TestValidateShardConfig(t *testing.T) {
 		cfg := baseOAuth2Config()
 		cfg.Strategy = "round-robin"
 		cfg.ShardCount = 3
-		cfg.ShardPercentages = []int{50, 50}
+		cfg.ShardPercentages = []float64{50, 50}
 
 		err := validateShardConfig(&cfg)
 		require.Error(t, err)
@@ -1345,3 +2794,40 @@ func TestValidateShardConfig(t *testing.T) {
 		assert.Contains(t, err.Error(), "•")
 	})
 }
+
+func TestValidateShardPrefix(t *testing.T) {
+	t.Parallel()
+
+	for _, prefix := range []string{"", "shard_", "wave_", "ring-", "batch.", "v2_wave_", "wave"} {
+		cfg := baseOAuth2Config()
+		cfg.ShardPrefix = prefix
+		var issues []string
+		validateShardPrefix(&cfg, &issues)
+		assert.Empty(t, issues, prefix)
+	}
+
+	for _, prefix := range []string{"wave2", "wave 1_", "wave/", "wave:", `wave"`, "wave*", "wåve_"} {
+		cfg := baseOAuth2Config()
+		cfg.ShardPrefix = prefix
+		var issues []string
+		validateShardPrefix(&cfg, &issues)
+		require.Len(t, issues, 1, prefix)
+		assert.Contains(t, issues[0], "shard_prefix", prefix)
+	}
+}
+
+func TestValidateOutputShardName_ShardPrefix(t *testing.T) {
+	t.Parallel()
+	cfg := baseOAuth2Config()
+	cfg.ShardPrefix = "wave_"
+
+	var issues []string
+	validateOutputShardName(&cfg, "select_shard", "wave_1", &issues)
+	assert.Empty(t, issues)
+
+	validateOutputShardName(&cfg, "select_shard", "shard_1", &issues)
+	validateOutputShardName(&cfg, "select_shard", "wave_3", &issues)
+	require.Len(t, issues, 2)
+	assert.Contains(t, issues[0], "use a shard name like 'wave_0'")
+	assert.Contains(t, issues[1], "valid names are wave_0 to wave_2")
+}
@@ -1,22 +1,63 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"runtime"
 
 	"github.com/spf13/cobra"
 )
 
-// Version is set at build time via -ldflags "-X github.com/deploymenttheory/go-jamf-guid-sharder/cmd.Version=x.y.z"
-var Version = "dev"
+// Version, Commit, and BuildDate are set at build time via -ldflags, e.g.
+// "-X github.com/deploymenttheory/go-jamf-guid-sharder/cmd.Version=x.y.z".
+var (
+	Version   = "dev"
+	Commit    = "none"
+	BuildDate = "unknown"
+)
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version of go-jamf-guid-sharder",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("go-jamf-guid-sharder version %s\n", Version)
-	},
+	Long: `Prints the version of go-jamf-guid-sharder. Use --output json to print the
+version, Go version, commit, and build date as a JSON object.`,
+	RunE: runVersion,
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().String("output", "text", "Output format: text or json")
+}
+
+// versionInfo is the JSON form of the version command's output.
+type versionInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+func runVersion(cmd *cobra.Command, _ []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	return writeVersion(cmd.OutOrStdout(), output)
+}
+
+// writeVersion prints the build information to w in the given format.
+func writeVersion(w io.Writer, output string) error {
+	switch output {
+	case "", "text":
+		_, err := fmt.Fprintf(w, "go-jamf-guid-sharder version %s\n", Version)
+		return err
+	case "json":
+		return json.NewEncoder(w).Encode(versionInfo{
+			Version:   Version,
+			GoVersion: runtime.Version(),
+			Commit:    Commit,
+			BuildDate: BuildDate,
+		})
+	default:
+		return fmt.Errorf("invalid --output %q: must be one of: text, json", output)
+	}
 }
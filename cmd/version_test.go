@@ -0,0 +1,43 @@
+package cmd
+
+// version_test.go contains tests for the `version` command in version.go.
+//
+//   TestWriteVersion_*   — text and JSON output formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteVersion_Text(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeVersion(&buf, "text"))
+
+	assert.Equal(t, "go-jamf-guid-sharder version "+Version+"\n", buf.String())
+}
+
+func TestWriteVersion_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeVersion(&buf, "json"))
+
+	var info versionInfo
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &info))
+	assert.Equal(t, Version, info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, Commit, info.Commit)
+	assert.Equal(t, BuildDate, info.BuildDate)
+}
+
+func TestWriteVersion_InvalidOutput(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeVersion(&buf, "yaml")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid --output "yaml"`)
+	assert.Empty(t, buf.String())
+}
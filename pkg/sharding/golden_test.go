@@ -0,0 +1,97 @@
+package sharding
+
+// golden_test.go pins the strategies to the golden files under
+// testdata/golden. Each file holds the shards for one strategy over
+// goldenIDs; a diff means the change moves IDs for anyone embedding the
+// sharder. After an intended change, regenerate them with:
+//
+//   go test ./pkg/sharding -run TestGolden -update
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata/golden")
+
+// goldenSeed is the seed every golden vector is computed with.
+const goldenSeed = "golden-v1"
+
+// goldenIDs is the fixed pool behind every golden vector: 1–40, out of order
+// as Jamf Pro may return them.
+func goldenIDs() []string {
+	ids := createTestIDs(40, 1)
+	slices.Reverse(ids)
+	return ids
+}
+
+// goldenShards is the golden file format: shard name to its IDs.
+func goldenShards(shards [][]string) map[string][]string {
+	named := make(map[string][]string, len(shards))
+	for i, shard := range shards {
+		named[fmt.Sprintf("shard_%d", i)] = append([]string{}, shard...)
+	}
+	return named
+}
+
+func TestGolden(t *testing.T) {
+	ids := goldenIDs()
+	tests := []struct {
+		name   string
+		shards [][]string
+	}{
+		{"round-robin", RoundRobin(ids, 3, 0, goldenSeed, nil)},
+		{"round-robin-unseeded", RoundRobin(ids, 3, 1, "", nil)},
+		{"percentage", Percentage(ids, []float64{10, 30, 60}, goldenSeed, nil, false)},
+		{"size", Size(ids, []int{5, 10, -1}, goldenSeed, nil)},
+		{"rendezvous", Rendezvous(ids, 3, nil, goldenSeed, nil)},
+		{"rendezvous-weighted", Rendezvous(ids, 3, []float64{1, 2, 1}, goldenSeed, nil)},
+		{"balanced", Balanced(ids, 3, goldenSeed, nil)},
+		{"hash-ring", HashRing(ids, 3, 64, goldenSeed, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("testdata", "golden", tt.name+".json")
+			got := goldenShards(tt.shards)
+
+			if *updateGolden {
+				data, err := json.MarshalIndent(got, "", "  ")
+				require.NoError(t, err)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, append(data, '\n'), 0o644))
+			}
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err, "missing golden file — run with -update to create it")
+			var want map[string][]string
+			require.NoError(t, json.Unmarshal(data, &want))
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestStrategies_DoNotModifyInput(t *testing.T) {
+	ids := goldenIDs()
+	reservations := &Reservations{
+		IDsByShard:    map[int][]string{1: {"90", "80"}},
+		UnreservedIDs: goldenIDs(),
+	}
+	reserved := slices.Clone(reservations.IDsByShard[1])
+
+	RoundRobin(ids, 3, 0, "", nil)
+	Percentage(ids, []float64{50, 50}, "", nil, false)
+	Size(ids, []int{5, -1}, "", reservations)
+	Rendezvous(ids, 3, nil, goldenSeed, reservations)
+
+	assert.Equal(t, goldenIDs(), ids)
+	assert.Equal(t, goldenIDs(), reservations.UnreservedIDs)
+	assert.Equal(t, reserved, reservations.IDsByShard[1])
+}
@@ -0,0 +1,60 @@
+// Package sharding implements the strategies go-jamf-guid-sharder uses to
+// split a pool of Jamf Pro IDs into shards, for programs that embed the
+// sharder instead of running the CLI. For the same IDs, seed, and
+// reservations, each function returns exactly the shards the CLI would. The
+// golden files under testdata/golden pin these outputs: a change that moves
+// any ID is a breaking change to this contract.
+//
+// Shards are returned indexed by shard number; the CLI names shard i
+// "shard_i". The input slices are never modified, and each returned shard is
+// a new slice, sorted numerically.
+package sharding
+
+import "slices"
+
+// PercentageSumTolerance is how far the percentages given to Percentage may
+// sum from 100, or above it for a partial split, to absorb float rounding in
+// fractional percentages such as 12.5.
+const PercentageSumTolerance = 1e-6
+
+// Reservations pins IDs to shards ahead of a strategy. A strategy given
+// reservations distributes only UnreservedIDs, then adds each shard's
+// reserved IDs to it. The ids argument is still the whole pool, reserved IDs
+// included, since Percentage sizes its shards against it.
+type Reservations struct {
+	// IDsByShard maps a shard index to the IDs pinned to that shard. Every
+	// index must be less than the shard count.
+	IDsByShard map[int][]string
+	// UnreservedIDs is the pool without the reserved IDs.
+	UnreservedIDs []string
+}
+
+// Counts returns the number of IDs reserved for each shard, keyed by shard
+// index. It is nil for nil reservations.
+func (r *Reservations) Counts() map[int]int {
+	if r == nil {
+		return nil
+	}
+	counts := make(map[int]int, len(r.IDsByShard))
+	for idx, ids := range r.IDsByShard {
+		counts[idx] = len(ids)
+	}
+	return counts
+}
+
+// finish prepends the reserved IDs to their shards and sorts every shard
+// numerically. The reserved IDs are copied, so reservations are never
+// modified.
+func finish(shards [][]string, reservations *Reservations) [][]string {
+	if reservations != nil {
+		for idx, reservedIDs := range reservations.IDsByShard {
+			shards[idx] = append(slices.Clone(reservedIDs), shards[idx]...)
+		}
+	}
+
+	for i := range shards {
+		SortIDsNumerically(shards[i])
+	}
+
+	return shards
+}
@@ -0,0 +1,637 @@
+package sharding
+
+// strategies.go contains the sharding algorithms. The original four are
+// adapted from the terraform-provider-jamfpro guid_list_sharder data source
+// with all Terraform and tflog dependencies removed; the logic is otherwise
+// identical.
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RoundRobin distributes IDs in circular order, guaranteeing equal
+// shard sizes ±1. If a seed is provided, IDs are sorted numerically then
+// shuffled deterministically before distribution. Distribution starts at
+// shard offset%shardCount rather than shard_0, so successive batches can
+// begin at different shards.
+//
+// Algorithm: Round-robin scheduling
+// Reference: https://en.wikipedia.org/wiki/Round-robin_scheduling
+func RoundRobin(ids []string, shardCount, offset int, seed string, reservations *Reservations) [][]string {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	shards := make([][]string, shardCount)
+	distributionIDs := DistributionOrder(unreservedIDs, seed)
+
+	for i, id := range distributionIDs {
+		idx := (i + offset) % shardCount
+		shards[idx] = append(shards[idx], id)
+	}
+
+	return finish(shards, reservations)
+}
+
+// Percentage distributes IDs according to specified percentages.
+// Target shard sizes are calculated against total ID count (after exclusions).
+// Reserved counts are subtracted from targets to maintain percentage accuracy.
+// The last shard receives any remainder from rounding. When the percentages
+// sum to less than 100 (allow_partial), the last shard is sized like the
+// others and the IDs beyond the requested share are left out of every shard.
+//
+// A shard whose reservations exceed its target gets no distributed IDs. With
+// rebalance set (balance_after_reservations), the excess is also taken from
+// the other shards' targets in proportion to their percentages, rather than
+// left for the last shard alone to absorb; see PercentageTargets.
+func Percentage(ids []string, percentages []float64, seed string, reservations *Reservations, rebalance bool) [][]string {
+	unreservedIDs := ids
+	totalIDs := len(ids)
+
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	shardCount := len(percentages)
+	shards := make([][]string, shardCount)
+
+	if len(unreservedIDs) == 0 {
+		return shards
+	}
+
+	distributionIDs := DistributionOrder(unreservedIDs, seed)
+
+	partial := 0.0
+	for _, percentage := range percentages {
+		partial += percentage
+	}
+
+	reservedCounts := reservations.Counts()
+	targets, _ := PercentageTargets(totalIDs, percentages, reservedCounts, rebalance)
+
+	currentIndex := 0
+	for i := range percentages {
+		var shardSize int
+		if i == shardCount-1 && partial >= 100-PercentageSumTolerance {
+			shardSize = len(unreservedIDs) - currentIndex
+		} else {
+			shardSize = int(targets[i]) - reservedCounts[i]
+		}
+
+		if currentIndex+shardSize > len(unreservedIDs) {
+			shardSize = len(unreservedIDs) - currentIndex
+		}
+
+		if shardSize > 0 {
+			shards[i] = distributionIDs[currentIndex : currentIndex+shardSize]
+			currentIndex += shardSize
+		}
+	}
+
+	return finish(shards, reservations)
+}
+
+// PercentageTargets returns each shard's target size, reservations included,
+// for totalIDs split by percentages, and the indices of the shards whose
+// reserved counts exceed their target.
+//
+// Without rebalance the targets are the plain percentages of totalIDs. With
+// rebalance, an over-reserved shard's target becomes its reserved count, and
+// the excess is taken from the other shards in proportion to their
+// percentages. That can push another shard's reservations over its reduced
+// target, so the split is repeated until no further shard is over.
+func PercentageTargets(totalIDs int, percentages []float64, reservedCounts map[int]int, rebalance bool) ([]float64, []int) {
+	base := make([]float64, len(percentages))
+	for i, percentage := range percentages {
+		base[i] = float64(totalIDs) * percentage / 100.0
+	}
+	targets := slices.Clone(base)
+
+	over := make([]bool, len(percentages))
+	for {
+		changed := false
+		for i, target := range targets {
+			if !over[i] && float64(reservedCounts[i]) > target {
+				over[i], changed = true, true
+			}
+		}
+		if !changed || !rebalance {
+			break
+		}
+		excess, remaining := 0.0, 0.0
+		for i, percentage := range percentages {
+			if over[i] {
+				excess += float64(reservedCounts[i]) - base[i]
+			} else {
+				remaining += percentage
+			}
+		}
+		for i, percentage := range percentages {
+			switch {
+			case over[i]:
+				targets[i] = float64(reservedCounts[i])
+			case remaining > 0:
+				targets[i] = base[i] - excess*percentage/remaining
+			}
+		}
+	}
+
+	var overReserved []int
+	for i, isOver := range over {
+		if isOver {
+			overReserved = append(overReserved, i)
+		}
+	}
+	return targets, overReserved
+}
+
+// Size distributes IDs according to specified absolute sizes.
+// A value of -1 in the last position means "all remaining IDs".
+// Reserved counts are subtracted from targets so the final shard size
+// (distributed + reserved) matches the requested size.
+func Size(ids []string, sizes []int, seed string, reservations *Reservations) [][]string {
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	shardCount := len(sizes)
+	shards := make([][]string, shardCount)
+
+	if len(unreservedIDs) == 0 {
+		return shards
+	}
+
+	distributionIDs := DistributionOrder(unreservedIDs, seed)
+
+	currentIndex := 0
+	for i, size := range sizes {
+		var shardSize int
+
+		if size == -1 {
+			shardSize = len(unreservedIDs) - currentIndex
+		} else {
+			shardSize = size
+			if reservations != nil {
+				shardSize -= len(reservations.IDsByShard[i])
+			}
+			if currentIndex+shardSize > len(unreservedIDs) {
+				shardSize = len(unreservedIDs) - currentIndex
+			}
+		}
+
+		if shardSize > 0 && currentIndex < len(unreservedIDs) {
+			shards[i] = distributionIDs[currentIndex : currentIndex+shardSize]
+			currentIndex += shardSize
+		} else {
+			shards[i] = []string{}
+		}
+	}
+
+	return finish(shards, reservations)
+}
+
+// AutoSizes expands the single shard_sizes value used with auto_shards
+// into as many shards of that size as total IDs need, the last set to -1 so
+// it holds the remainder. At least one shard is always returned.
+func AutoSizes(size, total int) []int {
+	sizes := make([]int, max(1, (total+size-1)/size))
+	for i := range sizes {
+		sizes[i] = size
+	}
+	sizes[len(sizes)-1] = -1
+	return sizes
+}
+
+// Rendezvous distributes IDs using Highest Random Weight (HRW) algorithm.
+// Always deterministic. Provides superior stability when shard count changes —
+// only ~1/n IDs move when a new shard is added.
+//
+// When weights is non-empty, each shard's hash is scaled with the logarithmic
+// method so that a shard attracts IDs in proportion to its weight. A nil or
+// empty weights slice keeps the classic unweighted comparison. Ties on the
+// 64-bit weight are broken by rendezvousWins.
+//
+// Algorithm: Rendezvous Hashing (Highest Random Weight Hashing)
+// Reference: https://en.wikipedia.org/wiki/Rendezvous_hashing
+// Original Paper: Thaler & Ravishankar (1998)
+// Weighted variant: Schindelhauer & Schomaker, "Weighted Distributed Hash Tables" (2005)
+func Rendezvous(ids []string, shardCount int, weights []float64, seed string, reservations *Reservations) [][]string {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	return finish(assignRendezvous(unreservedIDs, shardCount, weights, seed), reservations)
+}
+
+// RendezvousParallel is Rendezvous with the unreserved IDs
+// split into contiguous chunks, one per GOMAXPROCS goroutine. Each worker
+// fills its own shard slices, and they are joined in chunk order before
+// sorting, so the result is identical to the serial version.
+func RendezvousParallel(ids []string, shardCount int, weights []float64, seed string, reservations *Reservations) [][]string {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), len(unreservedIDs))
+	if workers <= 1 {
+		return Rendezvous(ids, shardCount, weights, seed, reservations)
+	}
+
+	chunkSize := (len(unreservedIDs) + workers - 1) / workers
+	partials := make([][][]string, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		lo := min(w*chunkSize, len(unreservedIDs))
+		hi := min(lo+chunkSize, len(unreservedIDs))
+		wg.Go(func() {
+			partials[w] = assignRendezvous(unreservedIDs[lo:hi], shardCount, weights, seed)
+		})
+	}
+	wg.Wait()
+
+	shards := make([][]string, shardCount)
+	for i := range shardCount {
+		shards[i] = []string{}
+		for _, partial := range partials {
+			shards[i] = append(shards[i], partial[i]...)
+		}
+	}
+	return finish(shards, reservations)
+}
+
+// assignRendezvous places each ID in the shard with the highest rendezvous
+// score, keeping the IDs' order within each shard.
+func assignRendezvous(ids []string, shardCount int, weights []float64, seed string) [][]string {
+	weighted := len(weights) == shardCount
+
+	shards := make([][]string, shardCount)
+	for i := range shardCount {
+		shards[i] = []string{}
+	}
+
+	hasher := newRendezvousHasher(shardCount, seed)
+	for _, id := range ids {
+		var highestHash [32]byte
+		highestWeight := uint64(0)
+		highestScore := math.Inf(-1)
+		selectedShard := -1
+
+		for shardIdx := range shardCount {
+			hash := hasher.digest(id, shardIdx)
+			weight := binary.BigEndian.Uint64(hash[:8])
+
+			if weighted {
+				score := weightedRendezvousScore(weight, weights[shardIdx])
+				if selectedShard < 0 || rendezvousWins(score, hash, highestScore, highestHash) {
+					highestScore, highestHash = score, hash
+					selectedShard = shardIdx
+				}
+				continue
+			}
+
+			if selectedShard < 0 || rendezvousWins(weight, hash, highestWeight, highestHash) {
+				highestWeight, highestHash = weight, hash
+				selectedShard = shardIdx
+			}
+		}
+
+		shards[selectedShard] = append(shards[selectedShard], id)
+	}
+	return shards
+}
+
+// Balanced assigns each ID to the currently least-loaded shard, with
+// ties going to the lowest shard index. Reserved IDs count towards a shard's
+// starting load, so the final shard sizes (reserved + distributed) are as
+// even as possible. The seed controls processing order via
+// DistributionOrder.
+//
+// Algorithm: Greedy least-loaded assignment (list scheduling)
+// Reference: https://en.wikipedia.org/wiki/List_scheduling
+func Balanced(ids []string, shardCount int, seed string, reservations *Reservations) [][]string {
+	return BalancedWeighted(ids, shardCount, nil, seed, reservations)
+}
+
+// BalancedWeighted is Balanced with an optional per-ID weight.
+// IDs missing from idWeights (or a nil map) weigh 1, which reduces the
+// algorithm to balancing counts. Reserved IDs are always weighted 1.
+func BalancedWeighted(ids []string, shardCount int, idWeights map[string]float64, seed string, reservations *Reservations) [][]string {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	shards := make([][]string, shardCount)
+	loads := make([]float64, shardCount)
+	for i := range shardCount {
+		shards[i] = []string{}
+		if reservations != nil {
+			loads[i] = float64(len(reservations.IDsByShard[i]))
+		}
+	}
+
+	for _, id := range DistributionOrder(unreservedIDs, seed) {
+		target := 0
+		for shardIdx := 1; shardIdx < shardCount; shardIdx++ {
+			if loads[shardIdx] < loads[target] {
+				target = shardIdx
+			}
+		}
+
+		weight := 1.0
+		if w, ok := idWeights[id]; ok {
+			weight = w
+		}
+		shards[target] = append(shards[target], id)
+		loads[target] += weight
+	}
+
+	return finish(shards, reservations)
+}
+
+// HashRing distributes IDs with classic consistent hashing. Each shard
+// places virtualNodes points on a 64-bit ring, hashed from "shard_i#v:seed",
+// and each ID goes to the owner of the first point clockwise from the ID's
+// own hash. Always deterministic. Adding or removing a shard only moves the
+// IDs on the arcs its points claim or release; more virtual nodes give a
+// more even spread at the cost of a larger ring.
+//
+// Algorithm: Consistent hashing with virtual nodes
+// Reference: https://en.wikipedia.org/wiki/Consistent_hashing
+// Original Paper: Karger et al. (1997)
+func HashRing(ids []string, shardCount, virtualNodes int, seed string, reservations *Reservations) [][]string {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+	if virtualNodes <= 0 {
+		virtualNodes = 1
+	}
+
+	unreservedIDs := ids
+	if reservations != nil {
+		unreservedIDs = reservations.UnreservedIDs
+	}
+
+	ring := buildHashRing(shardCount, virtualNodes, seed)
+
+	shards := make([][]string, shardCount)
+	for i := range shardCount {
+		shards[i] = []string{}
+	}
+
+	for _, id := range unreservedIDs {
+		owner := ring[ringOwner(ring, ringHash(id))].shard
+		shards[owner] = append(shards[owner], id)
+	}
+
+	return finish(shards, reservations)
+}
+
+// Ring is the consistent hash ring HashRing places IDs on, for callers that
+// need to explain a placement.
+type Ring struct {
+	points []ringPoint
+}
+
+// NewRing builds the ring HashRing uses for shardCount shards with
+// virtualNodes points each.
+func NewRing(shardCount, virtualNodes int, seed string) *Ring {
+	return &Ring{points: buildHashRing(max(shardCount, 1), max(virtualNodes, 1), seed)}
+}
+
+// Locate returns id's hash on the ring, and the hash and shard of the point
+// that claims it.
+func (r *Ring) Locate(id string) (hash, point uint64, shard int) {
+	hash = ringHash(id)
+	owner := r.points[ringOwner(r.points, hash)]
+	return hash, owner.hash, owner.shard
+}
+
+// ringPoint is one virtual node on the hash ring.
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// buildHashRing places virtualNodes points per shard on the ring, sorted by
+// hash.
+func buildHashRing(shardCount, virtualNodes int, seed string) []ringPoint {
+	ring := make([]ringPoint, 0, shardCount*virtualNodes)
+	for shardIdx := range shardCount {
+		for v := range virtualNodes {
+			ring = append(ring, ringPoint{
+				hash:  ringHash(fmt.Sprintf("shard_%d#%d:%s", shardIdx, v, seed)),
+				shard: shardIdx,
+			})
+		}
+	}
+	// Break hash ties on shard index so the ring order never depends on
+	// construction order.
+	slices.SortFunc(ring, func(a, b ringPoint) int {
+		if c := cmp.Compare(a.hash, b.hash); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.shard, b.shard)
+	})
+	return ring
+}
+
+// ringOwner returns the index of the first point on ring at or clockwise
+// from h, wrapping past the top of the ring to the first point.
+func ringOwner(ring []ringPoint, h uint64) int {
+	pos, _ := slices.BinarySearchFunc(ring, h, func(p ringPoint, target uint64) int {
+		return cmp.Compare(p.hash, target)
+	})
+	if pos == len(ring) {
+		pos = 0
+	}
+	return pos
+}
+
+// rendezvousDigest is the SHA-256 digest rendezvous hashing scores an ID
+// against one shard with.
+func rendezvousDigest(id string, shardIdx int, seed string) [32]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("%s:shard_%d:%s", id, shardIdx, seed)))
+}
+
+// RendezvousScores returns the 64-bit weight each shard scores for id under
+// Rendezvous and, when weights has one entry per shard, the weighted score
+// compared in its place. Both are indexed by shard; the highest wins.
+func RendezvousScores(id string, shardCount int, weights []float64, seed string) ([]uint64, []float64) {
+	raw := make([]uint64, shardCount)
+	var scaled []float64
+	if len(weights) == shardCount {
+		scaled = make([]float64, shardCount)
+	}
+	for shardIdx := range shardCount {
+		hash := rendezvousDigest(id, shardIdx, seed)
+		raw[shardIdx] = binary.BigEndian.Uint64(hash[:8])
+		if scaled != nil {
+			scaled[shardIdx] = weightedRendezvousScore(raw[shardIdx], weights[shardIdx])
+		}
+	}
+	return raw, scaled
+}
+
+// rendezvousHasher computes rendezvousDigest for many IDs without formatting
+// a key per (ID, shard) pair. SHA-256 cannot be resumed after the ID, so the
+// ":shard_N:seed" suffixes are built once as bytes rather than hashed, and
+// each key is assembled in a reused buffer.
+type rendezvousHasher struct {
+	suffixes [][]byte
+	buf      []byte
+}
+
+func newRendezvousHasher(shardCount int, seed string) *rendezvousHasher {
+	h := &rendezvousHasher{suffixes: make([][]byte, shardCount)}
+	for i := range shardCount {
+		h.suffixes[i] = fmt.Appendf(nil, ":shard_%d:%s", i, seed)
+	}
+	return h
+}
+
+// digest returns rendezvousDigest(id, shardIdx, seed). The buffer is reused,
+// so a hasher must not be shared between goroutines.
+func (h *rendezvousHasher) digest(id string, shardIdx int) [32]byte {
+	h.buf = append(append(h.buf[:0], id...), h.suffixes[shardIdx]...)
+	return sha256.Sum256(h.buf)
+}
+
+// ringHash places a key on the hash ring using the first 8 bytes of its
+// SHA-256 digest.
+func ringHash(key string) uint64 {
+	hash := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// rendezvousWins reports whether a candidate shard beats the current best.
+// The higher score wins; on an exact tie the full 32-byte digests decide, so
+// the result never depends on the order in which shards are visited. Only
+// identical digests (which cannot occur for distinct shard inputs) keep the
+// current best.
+func rendezvousWins[T cmp.Ordered](score T, digest [32]byte, bestScore T, bestDigest [32]byte) bool {
+	if c := cmp.Compare(score, bestScore); c != 0 {
+		return c > 0
+	}
+	return bytes.Compare(digest[:], bestDigest[:]) > 0
+}
+
+// weightedRendezvousScore maps a 64-bit hash onto the open interval (0, 1)
+// and applies the logarithmic weighting -w / ln(u). For equal weights the
+// ordering of scores matches the ordering of the raw hashes.
+func weightedRendezvousScore(hash uint64, weight float64) float64 {
+	u := (float64(hash>>11) + 0.5) / (1 << 53)
+	return -weight / math.Log(u)
+}
+
+// DistributionOrder returns the order the sequential strategies hand out
+// IDs in: sorted numerically, then shuffled deterministically using the
+// seed, or in their given (API) order when seed is empty. The result is a
+// new slice.
+func DistributionOrder(ids []string, seed string) []string {
+	if seed == "" {
+		return slices.Clone(ids)
+	}
+
+	sorted := make([]string, len(ids))
+	copy(sorted, ids)
+	SortIDsNumerically(sorted)
+	return shuffleIDs(sorted, seed)
+}
+
+// shuffleIDs performs a deterministic Fisher-Yates shuffle seeded from the
+// given string. Returns a new slice; the original is not mutated.
+//
+// Algorithm: Fisher-Yates shuffle (Knuth shuffle)
+// Reference: https://en.wikipedia.org/wiki/Fisher%E2%80%93Yates_shuffle
+func shuffleIDs(ids []string, seed string) []string {
+	rng := createSeededRNG(seed)
+	shuffled := make([]string, len(ids))
+	copy(shuffled, ids)
+
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+
+	return shuffled
+}
+
+// createSeededRNG derives a deterministic *rand.Rand from a seed string by
+// hashing it with SHA-256 and reading the first 8 bytes as a uint64.
+func createSeededRNG(seed string) *rand.Rand {
+	hash := sha256.Sum256([]byte(seed))
+	seedValue := int64(binary.BigEndian.Uint64(hash[:8]))
+	return rand.New(rand.NewSource(seedValue))
+}
+
+// SortIDsNumerically sorts a string-ID slice by numeric value in-place.
+// Namespaced IDs ("computer:101") sort by namespace, then numeric value.
+// Within a namespace, IDs that are not plain integers sort after the numeric
+// ones, lexically, so the order is total whatever the IDs hold.
+func SortIDsNumerically(ids []string) {
+	slices.SortStableFunc(ids, compareIDsNumerically)
+}
+
+// compareIDsNumerically orders two IDs as SortIDsNumerically does. Equal
+// numbers written differently ("7" and "007") are ordered lexically.
+func compareIDsNumerically(a, b string) int {
+	aNamespace, aNum := splitNamespacedID(a)
+	bNamespace, bNum := splitNamespacedID(b)
+	if c := strings.Compare(aNamespace, bNamespace); c != 0 {
+		return c
+	}
+	aInt, aErr := strconv.Atoi(aNum)
+	bInt, bErr := strconv.Atoi(bNum)
+	switch {
+	case aErr == nil && bErr == nil:
+		if c := cmp.Compare(aInt, bInt); c != 0 {
+			return c
+		}
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(aNum, bNum)
+}
+
+// splitNamespacedID splits "computer:101" into ("computer", "101"). A plain
+// ID has an empty namespace.
+func splitNamespacedID(id string) (namespace, num string) {
+	if namespace, num, ok := strings.Cut(id, ":"); ok {
+		return namespace, num
+	}
+	return "", id
+}
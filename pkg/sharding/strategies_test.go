@@ -0,0 +1,1297 @@
+package sharding
+
+// strategies_test.go contains tests for the strategies and ordering helpers
+// in strategies.go. The golden vectors are in golden_test.go.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test helper to create sample IDs
+func createTestIDs(count int, start int) []string {
+	ids := make([]string, count)
+	for i := range count {
+		ids[i] = fmt.Sprintf("%d", start+i)
+	}
+	return ids
+}
+
+// ── Round-Robin Tests ────────────────────────────────────────────────────────
+
+func TestRoundRobin_EqualDistribution(t *testing.T) {
+	ids := createTestIDs(9, 1)
+	shards := RoundRobin(ids, 3, 0, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Len(t, shards[0], 3)
+	assert.Len(t, shards[1], 3)
+	assert.Len(t, shards[2], 3)
+}
+
+func TestRoundRobin_UnevenDistribution(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := RoundRobin(ids, 3, 0, "", nil)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 10, totalIDs)
+	assert.True(t, len(shards[0]) >= 3 && len(shards[0]) <= 4)
+	assert.True(t, len(shards[1]) >= 3 && len(shards[1]) <= 4)
+	assert.True(t, len(shards[2]) >= 3 && len(shards[2]) <= 4)
+}
+
+func TestRoundRobin_WithSeed(t *testing.T) {
+	ids := createTestIDs(9, 1)
+
+	shards1 := RoundRobin(ids, 3, 0, "test-seed", nil)
+	shards2 := RoundRobin(ids, 3, 0, "test-seed", nil)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	for i := range 3 {
+		assert.Equal(t, shards1[i], shards2[i], "Same seed should produce identical distribution")
+	}
+}
+
+func TestRoundRobin_DifferentSeeds(t *testing.T) {
+	ids := createTestIDs(9, 1)
+
+	shards1 := RoundRobin(ids, 3, 0, "seed1", nil)
+	shards2 := RoundRobin(ids, 3, 0, "seed2", nil)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	different := false
+	for i := range 3 {
+		if !slicesEqual(shards1[i], shards2[i]) {
+			different = true
+			break
+		}
+	}
+	assert.True(t, different, "Different seeds should produce different distributions")
+}
+
+func TestRoundRobin_WithReservations(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"100", "101"},
+			2: {"200"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := RoundRobin(ids, 3, 0, "", reservations)
+
+	require.Len(t, shards, 3)
+	assert.Contains(t, shards[0], "100")
+	assert.Contains(t, shards[0], "101")
+	assert.Contains(t, shards[2], "200")
+}
+
+func TestRoundRobin_ZeroShardCount(t *testing.T) {
+	ids := createTestIDs(5, 1)
+	shards := RoundRobin(ids, 0, 0, "", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 5)
+}
+
+func TestRoundRobin_EmptyIDs(t *testing.T) {
+	shards := RoundRobin([]string{}, 3, 0, "", nil)
+
+	require.Len(t, shards, 3)
+	for i := range 3 {
+		assert.Empty(t, shards[i])
+	}
+}
+
+func TestRoundRobin_Offset(t *testing.T) {
+	ids := createTestIDs(4, 1)
+	shards := RoundRobin(ids, 3, 1, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, []string{"3"}, shards[0])
+	assert.Equal(t, []string{"1", "4"}, shards[1])
+	assert.Equal(t, []string{"2"}, shards[2])
+}
+
+func TestRoundRobin_OffsetWraps(t *testing.T) {
+	ids := createTestIDs(7, 1)
+
+	assert.Equal(t, RoundRobin(ids, 3, 1, "", nil), RoundRobin(ids, 3, 4, "", nil),
+		"An offset of shard_count+1 should match an offset of 1")
+}
+
+// ── Percentage Tests ──────────────────────────────────────────────────────────
+
+func TestPercentage_BasicDistribution(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	percentages := []float64{10, 30, 60}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 10, len(shards[0]))
+	assert.Equal(t, 30, len(shards[1]))
+	assert.Equal(t, 60, len(shards[2]))
+}
+
+func TestPercentage_WithRemainder(t *testing.T) {
+	ids := createTestIDs(103, 1)
+	percentages := []float64{10, 30, 60}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 103, totalIDs, "All IDs should be distributed")
+	assert.Equal(t, 103-len(shards[0])-len(shards[1]), len(shards[2]), "Last shard gets remainder")
+}
+
+func TestPercentage_Partial(t *testing.T) {
+	ids := createTestIDs(1000, 1)
+	percentages := []float64{10, 50}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 2)
+	assert.Equal(t, 100, len(shards[0]))
+	assert.Equal(t, 500, len(shards[1]), "Last shard is sized by its percentage, not given the remainder")
+}
+
+func TestPercentage_PartialWithReservations(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	percentages := []float64{20, 40}
+	reservations := &Reservations{
+		IDsByShard:    map[int][]string{1: {"1000", "1001", "1002"}},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "", reservations, false)
+
+	require.Len(t, shards, 2)
+	assert.Equal(t, 20, len(shards[0]))
+	assert.Equal(t, 40, len(shards[1]), "Reserved IDs count toward the last shard's share")
+	assert.Contains(t, shards[1], "1000")
+}
+
+func TestPercentage_Fractional(t *testing.T) {
+	ids := createTestIDs(80, 1)
+	percentages := []float64{12.5, 12.5, 25, 50}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 4)
+	assert.Len(t, shards[0], 10)
+	assert.Len(t, shards[1], 10)
+	assert.Len(t, shards[2], 20)
+	assert.Len(t, shards[3], 40)
+}
+
+func TestPercentage_WithSeed(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	percentages := []float64{10, 30, 60}
+
+	shards1 := Percentage(ids, percentages, "test-seed", nil, false)
+	shards2 := Percentage(ids, percentages, "test-seed", nil, false)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	for i := range 3 {
+		assert.Equal(t, shards1[i], shards2[i], "Same seed should produce identical distribution")
+	}
+}
+
+func TestPercentage_WithReservations(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	percentages := []float64{10, 30, 60}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"1000", "1001"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "", reservations, false)
+
+	require.Len(t, shards, 3)
+	assert.Contains(t, shards[0], "1000")
+	assert.Contains(t, shards[0], "1001")
+	assert.Equal(t, 10, len(shards[0]), "Shard 0 should have 10 total (8 distributed + 2 reserved)")
+}
+
+func TestPercentage_EmptyIDs(t *testing.T) {
+	percentages := []float64{10, 30, 60}
+	shards := Percentage([]string{}, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	for i := range 3 {
+		assert.Empty(t, shards[i])
+	}
+}
+
+func TestPercentage_WithReservationsExceedingTarget(t *testing.T) {
+	allIDs := createTestIDs(100, 1)
+	reservedIDs := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+
+	unreservedIDs := make([]string, 0, len(allIDs)-len(reservedIDs))
+	reservedSet := make(map[string]bool)
+	for _, id := range reservedIDs {
+		reservedSet[id] = true
+	}
+	for _, id := range allIDs {
+		if !reservedSet[id] {
+			unreservedIDs = append(unreservedIDs, id)
+		}
+	}
+
+	percentages := []float64{10, 30, 60}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: reservedIDs,
+		},
+		UnreservedIDs: unreservedIDs,
+	}
+
+	shards := Percentage(allIDs, percentages, "", reservations, false)
+
+	require.Len(t, shards, 3)
+	assert.GreaterOrEqual(t, len(shards[0]), 10, "Shard 0 should have at least target percentage")
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 100, totalIDs, "Should have all 100 IDs distributed")
+}
+
+// percentageReservationTest returns 100 IDs with the first reserved to
+// shard_0, as the CLI reserves them.
+func percentageReservationTest(reserved int) ([]string, *Reservations) {
+	ids := createTestIDs(100, 1)
+	return ids, &Reservations{
+		IDsByShard:    map[int][]string{0: ids[:reserved]},
+		UnreservedIDs: ids[reserved:],
+	}
+}
+
+func TestPercentage_BalanceAfterReservations(t *testing.T) {
+	ids, reservations := percentageReservationTest(30)
+
+	shards := Percentage(ids, []float64{20, 40, 40}, "", reservations, true)
+
+	require.Len(t, shards, 3)
+	assert.Len(t, shards[0], 30, "shard_0 keeps all its reservations")
+	assert.Len(t, shards[1], 35, "The 10 excess IDs are taken from the other shards in proportion")
+	assert.Len(t, shards[2], 35)
+}
+
+func TestPercentage_WithoutBalanceLastShardAbsorbs(t *testing.T) {
+	ids, reservations := percentageReservationTest(30)
+
+	shards := Percentage(ids, []float64{20, 40, 40}, "", reservations, false)
+
+	require.Len(t, shards, 3)
+	assert.Len(t, shards[0], 30)
+	assert.Len(t, shards[1], 40)
+	assert.Len(t, shards[2], 30, "Only the last shard absorbs the excess")
+}
+
+func TestPercentageTargets_Rebalance(t *testing.T) {
+	targets, over := PercentageTargets(100, []float64{20, 40, 40}, map[int]int{0: 30}, true)
+
+	assert.Equal(t, []float64{30, 35, 35}, targets)
+	assert.Equal(t, []int{0}, over)
+}
+
+func TestPercentageTargets_RebalanceCascades(t *testing.T) {
+	// Taking shard_0's excess pushes shard_1's 18 reservations over its
+	// reduced target of about 17.8, so shard_2 absorbs both.
+	targets, over := PercentageTargets(100, []float64{10, 20, 70}, map[int]int{0: 20, 1: 18}, true)
+
+	assert.Equal(t, []int{0, 1}, over)
+	assert.Equal(t, []float64{20, 18, 62}, targets)
+}
+
+func TestPercentageTargets_NoRebalance(t *testing.T) {
+	targets, over := PercentageTargets(100, []float64{20, 40, 40}, map[int]int{0: 30}, false)
+
+	assert.Equal(t, []float64{20, 40, 40}, targets, "Targets stay at the plain percentages")
+	assert.Equal(t, []int{0}, over)
+}
+
+func TestPercentage_EdgeCaseRounding(t *testing.T) {
+	ids := createTestIDs(97, 1)
+	percentages := []float64{33, 33, 34}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 97, totalIDs, "All IDs should be distributed")
+}
+
+func TestPercentage_ReservationsWithBoundaryCondition(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	percentages := []float64{40, 40, 20}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"100", "101"},
+			1: {"200", "201", "202"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "", reservations, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 55, totalIDs, "Should have 50 unreserved + 5 reserved")
+	assert.Contains(t, shards[0], "100")
+	assert.Contains(t, shards[1], "200")
+}
+
+func TestPercentage_BoundaryOverflow(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	percentages := []float64{50, 50}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"100", "101", "102", "103", "104", "105", "106"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "", reservations, false)
+
+	require.Len(t, shards, 2)
+	totalIDs := len(shards[0]) + len(shards[1])
+	assert.Equal(t, 17, totalIDs, "Should have 10 unreserved + 7 reserved")
+}
+
+// ── Size Tests ────────────────────────────────────────────────────────────────
+
+func TestSize_ExactSizes(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	sizes := []int{10, 30, 60}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 10, len(shards[0]))
+	assert.Equal(t, 30, len(shards[1]))
+	assert.Equal(t, 60, len(shards[2]))
+}
+
+func TestSize_WithRemainder(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	sizes := []int{10, 20, -1}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 10, len(shards[0]))
+	assert.Equal(t, 20, len(shards[1]))
+	assert.Equal(t, 20, len(shards[2]), "Last shard with -1 should get remaining 20 IDs")
+}
+
+func TestSize_WithSeed(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	sizes := []int{10, 20, 20}
+
+	shards1 := Size(ids, sizes, "test-seed", nil)
+	shards2 := Size(ids, sizes, "test-seed", nil)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	for i := range 3 {
+		assert.Equal(t, shards1[i], shards2[i], "Same seed should produce identical distribution")
+	}
+}
+
+func TestSize_WithReservations(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	sizes := []int{10, 30, 60}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"1000", "1001"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Size(ids, sizes, "", reservations)
+
+	require.Len(t, shards, 3)
+	assert.Contains(t, shards[0], "1000")
+	assert.Contains(t, shards[0], "1001")
+	assert.Equal(t, 10, len(shards[0]), "Shard 0 should have 10 total (8 distributed + 2 reserved)")
+}
+
+func TestSize_InsufficientIDs(t *testing.T) {
+	ids := createTestIDs(5, 1)
+	sizes := []int{10, 20, 30}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 5, totalIDs, "Should distribute all available IDs")
+	assert.Equal(t, 5, len(shards[0]))
+	assert.Empty(t, shards[1])
+	assert.Empty(t, shards[2])
+}
+
+func TestSize_EmptyIDs(t *testing.T) {
+	sizes := []int{10, 20, 30}
+	shards := Size([]string{}, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	for i := range 3 {
+		assert.Empty(t, shards[i])
+	}
+}
+
+func TestSize_WithReservationsExceedingTarget(t *testing.T) {
+	allIDs := createTestIDs(100, 1)
+	reservedIDs := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+
+	unreservedIDs := make([]string, 0, len(allIDs)-len(reservedIDs))
+	reservedSet := make(map[string]bool)
+	for _, id := range reservedIDs {
+		reservedSet[id] = true
+	}
+	for _, id := range allIDs {
+		if !reservedSet[id] {
+			unreservedIDs = append(unreservedIDs, id)
+		}
+	}
+
+	sizes := []int{10, 30, 60}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: reservedIDs,
+		},
+		UnreservedIDs: unreservedIDs,
+	}
+
+	shards := Size(allIDs, sizes, "", reservations)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 12, len(shards[0]), "Shard 0 should have 12 reserved IDs (no additional distribution when reserved exceeds target)")
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 100, totalIDs, "Should have all 100 IDs distributed")
+}
+
+func TestAutoSizes(t *testing.T) {
+	assert.Equal(t, []int{500, 500, -1}, AutoSizes(500, 1200), "The last shard holds the remainder")
+	assert.Equal(t, []int{500, -1}, AutoSizes(500, 1000), "An exact multiple fills the last shard")
+	assert.Equal(t, []int{-1}, AutoSizes(500, 10))
+	assert.Equal(t, []int{-1}, AutoSizes(500, 0), "At least one shard")
+}
+
+// ── Rendezvous Tests ──────────────────────────────────────────────────────────
+
+func TestRendezvous_BasicDistribution(t *testing.T) {
+	ids := createTestIDs(100, 1)
+
+	shards := Rendezvous(ids, 3, nil, "test-seed", nil)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 100, totalIDs, "All IDs should be distributed")
+}
+
+func TestRendezvous_Deterministic(t *testing.T) {
+	ids := createTestIDs(50, 1)
+
+	shards1 := Rendezvous(ids, 3, nil, "test-seed", nil)
+	shards2 := Rendezvous(ids, 3, nil, "test-seed", nil)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	for i := range 3 {
+		assert.Equal(t, shards1[i], shards2[i], "Same seed should produce identical distribution")
+	}
+}
+
+func TestRendezvous_DifferentSeeds(t *testing.T) {
+	ids := createTestIDs(50, 1)
+
+	shards1 := Rendezvous(ids, 3, nil, "seed1", nil)
+	shards2 := Rendezvous(ids, 3, nil, "seed2", nil)
+
+	require.Len(t, shards1, 3)
+	require.Len(t, shards2, 3)
+
+	different := false
+	for i := range 3 {
+		if !slicesEqual(shards1[i], shards2[i]) {
+			different = true
+			break
+		}
+	}
+	assert.True(t, different, "Different seeds should produce different distributions")
+}
+
+func TestRendezvous_WithReservations(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			1: {"1000", "1001"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Rendezvous(ids, 3, nil, "test-seed", reservations)
+
+	require.Len(t, shards, 3)
+	assert.Contains(t, shards[1], "1000")
+	assert.Contains(t, shards[1], "1001")
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 52, totalIDs, "Should have 50 distributed + 2 reserved")
+}
+
+func TestRendezvous_ZeroShardCount(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := Rendezvous(ids, 0, nil, "test-seed", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 10)
+}
+
+func TestRendezvous_EmptyIDs(t *testing.T) {
+	shards := Rendezvous([]string{}, 3, nil, "test-seed", nil)
+
+	require.Len(t, shards, 3)
+	for i := range 3 {
+		assert.Empty(t, shards[i])
+	}
+}
+
+func TestRendezvous_Stability(t *testing.T) {
+	ids := createTestIDs(100, 1)
+
+	shards3 := Rendezvous(ids, 3, nil, "stability-test", nil)
+	shards4 := Rendezvous(ids, 4, nil, "stability-test", nil)
+
+	require.Len(t, shards3, 3)
+	require.Len(t, shards4, 4)
+
+	movedCount := 0
+	for _, id := range ids {
+		inShard3 := findIDShard(id, shards3)
+		inShard4 := findIDShard(id, shards4)
+		if inShard3 != inShard4 {
+			movedCount++
+		}
+	}
+
+	expectedMoved := 100 / 4
+	tolerance := 15
+	assert.InDelta(t, expectedMoved, movedCount, float64(tolerance),
+		"Rendezvous should move approximately 1/n IDs when shard count changes")
+}
+
+func TestRendezvous_EqualWeightsMatchUnweighted(t *testing.T) {
+	ids := createTestIDs(200, 1)
+
+	unweighted := Rendezvous(ids, 4, nil, "weights", nil)
+	weighted := Rendezvous(ids, 4, []float64{1, 1, 1, 1}, "weights", nil)
+
+	for i := range 4 {
+		assert.Equal(t, unweighted[i], weighted[i], "Equal weights should not change placement")
+	}
+}
+
+func TestRendezvous_WeightedDistribution(t *testing.T) {
+	ids := createTestIDs(10000, 1)
+
+	shards := Rendezvous(ids, 3, []float64{1, 2, 1}, "weighted-test", nil)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 10000, len(shards[0])+len(shards[1])+len(shards[2]))
+	assert.InDelta(t, 2500, len(shards[0]), 250)
+	assert.InDelta(t, 5000, len(shards[1]), 250, "Double-weight shard should attract ~double the IDs")
+	assert.InDelta(t, 2500, len(shards[2]), 250)
+}
+
+func TestRendezvous_WeightedStability(t *testing.T) {
+	ids := createTestIDs(1000, 1)
+
+	before := Rendezvous(ids, 3, []float64{1, 1, 1}, "weighted-stability", nil)
+	after := Rendezvous(ids, 3, []float64{1, 1, 2}, "weighted-stability", nil)
+
+	// Raising shard_2's weight may only pull IDs into shard_2; nothing moves
+	// between shard_0 and shard_1.
+	for _, id := range ids {
+		from, to := findIDShard(id, before), findIDShard(id, after)
+		if from != to {
+			assert.Equal(t, 2, to, "ID %s moved from shard_%d to shard_%d", id, from, to)
+		}
+	}
+}
+
+func TestRendezvousHasher_MatchesDigest(t *testing.T) {
+	hasher := newRendezvousHasher(12, "hasher-seed")
+
+	for _, id := range []string{"1", "42", "100000", "a-long-non-numeric-id"} {
+		for shardIdx := range 12 {
+			assert.Equal(t, rendezvousDigest(id, shardIdx, "hasher-seed"), hasher.digest(id, shardIdx),
+				"id %s shard_%d", id, shardIdx)
+		}
+	}
+}
+
+func TestRendezvousParallel_MatchesSerial(t *testing.T) {
+	// Several workers even on a single-CPU machine.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	ids := createTestIDs(5003, 1)
+	reservations := &Reservations{
+		IDsByShard:    map[int][]string{1: {"9001", "9002"}},
+		UnreservedIDs: ids,
+	}
+
+	for _, weights := range [][]float64{nil, {1, 3, 2, 1, 1}} {
+		assert.Equal(t,
+			Rendezvous(ids, 5, weights, "parallel", nil),
+			RendezvousParallel(ids, 5, weights, "parallel", nil))
+	}
+	assert.Equal(t,
+		Rendezvous(ids, 5, nil, "parallel", reservations),
+		RendezvousParallel(ids, 5, nil, "parallel", reservations))
+	assert.Equal(t,
+		Rendezvous(ids[:1], 3, nil, "parallel", nil),
+		RendezvousParallel(ids[:1], 3, nil, "parallel", nil), "Fewer IDs than workers")
+	assert.Equal(t, [][]string{{}, {}}, RendezvousParallel(nil, 2, nil, "parallel", nil))
+}
+
+func BenchmarkRendezvous(b *testing.B) {
+	ids := createTestIDs(100000, 1)
+
+	for b.Loop() {
+		Rendezvous(ids, 10, nil, "benchmark", nil)
+	}
+}
+
+func BenchmarkRendezvousParallel(b *testing.B) {
+	ids := createTestIDs(100000, 1)
+
+	for b.Loop() {
+		RendezvousParallel(ids, 10, nil, "benchmark", nil)
+	}
+}
+
+func TestRendezvousWins_HigherScoreWins(t *testing.T) {
+	low := [32]byte{0xff}
+	high := [32]byte{0x00}
+
+	assert.True(t, rendezvousWins(uint64(2), low, uint64(1), high))
+	assert.False(t, rendezvousWins(uint64(1), high, uint64(2), low), "Digest only matters on a score tie")
+}
+
+func TestRendezvousWins_TieBrokenByFullDigest(t *testing.T) {
+	// Two digests sharing the same first 8 bytes produce the same 64-bit
+	// weight — a collision — and differ only later in the digest.
+	var a, b [32]byte
+	copy(a[:8], []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	copy(b[:8], []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	a[31], b[31] = 0x01, 0x02
+	weight := binary.BigEndian.Uint64(a[:8])
+	require.Equal(t, weight, binary.BigEndian.Uint64(b[:8]))
+
+	assert.True(t, rendezvousWins(weight, b, weight, a), "Larger full digest wins the tie")
+	assert.False(t, rendezvousWins(weight, a, weight, b))
+
+	// The winner is the same regardless of which shard was visited first.
+	visitOrder := func(first, second [32]byte) [32]byte {
+		best := first
+		if rendezvousWins(weight, second, weight, best) {
+			best = second
+		}
+		return best
+	}
+	assert.Equal(t, visitOrder(a, b), visitOrder(b, a))
+}
+
+func TestRendezvousWins_WeightedScoreTie(t *testing.T) {
+	a := [32]byte{0x10}
+	b := [32]byte{0x20}
+
+	assert.True(t, rendezvousWins(0.5, b, 0.5, a))
+	assert.False(t, rendezvousWins(0.5, a, 0.5, b))
+	assert.False(t, rendezvousWins(0.5, a, 0.5, a), "Identical digests keep the current best")
+}
+
+// ── Balanced Tests ────────────────────────────────────────────────────────────
+
+func TestBalanced_EqualCounts(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := Balanced(ids, 3, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Len(t, shards[0], 4)
+	assert.Len(t, shards[1], 3)
+	assert.Len(t, shards[2], 3)
+}
+
+func TestBalanced_WithSeed(t *testing.T) {
+	ids := createTestIDs(30, 1)
+	shards1 := Balanced(ids, 3, "seed", nil)
+	shards2 := Balanced(ids, 3, "seed", nil)
+	unseeded := Balanced(ids, 3, "", nil)
+
+	assert.Equal(t, shards1, shards2, "Same seed should produce same distribution")
+	assert.NotEqual(t, unseeded, shards1, "Seed should change processing order")
+}
+
+func TestBalanced_ReservationsCountTowardsLoad(t *testing.T) {
+	ids := createTestIDs(7, 1)
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"100", "101", "102"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Balanced(ids, 2, "", reservations)
+
+	require.Len(t, shards, 2)
+	assert.Len(t, shards[0], 5, "3 reserved + 2 distributed")
+	assert.Len(t, shards[1], 5)
+	assert.Contains(t, shards[0], "100")
+}
+
+func TestBalancedWeighted_EvensTotalWeight(t *testing.T) {
+	ids := []string{"1", "2", "3", "4"}
+	weights := map[string]float64{"1": 10, "2": 1, "3": 1, "4": 1}
+
+	shards := BalancedWeighted(ids, 2, weights, "", nil)
+
+	require.Len(t, shards, 2)
+	assert.Equal(t, []string{"1"}, shards[0])
+	assert.Equal(t, []string{"2", "3", "4"}, shards[1])
+}
+
+func TestBalanced_ZeroShardCount(t *testing.T) {
+	ids := createTestIDs(5, 1)
+	shards := Balanced(ids, 0, "", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 5)
+}
+
+func TestBalanced_EmptyIDs(t *testing.T) {
+	shards := Balanced([]string{}, 3, "", nil)
+
+	require.Len(t, shards, 3)
+	for _, shard := range shards {
+		assert.NotNil(t, shard)
+		assert.Empty(t, shard)
+	}
+}
+
+// ── Hash Ring Tests ───────────────────────────────────────────────────────────
+
+func TestHashRing_AllIDsDistributed(t *testing.T) {
+	ids := createTestIDs(1000, 1)
+
+	shards := HashRing(ids, 4, 150, "ring", nil)
+
+	require.Len(t, shards, 4)
+	total := 0
+	for i, shard := range shards {
+		total += len(shard)
+		assert.InDelta(t, 250, len(shard), 100, "shard %d should hold roughly a quarter of the IDs", i)
+	}
+	assert.Equal(t, 1000, total)
+}
+
+func TestHashRing_Deterministic(t *testing.T) {
+	ids := createTestIDs(200, 1)
+
+	shards1 := HashRing(ids, 3, 50, "seed", nil)
+	shards2 := HashRing(ids, 3, 50, "seed", nil)
+
+	assert.Equal(t, shards1, shards2)
+}
+
+func TestHashRing_SeedChangesAssignment(t *testing.T) {
+	ids := createTestIDs(200, 1)
+
+	shards1 := HashRing(ids, 3, 50, "seed-a", nil)
+	shards2 := HashRing(ids, 3, 50, "seed-b", nil)
+
+	assert.NotEqual(t, shards1, shards2)
+}
+
+func TestHashRing_AddingShardOnlyMovesIDsToNewShard(t *testing.T) {
+	ids := createTestIDs(1000, 1)
+
+	before := HashRing(ids, 4, 100, "stable", nil)
+	after := HashRing(ids, 5, 100, "stable", nil)
+
+	moved := 0
+	for _, id := range ids {
+		oldShard, newShard := findIDShard(id, before), findIDShard(id, after)
+		if oldShard != newShard {
+			moved++
+			assert.Equal(t, 4, newShard, "ID %s should only move to the new shard", id)
+		}
+	}
+	assert.InDelta(t, 200, moved, 100, "Roughly 1/5 of IDs should move")
+}
+
+func TestHashRing_WithReservations(t *testing.T) {
+	ids := createTestIDs(20, 1)
+	reservations := &Reservations{
+		IDsByShard:    map[int][]string{1: {"5", "6"}},
+		UnreservedIDs: append(slices.Clone(ids[:4]), ids[6:]...),
+	}
+
+	shards := HashRing(ids, 3, 10, "", reservations)
+
+	assert.Contains(t, shards[1], "5")
+	assert.Contains(t, shards[1], "6")
+	total := 0
+	for _, shard := range shards {
+		total += len(shard)
+	}
+	assert.Equal(t, 20, total)
+}
+
+func TestHashRing_ZeroCounts(t *testing.T) {
+	ids := createTestIDs(5, 1)
+
+	shards := HashRing(ids, 0, 0, "", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 5)
+}
+
+func TestHashRing_EmptyIDs(t *testing.T) {
+	shards := HashRing([]string{}, 3, 10, "", nil)
+
+	require.Len(t, shards, 3)
+	for _, shard := range shards {
+		assert.NotNil(t, shard)
+		assert.Empty(t, shard)
+	}
+}
+
+// ── Helper Function Tests ─────────────────────────────────────────────────────
+
+func TestDistributionOrder_NoSeed(t *testing.T) {
+	ids := []string{"5", "2", "8", "1", "3"}
+	result := DistributionOrder(ids, "")
+
+	assert.Equal(t, ids, result, "Without seed, should return original order")
+}
+
+func TestDistributionOrder_WithSeed(t *testing.T) {
+	ids := []string{"5", "2", "8", "1", "3"}
+	result := DistributionOrder(ids, "test-seed")
+
+	assert.Len(t, result, 5)
+	assert.NotEqual(t, []string{"1", "2", "3", "5", "8"}, result, "Should be shuffled, not just sorted")
+
+	result2 := DistributionOrder(ids, "test-seed")
+	assert.Equal(t, result, result2, "Same seed should produce same shuffle")
+}
+
+func TestShuffleIDs_Deterministic(t *testing.T) {
+	ids := createTestIDs(20, 1)
+
+	shuffled1 := shuffleIDs(ids, "test-seed")
+	shuffled2 := shuffleIDs(ids, "test-seed")
+
+	assert.Equal(t, shuffled1, shuffled2, "Same seed should produce identical shuffle")
+	assert.NotEqual(t, ids, shuffled1, "Should be shuffled")
+}
+
+func TestShuffleIDs_DifferentSeeds(t *testing.T) {
+	ids := createTestIDs(20, 1)
+
+	shuffled1 := shuffleIDs(ids, "seed1")
+	shuffled2 := shuffleIDs(ids, "seed2")
+
+	assert.NotEqual(t, shuffled1, shuffled2, "Different seeds should produce different shuffles")
+}
+
+func TestShuffleIDs_PreservesAllElements(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	shuffled := shuffleIDs(ids, "test-seed")
+
+	assert.Len(t, shuffled, len(ids))
+	for _, id := range ids {
+		assert.Contains(t, shuffled, id, "All original IDs should be present")
+	}
+}
+
+func TestCreateSeededRNG_Deterministic(t *testing.T) {
+	rng1 := createSeededRNG("test-seed")
+	rng2 := createSeededRNG("test-seed")
+
+	values1 := make([]int, 10)
+	values2 := make([]int, 10)
+
+	for i := range 10 {
+		values1[i] = rng1.Intn(1000)
+		values2[i] = rng2.Intn(1000)
+	}
+
+	assert.Equal(t, values1, values2, "Same seed should produce same random sequence")
+}
+
+func TestCreateSeededRNG_DifferentSeeds(t *testing.T) {
+	rng1 := createSeededRNG("seed1")
+	rng2 := createSeededRNG("seed2")
+
+	values1 := make([]int, 10)
+	values2 := make([]int, 10)
+
+	for i := range 10 {
+		values1[i] = rng1.Intn(1000)
+		values2[i] = rng2.Intn(1000)
+	}
+
+	assert.NotEqual(t, values1, values2, "Different seeds should produce different sequences")
+}
+
+func TestSortIDsNumerically(t *testing.T) {
+	ids := []string{"100", "5", "50", "1", "25"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"1", "5", "25", "50", "100"}
+	assert.Equal(t, expected, ids)
+}
+
+func TestSortIDsNumerically_Namespaced(t *testing.T) {
+	ids := []string{"mobile_device:3", "computer:100", "user:1", "computer:20", "mobile_device:10"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"computer:20", "computer:100", "mobile_device:3", "mobile_device:10", "user:1"}
+	assert.Equal(t, expected, ids, "Namespaced IDs sort by namespace, then numerically")
+}
+
+func TestSortIDsNumerically_NonNumericAfterNumeric(t *testing.T) {
+	ids := []string{"abc", "10", "1a", "9", "", "2"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"2", "9", "10", "", "1a", "abc"}
+	assert.Equal(t, expected, ids, "Non-numeric IDs sort after numeric ones, lexically")
+}
+
+func TestSortIDsNumerically_MixedNamespacedAndPlain(t *testing.T) {
+	ids := []string{"computer:10", "7", "computer:abc", "computer:9", "x", "mobile_device:1"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"7", "x", "computer:9", "computer:10", "computer:abc", "mobile_device:1"}
+	assert.Equal(t, expected, ids, "Plain IDs have an empty namespace, so they sort first")
+}
+
+func TestSortIDsNumerically_EqualValuesOrderedLexically(t *testing.T) {
+	ids := []string{"7", "007", "07"}
+	SortIDsNumerically(ids)
+
+	assert.Equal(t, []string{"007", "07", "7"}, ids)
+}
+
+func TestSortIDsNumerically_AlreadySorted(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"1", "2", "3", "4", "5"}
+	assert.Equal(t, expected, ids)
+}
+
+func TestSortIDsNumerically_SingleElement(t *testing.T) {
+	ids := []string{"42"}
+	SortIDsNumerically(ids)
+
+	assert.Equal(t, []string{"42"}, ids)
+}
+
+func TestSortIDsNumerically_Empty(t *testing.T) {
+	ids := []string{}
+	SortIDsNumerically(ids)
+
+	assert.Empty(t, ids)
+}
+
+// ── Edge Cases ────────────────────────────────────────────────────────────────
+
+func TestRoundRobin_SingleShard(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := RoundRobin(ids, 1, 0, "", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 10)
+}
+
+func TestPercentage_SingleShard(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := Percentage(ids, []float64{100}, "", nil, false)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 10)
+}
+
+func TestSize_SingleShard(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := Size(ids, []int{-1}, "", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 10)
+}
+
+func TestRendezvous_SingleShard(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	shards := Rendezvous(ids, 1, nil, "test-seed", nil)
+
+	require.Len(t, shards, 1)
+	assert.Len(t, shards[0], 10)
+}
+
+func TestSize_MultipleRemainderShards(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	sizes := []int{10, -1}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 2)
+	assert.Equal(t, 10, len(shards[0]))
+	assert.Equal(t, 90, len(shards[1]))
+}
+
+func TestSize_ZeroSizeWithReservations(t *testing.T) {
+	ids := createTestIDs(10, 1)
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"1000", "1001", "1002", "1003", "1004"},
+		},
+		UnreservedIDs: ids,
+	}
+	sizes := []int{5, 10}
+
+	shards := Size(ids, sizes, "", reservations)
+
+	require.Len(t, shards, 2)
+	assert.Equal(t, 5, len(shards[0]), "Shard 0 should have exactly 5 (all reserved, 0 distributed)")
+	assert.Contains(t, shards[0], "1000")
+}
+
+// ── Test Utilities ────────────────────────────────────────────────────────────
+
+func slicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func findIDShard(id string, shards [][]string) int {
+	for i, shard := range shards {
+		for _, shardID := range shard {
+			if shardID == id {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ── Additional Coverage Tests ─────────────────────────────────────────────────
+
+func TestPercentage_NegativeShardSize(t *testing.T) {
+	ids := createTestIDs(20, 1)
+	percentages := []float64{60, 30, 10}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: createTestIDs(15, 100),
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "", reservations, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 35, totalIDs, "Should have 20 unreserved + 15 reserved")
+}
+
+func TestPercentage_MultipleReservations(t *testing.T) {
+	ids := createTestIDs(100, 1)
+	percentages := []float64{25, 25, 25, 25}
+	reservations := &Reservations{
+		IDsByShard: map[int][]string{
+			0: {"1000", "1001"},
+			1: {"2000"},
+			2: {"3000", "3001", "3002"},
+			3: {"4000"},
+		},
+		UnreservedIDs: ids,
+	}
+
+	shards := Percentage(ids, percentages, "multi-reserve", reservations, false)
+
+	require.Len(t, shards, 4)
+	assert.Contains(t, shards[0], "1000")
+	assert.Contains(t, shards[1], "2000")
+	assert.Contains(t, shards[2], "3000")
+	assert.Contains(t, shards[3], "4000")
+
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 107, totalIDs, "Should have 100 unreserved + 7 reserved")
+}
+
+func TestPercentage_SmallIDSet(t *testing.T) {
+	ids := []string{"1", "2", "3"}
+	percentages := []float64{33, 33, 34}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := len(shards[0]) + len(shards[1]) + len(shards[2])
+	assert.Equal(t, 3, totalIDs, "All IDs should be distributed")
+}
+
+func TestSize_ExactFit(t *testing.T) {
+	ids := createTestIDs(60, 1)
+	sizes := []int{20, 20, 20}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Equal(t, 20, len(shards[0]))
+	assert.Equal(t, 20, len(shards[1]))
+	assert.Equal(t, 20, len(shards[2]))
+}
+
+func TestSize_MoreSizesThanIDs(t *testing.T) {
+	ids := []string{"1", "2", "3"}
+	sizes := []int{10, 10, 10, 10}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 4)
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 3, totalIDs, "Should only distribute available IDs")
+}
+
+func TestSortIDsNumerically_LargeNumbers(t *testing.T) {
+	ids := []string{"1000", "50", "500", "5", "5000"}
+	SortIDsNumerically(ids)
+
+	expected := []string{"5", "50", "500", "1000", "5000"}
+	assert.Equal(t, expected, ids)
+}
+
+func TestShuffleIDs_SingleElement(t *testing.T) {
+	ids := []string{"42"}
+	shuffled := shuffleIDs(ids, "test-seed")
+
+	assert.Equal(t, []string{"42"}, shuffled)
+}
+
+func TestShuffleIDs_TwoElements(t *testing.T) {
+	ids := []string{"1", "2"}
+	shuffled := shuffleIDs(ids, "test-seed")
+
+	assert.Len(t, shuffled, 2)
+	assert.Contains(t, shuffled, "1")
+	assert.Contains(t, shuffled, "2")
+}
+
+func TestCreateSeededRNG_EmptySeed(t *testing.T) {
+	rng := createSeededRNG("")
+
+	val1 := rng.Intn(1000)
+	val2 := rng.Intn(1000)
+
+	assert.True(t, val1 >= 0 && val1 < 1000)
+	assert.True(t, val2 >= 0 && val2 < 1000)
+}
+
+func TestDistributionOrder_PreservesAllIDs(t *testing.T) {
+	ids := createTestIDs(50, 1)
+	result := DistributionOrder(ids, "preserve-test")
+
+	assert.Len(t, result, len(ids))
+	for _, id := range ids {
+		assert.Contains(t, result, id)
+	}
+}
+
+// ── Boundary Tests ────────────────────────────────────────────────────────────
+
+func TestRoundRobin_OneID(t *testing.T) {
+	ids := []string{"1"}
+	shards := RoundRobin(ids, 3, 0, "", nil)
+
+	require.Len(t, shards, 3)
+	assert.Len(t, shards[0], 1)
+	assert.Empty(t, shards[1])
+	assert.Empty(t, shards[2])
+}
+
+func TestPercentage_OneID(t *testing.T) {
+	ids := []string{"1"}
+	percentages := []float64{33, 33, 34}
+
+	shards := Percentage(ids, percentages, "", nil, false)
+
+	require.Len(t, shards, 3)
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 1, totalIDs)
+}
+
+func TestSize_OneID(t *testing.T) {
+	ids := []string{"1"}
+	sizes := []int{10, 20, 30}
+
+	shards := Size(ids, sizes, "", nil)
+
+	require.Len(t, shards, 3)
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 1, totalIDs)
+}
+
+func TestRendezvous_OneID(t *testing.T) {
+	ids := []string{"1"}
+	shards := Rendezvous(ids, 3, nil, "test", nil)
+
+	require.Len(t, shards, 3)
+	totalIDs := 0
+	for _, shard := range shards {
+		totalIDs += len(shard)
+	}
+	assert.Equal(t, 1, totalIDs)
+}